@@ -0,0 +1,263 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/hsm"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+)
+
+const (
+	rootCertFile    = "root.crt"
+	rootKeyFile     = "root.key"
+	issuingCertFile = "issuing.crt"
+	issuingKeyFile  = "issuing.key"
+
+	caKeyBits = 3072
+
+	// id of the CA keys when they are kept in a key store
+	RootKeyID    = "ca-root"
+	IssuingKeyID = "ca-issuing"
+)
+
+var (
+	ErrNotInitialized     = errors.New("certificate authority is not initialized, run with --ca-init")
+	ErrAlreadyInitialized = errors.New("certificate authority is already initialized")
+	ErrMissingPassphrase  = errors.New("CA_PASSPHRASE is not set")
+)
+
+// Authority is the loaded issuing CA. The root key is only decrypted while
+// the hierarchy is created and never kept in memory afterwards; in a key
+// store it stays in the store.
+type Authority struct {
+	Root       *x509.Certificate
+	Issuing    *x509.Certificate
+	issuingKey crypto.Signer
+}
+
+// Init creates the root and issuing CA and writes them, keys encrypted, to
+// cfg.Dir. When keys is not nil, e.g. a PKCS#11 token, the keys are generated
+// there instead and only the certificates are written. It refuses to
+// overwrite an existing hierarchy.
+func Init(cfg config.CAConfig, keys hsm.KeyStore) (*Authority, error) {
+	if keys == nil && cfg.Passphrase == "" {
+		return nil, ErrMissingPassphrase
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Dir, rootCertFile)); err == nil {
+		return nil, ErrAlreadyInitialized
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	rootKey, err := newCAKey(keys, RootKeyID)
+	if err != nil {
+		return nil, err
+	}
+	rootSerial, err := NewSerial()
+	if err != nil {
+		return nil, err
+	}
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          rootSerial,
+		Subject:               pkix.Name{CommonName: cfg.Name + " Root CA", Organization: []string{cfg.Name}},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.AddDate(20, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLen:            1,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, rootKey.Public(), rootKey)
+	if err != nil {
+		return nil, err
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		return nil, err
+	}
+
+	issuingKey, err := newCAKey(keys, IssuingKeyID)
+	if err != nil {
+		return nil, err
+	}
+	issuingSerial, err := NewSerial()
+	if err != nil {
+		return nil, err
+	}
+	issuingTmpl := &x509.Certificate{
+		SerialNumber:          issuingSerial,
+		Subject:               pkix.Name{CommonName: cfg.Name + " Issuing CA", Organization: []string{cfg.Name}},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLen:            0,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	issuingDER, err := x509.CreateCertificate(rand.Reader, issuingTmpl, root, issuingKey.Public(), rootKey)
+	if err != nil {
+		return nil, err
+	}
+	issuing, err := x509.ParseCertificate(issuingDER)
+	if err != nil {
+		return nil, err
+	}
+
+	type file struct {
+		name string
+		data []byte
+		perm os.FileMode
+	}
+	var files []file
+	if keys == nil {
+		passphrase := []byte(cfg.Passphrase)
+		rootKeyPEM, err := EncryptKeyPEM(rootKey, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		issuingKeyPEM, err := EncryptKeyPEM(issuingKey, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file{rootKeyFile, rootKeyPEM, 0600}, file{issuingKeyFile, issuingKeyPEM, 0600})
+	}
+	files = append(files,
+		file{issuingCertFile, encodeCert(issuing), 0644},
+		// root.crt is written last, it marks the hierarchy as complete
+		file{rootCertFile, encodeCert(root), 0644},
+	)
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(cfg.Dir, f.name), f.data, f.perm); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Authority{Root: root, Issuing: issuing, issuingKey: issuingKey}, nil
+}
+
+// Load reads the hierarchy created by Init and unlocks the issuing key, or
+// finds it in keys when the hierarchy was created in a key store.
+func Load(cfg config.CAConfig, keys hsm.KeyStore) (*Authority, error) {
+	rootPEM, err := os.ReadFile(filepath.Join(cfg.Dir, rootCertFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotInitialized
+	}
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil && cfg.Passphrase == "" {
+		return nil, ErrMissingPassphrase
+	}
+
+	root, err := decodeCert(rootPEM)
+	if err != nil {
+		return nil, err
+	}
+	issuingPEM, err := os.ReadFile(filepath.Join(cfg.Dir, issuingCertFile))
+	if err != nil {
+		return nil, err
+	}
+	issuing, err := decodeCert(issuingPEM)
+	if err != nil {
+		return nil, err
+	}
+	if err := issuing.CheckSignatureFrom(root); err != nil {
+		return nil, err
+	}
+
+	var issuingKey crypto.Signer
+	if keys != nil {
+		issuingKey, err = keys.FindKey(IssuingKeyID)
+	} else {
+		var issuingKeyPEM []byte
+		issuingKeyPEM, err = os.ReadFile(filepath.Join(cfg.Dir, issuingKeyFile))
+		if err == nil {
+			issuingKey, err = DecryptKeyPEM(issuingKeyPEM, []byte(cfg.Passphrase))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := pki.MatchesCertificate(issuingKey, issuing); err != nil {
+		return nil, fmt.Errorf("issuing CA key: %w", err)
+	}
+
+	return &Authority{Root: root, Issuing: issuing, issuingKey: issuingKey}, nil
+}
+
+// Issue signs tmpl with the issuing CA. The caller owns serial allocation.
+func (a *Authority) Issue(tmpl *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error) {
+	if tmpl.SerialNumber == nil {
+		return nil, errors.New("certificate template has no serial number")
+	}
+	if tmpl.NotAfter.After(a.Issuing.NotAfter) {
+		tmpl.NotAfter = a.Issuing.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.Issuing, pub, a.issuingKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Chain returns the issuing CA followed by the root.
+func (a *Authority) Chain() []*x509.Certificate {
+	return []*x509.Certificate{a.Issuing, a.Root}
+}
+
+// ChainPEM returns Chain as concatenated PEM blocks.
+func (a *Authority) ChainPEM() []byte {
+	var out []byte
+	for _, cert := range a.Chain() {
+		out = append(out, encodeCert(cert)...)
+	}
+	return out
+}
+
+// NewSerial returns a random positive 128-bit serial number.
+func NewSerial() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 127)
+	serial, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return nil, err
+	}
+	// keep the high bit set so every serial has the same length
+	return serial.SetBit(serial, 126, 1), nil
+}
+
+// newCAKey generates a CA key, in keys under id when keys is not nil.
+func newCAKey(keys hsm.KeyStore, id string) (crypto.Signer, error) {
+	if keys != nil {
+		return keys.GenerateKey(id, pki.KeyRSA3072)
+	}
+	return rsa.GenerateKey(rand.Reader, caKeyBits)
+}
+
+func encodeCert(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func decodeCert(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("invalid CA certificate file")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -0,0 +1,81 @@
+package ca
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// RFC 5280 section 5.3.1 reason codes. certificateHold is left out on purpose,
+// revocation here is always final.
+const (
+	ReasonUnspecified          = 0
+	ReasonKeyCompromise        = 1
+	ReasonCACompromise         = 2
+	ReasonAffiliationChanged   = 3
+	ReasonSuperseded           = 4
+	ReasonCessationOfOperation = 5
+	ReasonPrivilegeWithdrawn   = 9
+)
+
+var reasonNames = map[string]int{
+	"unspecified":          ReasonUnspecified,
+	"keyCompromise":        ReasonKeyCompromise,
+	"cACompromise":         ReasonCACompromise,
+	"affiliationChanged":   ReasonAffiliationChanged,
+	"superseded":           ReasonSuperseded,
+	"cessationOfOperation": ReasonCessationOfOperation,
+	"privilegeWithdrawn":   ReasonPrivilegeWithdrawn,
+}
+
+// ParseReason maps an RFC 5280 reason name to its code. An empty name means
+// unspecified.
+func ParseReason(name string) (int, error) {
+	if name == "" {
+		return ReasonUnspecified, nil
+	}
+	code, ok := reasonNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown revocation reason %q", name)
+	}
+	return code, nil
+}
+
+// ReasonName is the inverse of ParseReason.
+func ReasonName(code int) string {
+	for name, c := range reasonNames {
+		if c == code {
+			return name
+		}
+	}
+	return "unspecified"
+}
+
+// RevokedEntry is one certificate to list on the CRL.
+type RevokedEntry struct {
+	Serial    *big.Int
+	RevokedAt time.Time
+	Reason    int
+}
+
+// CreateCRL signs a DER encoded CRL with the issuing CA.
+func (a *Authority) CreateCRL(entries []RevokedEntry, number *big.Int, thisUpdate, nextUpdate time.Time) ([]byte, error) {
+	revoked := make([]x509.RevocationListEntry, 0, len(entries))
+	for _, entry := range entries {
+		revoked = append(revoked, x509.RevocationListEntry{
+			SerialNumber:   entry.Serial,
+			RevocationTime: entry.RevokedAt.UTC(),
+			ReasonCode:     entry.Reason,
+		})
+	}
+
+	tmpl := &x509.RevocationList{
+		RevokedCertificateEntries: revoked,
+		Number:                    number,
+		ThisUpdate:                thisUpdate.UTC(),
+		NextUpdate:                nextUpdate.UTC(),
+	}
+	return x509.CreateRevocationList(rand.Reader, tmpl, a.Issuing, a.issuingKey)
+}
@@ -0,0 +1,106 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/hsm"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+)
+
+// Names of the service identities the platform signs with itself.
+const (
+	IdentityOCSP   = "ocsp"
+	IdentityTSA    = "tsa"
+	IdentityReport = "report"
+)
+
+var ErrIdentityNotFound = errors.New("service identity not found")
+
+// ServiceIdentity is a certificate and key the platform itself signs with,
+// e.g. the delegated OCSP responder, the time-stamp authority or the signer of
+// verification reports. It is issued by the issuing CA and
+// stored next to it with the same key encryption, or with its key in the same
+// key store.
+type ServiceIdentity struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+}
+
+// NewServiceIdentityKey generates the key of the identity name to be issued
+// with serial, in keys when it is not nil.
+func NewServiceIdentityKey(keys hsm.KeyStore, name string, serial *big.Int) (crypto.Signer, error) {
+	if keys != nil {
+		return keys.GenerateKey(identityKeyID(name, serial), pki.KeyRSA2048)
+	}
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+// identityKeyID names the key of an identity in a key store. The serial
+// tells the keys of successive identities apart: a renewed identity gets a
+// new key, the previous one stays in the store.
+func identityKeyID(name string, serial *big.Int) string {
+	return "ca-" + name + "-" + serial.Text(16)
+}
+
+// LoadServiceIdentity reads <name>.crt and <name>.key from the CA directory,
+// or finds the key in keys when it is not nil.
+func LoadServiceIdentity(cfg config.CAConfig, keys hsm.KeyStore, name string) (*ServiceIdentity, error) {
+	certPEM, err := os.ReadFile(filepath.Join(cfg.Dir, name+".crt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	cert, err := decodeCert(certPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	if keys != nil {
+		key, err := keys.FindKey(identityKeyID(name, cert.SerialNumber))
+		if errors.Is(err, hsm.ErrKeyNotFound) {
+			// cấp lại identity khi khóa không còn trong key store
+			return nil, ErrIdentityNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &ServiceIdentity{Certificate: cert, Key: key}, nil
+	}
+
+	keyPEM, err := os.ReadFile(filepath.Join(cfg.Dir, name+".key"))
+	if err != nil {
+		return nil, err
+	}
+	key, err := DecryptKeyPEM(keyPEM, []byte(cfg.Passphrase))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceIdentity{Certificate: cert, Key: key}, nil
+}
+
+// SaveServiceIdentity writes an identity created with Authority.Issue. Only
+// the certificate is written when its key is in keys.
+func SaveServiceIdentity(cfg config.CAConfig, keys hsm.KeyStore, name string, identity *ServiceIdentity) error {
+	if keys != nil {
+		return os.WriteFile(filepath.Join(cfg.Dir, name+".crt"), encodeCert(identity.Certificate), 0644)
+	}
+	keyPEM, err := EncryptKeyPEM(identity.Key, []byte(cfg.Passphrase))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(cfg.Dir, name+".key"), keyPEM, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cfg.Dir, name+".crt"), encodeCert(identity.Certificate), 0644)
+}
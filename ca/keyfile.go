@@ -0,0 +1,130 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	encryptedKeyBlockType = "ENCRYPTED SIGNING KEY"
+
+	argonTime    uint32 = 3
+	argonMemory  uint32 = 64 * 1024
+	argonThreads uint8  = 4
+	argonKeyLen  uint32 = 32
+)
+
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted key file")
+
+// EncryptKeyPEM seals a private key as PKCS#8 under an AES-256-GCM key derived
+// from the passphrase with Argon2id. The KDF parameters travel in the PEM
+// headers so they can be raised later without breaking existing files.
+func EncryptKeyPEM(key crypto.Signer, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newKeyFileGCM(passphrase, salt, argonTime, argonMemory, argonThreads)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	block := &pem.Block{
+		Type: encryptedKeyBlockType,
+		Headers: map[string]string{
+			"KDF":     "argon2id",
+			"Salt":    hex.EncodeToString(salt),
+			"Time":    strconv.FormatUint(uint64(argonTime), 10),
+			"Memory":  strconv.FormatUint(uint64(argonMemory), 10),
+			"Threads": strconv.FormatUint(uint64(argonThreads), 10),
+		},
+		Bytes: gcm.Seal(nonce, nonce, der, nil),
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// DecryptKeyPEM reverses EncryptKeyPEM.
+func DecryptKeyPEM(data []byte, passphrase []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != encryptedKeyBlockType {
+		return nil, errors.New("not an encrypted key file")
+	}
+	if block.Headers["KDF"] != "argon2id" {
+		return nil, fmt.Errorf("unsupported key derivation %q", block.Headers["KDF"])
+	}
+
+	salt, err := hex.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, errors.New("invalid salt")
+	}
+	t, err := strconv.ParseUint(block.Headers["Time"], 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid argon2 time")
+	}
+	m, err := strconv.ParseUint(block.Headers["Memory"], 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid argon2 memory")
+	}
+	p, err := strconv.ParseUint(block.Headers["Threads"], 10, 8)
+	if err != nil {
+		return nil, errors.New("invalid argon2 threads")
+	}
+
+	gcm, err := newKeyFileGCM(passphrase, salt, uint32(t), uint32(m), uint8(p))
+	if err != nil {
+		return nil, err
+	}
+	if len(block.Bytes) < gcm.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	nonce, ciphertext := block.Bytes[:gcm.NonceSize()], block.Bytes[gcm.NonceSize():]
+	der, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("key file does not hold a signing key")
+	}
+	return signer, nil
+}
+
+func newKeyFileGCM(passphrase, salt []byte, t, m uint32, p uint8) (cipher.AEAD, error) {
+	kek := argon2.IDKey(passphrase, salt, t, m, p, argonKeyLen)
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
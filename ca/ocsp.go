@@ -0,0 +1,71 @@
+package ca
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// OIDOCSPNoCheck marks a delegated responder certificate whose own status
+// does not need to be checked (RFC 6960 section 4.2.2.2.1).
+var OIDOCSPNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+
+// CertStatus is what the certificate table knows about a serial.
+type CertStatus struct {
+	Known     bool
+	RevokedAt time.Time
+	Reason    int
+}
+
+// IssuedOCSPRequest reports whether req asks about a certificate issued by
+// this authority's issuing CA.
+func (a *Authority) IssuedOCSPRequest(req *ocsp.Request) bool {
+	if !req.HashAlgorithm.Available() {
+		return false
+	}
+
+	var spki struct {
+		Algorithm asn1.RawValue
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(a.Issuing.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+
+	h := req.HashAlgorithm.New()
+	h.Write(a.Issuing.RawSubject)
+	nameHash := h.Sum(nil)
+
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+
+	return bytes.Equal(nameHash, req.IssuerNameHash) && bytes.Equal(keyHash, req.IssuerKeyHash)
+}
+
+// CreateOCSPResponse builds a signed OCSP response for serial. Unknown
+// serials are answered with the unknown status rather than an error.
+func (a *Authority) CreateOCSPResponse(responder *ServiceIdentity, serial *big.Int, status CertStatus, thisUpdate, nextUpdate time.Time) ([]byte, error) {
+	tmpl := ocsp.Response{
+		SerialNumber: serial,
+		ThisUpdate:   thisUpdate.UTC(),
+		NextUpdate:   nextUpdate.UTC(),
+		Certificate:  responder.Certificate,
+	}
+
+	switch {
+	case !status.Known:
+		tmpl.Status = ocsp.Unknown
+	case !status.RevokedAt.IsZero():
+		tmpl.Status = ocsp.Revoked
+		tmpl.RevokedAt = status.RevokedAt.UTC()
+		tmpl.RevocationReason = status.Reason
+	default:
+		tmpl.Status = ocsp.Good
+	}
+
+	return ocsp.CreateResponse(a.Issuing, responder.Certificate, tmpl, responder.Key)
+}
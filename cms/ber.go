@@ -0,0 +1,131 @@
+package cms
+
+// maxBERDepth bounds nesting so hostile input cannot exhaust the stack.
+const maxBERDepth = 64
+
+// berToDER rewrites indefinite-length encodings as definite lengths. Input
+// that is already DER comes back unchanged, so signed attributes keep the
+// exact bytes they were signed over.
+func berToDER(data []byte) ([]byte, error) {
+	out, rest, err := convertBER(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, ErrMalformed
+	}
+	return out, nil
+}
+
+func convertBER(data []byte, depth int) ([]byte, []byte, error) {
+	if depth > maxBERDepth || len(data) < 2 {
+		return nil, nil, ErrMalformed
+	}
+
+	// identifier octets, including high tag number form
+	tagLen := 1
+	if data[0]&0x1f == 0x1f {
+		for {
+			if tagLen >= len(data) {
+				return nil, nil, ErrMalformed
+			}
+			tagLen++
+			if data[tagLen-1]&0x80 == 0 {
+				break
+			}
+		}
+	}
+	if tagLen >= len(data) {
+		return nil, nil, ErrMalformed
+	}
+	tag := data[:tagLen]
+	constructed := data[0]&0x20 != 0
+	rest := data[tagLen:]
+
+	if rest[0] == 0x80 {
+		if !constructed {
+			return nil, nil, ErrMalformed
+		}
+		rest = rest[1:]
+		var body []byte
+		for {
+			if len(rest) < 2 {
+				return nil, nil, ErrMalformed
+			}
+			if rest[0] == 0 && rest[1] == 0 {
+				rest = rest[2:]
+				break
+			}
+			child, remaining, err := convertBER(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			body = append(body, child...)
+			rest = remaining
+		}
+		return encodeElement(tag, body), rest, nil
+	}
+
+	length, lenLen, err := readLength(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	rest = rest[lenLen:]
+	if length > len(rest) {
+		return nil, nil, ErrMalformed
+	}
+	content, remaining := rest[:length], rest[length:]
+
+	if !constructed {
+		return data[:len(data)-len(remaining)], remaining, nil
+	}
+
+	var body []byte
+	for len(content) > 0 {
+		child, next, err := convertBER(content, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		body = append(body, child...)
+		content = next
+	}
+	return encodeElement(tag, body), remaining, nil
+}
+
+func readLength(data []byte) (int, int, error) {
+	if len(data) == 0 {
+		return 0, 0, ErrMalformed
+	}
+	if data[0]&0x80 == 0 {
+		return int(data[0]), 1, nil
+	}
+	n := int(data[0] & 0x7f)
+	if n == 0 || n > 4 || len(data) < 1+n {
+		return 0, 0, ErrMalformed
+	}
+	length := 0
+	for _, b := range data[1 : 1+n] {
+		length = length<<8 | int(b)
+	}
+	if length < 0 {
+		return 0, 0, ErrMalformed
+	}
+	return length, 1 + n, nil
+}
+
+func encodeElement(tag []byte, body []byte) []byte {
+	out := append([]byte{}, tag...)
+	out = append(out, encodeLength(len(body))...)
+	return append(out, body...)
+}
+
+func encodeLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+	var buf []byte
+	for l := length; l > 0; l >>= 8 {
+		buf = append([]byte{byte(l)}, buf...)
+	}
+	return append([]byte{0x80 | byte(len(buf))}, buf...)
+}
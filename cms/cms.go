@@ -0,0 +1,272 @@
+// Package cms builds and parses RFC 5652 Cryptographic Message Syntax
+// SignedData, the container used for .p7s files, PDF signatures and RFC 3161
+// timestamp tokens.
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"time"
+)
+
+var (
+	OIDData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	OIDSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+	OIDAttributeContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	OIDAttributeMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	OIDAttributeSigningTime          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	OIDAttributeCounterSignature     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 6}
+	OIDAttributeTimeStampToken       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	OIDAttributeSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	OIDDigestSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	OIDDigestSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	OIDDigestSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	OIDDigestSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	OIDEncryptionRSA          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	OIDSignatureSHA1WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	OIDSignatureSHA256WithRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	OIDSignatureSHA384WithRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	OIDSignatureSHA512WithRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	OIDSignatureRSAPSS        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	OIDMGF1                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	OIDPublicKeyECDSA         = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	OIDSignatureECDSASHA256   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	OIDSignatureECDSASHA384   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	OIDSignatureECDSASHA512   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	OIDSignatureEd25519       = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+var (
+	ErrMalformed            = errors.New("cms: malformed SignedData")
+	ErrNotSignedData        = errors.New("cms: content is not SignedData")
+	ErrUnsupportedAlgorithm = errors.New("cms: unsupported algorithm")
+	ErrSignerNotFound       = errors.New("cms: signer certificate not found")
+	ErrDigestMismatch       = errors.New("cms: message digest does not match content")
+	ErrContentTypeMismatch  = errors.New("cms: content type attribute does not match")
+	ErrNoContent            = errors.New("cms: detached signature needs the signed content")
+	ErrInvalidSignature     = errors.New("cms: signature verification failed")
+)
+
+// PEMType is the block type openssl cms writes and reads with -inform PEM.
+const PEMType = "CMS"
+
+// Attribute is a CMS attribute, values are kept as DER elements.
+type Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue
+}
+
+// SignerInfo is one signer of a SignedData.
+type SignerInfo struct {
+	Version int
+
+	// Signer identifier: issuer and serial number, or a subject key
+	// identifier for version 3 signers.
+	Issuer       []byte
+	SerialNumber *big.Int
+	SubjectKeyID []byte
+
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttributes   []Attribute
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttributes []Attribute
+
+	// rawSignedAttributes holds the contents of the [0] signedAttrs field
+	// exactly as signed, so re-encoding never changes what was signed.
+	rawSignedAttributes []byte
+}
+
+// SignedData is a parsed or freshly built CMS SignedData.
+type SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier
+	ContentType      asn1.ObjectIdentifier
+	// Content is the encapsulated content, unused when Detached is set.
+	Content      []byte
+	Detached     bool
+	Certificates []*x509.Certificate
+	CRLs         [][]byte
+	SignerInfos  []*SignerInfo
+}
+
+// EncodePEM wraps a DER SignedData in a CMS PEM block.
+func EncodePEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: PEMType, Bytes: der})
+}
+
+// SignedAttribute returns the first signed attribute of the given type.
+func (si *SignerInfo) SignedAttribute(oid asn1.ObjectIdentifier) *Attribute {
+	return findAttribute(si.SignedAttributes, oid)
+}
+
+// UnsignedAttribute returns the first unsigned attribute of the given type.
+func (si *SignerInfo) UnsignedAttribute(oid asn1.ObjectIdentifier) *Attribute {
+	return findAttribute(si.UnsignedAttributes, oid)
+}
+
+// AddUnsignedAttribute appends a value to the unsigned attribute of the given
+// type, creating it if needed. The signature is not affected.
+func (si *SignerInfo) AddUnsignedAttribute(oid asn1.ObjectIdentifier, der []byte) error {
+	var value asn1.RawValue
+	if rest, err := asn1.Unmarshal(der, &value); err != nil || len(rest) > 0 {
+		return ErrMalformed
+	}
+	if attr := findAttribute(si.UnsignedAttributes, oid); attr != nil {
+		attr.Values = append(attr.Values, value)
+		return nil
+	}
+	si.UnsignedAttributes = append(si.UnsignedAttributes, Attribute{Type: oid, Values: []asn1.RawValue{value}})
+	return nil
+}
+
+// CounterSignatures parses the counterSignature unsigned attribute values.
+func (si *SignerInfo) CounterSignatures() ([]*SignerInfo, error) {
+	attr := si.UnsignedAttribute(OIDAttributeCounterSignature)
+	if attr == nil {
+		return nil, nil
+	}
+	counters := make([]*SignerInfo, 0, len(attr.Values))
+	for _, value := range attr.Values {
+		counter, err := ParseSignerInfo(value.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		counters = append(counters, counter)
+	}
+	return counters, nil
+}
+
+// AttachCounterSignature adds counter below the SignerInfo whose signature
+// value is parentSignature, searching si and its countersignatures
+// recursively. Nested attribute values on the way are re-encoded; it reports
+// whether the parent was found.
+func (si *SignerInfo) AttachCounterSignature(parentSignature []byte, counter *SignerInfo) (bool, error) {
+	if bytes.Equal(si.Signature, parentSignature) {
+		der, err := counter.Marshal()
+		if err != nil {
+			return false, err
+		}
+		return true, si.AddUnsignedAttribute(OIDAttributeCounterSignature, der)
+	}
+
+	attr := si.UnsignedAttribute(OIDAttributeCounterSignature)
+	if attr == nil {
+		return false, nil
+	}
+	for i, value := range attr.Values {
+		child, err := ParseSignerInfo(value.FullBytes)
+		if err != nil {
+			return false, err
+		}
+		found, err := child.AttachCounterSignature(parentSignature, counter)
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			continue
+		}
+		der, err := child.Marshal()
+		if err != nil {
+			return false, err
+		}
+		if _, err := asn1.Unmarshal(der, &attr.Values[i]); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// MessageDigest returns the messageDigest signed attribute.
+func (si *SignerInfo) MessageDigest() ([]byte, error) {
+	attr := si.SignedAttribute(OIDAttributeMessageDigest)
+	if attr == nil || len(attr.Values) != 1 {
+		return nil, ErrMalformed
+	}
+	var digest []byte
+	if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &digest); err != nil {
+		return nil, ErrMalformed
+	}
+	return digest, nil
+}
+
+// SigningTime returns the signingTime signed attribute, if present.
+func (si *SignerInfo) SigningTime() (time.Time, bool) {
+	attr := si.SignedAttribute(OIDAttributeSigningTime)
+	if attr == nil || len(attr.Values) != 1 {
+		return time.Time{}, false
+	}
+	var t time.Time
+	if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &t); err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// DigestHash maps the signer's digest algorithm to a crypto.Hash.
+func (si *SignerInfo) DigestHash() (crypto.Hash, error) {
+	return hashForDigestOID(si.DigestAlgorithm.Algorithm)
+}
+
+// SignerCertificate finds the certificate identified by the signer's sid
+// among the certificates carried in the SignedData.
+func (sd *SignedData) SignerCertificate(si *SignerInfo) (*x509.Certificate, error) {
+	for _, cert := range sd.Certificates {
+		if si.SubjectKeyID != nil {
+			if bytes.Equal(cert.SubjectKeyId, si.SubjectKeyID) {
+				return cert, nil
+			}
+			continue
+		}
+		if si.SerialNumber != nil && cert.SerialNumber.Cmp(si.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, si.Issuer) {
+			return cert, nil
+		}
+	}
+	return nil, ErrSignerNotFound
+}
+
+func findAttribute(attrs []Attribute, oid asn1.ObjectIdentifier) *Attribute {
+	for i := range attrs {
+		if attrs[i].Type.Equal(oid) {
+			return &attrs[i]
+		}
+	}
+	return nil
+}
+
+func hashForDigestOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(OIDDigestSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(OIDDigestSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(OIDDigestSHA512):
+		return crypto.SHA512, nil
+	default:
+		// SHA-1 is recognised but no longer accepted for signatures
+		return 0, ErrUnsupportedAlgorithm
+	}
+}
+
+func digestOIDForHash(hash crypto.Hash) (asn1.ObjectIdentifier, error) {
+	switch hash {
+	case crypto.SHA256:
+		return OIDDigestSHA256, nil
+	case crypto.SHA384:
+		return OIDDigestSHA384, nil
+	case crypto.SHA512:
+		return OIDDigestSHA512, nil
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
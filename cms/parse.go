@@ -0,0 +1,302 @@
+package cms
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+var (
+	tagContext0            = cbasn1.Tag(0).ContextSpecific()
+	tagContext0Compound    = cbasn1.Tag(0).Constructed().ContextSpecific()
+	tagContext1Compound    = cbasn1.Tag(1).Constructed().ContextSpecific()
+	tagOctetStringCompound = cbasn1.OCTET_STRING.Constructed()
+)
+
+// ParsePEM decodes a CMS or PKCS7 PEM block and parses it.
+func ParsePEM(data []byte) (*SignedData, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || (block.Type != PEMType && block.Type != "PKCS7") {
+		return nil, ErrMalformed
+	}
+	return Parse(block.Bytes)
+}
+
+// Parse decodes a ContentInfo holding SignedData. BER input with indefinite
+// lengths, as produced by some signing tools, is accepted.
+func Parse(data []byte) (*SignedData, error) {
+	der, err := berToDER(data)
+	if err != nil {
+		return nil, err
+	}
+
+	input := cryptobyte.String(der)
+	var contentInfo, signedData cryptobyte.String
+	var contentType asn1.ObjectIdentifier
+	if !input.ReadASN1(&contentInfo, cbasn1.SEQUENCE) ||
+		!contentInfo.ReadASN1ObjectIdentifier(&contentType) {
+		return nil, ErrMalformed
+	}
+	if !contentType.Equal(OIDSignedData) {
+		return nil, ErrNotSignedData
+	}
+	if !contentInfo.ReadASN1(&signedData, tagContext0Compound) ||
+		!signedData.ReadASN1(&signedData, cbasn1.SEQUENCE) {
+		return nil, ErrMalformed
+	}
+	return parseSignedData(signedData)
+}
+
+// ParsePadded is Parse for a signature stored in fixed size space, such as a
+// PDF /Contents entry, where the encoding is followed by zero padding.
+func ParsePadded(data []byte) (*SignedData, error) {
+	der, rest, err := convertBER(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range rest {
+		if b != 0 {
+			return nil, ErrMalformed
+		}
+	}
+	return Parse(der)
+}
+
+func parseSignedData(input cryptobyte.String) (*SignedData, error) {
+	sd := &SignedData{}
+
+	var version int64
+	var digestAlgorithms, encap cryptobyte.String
+	if !input.ReadASN1Integer(&version) ||
+		!input.ReadASN1(&digestAlgorithms, cbasn1.SET) ||
+		!input.ReadASN1(&encap, cbasn1.SEQUENCE) {
+		return nil, ErrMalformed
+	}
+	sd.Version = int(version)
+
+	for !digestAlgorithms.Empty() {
+		alg, err := readAlgorithmIdentifier(&digestAlgorithms)
+		if err != nil {
+			return nil, err
+		}
+		sd.DigestAlgorithms = append(sd.DigestAlgorithms, alg)
+	}
+
+	if !encap.ReadASN1ObjectIdentifier(&sd.ContentType) {
+		return nil, ErrMalformed
+	}
+	var eContent cryptobyte.String
+	var hasContent bool
+	if !encap.ReadOptionalASN1(&eContent, &hasContent, tagContext0Compound) {
+		return nil, ErrMalformed
+	}
+	sd.Detached = !hasContent
+	if hasContent {
+		content, err := readOctetString(&eContent)
+		if err != nil {
+			return nil, err
+		}
+		sd.Content = content
+	}
+
+	var certificates cryptobyte.String
+	var hasCertificates bool
+	if !input.ReadOptionalASN1(&certificates, &hasCertificates, tagContext0Compound) {
+		return nil, ErrMalformed
+	}
+	for !certificates.Empty() {
+		var element cryptobyte.String
+		var tag cbasn1.Tag
+		if !certificates.ReadAnyASN1Element(&element, &tag) {
+			return nil, ErrMalformed
+		}
+		// other CertificateChoices (attribute certificates) are skipped
+		if tag != cbasn1.SEQUENCE {
+			continue
+		}
+		cert, err := x509.ParseCertificate(element)
+		if err != nil {
+			return nil, err
+		}
+		sd.Certificates = append(sd.Certificates, cert)
+	}
+
+	var crls cryptobyte.String
+	var hasCRLs bool
+	if !input.ReadOptionalASN1(&crls, &hasCRLs, tagContext1Compound) {
+		return nil, ErrMalformed
+	}
+	for !crls.Empty() {
+		var element cryptobyte.String
+		if !crls.ReadAnyASN1Element(&element, nil) {
+			return nil, ErrMalformed
+		}
+		sd.CRLs = append(sd.CRLs, []byte(element))
+	}
+
+	var signerInfos cryptobyte.String
+	if !input.ReadASN1(&signerInfos, cbasn1.SET) || !input.Empty() {
+		return nil, ErrMalformed
+	}
+	for !signerInfos.Empty() {
+		var element cryptobyte.String
+		if !signerInfos.ReadASN1(&element, cbasn1.SEQUENCE) {
+			return nil, ErrMalformed
+		}
+		si, err := parseSignerInfo(element)
+		if err != nil {
+			return nil, err
+		}
+		sd.SignerInfos = append(sd.SignerInfos, si)
+	}
+
+	return sd, nil
+}
+
+// ParseSignerInfo decodes a single DER SignerInfo, the value of a
+// counterSignature attribute.
+func ParseSignerInfo(der []byte) (*SignerInfo, error) {
+	input := cryptobyte.String(der)
+	var element cryptobyte.String
+	if !input.ReadASN1(&element, cbasn1.SEQUENCE) || !input.Empty() {
+		return nil, ErrMalformed
+	}
+	return parseSignerInfo(element)
+}
+
+func parseSignerInfo(input cryptobyte.String) (*SignerInfo, error) {
+	si := &SignerInfo{}
+
+	var version int64
+	if !input.ReadASN1Integer(&version) {
+		return nil, ErrMalformed
+	}
+	si.Version = int(version)
+
+	switch {
+	case input.PeekASN1Tag(cbasn1.SEQUENCE):
+		var sid, issuer cryptobyte.String
+		si.SerialNumber = new(big.Int)
+		if !input.ReadASN1(&sid, cbasn1.SEQUENCE) ||
+			!sid.ReadASN1Element(&issuer, cbasn1.SEQUENCE) ||
+			!sid.ReadASN1Integer(si.SerialNumber) {
+			return nil, ErrMalformed
+		}
+		si.Issuer = []byte(issuer)
+	case input.PeekASN1Tag(tagContext0):
+		var ski cryptobyte.String
+		if !input.ReadASN1(&ski, tagContext0) {
+			return nil, ErrMalformed
+		}
+		si.SubjectKeyID = []byte(ski)
+	default:
+		return nil, ErrMalformed
+	}
+
+	var err error
+	if si.DigestAlgorithm, err = readAlgorithmIdentifier(&input); err != nil {
+		return nil, err
+	}
+
+	var signedAttrs cryptobyte.String
+	var hasSignedAttrs bool
+	if !input.ReadOptionalASN1(&signedAttrs, &hasSignedAttrs, tagContext0Compound) {
+		return nil, ErrMalformed
+	}
+	if hasSignedAttrs {
+		si.rawSignedAttributes = []byte(signedAttrs)
+		if si.SignedAttributes, err = parseAttributes(signedAttrs); err != nil {
+			return nil, err
+		}
+	}
+
+	if si.SignatureAlgorithm, err = readAlgorithmIdentifier(&input); err != nil {
+		return nil, err
+	}
+	var signature cryptobyte.String
+	if !input.ReadASN1(&signature, cbasn1.OCTET_STRING) {
+		return nil, ErrMalformed
+	}
+	si.Signature = []byte(signature)
+
+	var unsignedAttrs cryptobyte.String
+	var hasUnsignedAttrs bool
+	if !input.ReadOptionalASN1(&unsignedAttrs, &hasUnsignedAttrs, tagContext1Compound) || !input.Empty() {
+		return nil, ErrMalformed
+	}
+	if hasUnsignedAttrs {
+		if si.UnsignedAttributes, err = parseAttributes(unsignedAttrs); err != nil {
+			return nil, err
+		}
+	}
+
+	return si, nil
+}
+
+func parseAttributes(input cryptobyte.String) ([]Attribute, error) {
+	var attrs []Attribute
+	for !input.Empty() {
+		var element, values cryptobyte.String
+		var attr Attribute
+		if !input.ReadASN1(&element, cbasn1.SEQUENCE) ||
+			!element.ReadASN1ObjectIdentifier(&attr.Type) ||
+			!element.ReadASN1(&values, cbasn1.SET) {
+			return nil, ErrMalformed
+		}
+		for !values.Empty() {
+			var value cryptobyte.String
+			if !values.ReadAnyASN1Element(&value, nil) {
+				return nil, ErrMalformed
+			}
+			var raw asn1.RawValue
+			if _, err := asn1.Unmarshal(value, &raw); err != nil {
+				return nil, ErrMalformed
+			}
+			attr.Values = append(attr.Values, raw)
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, nil
+}
+
+func readAlgorithmIdentifier(input *cryptobyte.String) (pkix.AlgorithmIdentifier, error) {
+	var element cryptobyte.String
+	var alg pkix.AlgorithmIdentifier
+	if !input.ReadASN1Element(&element, cbasn1.SEQUENCE) {
+		return alg, ErrMalformed
+	}
+	if _, err := asn1.Unmarshal(element, &alg); err != nil {
+		return alg, ErrMalformed
+	}
+	return alg, nil
+}
+
+// readOctetString reads a primitive OCTET STRING or the concatenation of a
+// constructed one.
+func readOctetString(input *cryptobyte.String) ([]byte, error) {
+	var content cryptobyte.String
+	if input.PeekASN1Tag(tagOctetStringCompound) {
+		var chunks cryptobyte.String
+		if !input.ReadASN1(&chunks, tagOctetStringCompound) {
+			return nil, ErrMalformed
+		}
+		out := []byte{}
+		for !chunks.Empty() {
+			chunk, err := readOctetString(&chunks)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, chunk...)
+		}
+		return out, nil
+	}
+	if !input.ReadASN1(&content, cbasn1.OCTET_STRING) {
+		return nil, ErrMalformed
+	}
+	return append([]byte{}, content...), nil
+}
@@ -0,0 +1,406 @@
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// SignerConfig describes who signs and how.
+type SignerConfig struct {
+	Signer      crypto.Signer
+	Certificate *x509.Certificate
+	// Chain holds the intermediate and root certificates to embed after the
+	// signer certificate.
+	Chain     []*x509.Certificate
+	Algorithm pki.Algorithm
+	// SigningTime is added as a signed attribute unless zero. PAdES
+	// signatures leave it out and carry the time in the signature dictionary.
+	SigningTime time.Time
+	// ExtraSignedAttributes are appended to the mandatory content type,
+	// message digest and signing certificate attributes.
+	ExtraSignedAttributes []Attribute
+}
+
+// DigestHash is the hash the content must be digested with for a given
+// signature algorithm. Ed25519 uses SHA-512 as RFC 8419 requires.
+func DigestHash(alg pki.Algorithm) crypto.Hash {
+	if alg.Hash == 0 {
+		return crypto.SHA512
+	}
+	return alg.Hash
+}
+
+// SignDetached digests content and returns a SignedData without
+// encapsulated content, the layout of a .p7s file.
+func SignDetached(content io.Reader, cfg SignerConfig) (*SignedData, error) {
+	h := DigestHash(cfg.Algorithm).New()
+	if _, err := io.Copy(h, content); err != nil {
+		return nil, err
+	}
+	return SignDigest(h.Sum(nil), cfg)
+}
+
+// SignDigest builds a detached SignedData from a precomputed content digest.
+func SignDigest(digest []byte, cfg SignerConfig) (*SignedData, error) {
+	sd := newSignedData(OIDData, nil, cfg)
+	si, err := newSignerInfo(OIDData, digest, cfg)
+	if err != nil {
+		return nil, err
+	}
+	sd.SignerInfos = []*SignerInfo{si}
+	return sd, nil
+}
+
+// SignContent returns a SignedData encapsulating content of the given type,
+// e.g. the TSTInfo of a timestamp token.
+func SignContent(contentType asn1.ObjectIdentifier, content []byte, cfg SignerConfig) (*SignedData, error) {
+	h := DigestHash(cfg.Algorithm).New()
+	h.Write(content)
+
+	sd := newSignedData(contentType, content, cfg)
+	si, err := newSignerInfo(contentType, h.Sum(nil), cfg)
+	if err != nil {
+		return nil, err
+	}
+	sd.SignerInfos = []*SignerInfo{si}
+	return sd, nil
+}
+
+// SignCounterSignature creates a SignerInfo countersigning parent, i.e.
+// signing the parent's signature value as RFC 5652 section 11.4 describes.
+func SignCounterSignature(parent *SignerInfo, cfg SignerConfig) (*SignerInfo, error) {
+	h := DigestHash(cfg.Algorithm).New()
+	h.Write(parent.Signature)
+	return newSignerInfo(nil, h.Sum(nil), cfg)
+}
+
+func newSignedData(contentType asn1.ObjectIdentifier, content []byte, cfg SignerConfig) *SignedData {
+	sd := &SignedData{
+		Version:      1,
+		ContentType:  contentType,
+		Content:      content,
+		Detached:     content == nil,
+		Certificates: append([]*x509.Certificate{cfg.Certificate}, cfg.Chain...),
+	}
+	if !contentType.Equal(OIDData) {
+		sd.Version = 3
+	}
+	return sd
+}
+
+// newSignerInfo signs the attribute set for a content digest. A nil
+// contentType leaves the content type attribute out, as countersignatures
+// must.
+func newSignerInfo(contentType asn1.ObjectIdentifier, digest []byte, cfg SignerConfig) (*SignerInfo, error) {
+	if cfg.Signer == nil || cfg.Certificate == nil {
+		return nil, errors.New("cms: signer and certificate are required")
+	}
+	digestAlg, sigAlg, err := algorithmIdentifiers(cfg.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs []Attribute
+	if contentType != nil {
+		attr, err := NewAttribute(OIDAttributeContentType, contentType)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	attr, err := NewAttribute(OIDAttributeMessageDigest, digest)
+	if err != nil {
+		return nil, err
+	}
+	attrs = append(attrs, attr)
+	if !cfg.SigningTime.IsZero() {
+		attr, err := NewAttribute(OIDAttributeSigningTime, cfg.SigningTime.UTC().Truncate(time.Second))
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	attr, err = signingCertificateV2(cfg.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	attrs = append(attrs, attr)
+	attrs = append(attrs, cfg.ExtraSignedAttributes...)
+
+	rawAttrs, err := marshalAttributes(attrs)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := cfg.Algorithm.Sign(cfg.Signer, attributesToSign(rawAttrs))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignerInfo{
+		Version:             1,
+		Issuer:              cfg.Certificate.RawIssuer,
+		SerialNumber:        cfg.Certificate.SerialNumber,
+		DigestAlgorithm:     digestAlg,
+		SignedAttributes:    attrs,
+		SignatureAlgorithm:  sigAlg,
+		Signature:           signature,
+		rawSignedAttributes: rawAttrs,
+	}, nil
+}
+
+// NewAttribute DER encodes a single valued attribute.
+func NewAttribute(oid asn1.ObjectIdentifier, value interface{}) (Attribute, error) {
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		return Attribute{}, err
+	}
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &raw); err != nil {
+		return Attribute{}, err
+	}
+	return Attribute{Type: oid, Values: []asn1.RawValue{raw}}, nil
+}
+
+// signingCertificateV2 binds the signer certificate into the signed
+// attributes (RFC 5035), required by CAdES and PAdES baseline profiles.
+func signingCertificateV2(cert *x509.Certificate) (Attribute, error) {
+	sum := sha256.Sum256(cert.Raw)
+
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) { // SigningCertificateV2
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) { // certs
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) { // ESSCertIDv2, SHA-256 is the default hash
+				b.AddASN1OctetString(sum[:])
+				b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) { // IssuerSerial
+					b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) { // GeneralNames
+						b.AddASN1(cbasn1.Tag(4).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+							b.AddBytes(cert.RawIssuer)
+						})
+					})
+					b.AddASN1BigInt(cert.SerialNumber)
+				})
+			})
+		})
+	})
+	der, err := b.Bytes()
+	if err != nil {
+		return Attribute{}, err
+	}
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &raw); err != nil {
+		return Attribute{}, err
+	}
+	return Attribute{Type: OIDAttributeSigningCertificateV2, Values: []asn1.RawValue{raw}}, nil
+}
+
+// algorithmIdentifiers maps a platform algorithm to the CMS digest and
+// signature algorithm identifiers.
+func algorithmIdentifiers(alg pki.Algorithm) (pkix.AlgorithmIdentifier, pkix.AlgorithmIdentifier, error) {
+	digestOID, err := digestOIDForHash(DigestHash(alg))
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, pkix.AlgorithmIdentifier{}, err
+	}
+	digestAlg := pkix.AlgorithmIdentifier{Algorithm: digestOID, Parameters: asn1.NullRawValue}
+
+	switch alg.KeyType {
+	case "RSA":
+		if !alg.PSS {
+			return digestAlg, pkix.AlgorithmIdentifier{Algorithm: OIDEncryptionRSA, Parameters: asn1.NullRawValue}, nil
+		}
+		params, err := marshalPSSParameters(digestOID, alg.SaltLength)
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, pkix.AlgorithmIdentifier{}, err
+		}
+		return digestAlg, pkix.AlgorithmIdentifier{Algorithm: OIDSignatureRSAPSS, Parameters: params}, nil
+	case "ECDSA":
+		switch alg.Hash {
+		case crypto.SHA256:
+			return digestAlg, pkix.AlgorithmIdentifier{Algorithm: OIDSignatureECDSASHA256}, nil
+		case crypto.SHA384:
+			return digestAlg, pkix.AlgorithmIdentifier{Algorithm: OIDSignatureECDSASHA384}, nil
+		}
+	case "Ed25519":
+		// RFC 8419: no parameters, and the digest algorithm is SHA-512
+		return pkix.AlgorithmIdentifier{Algorithm: OIDDigestSHA512}, pkix.AlgorithmIdentifier{Algorithm: OIDSignatureEd25519}, nil
+	}
+	return pkix.AlgorithmIdentifier{}, pkix.AlgorithmIdentifier{}, ErrUnsupportedAlgorithm
+}
+
+// pssParameters is RSASSA-PSS-params from RFC 4055.
+type pssParameters struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"explicit,tag:0,optional"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"explicit,tag:1,optional"`
+	SaltLength   int                      `asn1:"explicit,tag:2,optional,default:20"`
+	TrailerField int                      `asn1:"explicit,tag:3,optional,default:1"`
+}
+
+func marshalPSSParameters(digestOID asn1.ObjectIdentifier, saltLength int) (asn1.RawValue, error) {
+	hashAlg := pkix.AlgorithmIdentifier{Algorithm: digestOID, Parameters: asn1.NullRawValue}
+	mgfParams, err := asn1.Marshal(hashAlg)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	der, err := asn1.Marshal(pssParameters{
+		Hash:         hashAlg,
+		MGF:          pkix.AlgorithmIdentifier{Algorithm: OIDMGF1, Parameters: asn1.RawValue{FullBytes: mgfParams}},
+		SaltLength:   saltLength,
+		TrailerField: 1,
+	})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{FullBytes: der}, nil
+}
+
+// marshalAttributes encodes the contents of a SET OF Attribute, sorted as DER
+// requires.
+func marshalAttributes(attrs []Attribute) ([]byte, error) {
+	encoded := make([][]byte, 0, len(attrs))
+	for _, attr := range attrs {
+		var b cryptobyte.Builder
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(attr.Type)
+			b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {
+				for _, value := range attr.Values {
+					b.AddBytes(value.FullBytes)
+				}
+			})
+		})
+		der, err := b.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, der)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return bytes.Join(encoded, nil), nil
+}
+
+// attributesToSign re-tags the [0] IMPLICIT signedAttrs contents as the
+// explicit SET OF that the signature covers.
+func attributesToSign(raw []byte) []byte {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) { b.AddBytes(raw) })
+	return b.BytesOrPanic()
+}
+
+// Marshal encodes the SignedData as a DER ContentInfo.
+func (sd *SignedData) Marshal() ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1ObjectIdentifier(OIDSignedData)
+		b.AddASN1(tagContext0Compound, func(b *cryptobyte.Builder) {
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddASN1Int64(int64(sd.Version))
+				b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {
+					for _, alg := range sd.digestAlgorithms() {
+						addAlgorithmIdentifier(b, alg)
+					}
+				})
+				b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					b.AddASN1ObjectIdentifier(sd.ContentType)
+					if !sd.Detached {
+						b.AddASN1(tagContext0Compound, func(b *cryptobyte.Builder) {
+							b.AddASN1OctetString(sd.Content)
+						})
+					}
+				})
+				if len(sd.Certificates) > 0 {
+					b.AddASN1(tagContext0Compound, func(b *cryptobyte.Builder) {
+						for _, cert := range sd.Certificates {
+							b.AddBytes(cert.Raw)
+						}
+					})
+				}
+				if len(sd.CRLs) > 0 {
+					b.AddASN1(tagContext1Compound, func(b *cryptobyte.Builder) {
+						for _, crl := range sd.CRLs {
+							b.AddBytes(crl)
+						}
+					})
+				}
+				b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {
+					for _, si := range sd.SignerInfos {
+						si.marshal(b)
+					}
+				})
+			})
+		})
+	})
+	return b.Bytes()
+}
+
+// Marshal encodes a single SignerInfo, the value stored in a
+// counterSignature attribute.
+func (si *SignerInfo) Marshal() ([]byte, error) {
+	var b cryptobyte.Builder
+	si.marshal(&b)
+	return b.Bytes()
+}
+
+func (si *SignerInfo) marshal(b *cryptobyte.Builder) {
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(int64(si.Version))
+		if si.SubjectKeyID != nil {
+			b.AddASN1(tagContext0, func(b *cryptobyte.Builder) { b.AddBytes(si.SubjectKeyID) })
+		} else {
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddBytes(si.Issuer)
+				b.AddASN1BigInt(si.SerialNumber)
+			})
+		}
+		addAlgorithmIdentifier(b, si.DigestAlgorithm)
+		if si.rawSignedAttributes != nil {
+			b.AddASN1(tagContext0Compound, func(b *cryptobyte.Builder) { b.AddBytes(si.rawSignedAttributes) })
+		}
+		addAlgorithmIdentifier(b, si.SignatureAlgorithm)
+		b.AddASN1OctetString(si.Signature)
+		if len(si.UnsignedAttributes) > 0 {
+			raw, err := marshalAttributes(si.UnsignedAttributes)
+			if err != nil {
+				b.SetError(err)
+				return
+			}
+			b.AddASN1(tagContext1Compound, func(b *cryptobyte.Builder) { b.AddBytes(raw) })
+		}
+	})
+}
+
+// digestAlgorithms lists the distinct digest algorithms of all signers.
+func (sd *SignedData) digestAlgorithms() []pkix.AlgorithmIdentifier {
+	algs := append([]pkix.AlgorithmIdentifier{}, sd.DigestAlgorithms...)
+	for _, si := range sd.SignerInfos {
+		found := false
+		for _, alg := range algs {
+			if alg.Algorithm.Equal(si.DigestAlgorithm.Algorithm) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			algs = append(algs, si.DigestAlgorithm)
+		}
+	}
+	return algs
+}
+
+func addAlgorithmIdentifier(b *cryptobyte.Builder, alg pkix.AlgorithmIdentifier) {
+	der, err := asn1.Marshal(alg)
+	if err != nil {
+		b.SetError(err)
+		return
+	}
+	b.AddBytes(der)
+}
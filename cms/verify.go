@@ -0,0 +1,237 @@
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"hash"
+	"io"
+)
+
+// Verify checks every signer against the content: the encapsulated content,
+// or detached when the SignedData carries none. It returns the signer
+// certificates in SignerInfos order. Certificate paths are not validated.
+func (sd *SignedData) Verify(detached io.Reader) ([]*x509.Certificate, error) {
+	if len(sd.SignerInfos) == 0 {
+		return nil, ErrMalformed
+	}
+
+	digests, err := sd.Digests(detached)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := make([]*x509.Certificate, 0, len(sd.SignerInfos))
+	for _, si := range sd.SignerInfos {
+		digestHash, err := si.DigestHash()
+		if err != nil {
+			return nil, err
+		}
+		cert, err := sd.VerifySigner(si, digests[digestHash])
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// Digests hashes the content once with every digest algorithm used by the
+// signers.
+func (sd *SignedData) Digests(detached io.Reader) (map[crypto.Hash][]byte, error) {
+	var content io.Reader
+	switch {
+	case !sd.Detached:
+		content = bytes.NewReader(sd.Content)
+	case detached != nil:
+		content = detached
+	default:
+		return nil, ErrNoContent
+	}
+
+	hashes := map[crypto.Hash]hash.Hash{}
+	var writers []io.Writer
+	for _, si := range sd.SignerInfos {
+		digestHash, err := si.DigestHash()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := hashes[digestHash]; !ok {
+			h := digestHash.New()
+			hashes[digestHash] = h
+			writers = append(writers, h)
+		}
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), content); err != nil {
+		return nil, err
+	}
+
+	digests := make(map[crypto.Hash][]byte, len(hashes))
+	for digestHash, h := range hashes {
+		digests[digestHash] = h.Sum(nil)
+	}
+	return digests, nil
+}
+
+// VerifySigner checks one signer given the digest of the content it signed,
+// computed with si.DigestHash. It returns the signer certificate.
+func (sd *SignedData) VerifySigner(si *SignerInfo, digest []byte) (*x509.Certificate, error) {
+	cert, err := sd.SignerCertificate(si)
+	if err != nil {
+		return nil, err
+	}
+	if err := si.verify(cert, sd.ContentType, digest); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// VerifyCounterSignature checks a counterSignature SignerInfo against the
+// signature value of its parent. certs is searched for the countersigner's
+// certificate.
+func VerifyCounterSignature(counter, parent *SignerInfo, certs []*x509.Certificate) (*x509.Certificate, error) {
+	digestHash, err := counter.DigestHash()
+	if err != nil {
+		return nil, err
+	}
+	h := digestHash.New()
+	h.Write(parent.Signature)
+
+	sd := &SignedData{Certificates: certs}
+	cert, err := sd.SignerCertificate(counter)
+	if err != nil {
+		return nil, err
+	}
+	if err := counter.verify(cert, nil, h.Sum(nil)); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// verify checks the signed attributes against the digest and the signature
+// against the certificate's key. contentType is nil for countersignatures.
+func (si *SignerInfo) verify(cert *x509.Certificate, contentType asn1.ObjectIdentifier, digest []byte) error {
+	if si.rawSignedAttributes == nil {
+		// without signed attributes the signature is over the content
+		// digest itself, which only works for hash-then-sign schemes
+		digestHash, err := si.DigestHash()
+		if err != nil {
+			return err
+		}
+		return verifySignature(cert.PublicKey, si.SignatureAlgorithm, digestHash, digest, nil, si.Signature)
+	}
+
+	messageDigest, err := si.MessageDigest()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(messageDigest, digest) {
+		return ErrDigestMismatch
+	}
+	if contentType != nil {
+		attr := si.SignedAttribute(OIDAttributeContentType)
+		if attr == nil || len(attr.Values) != 1 {
+			return ErrContentTypeMismatch
+		}
+		var signedType asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &signedType); err != nil || !signedType.Equal(contentType) {
+			return ErrContentTypeMismatch
+		}
+	}
+
+	digestHash, err := si.DigestHash()
+	if err != nil {
+		return err
+	}
+	message := attributesToSign(si.rawSignedAttributes)
+	h := digestHash.New()
+	h.Write(message)
+	return verifySignature(cert.PublicKey, si.SignatureAlgorithm, digestHash, h.Sum(nil), message, si.Signature)
+}
+
+// verifySignature dispatches on the signature algorithm identifier. hashed is
+// the digest of message under digestHash; message is only needed by Ed25519.
+func verifySignature(pub crypto.PublicKey, sigAlg pkix.AlgorithmIdentifier, digestHash crypto.Hash, hashed, message, signature []byte) error {
+	oid := sigAlg.Algorithm
+
+	// algorithms that name their own hash must agree with the digest
+	// algorithm, otherwise hashed was computed with the wrong function
+	named := map[string]crypto.Hash{
+		OIDSignatureSHA256WithRSA.String(): crypto.SHA256,
+		OIDSignatureSHA384WithRSA.String(): crypto.SHA384,
+		OIDSignatureSHA512WithRSA.String(): crypto.SHA512,
+		OIDSignatureECDSASHA256.String():   crypto.SHA256,
+		OIDSignatureECDSASHA384.String():   crypto.SHA384,
+		OIDSignatureECDSASHA512.String():   crypto.SHA512,
+	}
+	if namedHash, ok := named[oid.String()]; ok && namedHash != digestHash {
+		return ErrUnsupportedAlgorithm
+	}
+
+	switch {
+	case oid.Equal(OIDEncryptionRSA), oid.Equal(OIDSignatureSHA256WithRSA),
+		oid.Equal(OIDSignatureSHA384WithRSA), oid.Equal(OIDSignatureSHA512WithRSA):
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		if rsa.VerifyPKCS1v15(key, digestHash, hashed, signature) != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+
+	case oid.Equal(OIDSignatureRSAPSS):
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		var params pssParameters
+		if _, err := asn1.Unmarshal(sigAlg.Parameters.FullBytes, &params); err != nil {
+			return ErrMalformed
+		}
+		if params.Hash.Algorithm == nil {
+			// RFC 4055 default is SHA-1, which is not accepted
+			return ErrUnsupportedAlgorithm
+		}
+		pssHash, err := hashForDigestOID(params.Hash.Algorithm)
+		if err != nil || pssHash != digestHash {
+			return ErrUnsupportedAlgorithm
+		}
+		opts := &rsa.PSSOptions{SaltLength: params.SaltLength, Hash: pssHash}
+		if rsa.VerifyPSS(key, pssHash, hashed, signature, opts) != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+
+	case oid.Equal(OIDPublicKeyECDSA), oid.Equal(OIDSignatureECDSASHA256),
+		oid.Equal(OIDSignatureECDSASHA384), oid.Equal(OIDSignatureECDSASHA512):
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		if !ecdsa.VerifyASN1(key, hashed, signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+
+	case oid.Equal(OIDSignatureEd25519):
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok || message == nil {
+			return ErrInvalidSignature
+		}
+		if !ed25519.Verify(key, message, signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+
+	default:
+		return ErrUnsupportedAlgorithm
+	}
+}
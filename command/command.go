@@ -1,13 +1,17 @@
 package command
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
 	"strings"
 
 	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/keyring"
 	"github.com/PhanPhuc2609/be-sign-file/migrations"
 	"github.com/PhanPhuc2609/be-sign-file/script"
+	"github.com/PhanPhuc2609/be-sign-file/service"
 	"github.com/samber/do"
 	"gorm.io/gorm"
 )
@@ -20,6 +24,9 @@ func Commands(injector *do.Injector) bool {
 	migrate := false
 	seed := false
 	run := false
+	caInit := false
+	rotateMasterKey := false
+	checkBlobs := false
 	scriptFlag := false
 
 	for _, arg := range os.Args[1:] {
@@ -29,6 +36,15 @@ func Commands(injector *do.Injector) bool {
 		if arg == "--seed" {
 			seed = true
 		}
+		if arg == "--ca-init" {
+			caInit = true
+		}
+		if arg == "--rotate-master-key" {
+			rotateMasterKey = true
+		}
+		if arg == "--check-blobs" {
+			checkBlobs = true
+		}
 		if arg == "--run" {
 			run = true
 		}
@@ -43,6 +59,18 @@ func Commands(injector *do.Injector) bool {
 			log.Fatalf("error migration: %v", err)
 		}
 		log.Println("migration completed successfully")
+
+		// khóa riêng lưu dạng rõ trước khi có vault được bọc bằng master key;
+		// không có master key thì chúng được chuyển ở lần ký đầu tiên, với PIN
+		keyVault := do.MustInvokeNamed[service.KeyVaultService](injector, constants.KeyVaultService)
+		migrated, err := keyVault.MigrateLegacyKeys(context.Background())
+		if errors.Is(err, keyring.ErrNoMasterKey) {
+			log.Println("MASTER_KEY_FILE is not set, legacy private keys are left for their owners to protect with a PIN")
+		} else if err != nil {
+			log.Fatalf("error moving private keys into the vault: %v", err)
+		} else {
+			log.Printf("%d legacy private keys moved into the vault", migrated)
+		}
 	}
 
 	if seed {
@@ -52,6 +80,46 @@ func Commands(injector *do.Injector) bool {
 		log.Println("seeder completed successfully")
 	}
 
+	if caInit {
+		caService := do.MustInvokeNamed[service.CAService](injector, constants.CAService)
+		if err := caService.Initialize(context.Background()); err != nil {
+			log.Fatalf("error ca init: %v", err)
+		}
+		log.Println("certificate authority initialized successfully")
+	}
+
+	if rotateMasterKey {
+		encryptionService, err := do.InvokeNamed[service.EncryptionService](injector, constants.EncryptionService)
+		if err != nil {
+			log.Fatalf("error master key: %v", err)
+		}
+		rotated, err := encryptionService.RotateMasterKey(context.Background())
+		if err != nil {
+			log.Fatalf("error rotating master key: %v", err)
+		}
+		keyVault := do.MustInvokeNamed[service.KeyVaultService](injector, constants.KeyVaultService)
+		rewrapped, err := keyVault.RotateMasterKey(context.Background())
+		if err != nil {
+			log.Fatalf("error rotating master key: %v", err)
+		}
+		log.Printf("master key rotated successfully, %d data keys and %d signing keys rewrapped", rotated, rewrapped)
+	}
+
+	if checkBlobs {
+		documentService := do.MustInvokeNamed[service.DocumentService](injector, constants.DocumentService)
+		corrupted, err := documentService.CheckBlobs(context.Background())
+		for _, digest := range corrupted {
+			log.Printf("blob %s is missing or does not match its digest", digest)
+		}
+		if err != nil {
+			log.Fatalf("error checking blobs: %v", err)
+		}
+		if len(corrupted) > 0 {
+			log.Fatalf("%d corrupted blobs", len(corrupted))
+		}
+		log.Println("all blobs match their digest")
+	}
+
 	if scriptFlag {
 		if err := script.Script(scriptName, db); err != nil {
 			log.Fatalf("error script: %v", err)
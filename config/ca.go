@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+const (
+	DEFAULT_CA_DIR               = "./ca_store"
+	DEFAULT_CA_NAME              = "VinCSS"
+	DEFAULT_PUBLIC_BASE_URL      = "http://localhost:8888"
+	DEFAULT_CRL_REFRESH_INTERVAL = time.Hour
+	DEFAULT_TRUST_STORE_DIR      = "./trust_store"
+	// UUID based OID (2.25), usable without registering an arc
+	DEFAULT_TSA_POLICY_OID = "2.25.297977844126724156178257328349224674775"
+)
+
+type CAConfig struct {
+	Dir        string
+	Name       string
+	Passphrase string
+	// KeyBackend is KEY_BACKEND_SOFTWARE, keys in files encrypted with
+	// Passphrase, or KEY_BACKEND_PKCS11, keys in the token of PKCS11Config.
+	KeyBackend string
+
+	// BaseURL is the externally reachable address of this service, used for
+	// the CRL distribution point and other URLs embedded in certificates.
+	BaseURL            string
+	CRLRefreshInterval time.Duration
+
+	// TrustStoreDir holds the root certificates, besides the platform root,
+	// accepted when validating documents signed with other software.
+	TrustStoreDir string
+
+	// TSAPolicyOID is the policy the time-stamp authority issues tokens
+	// under.
+	TSAPolicyOID string
+}
+
+func NewCAConfig() CAConfig {
+	dir := os.Getenv("CA_DIR")
+	if dir == "" {
+		dir = DEFAULT_CA_DIR
+	}
+
+	name := os.Getenv("CA_NAME")
+	if name == "" {
+		name = DEFAULT_CA_NAME
+	}
+
+	baseURL := os.Getenv("PUBLIC_BASE_URL")
+	if baseURL == "" {
+		baseURL = DEFAULT_PUBLIC_BASE_URL
+	}
+
+	interval, err := time.ParseDuration(os.Getenv("CRL_REFRESH_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = DEFAULT_CRL_REFRESH_INTERVAL
+	}
+
+	trustDir := os.Getenv("TRUST_STORE_DIR")
+	if trustDir == "" {
+		trustDir = DEFAULT_TRUST_STORE_DIR
+	}
+
+	keyBackend := os.Getenv("CA_KEY_BACKEND")
+	if keyBackend == "" {
+		keyBackend = KEY_BACKEND_SOFTWARE
+	}
+
+	tsaPolicy := os.Getenv("TSA_POLICY_OID")
+	if tsaPolicy == "" {
+		tsaPolicy = DEFAULT_TSA_POLICY_OID
+	}
+
+	return CAConfig{
+		Dir:                dir,
+		Name:               name,
+		Passphrase:         os.Getenv("CA_PASSPHRASE"),
+		KeyBackend:         keyBackend,
+		BaseURL:            baseURL,
+		CRLRefreshInterval: interval,
+		TrustStoreDir:      trustDir,
+		TSAPolicyOID:       tsaPolicy,
+	}
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+const (
+	// Tài liệu đã xóa được giữ lại 30 ngày trước khi xóa hẳn
+	DEFAULT_DOCUMENT_RETENTION = 30 * 24 * time.Hour
+	DEFAULT_PURGE_INTERVAL     = time.Hour
+)
+
+// DocumentConfig controls how deleted documents are purged.
+type DocumentConfig struct {
+	// Retention is how long a deleted document is kept, with its signatures
+	// and file, before it is purged.
+	Retention time.Duration
+
+	PurgeInterval time.Duration
+}
+
+func NewDocumentConfig() DocumentConfig {
+	retention, err := time.ParseDuration(os.Getenv("DOCUMENT_RETENTION"))
+	if err != nil || retention < 0 {
+		retention = DEFAULT_DOCUMENT_RETENTION
+	}
+	interval, err := time.ParseDuration(os.Getenv("DOCUMENT_PURGE_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = DEFAULT_PURGE_INTERVAL
+	}
+
+	return DocumentConfig{Retention: retention, PurgeInterval: interval}
+}
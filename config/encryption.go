@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// EncryptionConfig locates the master keys that wrap the data keys of
+// encrypted documents. They are kept outside the database, in files or in
+// the environment as base64. A master key is required unless encryption is
+// turned off explicitly.
+type EncryptionConfig struct {
+	MasterKeyFile string
+	MasterKey     string
+
+	// Previous master keys only unwrap the data keys not rotated yet.
+	PreviousMasterKeyFiles []string
+	PreviousMasterKeys     []string
+
+	// Off stores documents unencrypted (STORAGE_ENCRYPTION=off).
+	Off bool
+
+	// AllowPlaintext reads the objects stored before encryption was turned
+	// on (STORAGE_ALLOW_PLAINTEXT=true), while they are migrated. Otherwise
+	// they are rejected, so plaintext swapped in for an encrypted object in
+	// the bucket is not served.
+	AllowPlaintext bool
+}
+
+func NewEncryptionConfig() EncryptionConfig {
+	return EncryptionConfig{
+		MasterKeyFile:          os.Getenv("MASTER_KEY_FILE"),
+		MasterKey:              os.Getenv("MASTER_KEY"),
+		PreviousMasterKeyFiles: splitList(os.Getenv("PREVIOUS_MASTER_KEY_FILES")),
+		PreviousMasterKeys:     splitList(os.Getenv("PREVIOUS_MASTER_KEYS")),
+		Off:                    os.Getenv("STORAGE_ENCRYPTION") == "off",
+		AllowPlaintext:         os.Getenv("STORAGE_ALLOW_PLAINTEXT") == "true",
+	}
+}
+
+func (c EncryptionConfig) Enabled() bool {
+	return c.MasterKeyFile != "" || c.MasterKey != ""
+}
+
+// splitList splits a comma separated variable, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
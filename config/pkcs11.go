@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	// KEY_BACKEND_SOFTWARE keeps keys in process: CA keys in files encrypted
+	// with CA_PASSPHRASE, user keys in the key vault.
+	KEY_BACKEND_SOFTWARE = "software"
+	// KEY_BACKEND_PKCS11 keeps keys in the PKCS#11 token of PKCS11Config,
+	// they never leave it.
+	KEY_BACKEND_PKCS11 = "pkcs11"
+)
+
+// PKCS11Config locates the token holding the keys of the pkcs11 backend: a
+// hardware security module, or SoftHSM2 for development and tests.
+type PKCS11Config struct {
+	// Module is the path of the PKCS#11 library of the token, e.g.
+	// /usr/lib/softhsm/libsofthsm2.so.
+	Module string
+	// TokenLabel selects the token, it may be empty when the module has only
+	// one.
+	TokenLabel string
+
+	// PIN of the token user, or a file holding it.
+	PIN     string
+	PINFile string
+}
+
+func NewPKCS11Config() PKCS11Config {
+	return PKCS11Config{
+		Module:     os.Getenv("PKCS11_MODULE"),
+		TokenLabel: os.Getenv("PKCS11_TOKEN_LABEL"),
+		PIN:        os.Getenv("PKCS11_PIN"),
+		PINFile:    os.Getenv("PKCS11_PIN_FILE"),
+	}
+}
+
+func (c PKCS11Config) Enabled() bool {
+	return c.Module != ""
+}
+
+// LoadPIN returns the token PIN, read from PINFile when it is set.
+func (c PKCS11Config) LoadPIN() (string, error) {
+	if c.PINFile == "" {
+		return c.PIN, nil
+	}
+	data, err := os.ReadFile(c.PINFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
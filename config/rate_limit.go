@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	DEFAULT_PUBLIC_VERIFY_RATE   = 10
+	DEFAULT_PUBLIC_VERIFY_PERIOD = time.Minute
+	DEFAULT_PUBLIC_VERIFY_BURST  = 5
+	// Kích thước tối đa của file tải lên trang xác minh công khai
+	DEFAULT_PUBLIC_VERIFY_MAX_SIZE = 20 << 20
+)
+
+// RateLimitConfig allows Rate requests per Period from one client, with
+// bursts of up to Burst requests.
+type RateLimitConfig struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+// PublicVerifyConfig limits the unauthenticated verification endpoints.
+type PublicVerifyConfig struct {
+	RateLimit   RateLimitConfig
+	MaxFileSize int64
+}
+
+// TrustedProxies are the proxies whose X-Forwarded-For header gives the
+// client IP that requests are limited by, from TRUSTED_PROXIES (IPs or
+// CIDRs). None by default: a client could otherwise send a new header on
+// every request to get a new limit.
+func TrustedProxies() []string {
+	return splitList(os.Getenv("TRUSTED_PROXIES"))
+}
+
+func NewPublicVerifyConfig() PublicVerifyConfig {
+	rate, err := strconv.Atoi(os.Getenv("PUBLIC_VERIFY_RATE"))
+	if err != nil || rate <= 0 {
+		rate = DEFAULT_PUBLIC_VERIFY_RATE
+	}
+
+	period, err := time.ParseDuration(os.Getenv("PUBLIC_VERIFY_PERIOD"))
+	if err != nil || period <= 0 {
+		period = DEFAULT_PUBLIC_VERIFY_PERIOD
+	}
+
+	burst, err := strconv.Atoi(os.Getenv("PUBLIC_VERIFY_BURST"))
+	if err != nil || burst <= 0 {
+		burst = DEFAULT_PUBLIC_VERIFY_BURST
+	}
+
+	maxSize, err := strconv.ParseInt(os.Getenv("PUBLIC_VERIFY_MAX_SIZE"), 10, 64)
+	if err != nil || maxSize <= 0 {
+		maxSize = DEFAULT_PUBLIC_VERIFY_MAX_SIZE
+	}
+
+	return PublicVerifyConfig{
+		RateLimit:   RateLimitConfig{Rate: rate, Period: period, Burst: burst},
+		MaxFileSize: maxSize,
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	STORAGE_DRIVER_LOCAL = "local"
+	STORAGE_DRIVER_S3    = "s3"
+
+	// thư mục làm việc, giữ nguyên đường dẫn uploads/ và assets/ như trước
+	DEFAULT_STORAGE_LOCAL_ROOT = "."
+	DEFAULT_S3_REGION          = "us-east-1"
+	// S3 cho phép tối đa 10000 phần: 16 MiB mỗi phần đủ cho file 150 GiB
+	DEFAULT_S3_PART_SIZE           = 16 << 20
+	DEFAULT_STORAGE_PRESIGN_EXPIRY = 15 * time.Minute
+)
+
+// StorageConfig selects where documents, signed outputs and profile images
+// are kept.
+type StorageConfig struct {
+	Driver string
+
+	// LocalRoot is the directory the local driver stores keys under.
+	LocalRoot string
+
+	S3 S3Config
+
+	// PresignExpiry is how long presigned download URLs stay valid.
+	PresignExpiry time.Duration
+}
+
+// S3Config addresses a bucket on AWS S3 or an S3-compatible server such as
+// MinIO.
+type S3Config struct {
+	// Endpoint is the base URL of the server, e.g. http://localhost:9000.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	// PathStyle puts the bucket in the path instead of the host name, as
+	// MinIO expects.
+	PathStyle bool
+
+	// PartSize is the size of the parts large objects are uploaded in; S3
+	// requires at least 5 MiB.
+	PartSize int64
+}
+
+func NewStorageConfig() StorageConfig {
+	driver := os.Getenv("STORAGE_DRIVER")
+	if driver == "" {
+		driver = STORAGE_DRIVER_LOCAL
+	}
+	root := os.Getenv("STORAGE_LOCAL_ROOT")
+	if root == "" {
+		root = DEFAULT_STORAGE_LOCAL_ROOT
+	}
+
+	region := os.Getenv("S3_REGION")
+	if region == "" {
+		region = DEFAULT_S3_REGION
+	}
+	pathStyle, err := strconv.ParseBool(os.Getenv("S3_PATH_STYLE"))
+	if err != nil {
+		pathStyle = true
+	}
+	partSize, err := strconv.ParseInt(os.Getenv("S3_PART_SIZE"), 10, 64)
+	if err != nil || partSize <= 0 {
+		partSize = DEFAULT_S3_PART_SIZE
+	}
+	expiry, err := time.ParseDuration(os.Getenv("STORAGE_PRESIGN_EXPIRY"))
+	if err != nil || expiry <= 0 {
+		expiry = DEFAULT_STORAGE_PRESIGN_EXPIRY
+	}
+
+	return StorageConfig{
+		Driver:    driver,
+		LocalRoot: root,
+		S3: S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    region,
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PathStyle: pathStyle,
+			PartSize:  partSize,
+		},
+		PresignExpiry: expiry,
+	}
+}
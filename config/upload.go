@@ -0,0 +1,36 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// Tài liệu lớn (bản scan, video làm chứng cứ) được ghi thẳng xuống đĩa
+	DEFAULT_MAX_UPLOAD_SIZE = 8 << 30
+	// Upload tus bị bỏ dở quá thời gian này thì bị xóa
+	DEFAULT_UPLOAD_EXPIRATION = 24 * time.Hour
+)
+
+// UploadConfig bounds the files accepted for upload and verification.
+type UploadConfig struct {
+	MaxSize int64
+
+	// Expiration is how long a resumable upload may stay without receiving
+	// data before it is removed.
+	Expiration time.Duration
+}
+
+func NewUploadConfig() UploadConfig {
+	maxSize, err := strconv.ParseInt(os.Getenv("MAX_UPLOAD_SIZE"), 10, 64)
+	if err != nil || maxSize <= 0 {
+		maxSize = DEFAULT_MAX_UPLOAD_SIZE
+	}
+	expiration, err := time.ParseDuration(os.Getenv("UPLOAD_EXPIRATION"))
+	if err != nil || expiration <= 0 {
+		expiration = DEFAULT_UPLOAD_EXPIRATION
+	}
+
+	return UploadConfig{MaxSize: maxSize, Expiration: expiration}
+}
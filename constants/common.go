@@ -10,6 +10,55 @@ const (
 	ENUM_PAGINATION_PER_PAGE = 10
 	ENUM_PAGINATION_PAGE = 1
 
+	ENUM_CERT_PROFILE_ROOT = "root"
+	ENUM_CERT_PROFILE_ISSUING = "issuing"
+	ENUM_CERT_PROFILE_USER = "user"
+	ENUM_CERT_PROFILE_OCSP = "ocsp"
+	ENUM_CERT_PROFILE_TSA = "tsa"
+	ENUM_CERT_PROFILE_REPORT = "report"
+
+	ENUM_CERT_STATUS_GOOD = "good"
+	ENUM_CERT_STATUS_REVOKED = "revoked"
+
+	ENUM_DOCUMENT_STATUS_UPLOADED = "uploaded"
+	ENUM_DOCUMENT_STATUS_SIGNED = "signed"
+	ENUM_DOCUMENT_STATUS_PENDING = "pending_signatures"
+	ENUM_DOCUMENT_STATUS_PARTIALLY_SIGNED = "partially_signed"
+	ENUM_DOCUMENT_STATUS_COMPLETED = "completed"
+	ENUM_DOCUMENT_STATUS_DECLINED = "declined"
+
+	ENUM_SIGNING_ORDER_SEQUENTIAL = "sequential"
+	ENUM_SIGNING_ORDER_PARALLEL = "parallel"
+
+	ENUM_SIGNING_REQUEST_IN_PROGRESS = "in_progress"
+	ENUM_SIGNING_REQUEST_COMPLETED = "completed"
+	ENUM_SIGNING_REQUEST_DECLINED = "declined"
+	ENUM_SIGNING_REQUEST_CANCELLED = "cancelled"
+
+	ENUM_PARTICIPANT_WAITING = "waiting"
+	ENUM_PARTICIPANT_PENDING = "pending"
+	ENUM_PARTICIPANT_SIGNED = "signed"
+	ENUM_PARTICIPANT_DECLINED = "declined"
+
+	ENUM_KEY_PROTECTION_PIN = "pin"
+	ENUM_KEY_PROTECTION_MASTER = "master"
+	ENUM_KEY_PROTECTION_PKCS11 = "pkcs11"
+
+	ENUM_KEY_USAGE_SIGN_DOCUMENT = "sign_document"
+	ENUM_KEY_USAGE_SIGN_STRING = "sign_string"
+	ENUM_KEY_USAGE_SIGN_JWS = "sign_jws"
+	ENUM_KEY_USAGE_COUNTERSIGN = "countersign"
+	ENUM_KEY_USAGE_ISSUE_CERTIFICATE = "issue_certificate"
+	ENUM_KEY_USAGE_SIGN_CRL = "sign_crl"
+
 	DB = "db"
 	JWTService = "JWTService"
+	CAService = "CAService"
+	UploadService = "UploadService"
+	DocumentService = "DocumentService"
+	EncryptionService = "EncryptionService"
+	KeyVaultService = "KeyVaultService"
+	Keyring = "Keyring"
+	PKCS11Token = "PKCS11Token"
+	Storage = "Storage"
 )
\ No newline at end of file
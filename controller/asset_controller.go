@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/storage"
+	"github.com/PhanPhuc2609/be-sign-file/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// AssetController serves the public files under /assets, such as profile
+// images, from the configured storage.
+type AssetController interface {
+	GetAsset(c *gin.Context)
+}
+
+type assetController struct {
+	store storage.Storage
+	// presignExpiry is how long the URLs clients are redirected to last
+	presignExpiry time.Duration
+}
+
+func NewAssetController(store storage.Storage, presignExpiry time.Duration) AssetController {
+	return &assetController{store: store, presignExpiry: presignExpiry}
+}
+
+// GET /assets/*filepath
+// Storage that can presign (S3) is downloaded from directly; local files
+// are served by the application.
+func (ctrl *assetController) GetAsset(c *gin.Context) {
+	key := utils.PATH + path.Clean("/"+c.Param("filepath"))
+
+	url, err := ctrl.store.Presign(c.Request.Context(), key, ctrl.presignExpiry)
+	if err == nil {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+	if !errors.Is(err, storage.ErrPresignNotSupported) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	file, err := ctrl.store.Get(c.Request.Context(), key)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	http.ServeContent(c.Writer, c.Request, path.Base(key), file.Info().ModTime, file)
+}
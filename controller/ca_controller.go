@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/PhanPhuc2609/be-sign-file/tsa"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ocsp"
+)
+
+type CAController interface {
+	GetChain(c *gin.Context)
+	GetCRL(c *gin.Context)
+	GetIssuer(c *gin.Context)
+	OCSP(c *gin.Context)
+	Timestamp(c *gin.Context)
+}
+
+type caController struct {
+	service service.CAService
+}
+
+func NewCAController(service service.CAService) CAController {
+	return &caController{service: service}
+}
+
+// GET /api/ca/chain
+func (ctrl *caController) GetChain(c *gin.Context) {
+	chain, err := ctrl.service.ChainPEM(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, "application/pem-certificate-chain", chain)
+}
+
+// GET /api/ca/crl
+func (ctrl *caController) GetCRL(c *gin.Context) {
+	crl, err := ctrl.service.CRL(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "application/pkix-crl", crl)
+}
+
+// GET /api/ca/issuer
+func (ctrl *caController) GetIssuer(c *gin.Context) {
+	der, err := ctrl.service.IssuingCertificate(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "application/pkix-cert", der)
+}
+
+// POST /api/ca/ocsp
+// GET /api/ca/ocsp/*request
+func (ctrl *caController) OCSP(c *gin.Context) {
+	var request []byte
+	if c.Request.Method == http.MethodGet {
+		// RFC 6960 appendix A.1: base64 of the DER request, URL encoded
+		encoded := strings.TrimPrefix(c.Param("request"), "/")
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			c.Data(http.StatusBadRequest, "application/ocsp-response", ocsp.MalformedRequestErrorResponse)
+			return
+		}
+		request = decoded
+	} else {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<10))
+		if err != nil {
+			c.Data(http.StatusBadRequest, "application/ocsp-response", ocsp.MalformedRequestErrorResponse)
+			return
+		}
+		request = body
+	}
+
+	response, err := ctrl.service.OCSPResponse(c.Request.Context(), request)
+	if err != nil {
+		c.Data(http.StatusInternalServerError, "application/ocsp-response", ocsp.InternalErrorErrorResponse)
+		return
+	}
+	c.Data(http.StatusOK, "application/ocsp-response", response)
+}
+
+// POST /api/ca/tsa
+func (ctrl *caController) Timestamp(c *gin.Context) {
+	if c.ContentType() != tsa.ContentTypeQuery {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + tsa.ContentTypeQuery})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<10))
+	if err != nil {
+		c.Data(http.StatusBadRequest, tsa.ContentTypeReply, tsa.ErrorResponse(tsa.FailureBadRequest, "cannot read request"))
+		return
+	}
+
+	response, err := ctrl.service.Timestamp(c.Request.Context(), body)
+	if err != nil {
+		c.Data(http.StatusInternalServerError, tsa.ContentTypeReply, tsa.ErrorResponse(tsa.FailureSystemFailure, "time-stamping failed"))
+		return
+	}
+	c.Data(http.StatusOK, tsa.ContentTypeReply, response)
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/PhanPhuc2609/be-sign-file/ca"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/PhanPhuc2609/be-sign-file/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	CertificateController interface {
+		EnrollCSR(ctx *gin.Context)
+		Revoke(ctx *gin.Context)
+	}
+
+	certificateController struct {
+		userService service.UserService
+		caService   service.CAService
+	}
+)
+
+func NewCertificateController(us service.UserService, cs service.CAService) CertificateController {
+	return &certificateController{
+		userService: us,
+		caService:   cs,
+	}
+}
+
+// POST /api/certificates/csr
+func (c *certificateController) EnrollCSR(ctx *gin.Context) {
+	var req dto.CSREnrollRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		res := utils.BuildResponseFailed(dto.MESSAGE_FAILED_GET_DATA_FROM_BODY, err.Error(), nil)
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, res)
+		return
+	}
+
+	userId := ctx.MustGet("user_id").(string)
+	result, err := c.userService.IssueCertificateFromCSR(ctx.Request.Context(), userId, req.CSR)
+	if err != nil {
+		res := utils.BuildResponseFailed(dto.MESSAGE_FAILED_ENROLL_CERTIFICATE, err.Error(), nil)
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	res := utils.BuildResponseSuccess(dto.MESSAGE_SUCCESS_ENROLL_CERTIFICATE, result)
+	ctx.JSON(http.StatusOK, res)
+}
+
+// POST /api/certificates/:serial/revoke
+func (c *certificateController) Revoke(ctx *gin.Context) {
+	var req dto.RevokeCertificateRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		res := utils.BuildResponseFailed(dto.MESSAGE_FAILED_GET_DATA_FROM_BODY, err.Error(), nil)
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, res)
+		return
+	}
+
+	reason, err := ca.ParseReason(req.Reason)
+	if err != nil {
+		res := utils.BuildResponseFailed(dto.MESSAGE_FAILED_REVOKE_CERTIFICATE, err.Error(), nil)
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, res)
+		return
+	}
+
+	userId := ctx.MustGet("user_id").(string)
+	result, err := c.caService.RevokeCertificate(ctx.Request.Context(), userId, ctx.Param("serial"), reason)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, dto.ErrRevokeForbidden) {
+			status = http.StatusForbidden
+		} else if errors.Is(err, dto.ErrCertificateNotFound) {
+			status = http.StatusNotFound
+		}
+		res := utils.BuildResponseFailed(dto.MESSAGE_FAILED_REVOKE_CERTIFICATE, err.Error(), nil)
+		ctx.JSON(status, res)
+		return
+	}
+
+	res := utils.BuildResponseSuccess(dto.MESSAGE_SUCCESS_REVOKE_CERTIFICATE, result)
+	ctx.JSON(http.StatusOK, res)
+}
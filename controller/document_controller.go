@@ -1,10 +1,16 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 
-	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
 	"github.com/PhanPhuc2609/be-sign-file/service"
 	"github.com/gin-gonic/gin"
 )
@@ -15,14 +21,66 @@ type DocumentController interface {
 	GetDocumentsByUserID(c *gin.Context)
 	DeleteDocument(c *gin.Context)
 	UploadAndVerifyDocument(c *gin.Context)
+	DownloadVerificationReport(c *gin.Context)
+	DownloadContent(c *gin.Context)
+	DownloadSigned(c *gin.Context)
 }
 
 type documentController struct {
 	service service.DocumentService
+	config  config.UploadConfig
 }
 
-func NewDocumentController(service service.DocumentService) DocumentController {
-	return &documentController{service: service}
+func NewDocumentController(service service.DocumentService, config config.UploadConfig) DocumentController {
+	return &documentController{service: service, config: config}
+}
+
+var errNoFile = errors.New("No file is received")
+
+// formFileStream returns the file field of a multipart upload as a reader
+// over the request body, so the upload is never buffered in memory or in a
+// temporary file. The request body is capped at maxSize.
+func formFileStream(c *gin.Context, field string, maxSize int64) (*multipart.Part, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, errNoFile
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errNoFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == field && part.FileName() != "" {
+			return part, nil
+		}
+	}
+}
+
+func isTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+// uploadErrorStatus maps errors of receiving an upload to HTTP statuses.
+func uploadErrorStatus(err error) int {
+	switch {
+	case isTooLarge(err):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errNoFile):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func uploadErrorMessage(err error) string {
+	if isTooLarge(err) {
+		return "File is too large"
+	}
+	return err.Error()
 }
 
 // POST /api/documents/upload
@@ -38,25 +96,15 @@ func (ctrl *documentController) UploadDocument(c *gin.Context) {
 		return
 	}
 
-	file, err := c.FormFile("file")
+	// Ghi file xuống đĩa ngay khi nhận, vừa ghi vừa tính digest
+	file, err := formFileStream(c, "file", ctrl.config.MaxSize)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file is received"})
-		return
-	}
-	uploadPath := "uploads/" + file.Filename
-	if err := c.SaveUploadedFile(file, uploadPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot save file"})
+		c.JSON(uploadErrorStatus(err), gin.H{"error": uploadErrorMessage(err)})
 		return
 	}
-	doc := entity.Document{
-		UserID:   userIDStr,
-		FileName: file.Filename,
-		FilePath: uploadPath,
-		Status:   "uploaded",
-	}
-	createdDoc, err := ctrl.service.CreateDocument(c.Request.Context(), doc)
+	createdDoc, err := ctrl.service.UploadDocument(c.Request.Context(), userIDStr, file.FileName(), file)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(uploadErrorStatus(err), gin.H{"error": uploadErrorMessage(err)})
 		return
 	}
 	c.JSON(http.StatusOK, createdDoc)
@@ -106,24 +154,108 @@ func (ctrl *documentController) UploadAndVerifyDocument(c *gin.Context) {
 		return
 	}
 
-	file, err := c.FormFile("file")
+	file, err := formFileStream(c, "file", ctrl.config.MaxSize)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file is received"})
+		c.JSON(uploadErrorStatus(err), gin.H{"error": uploadErrorMessage(err)})
 		return
 	}
 
-	verified, message, err := ctrl.service.UploadAndVerifyDocumentService(c.Request.Context(), userIDStr, file)
+	result, err := ctrl.service.UploadAndVerifyDocumentService(c.Request.Context(), userIDStr, file.FileName(), file)
+	if isTooLarge(err) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": uploadErrorMessage(err)})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"verified": false, "message": message, "error": err.Error()})
+		c.JSON(http.StatusOK, gin.H{"verified": false, "message": result.Message, "error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"verified": verified, "message": message})
+	c.JSON(http.StatusOK, result)
+}
+
+// POST /api/documents/verify/report
+// Verifies the uploaded file like /verify and returns the report as a
+// signed CMS (.p7m) whose content is the JSON report.
+func (ctrl *documentController) DownloadVerificationReport(c *gin.Context) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userIDStr, ok := userIDVal.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user_id in context"})
+		return
+	}
+
+	file, err := formFileStream(c, "file", ctrl.config.MaxSize)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": uploadErrorMessage(err)})
+		return
+	}
+
+	result, err := ctrl.service.UploadAndVerifyDocumentService(c.Request.Context(), userIDStr, file.FileName(), file)
+	if err != nil && result.ReportID == "" {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": uploadErrorMessage(err)})
+		return
+	}
+	report, err := ctrl.service.SignVerificationReport(c.Request.Context(), result)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "verification-report-"+result.ReportID+".p7m"))
+	c.Data(http.StatusOK, "application/pkcs7-mime", report)
+}
+
+// GET /api/documents/:id/content
+func (ctrl *documentController) DownloadContent(c *gin.Context) {
+	ctrl.serveDocumentFile(c, false)
+}
+
+// GET /api/documents/:id/signed
+func (ctrl *documentController) DownloadSigned(c *gin.Context) {
+	ctrl.serveDocumentFile(c, true)
+}
+
+// serveDocumentFile sends the original or signed file under the original
+// file name. http.ServeContent answers Range, If-Range and If-None-Match
+// against the digest ETag.
+func (ctrl *documentController) serveDocumentFile(c *gin.Context, signed bool) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	file, err := ctrl.service.OpenDocumentFile(c.Request.Context(), userIDStr, uint(id), signed)
+	if errors.Is(err, dto.ErrDocumentNotFound) || errors.Is(err, dto.ErrSignedFileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Content.Close()
+
+	c.Header("Content-Type", file.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}))
+	c.Header("ETag", `"`+file.Digest+`"`)
+	c.Header("Cache-Control", "private, no-cache")
+	http.ServeContent(c.Writer, c.Request, file.Name, file.ModTime, file.Content)
 }
 
 // DELETE /api/documents/:id
 func (ctrl *documentController) DeleteDocument(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
-	err := ctrl.service.DeleteDocument(c.Request.Context(), uint(id))
+	err := ctrl.service.DeleteDocument(c.Request.Context(), userIDStr, uint(id))
+	if errors.Is(err, dto.ErrDocumentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+const VERIFY_HTML = "verify.html"
+
+// PublicVerifyController lets anyone holding a signed file verify it,
+// without an account.
+type PublicVerifyController interface {
+	Verify(c *gin.Context)
+	VerifyPage(c *gin.Context)
+	SubmitVerifyPage(c *gin.Context)
+}
+
+type publicVerifyController struct {
+	service service.DocumentService
+	config  config.PublicVerifyConfig
+}
+
+func NewPublicVerifyController(service service.DocumentService, config config.PublicVerifyConfig) PublicVerifyController {
+	return &publicVerifyController{service: service, config: config}
+}
+
+// POST /api/public/verify
+func (ctrl *publicVerifyController) Verify(c *gin.Context) {
+	result, status, err := ctrl.verify(c)
+	if err != nil && result.ReportID == "" {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GET /verify
+func (ctrl *publicVerifyController) VerifyPage(c *gin.Context) {
+	ctrl.renderPage(c, http.StatusOK, gin.H{})
+}
+
+// POST /verify
+func (ctrl *publicVerifyController) SubmitVerifyPage(c *gin.Context) {
+	result, status, err := ctrl.verify(c)
+	if err != nil && result.ReportID == "" {
+		ctrl.renderPage(c, status, gin.H{"Error": err.Error()})
+		return
+	}
+	ctrl.renderPage(c, http.StatusOK, gin.H{"Result": result})
+}
+
+// verify reads the uploaded "file" field within the size limit and verifies
+// it. On a failed upload the status tells why.
+func (ctrl *publicVerifyController) verify(c *gin.Context) (dto.PublicVerifyResponse, int, error) {
+	file, err := formFileStream(c, "file", ctrl.config.MaxFileSize)
+	if err != nil {
+		return dto.PublicVerifyResponse{}, uploadErrorStatus(err), errors.New(uploadErrorMessage(err))
+	}
+	result, err := ctrl.service.VerifyDocumentPublic(c.Request.Context(), file.FileName(), file)
+	if isTooLarge(err) {
+		return dto.PublicVerifyResponse{}, http.StatusRequestEntityTooLarge, errors.New(uploadErrorMessage(err))
+	}
+	return result, http.StatusOK, err
+}
+
+func (ctrl *publicVerifyController) renderPage(c *gin.Context, status int, data gin.H) {
+	tmpl, err := template.New(VERIFY_HTML).Funcs(template.FuncMap{
+		"time": func(unix int64) string {
+			return time.Unix(unix, 0).UTC().Format("2006-01-02 15:04:05 UTC")
+		},
+		"deref": func(b *bool) bool { return b != nil && *b },
+	}).ParseFiles(VERIFY_HTML)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Cannot load verification page")
+		return
+	}
+	c.Render(status, render.HTML{Template: tmpl, Name: VERIFY_HTML, Data: data})
+}
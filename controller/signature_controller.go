@@ -1,10 +1,17 @@
 package controller
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
+	"github.com/PhanPhuc2609/be-sign-file/cms"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
 	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/hsm"
 	"github.com/PhanPhuc2609/be-sign-file/service"
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +22,11 @@ type SignatureController interface {
 	GetSignaturesByDocumentID(c *gin.Context)
 	DeleteSignature(c *gin.Context)
 	SignString(c *gin.Context)
+	DownloadCMS(c *gin.Context)
+	SignJWS(c *gin.Context)
+	VerifyJWS(c *gin.Context)
+	CounterSign(c *gin.Context)
+	VerifySignatureTree(c *gin.Context)
 }
 
 type signatureController struct {
@@ -37,9 +49,7 @@ func (ctrl *signatureController) CreateSignature(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user_id in context"})
 		return
 	}
-	var req struct {
-		DocumentID uint `json:"document_id" binding:"required"`
-	}
+	var req dto.SignDocumentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -47,10 +57,11 @@ func (ctrl *signatureController) CreateSignature(c *gin.Context) {
 	sig := entity.Signature{
 		DocumentID: req.DocumentID,
 		SignerID:   userIDStr,
+		Algorithm:  req.Algorithm,
 	}
-	createdSig, err := ctrl.service.CreateSignature(c.Request.Context(), sig)
+	createdSig, err := ctrl.service.CreateSignature(c.Request.Context(), sig, req.PIN)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, createdSig)
@@ -67,6 +78,31 @@ func (ctrl *signatureController) GetSignatureByID(c *gin.Context) {
 	c.JSON(http.StatusOK, sig)
 }
 
+// GET /api/signatures/:id/p7s?format=der|pem
+func (ctrl *signatureController) DownloadCMS(c *gin.Context) {
+	userID, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	der, fileName, err := ctrl.service.GetSignatureCMS(c.Request.Context(), userID, uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch c.DefaultQuery("format", "der") {
+	case "der":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName+".p7s"))
+		c.Data(http.StatusOK, "application/pkcs7-signature", der)
+	case "pem":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName+".p7s.pem"))
+		c.Data(http.StatusOK, "application/x-pem-file", cms.EncodePEM(der))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be der or pem"})
+	}
+}
+
 // GET /api/signatures/document/:doc_id
 func (ctrl *signatureController) GetSignaturesByDocumentID(c *gin.Context) {
 	docID, _ := strconv.ParseUint(c.Param("doc_id"), 10, 64)
@@ -101,20 +137,132 @@ func (ctrl *signatureController) SignString(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user_id in context"})
 		return
 	}
-	var req struct {
-		Raw string `json:"raw" binding:"required"`
-	}
+	var req dto.SignStringRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	signature, publicKey, err := ctrl.service.SignString(c.Request.Context(), userIDStr, req.Raw)
+	signature, publicKey, algorithm, err := ctrl.service.SignString(c.Request.Context(), userIDStr, req.Raw, req.Algorithm, req.PIN)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(signingKeyErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"signature":  signature,
 		"public_key": publicKey,
+		"algorithm":  algorithm,
 	})
 }
+
+// POST /api/signatures/jws
+func (ctrl *signatureController) SignJWS(c *gin.Context) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userIDStr, ok := userIDVal.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user_id in context"})
+		return
+	}
+	var req dto.SignJWSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	res, err := ctrl.service.SignJWS(c.Request.Context(), userIDStr, req.Payload, req.Algorithm, req.PIN)
+	if err != nil {
+		c.JSON(signingKeyErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// POST /api/signatures/jws/verify
+func (ctrl *signatureController) VerifyJWS(c *gin.Context) {
+	var req dto.VerifyJWSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// "jws" có thể là chuỗi compact hoặc object JSON
+	token := []byte(req.JWS)
+	if bytes.HasPrefix(bytes.TrimSpace(token), []byte(`"`)) {
+		var compact string
+		if err := json.Unmarshal(token, &compact); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		token = []byte(compact)
+	}
+	res, err := ctrl.service.VerifyJWS(c.Request.Context(), token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"verified": false,
+			"message":  res.Message,
+			"error":    err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// POST /api/signatures/:id/countersign
+func (ctrl *signatureController) CounterSign(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	var req dto.CounterSignRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	sig, err := ctrl.service.CounterSign(c.Request.Context(), uint(id), userIDStr, req.Algorithm, req.PIN)
+	if err != nil {
+		status := signingKeyErrorStatus(err, http.StatusInternalServerError)
+		if errors.Is(err, dto.ErrSignatureNotFound) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, dto.ErrCounterSignOwnSignature) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sig)
+}
+
+// GET /api/signatures/:id/verify
+func (ctrl *signatureController) VerifySignatureTree(c *gin.Context) {
+	userID, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	tree, err := ctrl.service.VerifySignatureTree(c.Request.Context(), userID, uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tree)
+}
+
+// signingKeyErrorStatus maps the errors of unlocking the signer's key from
+// the vault, other errors get fallback.
+func signingKeyErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, dto.ErrKeyPINRequired), errors.Is(err, dto.ErrKeyPINTooShort), errors.Is(err, dto.ErrKeyProtectionRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, dto.ErrWrongKeyPIN):
+		return http.StatusForbidden
+	case errors.Is(err, dto.ErrKeyLocked):
+		return http.StatusLocked
+	case errors.Is(err, dto.ErrNoSigningKey), errors.Is(err, hsm.ErrKeyNotFound):
+		return http.StatusConflict
+	case errors.Is(err, dto.ErrKeyBackendUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return fallback
+}
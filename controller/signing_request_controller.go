@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/gin-gonic/gin"
+)
+
+type SigningRequestController interface {
+	CreateSigningRequest(c *gin.Context)
+	GetSigningRequestByID(c *gin.Context)
+	GetSigningRequestsByDocumentID(c *gin.Context)
+	GetPendingTasks(c *gin.Context)
+	Sign(c *gin.Context)
+	Decline(c *gin.Context)
+	Cancel(c *gin.Context)
+}
+
+type signingRequestController struct {
+	service service.SigningRequestService
+}
+
+func NewSigningRequestController(service service.SigningRequestService) SigningRequestController {
+	return &signingRequestController{service: service}
+}
+
+// workflowErrorStatus maps signing request errors to HTTP statuses.
+func workflowErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, dto.ErrSigningRequestNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, dto.ErrSigningRequestForbidden), errors.Is(err, dto.ErrNotParticipant):
+		return http.StatusForbidden
+	case errors.Is(err, dto.ErrSigningRequestActive), errors.Is(err, dto.ErrSigningRequestClosed), errors.Is(err, dto.ErrNotYourTurn):
+		return http.StatusConflict
+	case errors.Is(err, dto.ErrDuplicateSigner):
+		return http.StatusBadRequest
+	}
+	return signingKeyErrorStatus(err, http.StatusInternalServerError)
+}
+
+// POST /api/signing-requests
+func (ctrl *signingRequestController) CreateSigningRequest(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	var req dto.CreateSigningRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request, err := ctrl.service.CreateSigningRequest(c.Request.Context(), userIDStr, req)
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, request)
+}
+
+// GET /api/signing-requests/:id
+func (ctrl *signingRequestController) GetSigningRequestByID(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	request, err := ctrl.service.GetSigningRequestByID(c.Request.Context(), userIDStr, uint(id))
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, request)
+}
+
+// GET /api/signing-requests/document/:doc_id
+func (ctrl *signingRequestController) GetSigningRequestsByDocumentID(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	docID, _ := strconv.ParseUint(c.Param("doc_id"), 10, 64)
+	requests, err := ctrl.service.GetSigningRequestsByDocumentID(c.Request.Context(), userIDStr, uint(docID))
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, requests)
+}
+
+// GET /api/signing-requests/tasks
+func (ctrl *signingRequestController) GetPendingTasks(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	requests, err := ctrl.service.GetPendingTasks(c.Request.Context(), userIDStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, requests)
+}
+
+// POST /api/signing-requests/:id/sign
+func (ctrl *signingRequestController) Sign(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	var req dto.SignTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	sig, err := ctrl.service.Sign(c.Request.Context(), uint(id), userIDStr, req.Algorithm, req.PIN)
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sig)
+}
+
+// POST /api/signing-requests/:id/decline
+func (ctrl *signingRequestController) Decline(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	var req dto.DeclineTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	request, err := ctrl.service.Decline(c.Request.Context(), uint(id), userIDStr, req.Reason)
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, request)
+}
+
+// POST /api/signing-requests/:id/cancel
+func (ctrl *signingRequestController) Cancel(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	request, err := ctrl.service.Cancel(c.Request.Context(), uint(id), userIDStr)
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, request)
+}
+
+// contextUserID returns the authenticated user, answering the request
+// itself when there is none.
+func contextUserID(c *gin.Context) (string, bool) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return "", false
+	}
+	userIDStr, ok := userIDVal.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user_id in context"})
+		return "", false
+	}
+	return userIDStr, true
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/gin-gonic/gin"
+)
+
+// UploadController serves resumable uploads following the tus 1.0 protocol
+// with the creation, expiration and termination extensions.
+type UploadController interface {
+	Options(c *gin.Context)
+	CreateUpload(c *gin.Context)
+	HeadUpload(c *gin.Context)
+	PatchUpload(c *gin.Context)
+	DeleteUpload(c *gin.Context)
+	TusResumable() gin.HandlerFunc
+}
+
+type uploadController struct {
+	service service.UploadService
+	config  config.UploadConfig
+}
+
+func NewUploadController(service service.UploadService, config config.UploadConfig) UploadController {
+	return &uploadController{service: service, config: config}
+}
+
+// TusResumable rejects requests made with another version of the protocol.
+// OPTIONS is how clients discover the version, so it is let through.
+func (ctrl *uploadController) TusResumable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", dto.TUS_VERSION)
+		if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != dto.TUS_VERSION {
+			c.Header("Tus-Version", dto.TUS_VERSION)
+			c.AbortWithStatus(http.StatusPreconditionFailed)
+			return
+		}
+		c.Next()
+	}
+}
+
+// OPTIONS /api/uploads
+func (ctrl *uploadController) Options(c *gin.Context) {
+	c.Header("Tus-Version", dto.TUS_VERSION)
+	c.Header("Tus-Extension", dto.TUS_EXTENSIONS)
+	c.Header("Tus-Max-Size", strconv.FormatInt(ctrl.config.MaxSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// POST /api/uploads
+func (ctrl *uploadController) CreateUpload(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length is required"})
+		return
+	}
+	upload, err := ctrl.service.CreateUpload(c.Request.Context(), userIDStr, length, c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(uploadStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	writeUploadHeaders(c, upload)
+	c.Status(http.StatusCreated)
+}
+
+// HEAD /api/uploads/:id
+func (ctrl *uploadController) HeadUpload(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	upload, err := ctrl.service.ResumeUpload(c.Request.Context(), userIDStr, c.Param("id"))
+	if err != nil {
+		c.Status(uploadStatus(err))
+		return
+	}
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	c.Header("Cache-Control", "no-store")
+	writeUploadHeaders(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// PATCH /api/uploads/:id
+func (ctrl *uploadController) PatchUpload(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/offset+octet-stream"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset is required"})
+		return
+	}
+	upload, err := ctrl.service.WriteChunk(c.Request.Context(), userIDStr, c.Param("id"), offset, c.Request.Body)
+	if err != nil {
+		if upload.ID != "" {
+			writeUploadHeaders(c, upload)
+		}
+		c.JSON(uploadStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	writeUploadHeaders(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+// DELETE /api/uploads/:id
+func (ctrl *uploadController) DeleteUpload(c *gin.Context) {
+	userIDStr, ok := contextUserID(c)
+	if !ok {
+		return
+	}
+	if err := ctrl.service.TerminateUpload(c.Request.Context(), userIDStr, c.Param("id")); err != nil {
+		c.JSON(uploadStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// writeUploadHeaders sets the offset and expiration of an upload, and the
+// document it became once complete.
+func writeUploadHeaders(c *gin.Context, upload entity.Upload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.DocumentID != nil {
+		c.Header("X-Document-ID", strconv.FormatUint(uint64(*upload.DocumentID), 10))
+	}
+}
+
+// uploadStatus maps upload errors to the statuses the tus protocol expects.
+func uploadStatus(err error) int {
+	switch {
+	case errors.Is(err, dto.ErrUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, dto.ErrUploadOffsetMismatch):
+		return http.StatusConflict
+	case errors.Is(err, dto.ErrUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, dto.ErrUploadNoFileName):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -20,6 +20,7 @@ type (
 		VerifyEmail(ctx *gin.Context)
 		Update(ctx *gin.Context)
 		Delete(ctx *gin.Context)
+		CreateCertificate(ctx *gin.Context)
 	}
 
 	userController struct {
@@ -199,3 +200,36 @@ func (c *userController) Refresh(ctx *gin.Context) {
 	res := utils.BuildResponseSuccess(dto.MESSAGE_SUCCESS_REFRESH_TOKEN, result)
 	ctx.JSON(http.StatusOK, res)
 }
+
+func (c *userController) CreateCertificate(ctx *gin.Context) {
+	var req dto.UserCertificateRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBind(&req); err != nil {
+			res := utils.BuildResponseFailed(dto.MESSAGE_FAILED_GET_DATA_FROM_BODY, err.Error(), nil)
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, res)
+			return
+		}
+	}
+
+	userId := ctx.MustGet("user_id").(string)
+
+	user, err := c.userService.GetUserById(ctx.Request.Context(), userId)
+	if err != nil {
+		res := utils.BuildResponseFailed(dto.MESSAGE_FAILED_GET_USER, err.Error(), nil)
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	certPEM, pubPEM, err := c.userService.CreateUserCertificate(ctx.Request.Context(), user.ID, user.Email, user.Name, req.KeyType, req.KeyBackend, req.PIN)
+	if err != nil {
+		res := utils.BuildResponseFailed(dto.MESSAGE_FAILED_CREATE_CERTIFICATE, err.Error(), nil)
+		ctx.JSON(http.StatusBadRequest, res)
+		return
+	}
+
+	res := utils.BuildResponseSuccess(dto.MESSAGE_SUCCESS_CREATE_CERTIFICATE, dto.UserCertificateResponse{
+		CertPEM: certPEM,
+		PubPEM:  pubPEM,
+	})
+	ctx.JSON(http.StatusOK, res)
+}
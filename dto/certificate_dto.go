@@ -0,0 +1,51 @@
+package dto
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// Failed
+	MESSAGE_FAILED_ENROLL_CERTIFICATE = "failed enroll certificate"
+	MESSAGE_FAILED_REVOKE_CERTIFICATE = "failed revoke certificate"
+
+	// Success
+	MESSAGE_SUCCESS_ENROLL_CERTIFICATE = "success enroll certificate"
+	MESSAGE_SUCCESS_REVOKE_CERTIFICATE = "success revoke certificate"
+)
+
+var (
+	ErrInvalidCSR          = errors.New("invalid CSR PEM")
+	ErrCSRSignatureInvalid = errors.New("CSR signature invalid")
+	ErrCSRIdentityMismatch = errors.New("CSR subject or email does not match the current user")
+	ErrCertificateNotFound = errors.New("certificate not found")
+	ErrCertificateRevoked  = errors.New("certificate already revoked")
+	ErrRevokeForbidden     = errors.New("only the certificate owner or an admin can revoke it")
+)
+
+type (
+	CSREnrollRequest struct {
+		CSR string `json:"csr" form:"csr" binding:"required"`
+	}
+
+	RevokeCertificateRequest struct {
+		Reason string `json:"reason" form:"reason"`
+	}
+
+	CertificateStatusResponse struct {
+		Serial           string     `json:"serial"`
+		Status           string     `json:"status"`
+		RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+		RevocationReason string     `json:"revocation_reason,omitempty"`
+	}
+
+	CertificateEnrollResponse struct {
+		Serial      string    `json:"serial"`
+		Fingerprint string    `json:"fingerprint"`
+		NotBefore   time.Time `json:"not_before"`
+		NotAfter    time.Time `json:"not_after"`
+		CertPEM     string    `json:"cert_pem"`
+		ChainPEM    string    `json:"chain_pem"`
+	}
+)
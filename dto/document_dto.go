@@ -1,5 +1,16 @@
 package dto
 
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrDocumentNotFound   = errors.New("document not found")
+	ErrSignedFileNotFound = errors.New("document has not been signed yet")
+)
+
 type UploadDocumentRequest struct {
 	FileName string `json:"file_name" binding:"required"`
 	FileData []byte `json:"file_data" binding:"required"`
@@ -13,3 +24,119 @@ type DocumentResponse struct {
 	Digest   string `json:"digest"`
 	Status   string `json:"status"`
 }
+
+// DocumentFile is an opened original or signed file of a document, ready to
+// be served. The caller closes Content.
+type DocumentFile struct {
+	Content     io.ReadSeekCloser
+	Name        string
+	ContentType string
+	ModTime     time.Time
+	Size        int64
+	Digest      string // SHA-256 hex của nội dung, dùng làm ETag
+}
+
+// Kết luận chung của báo cáo xác minh
+const (
+	VERDICT_VALID         = "valid"
+	VERDICT_INVALID       = "invalid"
+	VERDICT_INDETERMINATE = "indeterminate" // chữ ký nguyên vẹn nhưng chưa xác lập được chuỗi tin cậy
+)
+
+// Nguồn của một chữ ký trong báo cáo
+const (
+	SIGNATURE_SOURCE_FILE     = "file"
+	SIGNATURE_SOURCE_DATABASE = "database"
+)
+
+// Trạng thái thu hồi chứng chỉ người ký
+const (
+	REVOCATION_GOOD    = "good"
+	REVOCATION_REVOKED = "revoked"
+	REVOCATION_UNKNOWN = "unknown" // chứng chỉ không do CA của hệ thống cấp
+)
+
+// VerifyDocumentResponse là báo cáo xác minh một file
+type VerifyDocumentResponse struct {
+	ReportID    string `json:"report_id,omitempty"`
+	GeneratedAt int64  `json:"generated_at,omitempty"`
+	FileName    string `json:"file_name,omitempty"`
+	FileDigest  string `json:"file_digest,omitempty"` // SHA-256 của file được tải lên
+	Format      string `json:"format,omitempty"`      // pdf, xml hoặc marker
+	DocumentID  *uint  `json:"document_id,omitempty"` // tài liệu tương ứng trong hệ thống, nếu tìm thấy
+	Verdict     string `json:"verdict,omitempty"`
+	Verified    bool   `json:"verified"`
+	Message     string `json:"message"`
+	// Chỉ có với file PDF
+	ModifiedAfterLastSignature *bool `json:"modified_after_last_signature,omitempty"`
+	// Chữ ký trong file và các bản ghi chữ ký của tài liệu trong hệ thống
+	Signatures []SignatureCheckResult `json:"signatures,omitempty"`
+}
+
+type SignatureCheckResult struct {
+	Source          string  `json:"source,omitempty"`
+	SignatureID     *uint   `json:"signature_id,omitempty"` // bản ghi chữ ký trong hệ thống
+	ParentID        *uint   `json:"parent_id,omitempty"`    // chữ ký được đối chứng
+	Field           string  `json:"field,omitempty"`
+	SignerName      string  `json:"signer_name,omitempty"`
+	Reason          string  `json:"reason,omitempty"`
+	Location        string  `json:"location,omitempty"`
+	SubFilter       string  `json:"sub_filter,omitempty"`
+	Algorithm       string  `json:"algorithm,omitempty"`
+	SignatureMethod string  `json:"signature_method,omitempty"`
+	SigningTime     int64   `json:"signing_time,omitempty"`
+	Timestamp       int64   `json:"timestamp,omitempty"` // time proven by the RFC 3161 token
+	ByteRange       []int64 `json:"byte_range,omitempty"`
+	// CoversDocument: chữ ký phủ nội dung file được tải lên
+	CoversDocument bool   `json:"covers_document"`
+	SignerSubject  string `json:"signer_subject,omitempty"`
+	SignerIssuer   string `json:"signer_issuer,omitempty"`
+	SignerSerial   string `json:"signer_serial,omitempty"`
+	// Thời điểm dùng để đánh giá chứng chỉ: dấu thời gian, thời điểm ký hoặc hiện tại
+	ValidationTime   int64  `json:"validation_time,omitempty"`
+	CertNotBefore    int64  `json:"cert_not_before,omitempty"`
+	CertNotAfter     int64  `json:"cert_not_after,omitempty"`
+	CertificateValid bool   `json:"certificate_valid"`
+	RevocationStatus string `json:"revocation_status,omitempty"`
+	RevokedAt        int64  `json:"revoked_at,omitempty"`
+	DigestValid      bool   `json:"digest_valid"`
+	SignatureValid   bool   `json:"signature_valid"`
+	ChainValid       bool   `json:"chain_valid"`
+	TimestampValid   *bool  `json:"timestamp_valid,omitempty"`
+	Valid            bool   `json:"valid"`
+	Error            string `json:"error,omitempty"`
+}
+
+// PublicVerifyResponse là báo cáo xác minh cho người không có tài khoản: chỉ
+// gồm thông tin không nhạy cảm về chữ ký
+type PublicVerifyResponse struct {
+	ReportID    string `json:"report_id,omitempty"`
+	GeneratedAt int64  `json:"generated_at,omitempty"`
+	FileName    string `json:"file_name,omitempty"`
+	FileDigest  string `json:"file_digest,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Verdict     string `json:"verdict,omitempty"`
+	Verified    bool   `json:"verified"`
+	Message     string `json:"message"`
+	// RegisteredDocument: nội dung khớp một tài liệu được ký trong hệ thống
+	RegisteredDocument         bool                    `json:"registered_document"`
+	ModifiedAfterLastSignature *bool                   `json:"modified_after_last_signature,omitempty"`
+	Signatures                 []PublicSignatureResult `json:"signatures,omitempty"`
+}
+
+type PublicSignatureResult struct {
+	Source           string `json:"source"`
+	CounterSignature bool   `json:"counter_signature"`
+	SignerName       string `json:"signer_name,omitempty"`
+	Algorithm        string `json:"algorithm,omitempty"`
+	SigningTime      int64  `json:"signing_time,omitempty"`
+	Timestamp        int64  `json:"timestamp,omitempty"`
+	CoversDocument   bool   `json:"covers_document"`
+	CertificateValid bool   `json:"certificate_valid"`
+	RevocationStatus string `json:"revocation_status,omitempty"`
+	DigestValid      bool   `json:"digest_valid"`
+	SignatureValid   bool   `json:"signature_valid"`
+	ChainValid       bool   `json:"chain_valid"`
+	TimestampValid   *bool  `json:"timestamp_valid,omitempty"`
+	Valid            bool   `json:"valid"`
+}
@@ -0,0 +1,14 @@
+package dto
+
+import "errors"
+
+var (
+	ErrNoSigningKey          = errors.New("signer has no signing key in the vault")
+	ErrKeyPINRequired        = errors.New("the PIN of the signing key is required")
+	ErrKeyPINTooShort        = errors.New("the PIN of the signing key must have at least 6 characters")
+	ErrWrongKeyPIN           = errors.New("wrong PIN for the signing key")
+	ErrKeyLocked             = errors.New("signing key locked after too many wrong PINs, try again later")
+	ErrKeyProtectionRequired = errors.New("no master key is configured: a PIN is required to protect the signing key")
+	ErrKeyBackendUnavailable = errors.New("no PKCS#11 token is configured for signing keys")
+	ErrKeyPINNotSupported    = errors.New("keys in the PKCS#11 token are protected by the token, not by a PIN")
+)
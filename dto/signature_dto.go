@@ -1,7 +1,27 @@
 package dto
 
+import (
+	"encoding/json"
+	"errors"
+)
+
+var (
+	ErrSignatureNotFound       = errors.New("signature not found")
+	ErrCounterSignOwnSignature = errors.New("a signer cannot countersign their own signature")
+)
+
 type SignDocumentRequest struct {
-	Algorithm string `json:"algorithm" binding:"required"`
+	DocumentID uint   `json:"document_id" binding:"required"`
+	Algorithm  string `json:"algorithm" binding:"omitempty,oneof=RSA-PSS-SHA256 RSA-SHA256 ECDSA-SHA256 ECDSA-SHA384 Ed25519"`
+	// PIN mở khóa riêng, chỉ cần khi khóa được bảo vệ bằng PIN
+	PIN string `json:"pin" binding:"max=128"`
+}
+
+type SignStringRequest struct {
+	Raw string `json:"raw" binding:"required"`
+	// Mặc định RSA-PSS-SHA256 với khóa RSA; RSA-SHA256 (PKCS#1 v1.5) chỉ khi client yêu cầu
+	Algorithm string `json:"algorithm" binding:"omitempty,oneof=RSA-PSS-SHA256 RSA-SHA256 ECDSA-SHA256 ECDSA-SHA384 Ed25519"`
+	PIN       string `json:"pin" binding:"max=128"`
 }
 
 type SignatureResponse struct {
@@ -12,3 +32,64 @@ type SignatureResponse struct {
 	Algorithm    string `json:"algorithm"`
 	SignedAt     int64  `json:"signed_at"`
 }
+
+type SignJWSRequest struct {
+	Payload   json.RawMessage `json:"payload" binding:"required"`
+	Algorithm string          `json:"algorithm" binding:"omitempty,oneof=RSA-PSS-SHA256 RSA-SHA256 ECDSA-SHA256 ECDSA-SHA384 Ed25519"`
+	PIN       string          `json:"pin" binding:"max=128"`
+}
+
+type SignJWSResponse struct {
+	Compact     string          `json:"compact"`
+	JSON        json.RawMessage `json:"json"`
+	Algorithm   string          `json:"algorithm"`
+	SigningTime int64           `json:"signing_time"`
+	CertSerial  string          `json:"cert_serial"`
+}
+
+type VerifyJWSRequest struct {
+	// Chuỗi compact hoặc object JWS JSON (flattened/general)
+	JWS json.RawMessage `json:"jws" binding:"required"`
+}
+
+type VerifyJWSResponse struct {
+	Verified   bool                 `json:"verified"`
+	Message    string               `json:"message"`
+	Payload    json.RawMessage      `json:"payload,omitempty"`
+	Signatures []JWSSignatureResult `json:"signatures,omitempty"`
+}
+
+type JWSSignatureResult struct {
+	Algorithm      string `json:"algorithm"`
+	SigningTime    int64  `json:"signing_time,omitempty"`
+	SignerName     string `json:"signer_name,omitempty"`
+	SignerSubject  string `json:"signer_subject,omitempty"`
+	SignerIssuer   string `json:"signer_issuer,omitempty"`
+	SignerSerial   string `json:"signer_serial,omitempty"`
+	SignatureValid bool   `json:"signature_valid"`
+	ChainValid     bool   `json:"chain_valid"`
+	Valid          bool   `json:"valid"`
+	Error          string `json:"error,omitempty"`
+}
+
+type CounterSignRequest struct {
+	Algorithm string `json:"algorithm" binding:"omitempty,oneof=RSA-PSS-SHA256 RSA-SHA256 ECDSA-SHA256 ECDSA-SHA384 Ed25519"`
+	PIN       string `json:"pin" binding:"max=128"`
+}
+
+// SignatureTreeNode là kết quả xác minh một chữ ký và các chữ ký đối chứng của nó
+type SignatureTreeNode struct {
+	ID            uint   `json:"id"`
+	ParentID      *uint  `json:"parent_id,omitempty"`
+	SignerID      string `json:"signer_id"`
+	SignerName    string `json:"signer_name,omitempty"`
+	Algorithm     string `json:"algorithm"`
+	SignedAt      int64  `json:"signed_at"`
+	TimestampedAt int64  `json:"timestamped_at,omitempty"`
+	CertSerial    string `json:"cert_serial"`
+	Valid         bool   `json:"valid"`
+	// Kết quả kiểm tra SignerInfo tương ứng trong file .p7s, nếu có
+	CMSValid          *bool               `json:"cms_valid,omitempty"`
+	Error             string              `json:"error,omitempty"`
+	CounterSignatures []SignatureTreeNode `json:"counter_signatures,omitempty"`
+}
@@ -0,0 +1,32 @@
+package dto
+
+import "errors"
+
+var (
+	ErrSigningRequestNotFound  = errors.New("signing request not found")
+	ErrSigningRequestActive    = errors.New("document already has an active signing request")
+	ErrSigningRequestClosed    = errors.New("signing request is no longer in progress")
+	ErrSigningRequestForbidden = errors.New("only the document owner can manage its signing requests")
+	ErrDuplicateSigner         = errors.New("a signer can only be listed once")
+	ErrNotParticipant          = errors.New("user is not a signer of this request")
+	ErrNotYourTurn             = errors.New("it is not this signer's turn to sign")
+)
+
+type (
+	CreateSigningRequestRequest struct {
+		DocumentID uint   `json:"document_id" binding:"required"`
+		Order      string `json:"order" binding:"omitempty,oneof=sequential parallel"`
+		// Người ký theo thứ tự; với "sequential" người sau chỉ ký khi người trước đã ký
+		SignerIDs []string `json:"signer_ids" binding:"required,min=1,dive,uuid"`
+		Message   string   `json:"message"`
+	}
+
+	SignTaskRequest struct {
+		Algorithm string `json:"algorithm" binding:"omitempty,oneof=RSA-PSS-SHA256 RSA-SHA256 ECDSA-SHA256 ECDSA-SHA384 Ed25519"`
+		PIN       string `json:"pin" binding:"max=128"`
+	}
+
+	DeclineTaskRequest struct {
+		Reason string `json:"reason"`
+	}
+)
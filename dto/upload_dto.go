@@ -0,0 +1,16 @@
+package dto
+
+import "errors"
+
+// Phiên bản giao thức tus được hỗ trợ
+const (
+	TUS_VERSION    = "1.0.0"
+	TUS_EXTENSIONS = "creation,expiration,termination"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadTooLarge       = errors.New("upload exceeds the maximum size")
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match")
+	ErrUploadNoFileName     = errors.New("upload metadata must include a filename")
+)
@@ -21,6 +21,7 @@ const (
 	MESSAGE_FAILED_PROSES_REQUEST     = "failed proses request"
 	MESSAGE_FAILED_DENIED_ACCESS      = "denied access"
 	MESSAGE_FAILED_VERIFY_EMAIL       = "failed verify email"
+	MESSAGE_FAILED_CREATE_CERTIFICATE = "failed create certificate"
 
 	// Success
 	MESSAGE_SUCCESS_REGISTER_USER           = "success create user"
@@ -31,6 +32,7 @@ const (
 	MESSAGE_SUCCESS_DELETE_USER             = "success delete user"
 	MESSAGE_SEND_VERIFICATION_EMAIL_SUCCESS = "success send verification email"
 	MESSAGE_SUCCESS_VERIFY_EMAIL            = "success verify email"
+	MESSAGE_SUCCESS_CREATE_CERTIFICATE      = "success create certificate"
 )
 
 var (
@@ -104,6 +106,19 @@ type (
 		IsVerified bool   `json:"is_verified"`
 	}
 
+	UserCertificateRequest struct {
+		KeyType string `json:"key_type" form:"key_type" binding:"omitempty,oneof=RSA-2048 RSA-3072 ECDSA-P256 ECDSA-P384 Ed25519"`
+		// PIN bảo vệ khóa riêng; bỏ trống thì khóa được bọc bằng master key
+		PIN string `json:"pin" form:"pin" binding:"omitempty,min=6,max=128"`
+		// pkcs11: khóa được sinh và giữ trong HSM, không bao giờ rời khỏi token
+		KeyBackend string `json:"key_backend" form:"key_backend" binding:"omitempty,oneof=software pkcs11"`
+	}
+
+	UserCertificateResponse struct {
+		CertPEM string `json:"cert_pem"`
+		PubPEM  string `json:"pub_pem"`
+	}
+
 	UserLoginRequest struct {
 		Email    string `json:"email" form:"email" binding:"required"`
 		Password string `json:"password" form:"password" binding:"required"`
@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+// Blob is the stored content of documents, kept once per SHA-256 digest
+// whatever the file names and owners. RefCount is the number of document
+// rows, deleted or not, that point to it; the content is removed from
+// storage once the last of them is purged.
+type Blob struct {
+	Digest   string `gorm:"primaryKey" json:"digest"`
+	Size     int64  `gorm:"not null" json:"size"`
+	RefCount int64  `gorm:"not null;index" json:"ref_count"`
+
+	CreatedAt time.Time `gorm:"type:timestamp with time zone" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:timestamp with time zone" json:"updated_at"`
+}
@@ -0,0 +1,27 @@
+package entity
+
+import "time"
+
+// Certificate records every certificate issued by the platform CA so serial
+// numbers stay unique and can later be looked up for status checks.
+type Certificate struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	Serial           string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"serial"`
+	Fingerprint      string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"fingerprint"`
+	UserID           string     `gorm:"type:varchar(36);index" json:"user_id"`
+	Profile          string     `gorm:"type:varchar(32);not null" json:"profile"`
+	Subject          string     `gorm:"type:varchar(255)" json:"subject"`
+	Issuer           string     `gorm:"type:varchar(255)" json:"issuer"`
+	NotBefore        time.Time  `gorm:"type:timestamp with time zone" json:"not_before"`
+	NotAfter         time.Time  `gorm:"type:timestamp with time zone" json:"not_after"`
+	CertPEM          string     `gorm:"type:text" json:"cert_pem"`
+	Status           string     `gorm:"type:varchar(16);not null;default:'good';index" json:"status"`
+	RevokedAt        *time.Time `gorm:"type:timestamp with time zone" json:"revoked_at,omitempty"`
+	RevocationReason int        `gorm:"default:0" json:"revocation_reason"`
+
+	Timestamp
+}
+
+func (c Certificate) IsRevoked() bool {
+	return c.RevokedAt != nil
+}
@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// DataKey is the key an encrypted object is sealed with, wrapped by the
+// master key MasterKeyID. It is deleted for good with its object.
+type DataKey struct {
+	ID          string `gorm:"type:uuid;primaryKey" json:"id"`
+	WrappedKey  []byte `gorm:"type:bytea;not null" json:"-"`
+	MasterKeyID string `gorm:"type:varchar(16);index;not null" json:"master_key_id"`
+
+	CreatedAt time.Time `gorm:"type:timestamp with time zone" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:timestamp with time zone" json:"updated_at"`
+}
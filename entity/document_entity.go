@@ -10,5 +10,7 @@ type Document struct {
 	FileName string `json:"file_name"`
 	FilePath string `json:"file_path"`
 	Digest   string `json:"digest"`
-	Status   string `json:"status"` // uploaded, signed, etc.
+	Status   string `json:"status"` // uploaded, signed, pending_signatures, partially_signed, completed, declined
+	// SHA-256 của file đã ký hiện tại, dùng làm ETag; cập nhật sau mỗi lần ký
+	SignedDigest string `json:"signed_digest,omitempty"`
 }
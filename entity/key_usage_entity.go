@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// KeyUsage is the audit entry written each time a private key is unlocked
+// to sign, including the attempts that failed. KeyID is a vault key, or
+// "ca:issuing" for the issuing CA.
+type KeyUsage struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	KeyID     string `gorm:"type:varchar(64);index;not null" json:"key_id"`
+	UserID    string `gorm:"type:varchar(36);index" json:"user_id"`
+	Purpose   string `gorm:"type:varchar(32);not null" json:"purpose"`
+	Reference string `gorm:"type:varchar(100)" json:"reference,omitempty"`
+	Success   bool   `gorm:"not null" json:"success"`
+
+	CreatedAt time.Time `gorm:"type:timestamp with time zone;index" json:"created_at"`
+}
@@ -4,12 +4,19 @@ import "gorm.io/gorm"
 
 type Signature struct {
 	gorm.Model
-	DocumentID   uint      `json:"document_id"`
-	Document     Document  `json:"document"`
-	SignerID     string    `json:"signer_id"`
-	Signer       User      `json:"signer"`
-	SignatureRaw string    `json:"signature_raw"`
-	Algorithm    string    `json:"algorithm"`
-	SignedAt     int64     `json:"signed_at"`
-	PrivateKey   string    `json:"private_key"`
+	DocumentID      uint     `json:"document_id"`
+	Document        Document `json:"document"`
+	ParentID        *uint    `gorm:"index" json:"parent_id,omitempty"` // set on a counter-signature, the signature it countersigns
+	SignerID        string   `json:"signer_id"`
+	Signer          User     `json:"signer"`
+	SignatureRaw    string   `json:"signature_raw"`
+	Algorithm       string   `json:"algorithm"`
+	SaltLength      int      `json:"salt_length,omitempty"`
+	SignedAt        int64    `json:"signed_at"`
+	CertSerial      string   `gorm:"type:varchar(64);index" json:"cert_serial"`
+	CertFingerprint string   `gorm:"type:varchar(64);index" json:"cert_fingerprint"`
+	PublicKey       string   `gorm:"type:text" json:"public_key,omitempty"` // PEM public key of a signature made with a one-off key, before signers had certificates
+	CMS             []byte   `gorm:"type:bytea" json:"-"`                   // detached CMS SignedData (.p7s) over the file, the counterSignature SignerInfo for a counter-signature
+	TimestampToken  []byte   `gorm:"type:bytea" json:"-"`                   // RFC 3161 token over the signature value
+	TimestampedAt   int64    `json:"timestamped_at,omitempty"`
 }
@@ -0,0 +1,155 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+)
+
+// SigningRequest is a document owner's list of required signers. In
+// sequential order only the signer at the lowest unsigned position has a
+// pending task; in parallel order every signer does from the start.
+type SigningRequest struct {
+	ID           uint                 `gorm:"primaryKey" json:"id"`
+	DocumentID   uint                 `gorm:"index;not null" json:"document_id"`
+	Document     Document             `json:"document"`
+	OwnerID      string               `gorm:"type:varchar(36);index;not null" json:"owner_id"`
+	Order        string               `gorm:"type:varchar(16);not null" json:"order"`
+	Status       string               `gorm:"type:varchar(16);not null;index" json:"status"`
+	Message      string               `gorm:"type:text" json:"message,omitempty"`
+	CompletedAt  *time.Time           `gorm:"type:timestamp with time zone" json:"completed_at,omitempty"`
+	Participants []SigningParticipant `gorm:"constraint:OnDelete:CASCADE" json:"participants"`
+
+	Timestamp
+}
+
+// SigningParticipant is one required signer of a request and their task.
+type SigningParticipant struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	SigningRequestID uint       `gorm:"index;not null" json:"signing_request_id"`
+	SignerID         string     `gorm:"type:uuid;index;not null" json:"signer_id"`
+	Signer           User       `json:"signer"`
+	Position         int        `gorm:"not null" json:"position"`
+	Status           string     `gorm:"type:varchar(16);not null;index" json:"status"`
+	SignatureID      *uint      `json:"signature_id,omitempty"`
+	DeclineReason    string     `gorm:"type:text" json:"decline_reason,omitempty"`
+	ActedAt          *time.Time `gorm:"type:timestamp with time zone" json:"acted_at,omitempty"`
+
+	Timestamp
+}
+
+// IsActive reports whether the request still waits for signatures.
+func (r *SigningRequest) IsActive() bool {
+	return r.Status == constants.ENUM_SIGNING_REQUEST_IN_PROGRESS
+}
+
+// Participant returns the participant entry of signerID, or nil.
+func (r *SigningRequest) Participant(signerID string) *SigningParticipant {
+	for i := range r.Participants {
+		if r.Participants[i].SignerID == signerID {
+			return &r.Participants[i]
+		}
+	}
+	return nil
+}
+
+// CanSign reports whether signerID has a pending task in an active request.
+func (r *SigningRequest) CanSign(signerID string) bool {
+	p := r.Participant(signerID)
+	return r.IsActive() && p != nil && p.Status == constants.ENUM_PARTICIPANT_PENDING
+}
+
+// Start puts the request in progress and opens the first tasks.
+func (r *SigningRequest) Start() {
+	r.Status = constants.ENUM_SIGNING_REQUEST_IN_PROGRESS
+	for i := range r.Participants {
+		r.Participants[i].Status = constants.ENUM_PARTICIPANT_WAITING
+	}
+	r.openTasks()
+}
+
+// RecordSignature marks the task of signerID as signed by signature
+// signatureID and opens the next tasks, completing the request when no
+// unsigned participant is left. The caller checks CanSign first.
+func (r *SigningRequest) RecordSignature(signerID string, signatureID uint, at time.Time) {
+	p := r.Participant(signerID)
+	p.Status = constants.ENUM_PARTICIPANT_SIGNED
+	p.SignatureID = &signatureID
+	p.ActedAt = &at
+
+	for _, other := range r.Participants {
+		if other.Status != constants.ENUM_PARTICIPANT_SIGNED {
+			r.openTasks()
+			return
+		}
+	}
+	r.Status = constants.ENUM_SIGNING_REQUEST_COMPLETED
+	r.CompletedAt = &at
+}
+
+// Decline ends the request: one refusal means the document can never
+// collect every required signature.
+func (r *SigningRequest) Decline(signerID string, reason string, at time.Time) {
+	p := r.Participant(signerID)
+	p.Status = constants.ENUM_PARTICIPANT_DECLINED
+	p.DeclineReason = reason
+	p.ActedAt = &at
+	r.Status = constants.ENUM_SIGNING_REQUEST_DECLINED
+	r.closeTasks()
+}
+
+// Cancel withdraws the request, closing the remaining tasks.
+func (r *SigningRequest) Cancel() {
+	r.Status = constants.ENUM_SIGNING_REQUEST_CANCELLED
+	r.closeTasks()
+}
+
+// DocumentStatus is the status the request gives its document.
+func (r *SigningRequest) DocumentStatus() string {
+	switch r.Status {
+	case constants.ENUM_SIGNING_REQUEST_COMPLETED:
+		return constants.ENUM_DOCUMENT_STATUS_COMPLETED
+	case constants.ENUM_SIGNING_REQUEST_DECLINED:
+		return constants.ENUM_DOCUMENT_STATUS_DECLINED
+	}
+	for _, p := range r.Participants {
+		if p.Status == constants.ENUM_PARTICIPANT_SIGNED {
+			if r.Status == constants.ENUM_SIGNING_REQUEST_CANCELLED {
+				return constants.ENUM_DOCUMENT_STATUS_SIGNED
+			}
+			return constants.ENUM_DOCUMENT_STATUS_PARTIALLY_SIGNED
+		}
+	}
+	if r.Status == constants.ENUM_SIGNING_REQUEST_CANCELLED {
+		return constants.ENUM_DOCUMENT_STATUS_UPLOADED
+	}
+	return constants.ENUM_DOCUMENT_STATUS_PENDING
+}
+
+// openTasks moves waiting participants to pending: all of them in parallel
+// order, those at the lowest unsigned position in sequential order.
+func (r *SigningRequest) openTasks() {
+	next := -1
+	for _, p := range r.Participants {
+		if p.Status != constants.ENUM_PARTICIPANT_SIGNED && (next < 0 || p.Position < next) {
+			next = p.Position
+		}
+	}
+	for i := range r.Participants {
+		p := &r.Participants[i]
+		if p.Status != constants.ENUM_PARTICIPANT_WAITING {
+			continue
+		}
+		if r.Order == constants.ENUM_SIGNING_ORDER_PARALLEL || p.Position == next {
+			p.Status = constants.ENUM_PARTICIPANT_PENDING
+		}
+	}
+}
+
+func (r *SigningRequest) closeTasks() {
+	for i := range r.Participants {
+		if p := &r.Participants[i]; p.Status == constants.ENUM_PARTICIPANT_PENDING {
+			p.Status = constants.ENUM_PARTICIPANT_WAITING
+		}
+	}
+}
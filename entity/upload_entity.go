@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// Upload is a resumable (tus) upload. The bytes received so far are kept as
+// chunks in storage; once Offset reaches Length they become a document.
+type Upload struct {
+	ID         string    `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     string    `gorm:"type:uuid;index;not null" json:"user_id"`
+	FileName   string    `gorm:"not null" json:"file_name"`
+	Length     int64     `gorm:"not null" json:"length"`
+	Offset     int64     `gorm:"not null" json:"offset"`
+	Metadata   string    `gorm:"type:text" json:"metadata,omitempty"` // Upload-Metadata header as sent by the client
+	ExpiresAt  time.Time `gorm:"type:timestamp with time zone;index;not null" json:"expires_at"`
+	DocumentID *uint     `json:"document_id,omitempty"` // set once the upload is complete
+
+	Timestamp
+}
+
+func (u Upload) IsComplete() bool {
+	return u.Offset == u.Length
+}
@@ -16,7 +16,7 @@ type User struct {
 	ImageUrl   string    `gorm:"type:varchar(255)" json:"image_url" validate:"omitempty,url"`
 	IsVerified bool      `gorm:"default:false" json:"is_verified"`
 	CertPEM    string    `gorm:"type:text" json:"cert_pem"`
-	PrivPEM    string    `gorm:"type:text" json:"priv_pem"`
+	PrivPEM    string    `gorm:"type:text" json:"-"` // legacy plaintext key, only read to move it into the vault
 	PubPEM     string    `gorm:"type:text" json:"pub_pem"`
 
 	Timestamp
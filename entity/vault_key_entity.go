@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// VaultKey is the private signing key of a user, kept encrypted: under a key
+// derived from the user's PIN with Argon2id, or under the master key
+// MasterKeyID. The server never stores it in clear. A key with the pkcs11
+// protection is not stored here at all: it lives in the PKCS#11 token under
+// the id of the record, EncryptedKey is empty.
+type VaultKey struct {
+	ID           string `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID       string `gorm:"type:uuid;uniqueIndex;not null" json:"user_id"`
+	Protection   string `gorm:"type:varchar(16);not null" json:"protection"`
+	EncryptedKey []byte `gorm:"type:bytea;not null" json:"-"`
+	MasterKeyID  string `gorm:"type:varchar(16);index" json:"master_key_id,omitempty"`
+
+	CreatedAt time.Time `gorm:"type:timestamp with time zone" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:timestamp with time zone" json:"updated_at"`
+}
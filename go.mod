@@ -5,11 +5,14 @@ go 1.23.0
 toolchain go1.24.1
 
 require (
+	github.com/beevik/etree v1.4.1
 	github.com/common-nighthawk/go-figure v0.0.0-20210622060536-734e95fb86be
 	github.com/gin-gonic/gin v1.10.0
 	github.com/golang-jwt/jwt/v4 v4.5.1
 	github.com/google/uuid v1.6.0
 	github.com/joho/godotenv v1.5.1
+	github.com/miekg/pkcs11 v1.1.1
+	github.com/russellhaering/goxmldsig v1.4.0
 	github.com/samber/do v1.6.0
 	github.com/spf13/viper v1.20.0
 	github.com/stretchr/testify v1.10.0
@@ -38,6 +41,7 @@ require (
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
+	github.com/jonboulle/clockwork v0.2.2 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
 	github.com/leodido/go-urn v1.4.0 // indirect
@@ -0,0 +1,27 @@
+// Package hsm signs with keys kept in a PKCS#11 token, such as a hardware
+// security module or SoftHSM2. Keys are generated in the token and never
+// leave it: they are only used through crypto.Signer.
+package hsm
+
+import (
+	"crypto"
+	"errors"
+)
+
+var (
+	ErrNotConfigured = errors.New("PKCS11_MODULE is not set")
+	ErrTokenNotFound = errors.New("PKCS#11 token not found")
+	ErrKeyNotFound   = errors.New("key not found in PKCS#11 token")
+	ErrKeyExists     = errors.New("key already exists in PKCS#11 token")
+	// ErrUnsupported is returned by builds without cgo, which loading a
+	// PKCS#11 module requires.
+	ErrUnsupported = errors.New("PKCS#11 support requires a build with cgo")
+)
+
+// KeyStore keeps private keys outside the process. Keys are named by an id
+// chosen by the caller, GenerateKey accepts the pki.Key* types.
+type KeyStore interface {
+	GenerateKey(id string, keyType string) (crypto.Signer, error)
+	FindKey(id string) (crypto.Signer, error)
+	DeleteKey(id string) error
+}
@@ -0,0 +1,124 @@
+//go:build cgo
+
+package hsm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/miekg/pkcs11"
+)
+
+// DigestInfo prefixes of PKCS#1 v1.5 signatures: CKM_RSA_PKCS only pads, the
+// caller encodes the hash algorithm.
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA224: {0x30, 0x2d, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x04, 0x05, 0x00, 0x04, 0x1c},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// hash and MGF1 mechanisms of CKM_RSA_PKCS_PSS
+var pssHashes = map[crypto.Hash][2]uint{
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512},
+}
+
+// tokenKey is a private key in the token. It signs digests like the keys of
+// crypto/rsa and crypto/ecdsa, so it can be used wherever they are.
+type tokenKey struct {
+	token  *Token
+	id     string
+	public crypto.PublicKey
+}
+
+func (k *tokenKey) Public() crypto.PublicKey {
+	return k.public
+}
+
+// Sign signs digest in the token. ECDSA signatures are returned ASN.1
+// encoded, as ecdsa.PrivateKey does; the token produces r || s.
+func (k *tokenKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	mechanism, input, err := k.mechanism(digest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature []byte
+	err = k.token.withSession(false, func(session pkcs11.SessionHandle) error {
+		handle, err := k.token.findObject(session, pkcs11.CKO_PRIVATE_KEY, k.id)
+		if err != nil {
+			return err
+		}
+		if err := k.token.ctx.SignInit(session, []*pkcs11.Mechanism{mechanism}, handle); err != nil {
+			return err
+		}
+		signature, err = k.token.ctx.Sign(session, input)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := k.public.(*ecdsa.PublicKey); ok {
+		if len(signature) == 0 || len(signature)%2 != 0 {
+			return nil, errors.New("invalid ECDSA signature from PKCS#11 token")
+		}
+		half := len(signature) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			R: new(big.Int).SetBytes(signature[:half]),
+			S: new(big.Int).SetBytes(signature[half:]),
+		})
+	}
+	return signature, nil
+}
+
+func (k *tokenKey) mechanism(digest []byte, opts crypto.SignerOpts) (*pkcs11.Mechanism, []byte, error) {
+	hash := opts.HashFunc()
+	if hash == 0 || len(digest) != hash.Size() {
+		return nil, nil, errors.New("PKCS#11 keys only sign digests")
+	}
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			hashes, ok := pssHashes[hash]
+			if !ok {
+				return nil, nil, fmt.Errorf("unsupported RSASSA-PSS hash %v", hash)
+			}
+			saltLength := pss.SaltLength
+			switch saltLength {
+			case rsa.PSSSaltLengthEqualsHash:
+				saltLength = hash.Size()
+			case rsa.PSSSaltLengthAuto:
+				// salt dài nhất có thể, như rsa.SignPSS
+				saltLength = (pub.N.BitLen()-1+7)/8 - 2 - hash.Size()
+			}
+			if saltLength < 0 {
+				return nil, nil, rsa.ErrMessageTooLong
+			}
+			params := pkcs11.NewPSSParams(hashes[0], hashes[1], uint(saltLength))
+			return pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, params), digest, nil
+		}
+		prefix, ok := digestInfoPrefixes[hash]
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported PKCS#1 v1.5 hash %v", hash)
+		}
+		input := append(append([]byte{}, prefix...), digest...)
+		return pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil), input, nil
+
+	case *ecdsa.PublicKey:
+		return pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil), digest, nil
+
+	default:
+		return nil, nil, errors.New("unsupported PKCS#11 key")
+	}
+}
@@ -0,0 +1,336 @@
+//go:build cgo
+
+package hsm
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/miekg/pkcs11"
+)
+
+var (
+	oidECPublicKey = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidCurveP256   = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidCurveP384   = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+)
+
+// Token is a PKCS#11 token the application is logged in to. It is safe for
+// concurrent use, every operation runs in a session of its own. A module can
+// only be initialized once per process, so open the token once and share it.
+type Token struct {
+	ctx  *pkcs11.Ctx
+	slot uint
+	// giữ session đăng nhập mở: trạng thái đăng nhập thuộc về ứng dụng và
+	// mất khi session cuối cùng bị đóng
+	login pkcs11.SessionHandle
+}
+
+// Open loads the module of cfg and logs in to its token as the user.
+func Open(cfg config.PKCS11Config) (*Token, error) {
+	if !cfg.Enabled() {
+		return nil, ErrNotConfigured
+	}
+	pin, err := cfg.LoadPIN()
+	if err != nil {
+		return nil, fmt.Errorf("PKCS#11 PIN: %w", err)
+	}
+
+	ctx := pkcs11.New(cfg.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("cannot load PKCS#11 module %s", cfg.Module)
+	}
+	if err := ctx.Initialize(); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		ctx.Destroy()
+		return nil, err
+	}
+	t := &Token{ctx: ctx}
+	if err := t.open(cfg.TokenLabel, pin); err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Token) open(label string, pin string) error {
+	slots, err := t.ctx.GetSlotList(true)
+	if err != nil {
+		return err
+	}
+	if label == "" && len(slots) > 1 {
+		return errors.New("several PKCS#11 tokens present, set PKCS11_TOKEN_LABEL")
+	}
+
+	found := false
+	for _, slot := range slots {
+		info, err := t.ctx.GetTokenInfo(slot)
+		if err != nil {
+			return err
+		}
+		if label == "" || info.Label == label {
+			t.slot, found = slot, true
+			break
+		}
+	}
+	if !found {
+		return ErrTokenNotFound
+	}
+
+	t.login, err = t.ctx.OpenSession(t.slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return err
+	}
+	if err := t.ctx.Login(t.login, pkcs11.CKU_USER, pin); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+		t.ctx.CloseSession(t.login)
+		return err
+	}
+	return nil
+}
+
+// Close logs out and unloads the module.
+func (t *Token) Close() error {
+	t.ctx.Logout(t.login)
+	t.ctx.CloseSession(t.login)
+	err := t.ctx.Finalize()
+	t.ctx.Destroy()
+	return err
+}
+
+// GenerateKey creates a key pair in the token. The private key is sensitive
+// and not extractable: it can only sign.
+func (t *Token) GenerateKey(id string, keyType string) (crypto.Signer, error) {
+	mechanism, public, private, err := keyTemplates(id, keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	var pub crypto.PublicKey
+	err = t.withSession(true, func(session pkcs11.SessionHandle) error {
+		if _, err := t.findObject(session, pkcs11.CKO_PRIVATE_KEY, id); err == nil {
+			return ErrKeyExists
+		} else if !errors.Is(err, ErrKeyNotFound) {
+			return err
+		}
+		handle, _, err := t.ctx.GenerateKeyPair(session, []*pkcs11.Mechanism{mechanism}, public, private)
+		if err != nil {
+			return err
+		}
+		pub, err = t.publicKey(session, handle)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tokenKey{token: t, id: id, public: pub}, nil
+}
+
+// FindKey returns the key pair id, created by GenerateKey or imported with
+// the tools of the token under the same CKA_ID.
+func (t *Token) FindKey(id string) (crypto.Signer, error) {
+	var pub crypto.PublicKey
+	err := t.withSession(false, func(session pkcs11.SessionHandle) error {
+		if _, err := t.findObject(session, pkcs11.CKO_PRIVATE_KEY, id); err != nil {
+			return err
+		}
+		handle, err := t.findObject(session, pkcs11.CKO_PUBLIC_KEY, id)
+		if err != nil {
+			return err
+		}
+		pub, err = t.publicKey(session, handle)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tokenKey{token: t, id: id, public: pub}, nil
+}
+
+// DeleteKey destroys both halves of the key pair id.
+func (t *Token) DeleteKey(id string) error {
+	return t.withSession(true, func(session pkcs11.SessionHandle) error {
+		deleted := false
+		for _, class := range []uint{pkcs11.CKO_PRIVATE_KEY, pkcs11.CKO_PUBLIC_KEY} {
+			handle, err := t.findObject(session, class, id)
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err := t.ctx.DestroyObject(session, handle); err != nil {
+				return err
+			}
+			deleted = true
+		}
+		if !deleted {
+			return ErrKeyNotFound
+		}
+		return nil
+	})
+}
+
+func (t *Token) withSession(readWrite bool, fn func(session pkcs11.SessionHandle) error) error {
+	flags := uint(pkcs11.CKF_SERIAL_SESSION)
+	if readWrite {
+		flags |= pkcs11.CKF_RW_SESSION
+	}
+	session, err := t.ctx.OpenSession(t.slot, flags)
+	if err != nil {
+		return err
+	}
+	defer t.ctx.CloseSession(session)
+	return fn(session)
+}
+
+func (t *Token) findObject(session pkcs11.SessionHandle, class uint, id string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(id)),
+	}
+	if err := t.ctx.FindObjectsInit(session, template); err != nil {
+		return 0, err
+	}
+	objects, _, err := t.ctx.FindObjects(session, 1)
+	if finalErr := t.ctx.FindObjectsFinal(session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) == 0 {
+		return 0, ErrKeyNotFound
+	}
+	return objects[0], nil
+}
+
+// publicKey reads the public key object handle.
+func (t *Token) publicKey(session pkcs11.SessionHandle, handle pkcs11.ObjectHandle) (crypto.PublicKey, error) {
+	attrs, err := t.ctx.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch keyType := ulong(attrs[0].Value); keyType {
+	case pkcs11.CKK_RSA:
+		attrs, err := t.ctx.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(attrs[1].Value)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA public exponent in PKCS#11 token")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(attrs[0].Value), E: int(exponent.Int64())}, nil
+
+	case pkcs11.CKK_EC:
+		attrs, err := t.ctx.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		// CKA_EC_POINT là OCTET STRING DER, một số token trả về điểm thô
+		var point []byte
+		if rest, err := asn1.Unmarshal(attrs[1].Value, &point); err != nil || len(rest) > 0 {
+			point = attrs[1].Value
+		}
+		// dựng SubjectPublicKeyInfo để x509 kiểm tra đường cong và điểm
+		spki, err := asn1.Marshal(struct {
+			Algorithm pkix.AlgorithmIdentifier
+			PublicKey asn1.BitString
+		}{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidECPublicKey, Parameters: asn1.RawValue{FullBytes: attrs[0].Value}},
+			PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return x509.ParsePKIXPublicKey(spki)
+
+	default:
+		return nil, fmt.Errorf("unsupported PKCS#11 key type %#x", keyType)
+	}
+}
+
+// keyTemplates returns what GenerateKeyPair needs to create a key of
+// keyType, one of the pki.Key* types except Ed25519.
+func keyTemplates(id string, keyType string) (*pkcs11.Mechanism, []*pkcs11.Attribute, []*pkcs11.Attribute, error) {
+	public := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(id)),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, id),
+	}
+	private := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(id)),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, id),
+	}
+
+	switch keyType {
+	case pki.KeyRSA2048, pki.KeyRSA3072, "":
+		bits := 2048
+		if keyType == pki.KeyRSA3072 {
+			bits = 3072
+		}
+		public = append(public,
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, bits),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+		)
+		private = append(private, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA))
+		return pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil), public, private, nil
+
+	case pki.KeyECDSAP256, pki.KeyECDSAP384:
+		curve := oidCurveP256
+		if keyType == pki.KeyECDSAP384 {
+			curve = oidCurveP384
+		}
+		params, err := asn1.Marshal(curve)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		public = append(public,
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params),
+		)
+		private = append(private, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC))
+		return pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil), public, private, nil
+
+	default:
+		return nil, nil, nil, fmt.Errorf("%w in PKCS#11 token: %q", pki.ErrUnsupportedKeyType, keyType)
+	}
+}
+
+// ulong decodes a CK_ULONG attribute, stored in the byte order of the host.
+func ulong(value []byte) uint {
+	switch len(value) {
+	case 8:
+		return uint(binary.NativeEndian.Uint64(value))
+	case 4:
+		return uint(binary.NativeEndian.Uint32(value))
+	default:
+		return ^uint(0)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !cgo
+
+package hsm
+
+import (
+	"crypto"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+)
+
+// Token is unavailable without cgo, Open always fails.
+type Token struct{}
+
+func Open(cfg config.PKCS11Config) (*Token, error) {
+	if !cfg.Enabled() {
+		return nil, ErrNotConfigured
+	}
+	return nil, ErrUnsupported
+}
+
+func (t *Token) Close() error { return ErrUnsupported }
+
+func (t *Token) GenerateKey(id string, keyType string) (crypto.Signer, error) {
+	return nil, ErrUnsupported
+}
+
+func (t *Token) FindKey(id string) (crypto.Signer, error) { return nil, ErrUnsupported }
+
+func (t *Token) DeleteKey(id string) error { return ErrUnsupported }
@@ -0,0 +1,137 @@
+// Package jws produces and checks JSON Web Signatures (RFC 7515) carrying the
+// signer's X.509 chain, with the JAdES signing time header (ETSI TS 119 182-1)
+// so the output can be used as a JAdES baseline B-B signature.
+package jws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+)
+
+// JOSE algorithm names.
+const (
+	RS256 = "RS256"
+	PS256 = "PS256"
+	ES256 = "ES256"
+	ES384 = "ES384"
+	EdDSA = "EdDSA"
+)
+
+// SigningTimeLayout is the format of the sigT header.
+const SigningTimeLayout = "2006-01-02T15:04:05Z"
+
+var (
+	ErrMalformed            = errors.New("jws: malformed signature")
+	ErrUnsupportedAlgorithm = errors.New("jws: unsupported algorithm")
+	ErrUnsupportedCritical  = errors.New("jws: unsupported critical header")
+	ErrNoCertificate        = errors.New("jws: header carries no x5c certificate")
+	ErrCertificateMismatch  = errors.New("jws: x5t#S256 does not match the signer certificate")
+	ErrInvalidSignature     = errors.New("jws: invalid signature value")
+)
+
+var b64 = base64.RawURLEncoding
+
+// algorithms maps JOSE names to the algorithms computing them.
+var algorithms = map[string]pki.Algorithm{
+	RS256: {Name: pki.AlgRSASHA256, KeyType: "RSA", Hash: crypto.SHA256},
+	PS256: {Name: pki.AlgRSAPSSSHA256, KeyType: "RSA", Hash: crypto.SHA256, PSS: true, SaltLength: crypto.SHA256.Size()},
+	ES256: {Name: pki.AlgECDSASHA256, KeyType: "ECDSA", Hash: crypto.SHA256},
+	ES384: {Name: pki.AlgECDSASHA384, KeyType: "ECDSA", Hash: crypto.SHA384},
+	EdDSA: {Name: pki.AlgEd25519, KeyType: "Ed25519"},
+}
+
+// AlgorithmName returns the JOSE "alg" value for an algorithm.
+func AlgorithmName(alg pki.Algorithm) (string, error) {
+	switch alg.Name {
+	case pki.AlgRSALegacy, pki.AlgRSASHA256:
+		return RS256, nil
+	case pki.AlgRSAPSSSHA256:
+		// PS256 fixes the salt length to the hash size
+		if alg.SaltLength != crypto.SHA256.Size() {
+			return "", ErrUnsupportedAlgorithm
+		}
+		return PS256, nil
+	case pki.AlgECDSASHA256:
+		return ES256, nil
+	case pki.AlgECDSASHA384:
+		return ES384, nil
+	case pki.AlgEd25519:
+		return EdDSA, nil
+	}
+	return "", ErrUnsupportedAlgorithm
+}
+
+// Header is the protected header written by Sign. Parsing keeps unknown
+// members in Raw so the crit list can be checked.
+type Header struct {
+	Algorithm   string   `json:"alg"`
+	Type        string   `json:"typ,omitempty"`
+	ContentType string   `json:"cty,omitempty"`
+	X5C         []string `json:"x5c,omitempty"`
+	X5TS256     string   `json:"x5t#S256,omitempty"`
+	SigningTime string   `json:"sigT,omitempty"`
+	Critical    []string `json:"crit,omitempty"`
+
+	Raw map[string]json.RawMessage `json:"-"`
+}
+
+// Time parses the sigT header, zero when absent or invalid.
+func (h Header) Time() time.Time {
+	t, err := time.Parse(SigningTimeLayout, h.SigningTime)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Signature is one signature over a payload, kept in its encoded form so
+// serialization reproduces exactly what was signed.
+type Signature struct {
+	Protected string
+	Payload   string
+	Signature string
+	Header    Header
+}
+
+// Compact returns the compact serialization.
+func (s *Signature) Compact() string {
+	return s.Protected + "." + s.Payload + "." + s.Signature
+}
+
+type flattened struct {
+	Payload   string `json:"payload"`
+	Protected string `json:"protected"`
+	Signature string `json:"signature"`
+}
+
+// JSON returns the flattened JSON serialization.
+func (s *Signature) JSON() ([]byte, error) {
+	return json.Marshal(flattened{Payload: s.Payload, Protected: s.Protected, Signature: s.Signature})
+}
+
+// DecodedPayload returns the signed payload bytes.
+func (s *Signature) DecodedPayload() ([]byte, error) {
+	payload, err := b64.DecodeString(s.Payload)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return payload, nil
+}
+
+func (s *Signature) signingInput() []byte {
+	return []byte(s.Protected + "." + s.Payload)
+}
+
+// signatureValue turns what crypto.Signer returns into the JWS encoding.
+func signatureValue(pub crypto.PublicKey, sig []byte) ([]byte, error) {
+	if key, ok := pub.(*ecdsa.PublicKey); ok {
+		return pki.ECDSAToRaw(key, sig)
+	}
+	return sig, nil
+}
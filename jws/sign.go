@@ -0,0 +1,72 @@
+package jws
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+)
+
+// SignerConfig describes who signs and how.
+type SignerConfig struct {
+	Signer      crypto.Signer
+	Certificate *x509.Certificate
+	// Chain is added to x5c after the signer certificate.
+	Chain     []*x509.Certificate
+	Algorithm pki.Algorithm
+	// SigningTime goes into the critical sigT header, omitted when zero.
+	SigningTime time.Time
+	// Type and ContentType set typ and cty.
+	Type        string
+	ContentType string
+}
+
+// Sign signs payload and returns the signature, which can be serialized in
+// compact or JSON form.
+func Sign(payload []byte, cfg SignerConfig) (*Signature, error) {
+	name, err := AlgorithmName(cfg.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbprint := sha256.Sum256(cfg.Certificate.Raw)
+	header := Header{
+		Algorithm:   name,
+		Type:        cfg.Type,
+		ContentType: cfg.ContentType,
+		X5TS256:     b64.EncodeToString(thumbprint[:]),
+	}
+	for _, cert := range append([]*x509.Certificate{cfg.Certificate}, cfg.Chain...) {
+		// x5c uses standard base64, unlike the rest of JOSE
+		header.X5C = append(header.X5C, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+	if !cfg.SigningTime.IsZero() {
+		header.SigningTime = cfg.SigningTime.UTC().Format(SigningTimeLayout)
+		header.Critical = []string{"sigT"}
+	}
+
+	encodedHeader, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	sig := &Signature{
+		Protected: b64.EncodeToString(encodedHeader),
+		Payload:   b64.EncodeToString(payload),
+		Header:    header,
+	}
+
+	raw, err := cfg.Algorithm.Sign(cfg.Signer, sig.signingInput())
+	if err != nil {
+		return nil, err
+	}
+	value, err := signatureValue(cfg.Signer.Public(), raw)
+	if err != nil {
+		return nil, err
+	}
+	sig.Signature = b64.EncodeToString(value)
+	return sig, nil
+}
@@ -0,0 +1,216 @@
+package jws
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+)
+
+// understood lists the header parameters this package can honour when a
+// signer marks them critical.
+var understood = map[string]bool{"sigT": true}
+
+// VerifyOptions configure signature validation.
+type VerifyOptions struct {
+	// Trust holds the accepted roots. Without it every chain is reported
+	// as untrusted.
+	Trust *pki.TrustStore
+	// Now is the validation time used when a signature has no sigT header.
+	// Defaults to the current time.
+	Now time.Time
+}
+
+// Result is the outcome for one signature.
+type Result struct {
+	Header  Header
+	Payload []byte
+	Signer  *x509.Certificate
+	Chain   []*x509.Certificate
+	// SigningTime is the claimed time from sigT, zero when absent.
+	SigningTime time.Time
+
+	SignatureValid bool
+	ChainValid     bool
+	// Err is the first problem found, nil for a valid signature.
+	Err error
+}
+
+// Valid reports whether the signature value and the certificate chain check
+// out.
+func (r Result) Valid() bool {
+	return r.SignatureValid && r.ChainValid
+}
+
+type generalJSON struct {
+	Payload    string `json:"payload"`
+	Protected  string `json:"protected"`
+	Signature  string `json:"signature"`
+	Signatures []struct {
+		Protected string `json:"protected"`
+		Signature string `json:"signature"`
+	} `json:"signatures"`
+}
+
+// Parse reads the compact, flattened JSON or general JSON serialization.
+func Parse(data []byte) ([]*Signature, error) {
+	data = bytes.TrimSpace(data)
+	var sigs []*Signature
+
+	if bytes.HasPrefix(data, []byte("{")) {
+		var doc generalJSON
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, ErrMalformed
+		}
+		if len(doc.Signatures) == 0 {
+			sigs = append(sigs, &Signature{Protected: doc.Protected, Payload: doc.Payload, Signature: doc.Signature})
+		}
+		for _, s := range doc.Signatures {
+			sigs = append(sigs, &Signature{Protected: s.Protected, Payload: doc.Payload, Signature: s.Signature})
+		}
+	} else {
+		parts := strings.Split(string(data), ".")
+		if len(parts) != 3 {
+			return nil, ErrMalformed
+		}
+		sigs = append(sigs, &Signature{Protected: parts[0], Payload: parts[1], Signature: parts[2]})
+	}
+
+	for _, sig := range sigs {
+		if sig.Protected == "" || sig.Signature == "" {
+			return nil, ErrMalformed
+		}
+		raw, err := b64.DecodeString(sig.Protected)
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		if err := json.Unmarshal(raw, &sig.Header); err != nil {
+			return nil, ErrMalformed
+		}
+		if err := json.Unmarshal(raw, &sig.Header.Raw); err != nil {
+			return nil, ErrMalformed
+		}
+	}
+	return sigs, nil
+}
+
+// Verify parses a serialized JWS and checks every signature.
+func Verify(data []byte, opts VerifyOptions) ([]Result, error) {
+	sigs, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	results := make([]Result, len(sigs))
+	for i, sig := range sigs {
+		results[i] = verifySignature(sig, opts)
+	}
+	return results, nil
+}
+
+func verifySignature(sig *Signature, opts VerifyOptions) Result {
+	res := Result{Header: sig.Header, SigningTime: sig.Header.Time()}
+
+	payload, err := sig.DecodedPayload()
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Payload = payload
+
+	alg, ok := algorithms[sig.Header.Algorithm]
+	if !ok {
+		res.Err = ErrUnsupportedAlgorithm
+		return res
+	}
+	if _, ok := sig.Header.Raw["crit"]; ok && len(sig.Header.Critical) == 0 {
+		res.Err = ErrUnsupportedCritical
+		return res
+	}
+	for _, name := range sig.Header.Critical {
+		if _, present := sig.Header.Raw[name]; !understood[name] || !present {
+			res.Err = ErrUnsupportedCritical
+			return res
+		}
+	}
+	if sig.Header.SigningTime != "" && res.SigningTime.IsZero() {
+		res.Err = ErrMalformed
+		return res
+	}
+
+	certs, err := headerCertificates(sig.Header)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Signer = certs[0]
+
+	value, err := b64.DecodeString(sig.Signature)
+	if err != nil {
+		res.Err = ErrMalformed
+		return res
+	}
+	if key, ok := res.Signer.PublicKey.(*ecdsa.PublicKey); ok {
+		if value, err = pki.ECDSAFromRaw(key, value); err != nil {
+			res.Err = ErrInvalidSignature
+			return res
+		}
+	}
+	if err := alg.WithSaltLength(0).Verify(res.Signer.PublicKey, sig.signingInput(), value); err != nil {
+		res.Err = ErrInvalidSignature
+		return res
+	}
+	res.SignatureValid = true
+
+	// like PAdES, the chain is checked at the claimed signing time
+	at := res.SigningTime
+	if at.IsZero() {
+		at = opts.Now
+	}
+	if opts.Trust == nil {
+		res.Err = pki.ErrUntrustedChain
+		return res
+	}
+	res.Chain, err = opts.Trust.Verify(res.Signer, certs[1:], at)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.ChainValid = true
+	return res
+}
+
+// headerCertificates decodes x5c, checking x5t#S256 against the signer
+// certificate when present.
+func headerCertificates(h Header) ([]*x509.Certificate, error) {
+	if len(h.X5C) == 0 {
+		return nil, ErrNoCertificate
+	}
+	certs := make([]*x509.Certificate, 0, len(h.X5C))
+	for _, encoded := range h.X5C {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if h.X5TS256 != "" {
+		thumbprint := sha256.Sum256(certs[0].Raw)
+		if h.X5TS256 != b64.EncodeToString(thumbprint[:]) {
+			return nil, ErrCertificateMismatch
+		}
+	}
+	return certs, nil
+}
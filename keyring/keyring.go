@@ -0,0 +1,142 @@
+// Package keyring holds the master keys that wrap data keys. The current
+// master key wraps new data keys; previous ones are kept only to unwrap the
+// data keys wrapped before a rotation.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+)
+
+// MASTER_KEY_SIZE is the size of a master key: an AES-256 key.
+const MASTER_KEY_SIZE = 32
+
+var (
+	ErrNoMasterKey      = errors.New("no master key configured")
+	ErrUnknownMasterKey = errors.New("master key not in keyring")
+	ErrUnwrap           = errors.New("cannot unwrap key")
+)
+
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// New loads the master keys of cfg. Each key is 32 bytes encoded in base64,
+// e.g. the output of `openssl rand -base64 32`.
+func New(cfg config.EncryptionConfig) (*Keyring, error) {
+	if !cfg.Enabled() {
+		return nil, ErrNoMasterKey
+	}
+	current, err := loadKey(cfg.MasterKeyFile, cfg.MasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("master key: %w", err)
+	}
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	if k.current, err = k.add(current); err != nil {
+		return nil, err
+	}
+	for _, file := range cfg.PreviousMasterKeyFiles {
+		key, err := loadKey(file, "")
+		if err != nil {
+			return nil, fmt.Errorf("previous master key: %w", err)
+		}
+		if _, err := k.add(key); err != nil {
+			return nil, err
+		}
+	}
+	for _, encoded := range cfg.PreviousMasterKeys {
+		key, err := loadKey("", encoded)
+		if err != nil {
+			return nil, fmt.Errorf("previous master key: %w", err)
+		}
+		if _, err := k.add(key); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// loadKey decodes the key in file, or encoded when file is empty.
+func loadKey(file string, encoded string) ([]byte, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(data)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.New("not base64")
+	}
+	if len(key) != MASTER_KEY_SIZE {
+		return nil, fmt.Errorf("%d bytes instead of %d", len(key), MASTER_KEY_SIZE)
+	}
+	return key, nil
+}
+
+func (k *Keyring) add(key []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	id := KeyID(key)
+	k.keys[id] = aead
+	return id, nil
+}
+
+// KeyID identifies a master key without revealing it: the first 8 bytes of
+// its SHA-256, in hex.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// CurrentID is the id of the master key that wraps new keys.
+func (k *Keyring) CurrentID() string {
+	return k.current
+}
+
+// Wrap encrypts key with the current master key, bound to ad: unwrapping
+// needs the same ad, so a wrapped key cannot be moved to another record.
+// It returns the wrapped key and the id of the master key.
+func (k *Keyring) Wrap(key []byte, ad []byte) ([]byte, string, error) {
+	aead := k.keys[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+	return aead.Seal(nonce, nonce, key, ad), k.current, nil
+}
+
+// Unwrap decrypts a key wrapped by the master key masterKeyID.
+func (k *Keyring) Unwrap(wrapped []byte, masterKeyID string, ad []byte) ([]byte, error) {
+	aead, ok := k.keys[masterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMasterKey, masterKeyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrUnwrap
+	}
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	key, err := aead.Open(nil, nonce, sealed, ad)
+	if err != nil {
+		return nil, ErrUnwrap
+	}
+	return key, nil
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
 	"github.com/PhanPhuc2609/be-sign-file/command"
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/constants"
 	"github.com/PhanPhuc2609/be-sign-file/middleware"
 	"github.com/PhanPhuc2609/be-sign-file/provider"
 	"github.com/PhanPhuc2609/be-sign-file/routes"
+	"github.com/PhanPhuc2609/be-sign-file/service"
 	"github.com/samber/do"
 
 	"github.com/common-nighthawk/go-figure"
@@ -24,8 +28,6 @@ func args(injector *do.Injector) bool {
 }
 
 func run(server *gin.Engine) {
-	server.Static("/assets", "./assets")
-
 	if os.Getenv("IS_LOGGER") == "true" {
 		routes.LoggerRoute(server)
 	}
@@ -61,7 +63,18 @@ func main() {
 		return
 	}
 
+	// background jobs
+	caService := do.MustInvokeNamed[service.CAService](injector, constants.CAService)
+	go caService.RunCRLRefresher(context.Background())
+	uploadService := do.MustInvokeNamed[service.UploadService](injector, constants.UploadService)
+	go uploadService.RunExpirationCleaner(context.Background())
+	documentService := do.MustInvokeNamed[service.DocumentService](injector, constants.DocumentService)
+	go documentService.RunPurger(context.Background())
+
 	server := gin.Default()
+	if err := server.SetTrustedProxies(config.TrustedProxies()); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
 	server.Use(middleware.CORSMiddleware())
 
 	// routes
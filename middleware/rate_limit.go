@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/gin-gonic/gin"
+)
+
+// bucket is a token bucket refilled at the configured rate.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimit limits each client IP with a token bucket. Rejected requests get
+// 429 with a Retry-After header. One handler keeps one set of buckets, so
+// routes sharing the handler share the limit.
+func RateLimit(cfg config.RateLimitConfig) gin.HandlerFunc {
+	var (
+		mu      sync.Mutex
+		buckets = make(map[string]*bucket)
+		swept   = time.Now()
+	)
+	perToken := cfg.Period / time.Duration(cfg.Rate)
+	burst := float64(cfg.Burst)
+
+	return func(ctx *gin.Context) {
+		now := time.Now()
+		mu.Lock()
+		// bỏ các client đã đầy token để map không tăng mãi
+		if now.Sub(swept) > cfg.Period {
+			for ip, b := range buckets {
+				if now.Sub(b.last) > perToken*time.Duration(cfg.Burst) {
+					delete(buckets, ip)
+				}
+			}
+			swept = now
+		}
+
+		ip := ctx.ClientIP()
+		b, ok := buckets[ip]
+		if !ok {
+			b = &bucket{tokens: burst, last: now}
+			buckets[ip] = b
+		}
+		b.tokens = math.Min(burst, b.tokens+float64(now.Sub(b.last))/float64(perToken))
+		b.last = now
+		allowed := b.tokens >= 1
+		if allowed {
+			b.tokens--
+		}
+		wait := time.Duration((1 - b.tokens) * float64(perToken))
+		mu.Unlock()
+
+		if !allowed {
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+			return
+		}
+		ctx.Next()
+	}
+}
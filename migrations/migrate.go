@@ -1,7 +1,11 @@
 package migrations
 
 import (
+	"crypto/x509"
+	"encoding/base64"
+
 	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
 	"gorm.io/gorm"
 )
 
@@ -11,9 +15,68 @@ func Migrate(db *gorm.DB) error {
 		&entity.RefreshToken{},
 		&entity.Document{},
 		&entity.Signature{},
+		&entity.Certificate{},
+		&entity.SigningRequest{},
+		&entity.SigningParticipant{},
+		&entity.Upload{},
+		&entity.Blob{},
+		&entity.DataKey{},
+		&entity.VaultKey{},
+		&entity.KeyUsage{},
 	); err != nil {
 		return err
 	}
 
+	// Signature không còn lưu khoá riêng nhưng AutoMigrate không xoá cột, các
+	// database cũ vẫn giữ khoá riêng RSA dạng plaintext trong private_key.
+	// Khoá này là thứ duy nhất xác minh được các chữ ký cũ, nên lưu public key
+	// của nó vào public_key trước khi xoá cột
+	if db.Migrator().HasColumn(&entity.Signature{}, "private_key") {
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := migrateSignaturePrivateKeys(tx); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&entity.Signature{}, "private_key")
+		})
+	}
+
+	return nil
+}
+
+// migrateSignaturePrivateKeys stores the public key of every signature that
+// still has its one-off private key (base64 PKCS#1 DER). Values that are not
+// a key could not verify anything and are left out.
+func migrateSignaturePrivateKeys(tx *gorm.DB) error {
+	var rows []struct {
+		ID         uint
+		PrivateKey string
+	}
+	if err := tx.Unscoped().Model(&entity.Signature{}).
+		Select("id, private_key").
+		Where("private_key IS NOT NULL AND private_key <> ''").
+		Where("public_key IS NULL OR public_key = ''").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		der, err := base64.StdEncoding.DecodeString(row.PrivateKey)
+		if err != nil {
+			continue
+		}
+		key, err := x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			continue
+		}
+		pubPEM, err := pki.EncodePublicKeyPEM(&key.PublicKey)
+		if err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&entity.Signature{}).
+			Where("id = ?", row.ID).
+			UpdateColumn("public_key", pubPEM).Error; err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,198 @@
+// Package pdf reads just enough of a PDF file to locate its objects and
+// appends incremental updates to it, which is what signing and signature
+// validation need. It does not render or rewrite existing content.
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrMalformed = errors.New("pdf: malformed file")
+	ErrEncrypted = errors.New("pdf: encrypted documents are not supported")
+	ErrNotFound  = errors.New("pdf: object not found")
+)
+
+// Object is one of: nil, bool, int64, float64, Name, String, Array, Dict,
+// Ref or *Stream.
+type Object interface{}
+
+// Name is a PDF name object, without the leading slash.
+type Name string
+
+// String is a PDF string object, literal or hexadecimal.
+type String []byte
+
+// Array is a PDF array.
+type Array []Object
+
+// Dict is a PDF dictionary.
+type Dict map[Name]Object
+
+// Ref is an indirect reference.
+type Ref struct {
+	Num int
+	Gen int
+}
+
+// Stream is a stream object. Data is only loaded on demand, Offset is where
+// the raw stream bytes start in the file.
+type Stream struct {
+	Dict   Dict
+	Offset int64
+	data   []byte
+}
+
+// Raw is written to the output verbatim. It is used for objects whose byte
+// layout matters, like the signature dictionary placeholders.
+type Raw []byte
+
+func (r Ref) String() string {
+	return fmt.Sprintf("%d %d R", r.Num, r.Gen)
+}
+
+// Get returns a dictionary value, nil when absent.
+func (d Dict) Get(key Name) Object {
+	return d[key]
+}
+
+// Copy returns a shallow copy of the dictionary.
+func (d Dict) Copy() Dict {
+	out := make(Dict, len(d))
+	for k, v := range d {
+		out[k] = v
+	}
+	return out
+}
+
+// Serialize writes an object in PDF syntax.
+func Serialize(obj Object) []byte {
+	var buf bytes.Buffer
+	writeObject(&buf, obj)
+	return buf.Bytes()
+}
+
+func writeObject(buf *bytes.Buffer, obj Object) {
+	switch v := obj.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case Name:
+		writeName(buf, v)
+	case String:
+		writeString(buf, v)
+	case Ref:
+		buf.WriteString(v.String())
+	case Array:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writeObject(buf, item)
+		}
+		buf.WriteByte(']')
+	case Dict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for _, k := range keys {
+			writeName(buf, Name(k))
+			buf.WriteByte(' ')
+			writeObject(buf, v[Name(k)])
+		}
+		buf.WriteString(">>")
+	case Raw:
+		buf.Write(v)
+	default:
+		panic(fmt.Sprintf("pdf: cannot serialize %T", obj))
+	}
+}
+
+func writeName(buf *bytes.Buffer, name Name) {
+	buf.WriteByte('/')
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < '!' || c > '~' || c == '#' || isDelimiter(c) {
+			fmt.Fprintf(buf, "#%02X", c)
+			continue
+		}
+		buf.WriteByte(c)
+	}
+}
+
+func writeString(buf *bytes.Buffer, s String) {
+	buf.WriteByte('(')
+	for _, c := range s {
+		switch c {
+		case '(', ')', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\n':
+			buf.WriteString(`\n`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte(')')
+}
+
+// TextString encodes s as a PDF text string, UTF-16BE with a byte order mark
+// when it is not plain ASCII.
+func TextString(s string) String {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return String(s)
+	}
+	out := []byte{0xfe, 0xff}
+	for _, r := range s {
+		if r >= 0x10000 {
+			r -= 0x10000
+			hi, lo := 0xd800+(r>>10), 0xdc00+(r&0x3ff)
+			out = append(out, byte(hi>>8), byte(hi), byte(lo>>8), byte(lo))
+			continue
+		}
+		out = append(out, byte(r>>8), byte(r))
+	}
+	return String(out)
+}
+
+// DecodeTextString is the inverse of TextString.
+func DecodeTextString(s String) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		var runes []rune
+		for i := 2; i+1 < len(s); i += 2 {
+			r := rune(s[i])<<8 | rune(s[i+1])
+			if r >= 0xd800 && r < 0xdc00 && i+3 < len(s) {
+				lo := rune(s[i+2])<<8 | rune(s[i+3])
+				r = 0x10000 + (r-0xd800)<<10 + (lo - 0xdc00)
+				i += 2
+			}
+			runes = append(runes, r)
+		}
+		return string(runes)
+	}
+	return string(s)
+}
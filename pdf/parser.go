@@ -0,0 +1,435 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+)
+
+const maxNesting = 64
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokKeyword
+	tokNumber
+	tokName
+	tokString
+	tokDictOpen
+	tokDictClose
+	tokArrayOpen
+	tokArrayClose
+)
+
+type token struct {
+	kind  tokenKind
+	value []byte
+}
+
+// parser tokenizes PDF syntax from a reader, tracking how many bytes were
+// consumed so stream data can be located.
+type parser struct {
+	r      *bufio.Reader
+	pos    int64
+	queued []token
+}
+
+func newParser(r io.Reader) *parser {
+	return &parser{r: bufio.NewReader(r)}
+}
+
+func isWhitespace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (p *parser) readByte() (byte, error) {
+	c, err := p.r.ReadByte()
+	if err == nil {
+		p.pos++
+	}
+	return c, err
+}
+
+func (p *parser) unreadByte() {
+	_ = p.r.UnreadByte()
+	p.pos--
+}
+
+func (p *parser) unread(t token) {
+	p.queued = append(p.queued, t)
+}
+
+func (p *parser) next() (token, error) {
+	if n := len(p.queued); n > 0 {
+		t := p.queued[n-1]
+		p.queued = p.queued[:n-1]
+		return t, nil
+	}
+
+	var c byte
+	var err error
+	for {
+		c, err = p.readByte()
+		if err == io.EOF {
+			return token{kind: tokEOF}, nil
+		}
+		if err != nil {
+			return token{}, err
+		}
+		if c == '%' {
+			for c != '\n' && c != '\r' {
+				if c, err = p.readByte(); err != nil {
+					return token{kind: tokEOF}, nil
+				}
+			}
+			continue
+		}
+		if !isWhitespace(c) {
+			break
+		}
+	}
+
+	switch c {
+	case '[':
+		return token{kind: tokArrayOpen}, nil
+	case ']':
+		return token{kind: tokArrayClose}, nil
+	case '<':
+		n, err := p.readByte()
+		if err != nil {
+			return token{}, ErrMalformed
+		}
+		if n == '<' {
+			return token{kind: tokDictOpen}, nil
+		}
+		p.unreadByte()
+		return p.readHexString()
+	case '>':
+		n, err := p.readByte()
+		if err != nil || n != '>' {
+			return token{}, ErrMalformed
+		}
+		return token{kind: tokDictClose}, nil
+	case '(':
+		return p.readLiteralString()
+	case '/':
+		return p.readName()
+	}
+
+	var buf []byte
+	buf = append(buf, c)
+	for {
+		c, err := p.readByte()
+		if err != nil {
+			break
+		}
+		if isWhitespace(c) || isDelimiter(c) {
+			p.unreadByte()
+			break
+		}
+		buf = append(buf, c)
+	}
+	if isNumber(buf) {
+		return token{kind: tokNumber, value: buf}, nil
+	}
+	return token{kind: tokKeyword, value: buf}, nil
+}
+
+func isNumber(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	digits := 0
+	for i, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case (c == '+' || c == '-') && i == 0:
+		case c == '.':
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+func (p *parser) readName() (token, error) {
+	var buf []byte
+	for {
+		c, err := p.readByte()
+		if err != nil {
+			break
+		}
+		if isWhitespace(c) || isDelimiter(c) {
+			p.unreadByte()
+			break
+		}
+		if c == '#' {
+			h1, err1 := p.readByte()
+			h2, err2 := p.readByte()
+			if err1 != nil || err2 != nil {
+				return token{}, ErrMalformed
+			}
+			v, err := strconv.ParseUint(string([]byte{h1, h2}), 16, 8)
+			if err != nil {
+				return token{}, ErrMalformed
+			}
+			c = byte(v)
+		}
+		buf = append(buf, c)
+	}
+	return token{kind: tokName, value: buf}, nil
+}
+
+func (p *parser) readHexString() (token, error) {
+	var digits []byte
+	for {
+		c, err := p.readByte()
+		if err != nil {
+			return token{}, ErrMalformed
+		}
+		if c == '>' {
+			break
+		}
+		if isWhitespace(c) {
+			continue
+		}
+		digits = append(digits, c)
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		v, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			return token{}, ErrMalformed
+		}
+		out[i] = byte(v)
+	}
+	return token{kind: tokString, value: out}, nil
+}
+
+func (p *parser) readLiteralString() (token, error) {
+	var buf []byte
+	depth := 1
+	for {
+		c, err := p.readByte()
+		if err != nil {
+			return token{}, ErrMalformed
+		}
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return token{kind: tokString, value: buf}, nil
+			}
+		case '\\':
+			e, err := p.readByte()
+			if err != nil {
+				return token{}, ErrMalformed
+			}
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// line continuation, swallow an optional LF
+				if n, err := p.readByte(); err == nil && n != '\n' {
+					p.unreadByte()
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2; i++ {
+						n, err := p.readByte()
+						if err != nil || n < '0' || n > '7' {
+							if err == nil {
+								p.unreadByte()
+							}
+							break
+						}
+						v = v*8 + int(n-'0')
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+}
+
+// parseObject reads one direct object, turning "n g R" into a Ref.
+func (p *parser) parseObject(depth int) (Object, error) {
+	if depth > maxNesting {
+		return nil, ErrMalformed
+	}
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.kind {
+	case tokEOF:
+		return nil, ErrMalformed
+	case tokName:
+		return Name(t.value), nil
+	case tokString:
+		return String(t.value), nil
+	case tokArrayOpen:
+		arr := Array{}
+		for {
+			t, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			if t.kind == tokArrayClose {
+				return arr, nil
+			}
+			if t.kind == tokEOF {
+				return nil, ErrMalformed
+			}
+			p.unread(t)
+			item, err := p.parseObject(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, item)
+		}
+	case tokDictOpen:
+		dict := Dict{}
+		for {
+			t, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			if t.kind == tokDictClose {
+				return dict, nil
+			}
+			if t.kind != tokName {
+				return nil, ErrMalformed
+			}
+			value, err := p.parseObject(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			// a null value is the same as an absent key
+			if value != nil {
+				dict[Name(t.value)] = value
+			}
+		}
+	case tokNumber:
+		if bytes.ContainsAny(t.value, ".") {
+			f, err := strconv.ParseFloat(string(t.value), 64)
+			if err != nil {
+				return nil, ErrMalformed
+			}
+			return f, nil
+		}
+		n, err := strconv.ParseInt(string(t.value), 10, 64)
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		// look ahead for "gen R"
+		t2, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if t2.kind == tokNumber && !bytes.ContainsAny(t2.value, ".+-") {
+			t3, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			if t3.kind == tokKeyword && string(t3.value) == "R" {
+				gen, _ := strconv.Atoi(string(t2.value))
+				return Ref{Num: int(n), Gen: gen}, nil
+			}
+			p.unread(t3)
+		}
+		p.unread(t2)
+		return n, nil
+	case tokKeyword:
+		switch string(t.value) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return nil, ErrMalformed
+}
+
+// parseIndirect reads "n g obj <object> [stream]". base is the file offset
+// the parser started at, used to record where stream data begins.
+func (p *parser) parseIndirect(base int64) (Ref, Object, error) {
+	var ref Ref
+	numTok, err1 := p.next()
+	genTok, err2 := p.next()
+	objTok, err3 := p.next()
+	if err1 != nil || err2 != nil || err3 != nil ||
+		numTok.kind != tokNumber || genTok.kind != tokNumber ||
+		objTok.kind != tokKeyword || string(objTok.value) != "obj" {
+		return ref, nil, ErrMalformed
+	}
+	ref.Num, _ = strconv.Atoi(string(numTok.value))
+	ref.Gen, _ = strconv.Atoi(string(genTok.value))
+
+	obj, err := p.parseObject(0)
+	if err != nil {
+		return ref, nil, err
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return ref, nil, err
+	}
+	if t.kind == tokKeyword && string(t.value) == "stream" {
+		dict, ok := obj.(Dict)
+		if !ok {
+			return ref, nil, ErrMalformed
+		}
+		// the keyword is followed by CRLF or LF
+		c, err := p.readByte()
+		if err != nil {
+			return ref, nil, ErrMalformed
+		}
+		if c == '\r' {
+			if c, err = p.readByte(); err != nil {
+				return ref, nil, ErrMalformed
+			}
+			if c != '\n' {
+				p.unreadByte()
+			}
+		} else if c != '\n' {
+			p.unreadByte()
+		}
+		return ref, &Stream{Dict: dict, Offset: base + p.pos}, nil
+	}
+	return ref, obj, nil
+}
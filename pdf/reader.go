@@ -0,0 +1,567 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	xrefFree = iota
+	xrefOffset
+	xrefCompressed
+)
+
+type xrefEntry struct {
+	kind   int
+	offset int64 // file offset, or object stream number when compressed
+	gen    int   // generation, or index within the object stream
+}
+
+// Reader gives random access to the objects of a PDF file.
+type Reader struct {
+	ra   io.ReaderAt
+	size int64
+
+	xref    map[int]xrefEntry
+	trailer Dict
+	// startXRef is the offset of the newest cross-reference section, the
+	// /Prev of the next incremental update.
+	startXRef int64
+	// xrefStream records whether the newest section is a cross-reference
+	// stream, in which case updates should use one too.
+	xrefStream bool
+
+	objStreams map[int]*objectStream
+}
+
+type objectStream struct {
+	data    []byte
+	offsets map[int]int64
+}
+
+// IsPDF reports whether data starts with the PDF file header.
+func IsPDF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("%PDF-"))
+}
+
+// NewReader loads the cross-reference sections of a PDF.
+func NewReader(ra io.ReaderAt, size int64) (*Reader, error) {
+	r := &Reader{
+		ra:         ra,
+		size:       size,
+		xref:       map[int]xrefEntry{},
+		objStreams: map[int]*objectStream{},
+	}
+
+	header := make([]byte, 8)
+	if _, err := ra.ReadAt(header, 0); err != nil || !IsPDF(header) {
+		return nil, ErrMalformed
+	}
+
+	start, err := r.findStartXRef()
+	if err != nil {
+		return nil, err
+	}
+	r.startXRef = start
+
+	seen := map[int64]bool{}
+	offset := start
+	first := true
+	for offset > 0 || first {
+		if seen[offset] || offset >= size {
+			return nil, ErrMalformed
+		}
+		seen[offset] = true
+
+		trailer, isStream, err := r.readXRefSection(offset)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			r.trailer = trailer
+			r.xrefStream = isStream
+			first = false
+		}
+		// hybrid files point at an additional cross-reference stream
+		if stm, ok := trailer[Name("XRefStm")].(int64); ok && !seen[stm] {
+			seen[stm] = true
+			if _, _, err := r.readXRefSection(stm); err != nil {
+				return nil, err
+			}
+		}
+		prev, ok := trailer[Name("Prev")].(int64)
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+
+	if _, ok := r.trailer[Name("Encrypt")]; ok {
+		return nil, ErrEncrypted
+	}
+	if _, ok := r.trailer[Name("Root")].(Ref); !ok {
+		return nil, ErrMalformed
+	}
+	return r, nil
+}
+
+// Size is the length of the underlying file.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// Trailer returns the newest trailer dictionary.
+func (r *Reader) Trailer() Dict {
+	return r.trailer
+}
+
+// Catalog returns the document catalog and its reference.
+func (r *Reader) Catalog() (Ref, Dict, error) {
+	ref := r.trailer[Name("Root")].(Ref)
+	dict, err := r.Dict(ref)
+	return ref, dict, err
+}
+
+func (r *Reader) findStartXRef() (int64, error) {
+	tail := int64(2048)
+	if tail > r.size {
+		tail = r.size
+	}
+	buf := make([]byte, tail)
+	if _, err := r.ra.ReadAt(buf, r.size-tail); err != nil && err != io.EOF {
+		return 0, err
+	}
+	i := bytes.LastIndex(buf, []byte("startxref"))
+	if i < 0 {
+		return 0, ErrMalformed
+	}
+	fields := bytes.Fields(buf[i+len("startxref"):])
+	if len(fields) == 0 {
+		return 0, ErrMalformed
+	}
+	offset, err := strconv.ParseInt(string(fields[0]), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, ErrMalformed
+	}
+	return offset, nil
+}
+
+func (r *Reader) section(offset int64) *parser {
+	return newParser(io.NewSectionReader(r.ra, offset, r.size-offset))
+}
+
+// readXRefSection merges one cross-reference section into r.xref, keeping
+// entries already seen since newer sections are read first.
+func (r *Reader) readXRefSection(offset int64) (Dict, bool, error) {
+	p := r.section(offset)
+	t, err := p.next()
+	if err != nil {
+		return nil, false, err
+	}
+	if t.kind == tokKeyword && string(t.value) == "xref" {
+		trailer, err := r.readXRefTable(p)
+		return trailer, false, err
+	}
+	p.unread(t)
+
+	_, obj, err := p.parseIndirect(offset)
+	if err != nil {
+		return nil, false, err
+	}
+	stream, ok := obj.(*Stream)
+	if !ok || stream.Dict[Name("Type")] != Name("XRef") {
+		return nil, false, ErrMalformed
+	}
+	if err := r.readXRefStream(stream); err != nil {
+		return nil, false, err
+	}
+	return stream.Dict, true, nil
+}
+
+func (r *Reader) readXRefTable(p *parser) (Dict, error) {
+	for {
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == tokKeyword && string(t.value) == "trailer" {
+			obj, err := p.parseObject(0)
+			if err != nil {
+				return nil, err
+			}
+			trailer, ok := obj.(Dict)
+			if !ok {
+				return nil, ErrMalformed
+			}
+			return trailer, nil
+		}
+		if t.kind != tokNumber {
+			return nil, ErrMalformed
+		}
+		start, _ := strconv.Atoi(string(t.value))
+		countTok, err := p.next()
+		if err != nil || countTok.kind != tokNumber {
+			return nil, ErrMalformed
+		}
+		count, _ := strconv.Atoi(string(countTok.value))
+		for i := 0; i < count; i++ {
+			offTok, err1 := p.next()
+			genTok, err2 := p.next()
+			kindTok, err3 := p.next()
+			if err1 != nil || err2 != nil || err3 != nil || kindTok.kind != tokKeyword {
+				return nil, ErrMalformed
+			}
+			if _, ok := r.xref[start+i]; ok {
+				continue
+			}
+			off, _ := strconv.ParseInt(string(offTok.value), 10, 64)
+			gen, _ := strconv.Atoi(string(genTok.value))
+			entry := xrefEntry{kind: xrefFree, offset: off, gen: gen}
+			if string(kindTok.value) == "n" {
+				entry.kind = xrefOffset
+			}
+			r.xref[start+i] = entry
+		}
+	}
+}
+
+func (r *Reader) readXRefStream(stream *Stream) error {
+	data, err := r.StreamData(stream)
+	if err != nil {
+		return err
+	}
+
+	w, ok := stream.Dict[Name("W")].(Array)
+	if !ok || len(w) != 3 {
+		return ErrMalformed
+	}
+	widths := make([]int, 3)
+	rowLen := 0
+	for i, v := range w {
+		n, ok := v.(int64)
+		if !ok || n < 0 || n > 8 {
+			return ErrMalformed
+		}
+		widths[i] = int(n)
+		rowLen += int(n)
+	}
+	if rowLen == 0 {
+		return ErrMalformed
+	}
+
+	size, _ := stream.Dict[Name("Size")].(int64)
+	index := Array{int64(0), size}
+	if idx, ok := stream.Dict[Name("Index")].(Array); ok {
+		index = idx
+	}
+
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, ok1 := index[i].(int64)
+		count, ok2 := index[i+1].(int64)
+		if !ok1 || !ok2 {
+			return ErrMalformed
+		}
+		for j := int64(0); j < count; j++ {
+			if pos+rowLen > len(data) {
+				return ErrMalformed
+			}
+			row := data[pos : pos+rowLen]
+			pos += rowLen
+
+			fields := make([]int64, 3)
+			off := 0
+			for k, width := range widths {
+				for _, b := range row[off : off+width] {
+					fields[k] = fields[k]<<8 | int64(b)
+				}
+				off += width
+			}
+			// a zero width type field defaults to 1
+			if widths[0] == 0 {
+				fields[0] = 1
+			}
+
+			num := int(start + j)
+			if _, ok := r.xref[num]; ok {
+				continue
+			}
+			switch fields[0] {
+			case 0:
+				r.xref[num] = xrefEntry{kind: xrefFree}
+			case 1:
+				r.xref[num] = xrefEntry{kind: xrefOffset, offset: fields[1], gen: int(fields[2])}
+			case 2:
+				r.xref[num] = xrefEntry{kind: xrefCompressed, offset: fields[1], gen: int(fields[2])}
+			}
+		}
+	}
+	return nil
+}
+
+// Object loads an indirect object.
+func (r *Reader) Object(ref Ref) (Object, error) {
+	entry, ok := r.xref[ref.Num]
+	if !ok || entry.kind == xrefFree {
+		return nil, ErrNotFound
+	}
+
+	if entry.kind == xrefCompressed {
+		return r.compressedObject(int(entry.offset), ref.Num)
+	}
+
+	got, obj, err := r.section(entry.offset).parseIndirect(entry.offset)
+	if err != nil {
+		return nil, err
+	}
+	if got.Num != ref.Num {
+		return nil, fmt.Errorf("%w: object %d not at its xref offset", ErrMalformed, ref.Num)
+	}
+	return obj, nil
+}
+
+// Resolve follows references until a direct object is reached.
+func (r *Reader) Resolve(obj Object) (Object, error) {
+	for i := 0; i < maxNesting; i++ {
+		ref, ok := obj.(Ref)
+		if !ok {
+			return obj, nil
+		}
+		var err error
+		if obj, err = r.Object(ref); err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrMalformed
+}
+
+// Dict resolves obj and expects a dictionary (or a stream's dictionary).
+func (r *Reader) Dict(obj Object) (Dict, error) {
+	resolved, err := r.Resolve(obj)
+	if err != nil {
+		return nil, err
+	}
+	switch v := resolved.(type) {
+	case Dict:
+		return v, nil
+	case *Stream:
+		return v.Dict, nil
+	}
+	return nil, ErrMalformed
+}
+
+// Array resolves obj and expects an array. A missing value is an empty array.
+func (r *Reader) Array(obj Object) (Array, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	resolved, err := r.Resolve(obj)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := resolved.(Array)
+	if !ok {
+		return nil, ErrMalformed
+	}
+	return arr, nil
+}
+
+func (r *Reader) compressedObject(streamNum, num int) (Object, error) {
+	objStm, ok := r.objStreams[streamNum]
+	if !ok {
+		obj, err := r.Object(Ref{Num: streamNum})
+		if err != nil {
+			return nil, err
+		}
+		stream, ok := obj.(*Stream)
+		if !ok {
+			return nil, ErrMalformed
+		}
+		if objStm, err = r.loadObjectStream(stream); err != nil {
+			return nil, err
+		}
+		r.objStreams[streamNum] = objStm
+	}
+
+	offset, ok := objStm.offsets[num]
+	if !ok || offset > int64(len(objStm.data)) {
+		return nil, ErrNotFound
+	}
+	return newParser(bytes.NewReader(objStm.data[offset:])).parseObject(0)
+}
+
+func (r *Reader) loadObjectStream(stream *Stream) (*objectStream, error) {
+	data, err := r.StreamData(stream)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := stream.Dict[Name("N")].(int64)
+	first, _ := stream.Dict[Name("First")].(int64)
+	if first < 0 || first > int64(len(data)) {
+		return nil, ErrMalformed
+	}
+
+	p := newParser(bytes.NewReader(data[:first]))
+	objStm := &objectStream{data: data[first:], offsets: map[int]int64{}}
+	for i := int64(0); i < n; i++ {
+		numTok, err1 := p.next()
+		offTok, err2 := p.next()
+		if err1 != nil || err2 != nil || numTok.kind != tokNumber || offTok.kind != tokNumber {
+			return nil, ErrMalformed
+		}
+		num, _ := strconv.Atoi(string(numTok.value))
+		off, _ := strconv.ParseInt(string(offTok.value), 10, 64)
+		objStm.offsets[num] = off
+	}
+	return objStm, nil
+}
+
+// RawStreamData reads the undecoded bytes of a stream.
+func (r *Reader) RawStreamData(stream *Stream) ([]byte, error) {
+	lengthObj, err := r.Resolve(stream.Dict[Name("Length")])
+	if err != nil {
+		return nil, err
+	}
+	length, ok := lengthObj.(int64)
+	if !ok || length < 0 || stream.Offset+length > r.size {
+		return nil, ErrMalformed
+	}
+	data := make([]byte, length)
+	if _, err := r.ra.ReadAt(data, stream.Offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// StreamData reads and decodes a stream. Only FlateDecode (with PNG
+// predictors) is supported, which covers cross-reference and object streams.
+func (r *Reader) StreamData(stream *Stream) ([]byte, error) {
+	if stream.data != nil {
+		return stream.data, nil
+	}
+	data, err := r.RawStreamData(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	filters, err := r.filterList(stream.Dict[Name("Filter")])
+	if err != nil {
+		return nil, err
+	}
+	params, _ := r.filterList(stream.Dict[Name("DecodeParms")])
+	for i, filter := range filters {
+		if filter != Name("FlateDecode") {
+			return nil, fmt.Errorf("%w: filter %v", ErrMalformed, filter)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+		if i < len(params) {
+			if p, err := r.Dict(params[i]); err == nil {
+				if data, err = unpredict(data, p); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	stream.data = data
+	return data, nil
+}
+
+func (r *Reader) filterList(obj Object) (Array, error) {
+	resolved, err := r.Resolve(obj)
+	if err != nil {
+		return nil, err
+	}
+	switch v := resolved.(type) {
+	case nil:
+		return nil, nil
+	case Array:
+		return v, nil
+	default:
+		return Array{v}, nil
+	}
+}
+
+// unpredict reverses the PNG row predictors used by cross-reference streams.
+func unpredict(data []byte, params Dict) ([]byte, error) {
+	predictor, _ := params[Name("Predictor")].(int64)
+	if predictor < 10 {
+		if predictor > 1 {
+			return nil, fmt.Errorf("%w: TIFF predictor", ErrMalformed)
+		}
+		return data, nil
+	}
+	columns, ok := params[Name("Columns")].(int64)
+	if !ok {
+		columns = 1
+	}
+	colors, ok := params[Name("Colors")].(int64)
+	if !ok {
+		colors = 1
+	}
+	bpc, ok := params[Name("BitsPerComponent")].(int64)
+	if !ok {
+		bpc = 8
+	}
+	bpp := int((colors*bpc + 7) / 8)
+	rowLen := int((columns*colors*bpc + 7) / 8)
+
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+1+rowLen <= len(data); pos += 1 + rowLen {
+		kind := data[pos]
+		row := append([]byte{}, data[pos+1:pos+1+rowLen]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, ErrMalformed
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,331 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/cms"
+)
+
+// DefaultContentsSize is the space reserved for the CMS signature, enough for
+// a three certificate chain with RSA-3072 keys and a timestamp token.
+const DefaultContentsSize = 16384
+
+const byteRangeWidth = 64
+
+var ErrSignatureTooLarge = errors.New("pdf: signature does not fit the reserved space")
+
+// SignOptions are the optional entries of the signature dictionary.
+type SignOptions struct {
+	Name        string
+	Reason      string
+	Location    string
+	ContactInfo string
+	// SigningTime goes into /M. PAdES baseline signatures carry the claimed
+	// signing time here rather than in the CMS signed attributes.
+	SigningTime time.Time
+	// ContentsSize overrides DefaultContentsSize.
+	ContentsSize int
+	// Timestamp, when set, obtains an RFC 3161 token over the CMS
+	// signature value. The token is added as an unsigned attribute, making
+	// the signature PAdES-B-T.
+	Timestamp func(signature []byte) ([]byte, error)
+}
+
+// Sign appends a PAdES-B-B signature revision, B-T when opts.Timestamp is
+// set, to the PDF read from src and writes the complete signed file to dst.
+// Existing revisions, including earlier signatures, are copied unchanged.
+func Sign(src io.ReaderAt, size int64, dst io.Writer, cfg cms.SignerConfig, opts SignOptions) error {
+	r, err := NewReader(src, size)
+	if err != nil {
+		return err
+	}
+	catalogRef, catalog, err := r.Catalog()
+	if err != nil {
+		return err
+	}
+	pageRef, page, err := r.firstPage(catalog)
+	if err != nil {
+		return err
+	}
+
+	contentsSize := opts.ContentsSize
+	if contentsSize == 0 {
+		contentsSize = DefaultContentsSize
+	}
+	sigDict, layout := signatureDictionary(opts, contentsSize)
+
+	u := r.NewUpdate()
+	sigRef := u.Add(Raw(sigDict))
+
+	fieldName, err := r.nextFieldName(catalog)
+	if err != nil {
+		return err
+	}
+	fieldRef := u.Add(Dict{
+		Name("Type"):    Name("Annot"),
+		Name("Subtype"): Name("Widget"),
+		Name("FT"):      Name("Sig"),
+		Name("T"):       TextString(fieldName),
+		Name("V"):       sigRef,
+		Name("F"):       int64(132), // print, locked
+		Name("Rect"):    Array{int64(0), int64(0), int64(0), int64(0)},
+		Name("P"):       pageRef,
+	})
+
+	if err := r.appendToArray(u, page, pageRef, Name("Annots"), fieldRef); err != nil {
+		return err
+	}
+	if err := r.addFormField(u, catalog, catalogRef, fieldRef); err != nil {
+		return err
+	}
+
+	update := u.Bytes()
+
+	// absolute positions of the /Contents hex string delimiters
+	body := size + u.BodyOffset(sigRef)
+	contentsStart := body + int64(layout.contentsStart)
+	contentsEnd := body + int64(layout.contentsEnd)
+	total := size + int64(len(update))
+
+	byteRange := fmt.Sprintf("0 %d %d %d", contentsStart, contentsEnd, total-contentsEnd)
+	if len(byteRange) > byteRangeWidth {
+		return ErrMalformed
+	}
+	brPos := u.BodyOffset(sigRef) + int64(layout.byteRange)
+	copy(update[brPos:brPos+byteRangeWidth], byteRange+strings.Repeat(" ", byteRangeWidth-len(byteRange)))
+
+	h := cms.DigestHash(cfg.Algorithm).New()
+	if _, err := io.Copy(h, io.NewSectionReader(src, 0, size)); err != nil {
+		return err
+	}
+	h.Write(update[:contentsStart-size])
+	h.Write(update[contentsEnd-size:])
+
+	cfg.SigningTime = time.Time{}
+	sd, err := cms.SignDigest(h.Sum(nil), cfg)
+	if err != nil {
+		return err
+	}
+	if opts.Timestamp != nil {
+		si := sd.SignerInfos[0]
+		token, err := opts.Timestamp(si.Signature)
+		if err != nil {
+			return err
+		}
+		if err := si.AddUnsignedAttribute(cms.OIDAttributeTimeStampToken, token); err != nil {
+			return err
+		}
+	}
+	der, err := sd.Marshal()
+	if err != nil {
+		return err
+	}
+	if len(der) > contentsSize {
+		return ErrSignatureTooLarge
+	}
+	hex.Encode(update[contentsStart-size+1:], der)
+
+	if _, err := io.Copy(dst, io.NewSectionReader(src, 0, size)); err != nil {
+		return err
+	}
+	_, err = dst.Write(update)
+	return err
+}
+
+type sigLayout struct {
+	byteRange     int // first byte inside the /ByteRange brackets
+	contentsStart int // the '<' of /Contents
+	contentsEnd   int // just after the '>' of /Contents
+}
+
+// signatureDictionary renders the signature dictionary with placeholders for
+// /ByteRange and /Contents, which are filled in once offsets are known.
+func signatureDictionary(opts SignOptions, contentsSize int) ([]byte, sigLayout) {
+	var buf bytes.Buffer
+	buf.WriteString("<</Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached")
+	if !opts.SigningTime.IsZero() {
+		buf.WriteString(" /M ")
+		writeObject(&buf, String(FormatDate(opts.SigningTime)))
+	}
+	for _, entry := range []struct {
+		key   Name
+		value string
+	}{
+		{"Name", opts.Name},
+		{"Reason", opts.Reason},
+		{"Location", opts.Location},
+		{"ContactInfo", opts.ContactInfo},
+	} {
+		if entry.value == "" {
+			continue
+		}
+		buf.WriteByte(' ')
+		writeName(&buf, entry.key)
+		buf.WriteByte(' ')
+		writeObject(&buf, TextString(entry.value))
+	}
+
+	var layout sigLayout
+	buf.WriteString(" /ByteRange [")
+	layout.byteRange = buf.Len()
+	buf.WriteString(strings.Repeat(" ", byteRangeWidth))
+	buf.WriteString("] /Contents ")
+	layout.contentsStart = buf.Len()
+	buf.WriteByte('<')
+	buf.WriteString(strings.Repeat("0", 2*contentsSize))
+	buf.WriteByte('>')
+	layout.contentsEnd = buf.Len()
+	buf.WriteString(">>")
+	return buf.Bytes(), layout
+}
+
+// FormatDate renders a PDF date string, D:YYYYMMDDHHmmSS+HH'mm'.
+func FormatDate(t time.Time) string {
+	_, offset := t.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return fmt.Sprintf("D:%s%c%02d'%02d'", t.Format("20060102150405"), sign, offset/3600, offset%3600/60)
+}
+
+// ParseDate reads a PDF date string; missing trailing fields default as the
+// specification describes.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimPrefix(s, "D:")
+	s = strings.ReplaceAll(s, "'", "")
+	layouts := []string{"20060102150405-0700", "20060102150405Z0700", "20060102150405Z", "20060102150405", "200601021504", "2006010215", "20060102", "200601", "2006"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: date %q", ErrMalformed, s)
+}
+
+// firstPage walks the page tree down its first kids.
+func (r *Reader) firstPage(catalog Dict) (Ref, Dict, error) {
+	node := catalog[Name("Pages")]
+	for i := 0; i < maxNesting; i++ {
+		ref, ok := node.(Ref)
+		if !ok {
+			return Ref{}, nil, ErrMalformed
+		}
+		dict, err := r.Dict(ref)
+		if err != nil {
+			return Ref{}, nil, err
+		}
+		if dict[Name("Type")] == Name("Page") {
+			return ref, dict, nil
+		}
+		kids, err := r.Array(dict[Name("Kids")])
+		if err != nil || len(kids) == 0 {
+			return Ref{}, nil, ErrMalformed
+		}
+		node = kids[0]
+	}
+	return Ref{}, nil, ErrMalformed
+}
+
+// nextFieldName picks "SignatureN" not used by an existing form field.
+func (r *Reader) nextFieldName(catalog Dict) (string, error) {
+	used := map[string]bool{}
+	if catalog[Name("AcroForm")] != nil {
+		form, err := r.Dict(catalog[Name("AcroForm")])
+		if err != nil {
+			return "", err
+		}
+		fields, err := r.Array(form[Name("Fields")])
+		if err != nil {
+			return "", err
+		}
+		for _, f := range fields {
+			field, err := r.Dict(f)
+			if err != nil {
+				continue
+			}
+			if name, ok := field[Name("T")].(String); ok {
+				used[DecodeTextString(name)] = true
+			}
+		}
+	}
+	for n := 1; ; n++ {
+		name := fmt.Sprintf("Signature%d", n)
+		if !used[name] {
+			return name, nil
+		}
+	}
+}
+
+// appendToArray adds item to the array under key in the dictionary owner,
+// rewriting either the array object (when indirect) or the owner.
+func (r *Reader) appendToArray(u *Update, owner Dict, ownerRef Ref, key Name, item Object) error {
+	if ref, ok := owner[key].(Ref); ok {
+		arr, err := r.Array(ref)
+		if err != nil {
+			return err
+		}
+		u.Replace(ref, append(append(Array{}, arr...), item))
+		return nil
+	}
+	arr, err := r.Array(owner[key])
+	if err != nil {
+		return err
+	}
+	updated := owner.Copy()
+	updated[key] = append(append(Array{}, arr...), item)
+	u.Replace(ownerRef, updated)
+	return nil
+}
+
+// addFormField registers a signature field in the interactive form, creating
+// the form if the document has none.
+func (r *Reader) addFormField(u *Update, catalog Dict, catalogRef Ref, fieldRef Ref) error {
+	if formRef, ok := catalog[Name("AcroForm")].(Ref); ok {
+		form, err := r.Dict(formRef)
+		if err != nil {
+			return err
+		}
+		form = form.Copy()
+		form[Name("SigFlags")] = int64(3)
+		if err := r.appendToArray(u, form, formRef, Name("Fields"), fieldRef); err != nil {
+			return err
+		}
+		// appendToArray may have replaced only the fields array
+		if _, replaced := u.objects[formRef.Num]; !replaced {
+			u.Replace(formRef, form)
+		}
+		return nil
+	}
+
+	form := Dict{}
+	if existing, ok := catalog[Name("AcroForm")].(Dict); ok {
+		form = existing.Copy()
+	}
+	form[Name("SigFlags")] = int64(3)
+	if fieldsRef, ok := form[Name("Fields")].(Ref); ok {
+		fields, err := r.Array(fieldsRef)
+		if err != nil {
+			return err
+		}
+		u.Replace(fieldsRef, append(append(Array{}, fields...), fieldRef))
+	} else {
+		fields, err := r.Array(form[Name("Fields")])
+		if err != nil {
+			return err
+		}
+		form[Name("Fields")] = append(append(Array{}, fields...), fieldRef)
+	}
+
+	updated := catalog.Copy()
+	updated[Name("AcroForm")] = form
+	u.Replace(catalogRef, updated)
+	return nil
+}
@@ -0,0 +1,160 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Update collects new and replaced objects and serializes them as an
+// incremental update appended after the existing file.
+type Update struct {
+	r       *Reader
+	nextNum int
+	objects map[int]Object
+	// offsets of each object's body in the serialized update, filled by Bytes
+	offsets map[int]int64
+}
+
+// NewUpdate starts an incremental update on top of the reader's file.
+func (r *Reader) NewUpdate() *Update {
+	size, _ := r.trailer[Name("Size")].(int64)
+	return &Update{
+		r:       r,
+		nextNum: int(size),
+		objects: map[int]Object{},
+		offsets: map[int]int64{},
+	}
+}
+
+// Add allocates a new object number for obj.
+func (u *Update) Add(obj Object) Ref {
+	ref := Ref{Num: u.nextNum}
+	u.nextNum++
+	u.objects[ref.Num] = obj
+	return ref
+}
+
+// Replace writes a new revision of an existing object.
+func (u *Update) Replace(ref Ref, obj Object) {
+	u.objects[ref.Num] = obj
+}
+
+// BodyOffset returns where the body of an object written by Bytes starts,
+// relative to the beginning of the update.
+func (u *Update) BodyOffset(ref Ref) int64 {
+	return u.offsets[ref.Num]
+}
+
+// Bytes serializes the update: the objects, a cross-reference section of the
+// same kind as the file's newest one, and the trailer.
+func (u *Update) Bytes() []byte {
+	base := u.r.size
+	var buf bytes.Buffer
+	buf.WriteString("\n")
+
+	nums := make([]int, 0, len(u.objects))
+	for num := range u.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	positions := map[int]int64{}
+	for _, num := range nums {
+		positions[num] = base + int64(buf.Len())
+		fmt.Fprintf(&buf, "%d %d obj\n", num, u.generation(num))
+		u.offsets[num] = int64(buf.Len())
+		writeObject(&buf, u.objects[num])
+		buf.WriteString("\nendobj\n")
+	}
+
+	trailer := Dict{
+		Name("Size"): int64(u.nextNum),
+		Name("Root"): u.r.trailer[Name("Root")],
+		Name("Prev"): u.r.startXRef,
+	}
+	for _, key := range []Name{"Info", "ID"} {
+		if v, ok := u.r.trailer[key]; ok {
+			trailer[key] = v
+		}
+	}
+
+	xrefOffset := base + int64(buf.Len())
+	if u.r.xrefStream {
+		u.writeXRefStream(&buf, trailer, nums, positions, xrefOffset)
+	} else {
+		u.writeXRefTable(&buf, trailer, nums, positions)
+	}
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes()
+}
+
+func (u *Update) generation(num int) int {
+	if entry, ok := u.r.xref[num]; ok && entry.kind == xrefOffset {
+		return entry.gen
+	}
+	return 0
+}
+
+func (u *Update) writeXRefTable(buf *bytes.Buffer, trailer Dict, nums []int, positions map[int]int64) {
+	buf.WriteString("xref\n")
+	for i := 0; i < len(nums); {
+		j := i
+		for j+1 < len(nums) && nums[j+1] == nums[j]+1 {
+			j++
+		}
+		fmt.Fprintf(buf, "%d %d\n", nums[i], j-i+1)
+		for _, num := range nums[i : j+1] {
+			fmt.Fprintf(buf, "%010d %05d n\r\n", positions[num], u.generation(num))
+		}
+		i = j + 1
+	}
+	buf.WriteString("trailer\n")
+	writeObject(buf, trailer)
+	buf.WriteString("\n")
+}
+
+func (u *Update) writeXRefStream(buf *bytes.Buffer, trailer Dict, nums []int, positions map[int]int64, xrefOffset int64) {
+	// the stream describes itself too
+	self := u.nextNum
+	u.nextNum++
+	trailer[Name("Size")] = int64(u.nextNum)
+	nums = append(nums, self)
+	positions[self] = xrefOffset
+
+	width := 4
+	if xrefOffset > 0xffffffff {
+		width = 8
+	}
+
+	var index Array
+	var data []byte
+	for i := 0; i < len(nums); {
+		j := i
+		for j+1 < len(nums) && nums[j+1] == nums[j]+1 {
+			j++
+		}
+		index = append(index, int64(nums[i]), int64(j-i+1))
+		for _, num := range nums[i : j+1] {
+			data = append(data, 1)
+			for shift := (width - 1) * 8; shift >= 0; shift -= 8 {
+				data = append(data, byte(positions[num]>>uint(shift)))
+			}
+			gen := u.generation(num)
+			data = append(data, byte(gen>>8), byte(gen))
+		}
+		i = j + 1
+	}
+
+	dict := trailer.Copy()
+	dict[Name("Type")] = Name("XRef")
+	dict[Name("W")] = Array{int64(1), int64(width), int64(2)}
+	dict[Name("Index")] = index
+	dict[Name("Length")] = int64(len(data))
+
+	fmt.Fprintf(buf, "%d 0 obj\n", self)
+	writeObject(buf, dict)
+	buf.WriteString("\nstream\n")
+	buf.Write(data)
+	buf.WriteString("\nendstream\nendobj\n")
+}
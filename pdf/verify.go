@@ -0,0 +1,360 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/cms"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/PhanPhuc2609/be-sign-file/tsa"
+)
+
+var (
+	ErrInvalidByteRange     = errors.New("pdf: signature byte range is invalid")
+	ErrUnsupportedSubFilter = errors.New("pdf: unsupported signature sub filter")
+)
+
+// VerifyOptions configure signature validation.
+type VerifyOptions struct {
+	// Trust holds the accepted roots. Without it every chain is reported
+	// as untrusted.
+	Trust *pki.TrustStore
+	// Now is the validation time used when a signature claims no signing
+	// time. Defaults to the current time.
+	Now time.Time
+}
+
+// SignatureResult is the outcome for one signature dictionary.
+type SignatureResult struct {
+	Field     string
+	Name      string
+	Reason    string
+	Location  string
+	SubFilter string
+	// SigningTime is the time claimed by the signer, from the CMS signed
+	// attributes or else the /M entry. Zero when neither is present.
+	SigningTime time.Time
+	ByteRange   [4]int64
+	// CoversDocument is set when the signed ranges reach the end of the
+	// file, i.e. nothing was appended after this signature.
+	CoversDocument bool
+
+	Signer *x509.Certificate
+	Chain  []*x509.Certificate
+
+	// Timestamp is the time of the signature time-stamp token, zero when
+	// the signature has none.
+	Timestamp time.Time
+
+	DigestValid    bool
+	SignatureValid bool
+	ChainValid     bool
+	TimestampValid bool
+	// Err is the first problem found, nil for a valid signature.
+	Err error
+}
+
+// Valid reports whether the signed bytes are intact, the signature checks
+// out, the signer chains to a trusted root and a time-stamp token, if any,
+// is valid.
+func (s SignatureResult) Valid() bool {
+	return s.DigestValid && s.SignatureValid && s.ChainValid && (s.Timestamp.IsZero() || s.TimestampValid)
+}
+
+// VerifyResult lists the signatures of a document in the order they were
+// applied.
+type VerifyResult struct {
+	Signatures []SignatureResult
+	// ModifiedAfterLastSignature is set when bytes follow the ranges of the
+	// newest signature, so the file is not exactly what was last signed.
+	ModifiedAfterLastSignature bool
+}
+
+// Verify finds every signature field of the PDF and validates it.
+func Verify(src io.ReaderAt, size int64, opts VerifyOptions) (*VerifyResult, error) {
+	r, err := NewReader(src, size)
+	if err != nil {
+		return nil, err
+	}
+	_, catalog, err := r.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	fields, err := r.signatureFields(catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VerifyResult{}
+	for _, field := range fields {
+		result.Signatures = append(result.Signatures, r.verifySignature(field, opts))
+	}
+	sort.SliceStable(result.Signatures, func(i, j int) bool {
+		return rangeEnd(result.Signatures[i]) < rangeEnd(result.Signatures[j])
+	})
+	if n := len(result.Signatures); n > 0 {
+		result.ModifiedAfterLastSignature = !result.Signatures[n-1].CoversDocument
+	}
+	return result, nil
+}
+
+func rangeEnd(s SignatureResult) int64 {
+	return s.ByteRange[2] + s.ByteRange[3]
+}
+
+type signatureField struct {
+	name  string
+	value Dict
+}
+
+// signatureFields walks the AcroForm field tree for signed signature fields.
+func (r *Reader) signatureFields(catalog Dict) ([]signatureField, error) {
+	if catalog[Name("AcroForm")] == nil {
+		return nil, nil
+	}
+	form, err := r.Dict(catalog[Name("AcroForm")])
+	if err != nil {
+		return nil, err
+	}
+	roots, err := r.Array(form[Name("Fields")])
+	if err != nil {
+		return nil, err
+	}
+
+	var out []signatureField
+	seen := map[Ref]bool{}
+	var walk func(items Array, parentName string, parentType Object, depth int) error
+	walk = func(items Array, parentName string, parentType Object, depth int) error {
+		if depth > maxNesting {
+			return ErrMalformed
+		}
+		for _, item := range items {
+			if ref, ok := item.(Ref); ok {
+				if seen[ref] {
+					continue
+				}
+				seen[ref] = true
+			}
+			field, err := r.Dict(item)
+			if err != nil {
+				return err
+			}
+
+			name := parentName
+			if partial, ok := field[Name("T")].(String); ok {
+				if name != "" {
+					name += "."
+				}
+				name += DecodeTextString(partial)
+			}
+			fieldType := parentType
+			if ft, ok := field[Name("FT")]; ok {
+				fieldType = ft
+			}
+
+			if fieldType == Name("Sig") && field[Name("V")] != nil {
+				value, err := r.Dict(field[Name("V")])
+				if err != nil {
+					return err
+				}
+				out = append(out, signatureField{name: name, value: value})
+			}
+			if field[Name("Kids")] != nil {
+				kids, err := r.Array(field[Name("Kids")])
+				if err != nil {
+					return err
+				}
+				if err := walk(kids, name, fieldType, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(roots, "", nil, 0); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *Reader) verifySignature(field signatureField, opts VerifyOptions) SignatureResult {
+	v := field.value
+	res := SignatureResult{Field: field.name}
+	res.Name = textEntry(v, "Name")
+	res.Reason = textEntry(v, "Reason")
+	res.Location = textEntry(v, "Location")
+	if subFilter, ok := v[Name("SubFilter")].(Name); ok {
+		res.SubFilter = string(subFilter)
+	}
+	if m, ok := v[Name("M")].(String); ok {
+		if t, err := ParseDate(string(m)); err == nil {
+			res.SigningTime = t
+		}
+	}
+
+	contents, err := r.signedRanges(v, &res)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	switch res.SubFilter {
+	case "adbe.pkcs7.detached", "ETSI.CAdES.detached":
+	default:
+		res.Err = ErrUnsupportedSubFilter
+		return res
+	}
+
+	sd, err := cms.ParsePadded(contents)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if !sd.Detached || len(sd.SignerInfos) == 0 {
+		res.Err = cms.ErrMalformed
+		return res
+	}
+	si := sd.SignerInfos[0]
+	if t, ok := si.SigningTime(); ok {
+		res.SigningTime = t
+	}
+
+	br := res.ByteRange
+	digests, err := sd.Digests(io.MultiReader(
+		io.NewSectionReader(r.ra, br[0], br[1]),
+		io.NewSectionReader(r.ra, br[2], br[3]),
+	))
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	digestHash, err := si.DigestHash()
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if res.Signer, err = sd.SignerCertificate(si); err != nil {
+		res.Err = err
+		return res
+	}
+	_, err = sd.VerifySigner(si, digests[digestHash])
+	if errors.Is(err, cms.ErrDigestMismatch) {
+		res.Err = err
+		return res
+	}
+	res.DigestValid = true
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.SignatureValid = true
+	if res.Name == "" {
+		res.Name = res.Signer.Subject.CommonName
+	}
+
+	if opts.Trust == nil {
+		res.Err = pki.ErrUntrustedChain
+		return res
+	}
+	if err := verifyTimestamp(si, opts.Trust, &res); err != nil {
+		res.Err = err
+		return res
+	}
+
+	// the chain is checked at the time-stamped, else the claimed, signing
+	// time so that signatures made before the signer certificate expired
+	// stay valid
+	at := res.Timestamp
+	if at.IsZero() {
+		at = res.SigningTime
+	}
+	if at.IsZero() {
+		at = opts.Now
+	}
+	res.Chain, err = opts.Trust.Verify(res.Signer, sd.Certificates, at)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.ChainValid = true
+	return res
+}
+
+// verifyTimestamp checks the signatureTimeStampToken attribute of a PAdES-B-T
+// signature. Signatures without one are left alone.
+func verifyTimestamp(si *cms.SignerInfo, trust *pki.TrustStore, res *SignatureResult) error {
+	attr := si.UnsignedAttribute(cms.OIDAttributeTimeStampToken)
+	if attr == nil || len(attr.Values) == 0 {
+		return nil
+	}
+	token, err := tsa.ParseToken(attr.Values[0].FullBytes)
+	if err != nil {
+		return err
+	}
+	res.Timestamp = token.Info.GenTime
+	if _, err := token.Verify(si.Signature, trust); err != nil {
+		return err
+	}
+	res.TimestampValid = true
+	return nil
+}
+
+// signedRanges checks the /ByteRange of a signature dictionary: it must start
+// at the beginning of the file and leave out exactly the hex string holding
+// the signature, which is returned decoded.
+func (r *Reader) signedRanges(v Dict, res *SignatureResult) ([]byte, error) {
+	ranges, err := r.Array(v[Name("ByteRange")])
+	if err != nil || len(ranges) != 4 {
+		return nil, ErrInvalidByteRange
+	}
+	for i, item := range ranges {
+		n, ok := item.(int64)
+		if !ok || n < 0 {
+			return nil, ErrInvalidByteRange
+		}
+		res.ByteRange[i] = n
+	}
+	br := res.ByteRange
+	end := br[2] + br[3]
+	if br[0] != 0 || br[1] >= br[2] || end > r.size {
+		return nil, ErrInvalidByteRange
+	}
+	res.CoversDocument = end == r.size
+
+	gap := make([]byte, br[2]-br[1])
+	if _, err := r.ra.ReadAt(gap, br[1]); err != nil {
+		return nil, ErrInvalidByteRange
+	}
+	if len(gap) < 2 || gap[0] != '<' || gap[len(gap)-1] != '>' {
+		return nil, ErrInvalidByteRange
+	}
+	digits := bytes.Map(func(c rune) rune {
+		if isWhitespace(byte(c)) {
+			return -1
+		}
+		return c
+	}, gap[1:len(gap)-1])
+	contents := make([]byte, hex.DecodedLen(len(digits)))
+	if _, err := hex.Decode(contents, digits); err != nil {
+		return nil, ErrInvalidByteRange
+	}
+	return contents, nil
+}
+
+func textEntry(d Dict, key Name) string {
+	s, ok := d[key].(String)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(DecodeTextString(s))
+}
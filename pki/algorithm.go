@@ -0,0 +1,187 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+)
+
+// Signature algorithm identifiers stored in entity.Signature.Algorithm.
+const (
+	// AlgRSALegacy is what rows signed before algorithm selection carry, it
+	// means RSA PKCS#1 v1.5 with SHA-256.
+	AlgRSALegacy    = "RSA"
+	AlgRSASHA256    = "RSA-SHA256"
+	AlgRSAPSSSHA256 = "RSA-PSS-SHA256"
+	AlgECDSASHA256  = "ECDSA-SHA256"
+	AlgECDSASHA384  = "ECDSA-SHA384"
+	AlgEd25519      = "Ed25519"
+)
+
+// Key types accepted when generating user keys.
+const (
+	KeyRSA2048   = "RSA-2048"
+	KeyRSA3072   = "RSA-3072"
+	KeyECDSAP256 = "ECDSA-P256"
+	KeyECDSAP384 = "ECDSA-P384"
+	KeyEd25519   = "Ed25519"
+)
+
+var ErrUnsupportedAlgorithm = errors.New("unsupported signature algorithm")
+
+// Algorithm describes how a signature value was produced. For RSASSA-PSS,
+// SaltLength is the salt used when signing; zero when verifying means the salt
+// length is detected from the signature.
+type Algorithm struct {
+	Name       string
+	KeyType    string
+	Hash       crypto.Hash
+	PSS        bool
+	SaltLength int
+}
+
+var algorithms = map[string]Algorithm{
+	AlgRSALegacy:    {Name: AlgRSALegacy, KeyType: "RSA", Hash: crypto.SHA256},
+	AlgRSASHA256:    {Name: AlgRSASHA256, KeyType: "RSA", Hash: crypto.SHA256},
+	AlgRSAPSSSHA256: {Name: AlgRSAPSSSHA256, KeyType: "RSA", Hash: crypto.SHA256, PSS: true, SaltLength: crypto.SHA256.Size()},
+	AlgECDSASHA256:  {Name: AlgECDSASHA256, KeyType: "ECDSA", Hash: crypto.SHA256},
+	AlgECDSASHA384:  {Name: AlgECDSASHA384, KeyType: "ECDSA", Hash: crypto.SHA384},
+	AlgEd25519:      {Name: AlgEd25519, KeyType: "Ed25519"},
+}
+
+// LookupAlgorithm resolves a stored algorithm identifier.
+func LookupAlgorithm(name string) (Algorithm, error) {
+	alg, ok := algorithms[name]
+	if !ok {
+		return Algorithm{}, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, name)
+	}
+	return alg, nil
+}
+
+// DefaultAlgorithm picks the algorithm used when a request does not ask for
+// one: RSASSA-PSS for RSA, SHA-256 for P-256 and SHA-384 for P-384.
+func DefaultAlgorithm(pub crypto.PublicKey) (string, error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return AlgRSAPSSSHA256, nil
+	case *ecdsa.PublicKey:
+		if key.Curve == elliptic.P384() {
+			return AlgECDSASHA384, nil
+		}
+		return AlgECDSASHA256, nil
+	case ed25519.PublicKey:
+		return AlgEd25519, nil
+	default:
+		return "", ErrUnsupportedKeyType
+	}
+}
+
+// ResolveAlgorithm validates a requested algorithm against the signer's key,
+// falling back to DefaultAlgorithm when none was requested.
+func ResolveAlgorithm(requested string, pub crypto.PublicKey) (Algorithm, error) {
+	if requested == "" {
+		name, err := DefaultAlgorithm(pub)
+		if err != nil {
+			return Algorithm{}, err
+		}
+		requested = name
+	}
+	alg, err := LookupAlgorithm(requested)
+	if err != nil {
+		return Algorithm{}, err
+	}
+	if alg.KeyType != KeyAlgorithm(pub) {
+		return Algorithm{}, fmt.Errorf("algorithm %s cannot be used with a %s key", alg.Name, KeyAlgorithm(pub))
+	}
+	return alg, nil
+}
+
+// WithSaltLength returns a copy of a PSS algorithm using the salt length
+// recorded with a stored signature, zero meaning unknown. Other algorithms are
+// returned unchanged.
+func (alg Algorithm) WithSaltLength(saltLength int) Algorithm {
+	if alg.PSS {
+		alg.SaltLength = saltLength
+	}
+	return alg
+}
+
+// SignerOpts returns the options to pass to crypto.Signer.Sign.
+func (alg Algorithm) SignerOpts() crypto.SignerOpts {
+	if alg.PSS {
+		return &rsa.PSSOptions{SaltLength: alg.SaltLength, Hash: alg.Hash}
+	}
+	return alg.Hash
+}
+
+// Sign hashes message as the algorithm requires and signs it.
+func (alg Algorithm) Sign(signer crypto.Signer, message []byte) ([]byte, error) {
+	if alg.Hash == 0 {
+		return signer.Sign(rand.Reader, message, crypto.Hash(0))
+	}
+	h := alg.Hash.New()
+	h.Write(message)
+	return signer.Sign(rand.Reader, h.Sum(nil), alg.SignerOpts())
+}
+
+// Verify checks a signature produced by Sign.
+func (alg Algorithm) Verify(pub crypto.PublicKey, message, signature []byte) error {
+	if alg.KeyType != KeyAlgorithm(pub) {
+		return ErrKeyMismatch
+	}
+
+	var digest []byte
+	if alg.Hash != 0 {
+		h := alg.Hash.New()
+		h.Write(message)
+		digest = h.Sum(nil)
+	}
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if alg.PSS {
+			saltLength := alg.SaltLength
+			if saltLength == 0 {
+				saltLength = rsa.PSSSaltLengthAuto
+			}
+			return rsa.VerifyPSS(key, alg.Hash, digest, signature, &rsa.PSSOptions{SaltLength: saltLength})
+		}
+		return rsa.VerifyPKCS1v15(key, alg.Hash, digest, signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, signature) {
+			return errors.New("ecdsa: verification error")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, message, signature) {
+			return errors.New("ed25519: verification error")
+		}
+		return nil
+	default:
+		return ErrUnsupportedKeyType
+	}
+}
+
+// GenerateKey creates a new private key of one of the Key* types.
+func GenerateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case KeyRSA2048, "":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyRSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case KeyECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedKeyType, keyType)
+	}
+}
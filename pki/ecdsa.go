@@ -0,0 +1,47 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+var ErrInvalidECDSASignature = errors.New("invalid ECDSA signature encoding")
+
+// ECDSAToRaw converts an ASN.1 ECDSA signature, as returned by crypto.Signer,
+// to the fixed size r||s form used by XML-DSig and JOSE.
+func ECDSAToRaw(pub *ecdsa.PublicKey, signature []byte) ([]byte, error) {
+	var inner cryptobyte.String
+	r, s := new(big.Int), new(big.Int)
+	input := cryptobyte.String(signature)
+	if !input.ReadASN1(&inner, cbasn1.SEQUENCE) || !input.Empty() ||
+		!inner.ReadASN1Integer(r) || !inner.ReadASN1Integer(s) || !inner.Empty() {
+		return nil, ErrInvalidECDSASignature
+	}
+
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	if r.Sign() <= 0 || s.Sign() <= 0 || len(r.Bytes()) > size || len(s.Bytes()) > size {
+		return nil, ErrInvalidECDSASignature
+	}
+	out := make([]byte, 2*size)
+	r.FillBytes(out[:size])
+	s.FillBytes(out[size:])
+	return out, nil
+}
+
+// ECDSAFromRaw is the inverse of ECDSAToRaw.
+func ECDSAFromRaw(pub *ecdsa.PublicKey, raw []byte) ([]byte, error) {
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	if len(raw) != 2*size {
+		return nil, ErrInvalidECDSASignature
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1BigInt(new(big.Int).SetBytes(raw[:size]))
+		b.AddASN1BigInt(new(big.Int).SetBytes(raw[size:]))
+	})
+	return b.Bytes()
+}
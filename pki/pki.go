@@ -0,0 +1,155 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidCertificatePEM = errors.New("invalid certificate PEM")
+	ErrInvalidPrivateKeyPEM  = errors.New("invalid private key PEM")
+	ErrInvalidPublicKeyPEM   = errors.New("invalid public key PEM")
+	ErrUnsupportedKeyType    = errors.New("unsupported key type")
+	ErrKeyMismatch           = errors.New("private key does not match certificate")
+)
+
+// ParseCertificatePEM decodes the first CERTIFICATE block of a PEM string.
+func ParseCertificatePEM(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, ErrInvalidCertificatePEM
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// ParsePrivateKeyPEM accepts PKCS#1, SEC 1 and PKCS#8 encoded keys and returns
+// them as a crypto.Signer.
+func ParsePrivateKeyPEM(keyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, ErrInvalidPrivateKeyPEM
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, ErrUnsupportedKeyType
+		}
+		return signer, nil
+	default:
+		return nil, ErrInvalidPrivateKeyPEM
+	}
+}
+
+// EncodeCertificatePEM wraps a DER certificate in a CERTIFICATE PEM block.
+func EncodeCertificatePEM(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// Fingerprint returns the lowercase hex SHA-256 of the certificate DER.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// SerialHex formats a certificate serial number the way it is stored in the
+// database.
+func SerialHex(cert *x509.Certificate) string {
+	return strings.ToLower(cert.SerialNumber.Text(16))
+}
+
+// MatchesCertificate reports whether signer is the private half of the
+// certificate's public key.
+func MatchesCertificate(signer crypto.Signer, cert *x509.Certificate) error {
+	type equaler interface {
+		Equal(x crypto.PublicKey) bool
+	}
+
+	pub, ok := signer.Public().(equaler)
+	if !ok {
+		return ErrUnsupportedKeyType
+	}
+	if !pub.Equal(cert.PublicKey) {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+// KeyAlgorithm names the public key family of a certificate.
+func KeyAlgorithm(pub crypto.PublicKey) string {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return "RSA"
+	case *ecdsa.PublicKey:
+		return "ECDSA"
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return ""
+	}
+}
+
+// CheckPublicKey rejects key types and sizes the platform does not issue
+// certificates for.
+func CheckPublicKey(pub crypto.PublicKey) error {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return errors.New("RSA keys must be at least 2048 bits")
+		}
+	case *ecdsa.PublicKey:
+		if name := key.Curve.Params().Name; name != "P-256" && name != "P-384" {
+			return errors.New("ECDSA keys must use P-256 or P-384")
+		}
+	case ed25519.PublicKey:
+	default:
+		return ErrUnsupportedKeyType
+	}
+	return nil
+}
+
+// EncodePrivateKeyPEM stores any supported key as an unencrypted PKCS#8
+// PRIVATE KEY block.
+func EncodePrivateKeyPEM(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// EncodePublicKeyPEM stores a public key as a PKIX PUBLIC KEY block.
+func EncodePublicKeyPEM(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// ParsePublicKeyPEM decodes a PKIX PUBLIC KEY block, as written by
+// EncodePublicKeyPEM.
+func ParsePublicKeyPEM(pubPEM string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pubPEM))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, ErrInvalidPublicKeyPEM
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
@@ -0,0 +1,129 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrUntrustedChain = errors.New("certificate chain does not lead to a trusted root")
+
+// TrustStore holds the root certificates accepted when validating signatures
+// made outside this service.
+type TrustStore struct {
+	roots *x509.CertPool
+	certs []*x509.Certificate
+}
+
+func NewTrustStore(roots ...*x509.Certificate) *TrustStore {
+	ts := &TrustStore{roots: x509.NewCertPool()}
+	for _, cert := range roots {
+		ts.Add(cert)
+	}
+	return ts
+}
+
+// LoadTrustStore reads every .pem, .crt and .cer file in dir. PEM files may
+// hold several certificates; other files are taken as a single DER
+// certificate. A missing directory gives an empty store.
+func LoadTrustStore(dir string) (*TrustStore, error) {
+	ts := NewTrustStore()
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return ts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".pem" && ext != ".crt" && ext != ".cer") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		certs, err := parseCertificates(data)
+		if err != nil {
+			return nil, errors.New(entry.Name() + ": " + err.Error())
+		}
+		for _, cert := range certs {
+			ts.Add(cert)
+		}
+	}
+	return ts, nil
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	if !strings.Contains(string(data), "-----BEGIN") {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.Certificate{cert}, nil
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, ErrInvalidCertificatePEM
+	}
+	return certs, nil
+}
+
+// Add trusts cert as a root.
+func (ts *TrustStore) Add(cert *x509.Certificate) {
+	ts.roots.AddCert(cert)
+	ts.certs = append(ts.certs, cert)
+}
+
+// Certificates returns the trusted roots.
+func (ts *TrustStore) Certificates() []*x509.Certificate {
+	return ts.certs
+}
+
+// Verify builds a path from cert to a trusted root, using intermediates as
+// candidate issuers, valid at the given time. Extended key usage is not
+// restricted: signing certificates carry a variety of purposes.
+func (ts *TrustStore) Verify(cert *x509.Certificate, intermediates []*x509.Certificate, at time.Time) ([]*x509.Certificate, error) {
+	pool := x509.NewCertPool()
+	for _, c := range intermediates {
+		if !c.Equal(cert) {
+			pool.AddCert(c)
+		}
+	}
+	chains, err := cert.Verify(x509.VerifyOptions{
+		Roots:         ts.roots,
+		Intermediates: pool,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		var invalid x509.CertificateInvalidError
+		if errors.As(err, &invalid) {
+			return nil, err
+		}
+		return nil, ErrUntrustedChain
+	}
+	return chains[0], nil
+}
@@ -0,0 +1,15 @@
+package provider
+
+import (
+	"github.com/PhanPhuc2609/be-sign-file/controller"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/samber/do"
+)
+
+func ProvideCADependencies(injector *do.Injector, caService service.CAService) {
+	do.Provide(
+		injector, func(i *do.Injector) (controller.CAController, error) {
+			return controller.NewCAController(caService), nil
+		},
+	)
+}
@@ -1,9 +1,17 @@
 package provider
 
 import (
+	"errors"
+	"fmt"
+	"log"
+
 	"github.com/PhanPhuc2609/be-sign-file/config"
 	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/hsm"
+	"github.com/PhanPhuc2609/be-sign-file/keyring"
+	"github.com/PhanPhuc2609/be-sign-file/repository"
 	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
 	"github.com/samber/do"
 	"gorm.io/gorm"
 )
@@ -21,12 +29,112 @@ func RegisterDependencies(injector *do.Injector) {
 		return service.NewJWTService(), nil
 	})
 
+	// token chỉ được mở một lần cho cả CA và khóa của user
+	do.ProvideNamed(injector, constants.PKCS11Token, func(i *do.Injector) (*hsm.Token, error) {
+		return hsm.Open(config.NewPKCS11Config())
+	})
+
+	do.ProvideNamed(injector, constants.CAService, func(i *do.Injector) (service.CAService, error) {
+		cfg := config.NewCAConfig()
+		var keys hsm.KeyStore
+		switch cfg.KeyBackend {
+		case config.KEY_BACKEND_SOFTWARE:
+		case config.KEY_BACKEND_PKCS11:
+			token, err := do.InvokeNamed[*hsm.Token](i, constants.PKCS11Token)
+			if err != nil {
+				return nil, fmt.Errorf("CA keys: %w", err)
+			}
+			keys = token
+		default:
+			return nil, fmt.Errorf("unknown CA_KEY_BACKEND %q", cfg.KeyBackend)
+		}
+		db := do.MustInvokeNamed[*gorm.DB](i, constants.DB)
+		return service.NewCAService(
+			repository.NewCertificateRepository(db),
+			repository.NewUserRepository(db),
+			repository.NewKeyUsageRepository(db),
+			cfg,
+			keys,
+		), nil
+	})
+
+	do.ProvideNamed(injector, constants.Keyring, func(i *do.Injector) (*keyring.Keyring, error) {
+		return keyring.New(config.NewEncryptionConfig())
+	})
+
+	do.ProvideNamed(injector, constants.EncryptionService, func(i *do.Injector) (service.EncryptionService, error) {
+		keys, err := do.InvokeNamed[*keyring.Keyring](i, constants.Keyring)
+		if err != nil {
+			return nil, err
+		}
+		db := do.MustInvokeNamed[*gorm.DB](i, constants.DB)
+		return service.NewEncryptionService(repository.NewDataKeyRepository(db), keys), nil
+	})
+
+	do.ProvideNamed(injector, constants.KeyVaultService, func(i *do.Injector) (service.KeyVaultService, error) {
+		// không có master key thì khóa riêng của user chỉ được bảo vệ bằng PIN
+		keys, err := do.InvokeNamed[*keyring.Keyring](i, constants.Keyring)
+		if errors.Is(err, keyring.ErrNoMasterKey) {
+			keys = nil
+		} else if err != nil {
+			return nil, err
+		}
+		// khóa của user chỉ có thể nằm trong HSM khi cấu hình PKCS11_MODULE
+		var keyStore hsm.KeyStore
+		if config.NewPKCS11Config().Enabled() {
+			token, err := do.InvokeNamed[*hsm.Token](i, constants.PKCS11Token)
+			if err != nil {
+				return nil, fmt.Errorf("user keys: %w", err)
+			}
+			keyStore = token
+		}
+		db := do.MustInvokeNamed[*gorm.DB](i, constants.DB)
+		return service.NewKeyVaultService(
+			repository.NewVaultKeyRepository(db),
+			repository.NewKeyUsageRepository(db),
+			repository.NewUserRepository(db),
+			keys,
+			keyStore,
+			db,
+		), nil
+	})
+
+	do.ProvideNamed(injector, constants.Storage, func(i *do.Injector) (storage.Storage, error) {
+		store, err := storage.New(config.NewStorageConfig())
+		if err != nil {
+			return nil, err
+		}
+		encryptionConfig := config.NewEncryptionConfig()
+		switch {
+		case encryptionConfig.Off && encryptionConfig.Enabled():
+			return nil, errors.New("STORAGE_ENCRYPTION=off cannot be used with a master key")
+		case encryptionConfig.Off:
+			log.Println("STORAGE_ENCRYPTION=off, documents are stored unencrypted")
+			return store, nil
+		case !encryptionConfig.Enabled():
+			return nil, errors.New("MASTER_KEY_FILE or MASTER_KEY is required to encrypt documents, set STORAGE_ENCRYPTION=off to store them unencrypted")
+		}
+		if encryptionConfig.AllowPlaintext {
+			log.Println("STORAGE_ALLOW_PLAINTEXT=true, unencrypted documents are still read")
+		}
+		encryptionService, err := do.InvokeNamed[service.EncryptionService](i, constants.EncryptionService)
+		if err != nil {
+			return nil, err
+		}
+		// tài liệu, file đã ký và upload dở đều nằm dưới uploads/
+		return storage.NewEncrypted(store, encryptionService, encryptionConfig.AllowPlaintext, service.UPLOAD_DIR+"/"), nil
+	})
+
 	// Initialize
 	db := do.MustInvokeNamed[*gorm.DB](injector, constants.DB)
 	jwtService := do.MustInvokeNamed[service.JWTService](injector, constants.JWTService)
+	caService := do.MustInvokeNamed[service.CAService](injector, constants.CAService)
+	store := do.MustInvokeNamed[storage.Storage](injector, constants.Storage)
+	keyVault := do.MustInvokeNamed[service.KeyVaultService](injector, constants.KeyVaultService)
 
 	// Provide Dependencies
-	ProvideUserDependencies(injector, db, jwtService)
-	ProvideDocumentDependencies(injector, db)
-	ProvideSignatureDependencies(injector, db)
+	ProvideUserDependencies(injector, db, jwtService, caService, keyVault, store)
+	ProvideDocumentDependencies(injector, db, caService, store)
+	ProvideSignatureDependencies(injector, db, caService, keyVault, store)
+	ProvideCADependencies(injector, caService)
 }
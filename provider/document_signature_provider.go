@@ -1,31 +1,63 @@
 package provider
 
 import (
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/constants"
 	"github.com/PhanPhuc2609/be-sign-file/controller"
 	"github.com/PhanPhuc2609/be-sign-file/repository"
 	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
 	"github.com/samber/do"
 	"gorm.io/gorm"
 )
 
-func ProvideDocumentDependencies(injector *do.Injector, db *gorm.DB) {
+func ProvideDocumentDependencies(injector *do.Injector, db *gorm.DB, caService service.CAService, store storage.Storage) {
 	docRepo := repository.NewDocumentRepository(db)
-	docService := service.NewDocumentService(docRepo, db)
+	certRepo := repository.NewCertificateRepository(db)
+	blobRepo := repository.NewBlobRepository(db)
+	docService := service.NewDocumentService(docRepo, certRepo, blobRepo, caService, store, config.NewDocumentConfig(), db)
+	do.ProvideNamed(injector, constants.DocumentService, func(i *do.Injector) (service.DocumentService, error) {
+		return docService, nil
+	})
 	do.Provide(
 		injector, func(i *do.Injector) (controller.DocumentController, error) {
-			return controller.NewDocumentController(docService), nil
+			return controller.NewDocumentController(docService, config.NewUploadConfig()), nil
+		},
+	)
+	do.Provide(
+		injector, func(i *do.Injector) (controller.PublicVerifyController, error) {
+			return controller.NewPublicVerifyController(docService, config.NewPublicVerifyConfig()), nil
+		},
+	)
+
+	uploadConfig := config.NewUploadConfig()
+	do.ProvideNamed(injector, constants.UploadService, func(i *do.Injector) (service.UploadService, error) {
+		return service.NewUploadService(repository.NewUploadRepository(db), docService, store, uploadConfig, db), nil
+	})
+	do.Provide(
+		injector, func(i *do.Injector) (controller.UploadController, error) {
+			uploadService := do.MustInvokeNamed[service.UploadService](i, constants.UploadService)
+			return controller.NewUploadController(uploadService, uploadConfig), nil
 		},
 	)
 }
 
-func ProvideSignatureDependencies(injector *do.Injector, db *gorm.DB) {
+func ProvideSignatureDependencies(injector *do.Injector, db *gorm.DB, caService service.CAService, keys service.KeyProvider, store storage.Storage) {
 	sigRepo := repository.NewSignatureRepository(db)
 	docRepo := repository.NewDocumentRepository(db)
 	userRepo := repository.NewUserRepository(db)
-	sigService := service.NewSignatureService(sigRepo, docRepo, userRepo, db)
+	certRepo := repository.NewCertificateRepository(db)
+	sigReqRepo := repository.NewSigningRequestRepository(db)
+	sigService := service.NewSignatureService(sigRepo, docRepo, userRepo, certRepo, sigReqRepo, caService, keys, store, db)
+	sigReqService := service.NewSigningRequestService(sigReqRepo, docRepo, userRepo, sigService, db)
 	do.Provide(
 		injector, func(i *do.Injector) (controller.SignatureController, error) {
 			return controller.NewSignatureController(sigService), nil
 		},
 	)
+	do.Provide(
+		injector, func(i *do.Injector) (controller.SigningRequestController, error) {
+			return controller.NewSigningRequestController(sigReqService), nil
+		},
+	)
 }
@@ -1,20 +1,23 @@
 package provider
 
 import (
+	"github.com/PhanPhuc2609/be-sign-file/config"
 	"github.com/PhanPhuc2609/be-sign-file/controller"
 	"github.com/PhanPhuc2609/be-sign-file/repository"
 	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
 	"github.com/samber/do"
 	"gorm.io/gorm"
 )
 
-func ProvideUserDependencies(injector *do.Injector, db *gorm.DB, jwtService service.JWTService) {
+func ProvideUserDependencies(injector *do.Injector, db *gorm.DB, jwtService service.JWTService, caService service.CAService, keyVault service.KeyVaultService, store storage.Storage) {
 	// Repository
 	userRepository := repository.NewUserRepository(db)
 	refreshTokenRepository := repository.NewRefreshTokenRepository(db)
+	vaultKeyRepository := repository.NewVaultKeyRepository(db)
 
 	// Service
-	userService := service.NewUserService(userRepository, refreshTokenRepository, jwtService, db)
+	userService := service.NewUserService(userRepository, refreshTokenRepository, jwtService, caService, keyVault, vaultKeyRepository, store, db)
 
 	// Controller
 	do.Provide(
@@ -22,4 +25,14 @@ func ProvideUserDependencies(injector *do.Injector, db *gorm.DB, jwtService serv
 			return controller.NewUserController(userService), nil
 		},
 	)
+	do.Provide(
+		injector, func(i *do.Injector) (controller.CertificateController, error) {
+			return controller.NewCertificateController(userService, caService), nil
+		},
+	)
+	do.Provide(
+		injector, func(i *do.Injector) (controller.AssetController, error) {
+			return controller.NewAssetController(store, config.NewStorageConfig().PresignExpiry), nil
+		},
+	)
 }
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BlobRepository interface {
+	Acquire(ctx context.Context, tx *gorm.DB, digest string, size int64) (entity.Blob, error)
+	Release(ctx context.Context, tx *gorm.DB, digest string) (entity.Blob, error)
+	LockUnreferenced(ctx context.Context, tx *gorm.DB, digest string) (entity.Blob, error)
+	FindUnreferenced(ctx context.Context, tx *gorm.DB) ([]entity.Blob, error)
+	FindReferenced(ctx context.Context, tx *gorm.DB) ([]entity.Blob, error)
+	Delete(ctx context.Context, tx *gorm.DB, digest string) error
+}
+
+type blobRepository struct {
+	db *gorm.DB
+}
+
+func NewBlobRepository(db *gorm.DB) BlobRepository {
+	return &blobRepository{db: db}
+}
+
+// Acquire adds a reference to the blob of digest, creating its row on the
+// first one. It waits while the row is locked for garbage collection.
+func (r *blobRepository) Acquire(ctx context.Context, tx *gorm.DB, digest string, size int64) (entity.Blob, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	blob := entity.Blob{Digest: digest, Size: size, RefCount: 1}
+	err := tx.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "digest"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"ref_count":  gorm.Expr("blobs.ref_count + 1"),
+			"updated_at": gorm.Expr("excluded.updated_at"),
+		}),
+	}, clause.Returning{}).Create(&blob).Error
+	if err != nil {
+		return entity.Blob{}, err
+	}
+	return blob, nil
+}
+
+// Release drops a reference to the blob of digest and returns it with the
+// references left.
+func (r *blobRepository) Release(ctx context.Context, tx *gorm.DB, digest string) (entity.Blob, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var blob entity.Blob
+	result := tx.WithContext(ctx).Model(&blob).Clauses(clause.Returning{}).
+		Where("digest = ?", digest).
+		Update("ref_count", gorm.Expr("ref_count - 1"))
+	if result.Error != nil {
+		return entity.Blob{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entity.Blob{}, gorm.ErrRecordNotFound
+	}
+	return blob, nil
+}
+
+// LockUnreferenced returns the blob of digest, locked for the transaction
+// tx, if no document references it.
+func (r *blobRepository) LockUnreferenced(ctx context.Context, tx *gorm.DB, digest string) (entity.Blob, error) {
+	var blob entity.Blob
+	err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("digest = ? AND ref_count <= 0", digest).
+		First(&blob).Error
+	if err != nil {
+		return entity.Blob{}, err
+	}
+	return blob, nil
+}
+
+// FindUnreferenced returns the blobs whose garbage collection did not
+// complete.
+func (r *blobRepository) FindUnreferenced(ctx context.Context, tx *gorm.DB) ([]entity.Blob, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var blobs []entity.Blob
+	if err := tx.WithContext(ctx).Where("ref_count <= 0").Find(&blobs).Error; err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+// FindReferenced returns the blobs documents point to, by digest.
+func (r *blobRepository) FindReferenced(ctx context.Context, tx *gorm.DB) ([]entity.Blob, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var blobs []entity.Blob
+	if err := tx.WithContext(ctx).Where("ref_count > 0").Order("digest").Find(&blobs).Error; err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+func (r *blobRepository) Delete(ctx context.Context, tx *gorm.DB, digest string) error {
+	if tx == nil {
+		tx = r.db
+	}
+	return tx.WithContext(ctx).Where("digest = ?", digest).Delete(&entity.Blob{}).Error
+}
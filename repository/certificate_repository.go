@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"gorm.io/gorm"
+)
+
+type CertificateRepository interface {
+	Create(ctx context.Context, tx *gorm.DB, cert entity.Certificate) (entity.Certificate, error)
+	FindBySerial(ctx context.Context, tx *gorm.DB, serial string) (entity.Certificate, error)
+	FindByFingerprint(ctx context.Context, tx *gorm.DB, fingerprint string) (entity.Certificate, error)
+	FindByUserID(ctx context.Context, tx *gorm.DB, userID string) ([]entity.Certificate, error)
+	ExistsSerial(ctx context.Context, tx *gorm.DB, serial string) (bool, error)
+	Revoke(ctx context.Context, tx *gorm.DB, serial string, revokedAt time.Time, reason int) error
+	FindRevoked(ctx context.Context, tx *gorm.DB) ([]entity.Certificate, error)
+}
+
+type certificateRepository struct {
+	db *gorm.DB
+}
+
+func NewCertificateRepository(db *gorm.DB) CertificateRepository {
+	return &certificateRepository{db: db}
+}
+
+func (r *certificateRepository) Create(ctx context.Context, tx *gorm.DB, cert entity.Certificate) (entity.Certificate, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	if err := tx.WithContext(ctx).Create(&cert).Error; err != nil {
+		return entity.Certificate{}, err
+	}
+	return cert, nil
+}
+
+func (r *certificateRepository) FindBySerial(ctx context.Context, tx *gorm.DB, serial string) (entity.Certificate, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var cert entity.Certificate
+	if err := tx.WithContext(ctx).Where("serial = ?", serial).Take(&cert).Error; err != nil {
+		return entity.Certificate{}, err
+	}
+	return cert, nil
+}
+
+func (r *certificateRepository) FindByFingerprint(ctx context.Context, tx *gorm.DB, fingerprint string) (entity.Certificate, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var cert entity.Certificate
+	if err := tx.WithContext(ctx).Where("fingerprint = ?", fingerprint).Take(&cert).Error; err != nil {
+		return entity.Certificate{}, err
+	}
+	return cert, nil
+}
+
+func (r *certificateRepository) FindByUserID(ctx context.Context, tx *gorm.DB, userID string) ([]entity.Certificate, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var certs []entity.Certificate
+	if err := tx.WithContext(ctx).Where("user_id = ?", userID).Order("id DESC").Find(&certs).Error; err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+func (r *certificateRepository) ExistsSerial(ctx context.Context, tx *gorm.DB, serial string) (bool, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var count int64
+	if err := tx.WithContext(ctx).Unscoped().Model(&entity.Certificate{}).Where("serial = ?", serial).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *certificateRepository) Revoke(ctx context.Context, tx *gorm.DB, serial string, revokedAt time.Time, reason int) error {
+	if tx == nil {
+		tx = r.db
+	}
+	return tx.WithContext(ctx).Model(&entity.Certificate{}).
+		Where("serial = ? AND revoked_at IS NULL", serial).
+		Updates(map[string]any{
+			"status":            constants.ENUM_CERT_STATUS_REVOKED,
+			"revoked_at":        revokedAt,
+			"revocation_reason": reason,
+		}).Error
+}
+
+func (r *certificateRepository) FindRevoked(ctx context.Context, tx *gorm.DB) ([]entity.Certificate, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var certs []entity.Certificate
+	if err := tx.WithContext(ctx).Where("revoked_at IS NOT NULL").Order("revoked_at").Find(&certs).Error; err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
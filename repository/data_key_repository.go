@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"gorm.io/gorm"
+)
+
+type DataKeyRepository interface {
+	Create(ctx context.Context, tx *gorm.DB, dataKey entity.DataKey) (entity.DataKey, error)
+	FindByID(ctx context.Context, tx *gorm.DB, id string) (entity.DataKey, error)
+	FindNotWrappedBy(ctx context.Context, tx *gorm.DB, masterKeyID string, limit int) ([]entity.DataKey, error)
+	Rewrap(ctx context.Context, tx *gorm.DB, dataKey entity.DataKey) error
+	Delete(ctx context.Context, tx *gorm.DB, id string) error
+}
+
+type dataKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewDataKeyRepository(db *gorm.DB) DataKeyRepository {
+	return &dataKeyRepository{db: db}
+}
+
+func (r *dataKeyRepository) Create(ctx context.Context, tx *gorm.DB, dataKey entity.DataKey) (entity.DataKey, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	if err := tx.WithContext(ctx).Create(&dataKey).Error; err != nil {
+		return entity.DataKey{}, err
+	}
+	return dataKey, nil
+}
+
+func (r *dataKeyRepository) FindByID(ctx context.Context, tx *gorm.DB, id string) (entity.DataKey, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var dataKey entity.DataKey
+	if err := tx.WithContext(ctx).Where("id = ?", id).First(&dataKey).Error; err != nil {
+		return entity.DataKey{}, err
+	}
+	return dataKey, nil
+}
+
+// FindNotWrappedBy returns up to limit data keys wrapped by another master
+// key than masterKeyID.
+func (r *dataKeyRepository) FindNotWrappedBy(ctx context.Context, tx *gorm.DB, masterKeyID string, limit int) ([]entity.DataKey, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var dataKeys []entity.DataKey
+	err := tx.WithContext(ctx).Where("master_key_id <> ?", masterKeyID).
+		Order("id").Limit(limit).Find(&dataKeys).Error
+	if err != nil {
+		return nil, err
+	}
+	return dataKeys, nil
+}
+
+// Rewrap replaces the wrapped key of a data key; a data key deleted
+// meanwhile stays deleted.
+func (r *dataKeyRepository) Rewrap(ctx context.Context, tx *gorm.DB, dataKey entity.DataKey) error {
+	if tx == nil {
+		tx = r.db
+	}
+	return tx.WithContext(ctx).Model(&entity.DataKey{}).Where("id = ?", dataKey.ID).
+		Updates(map[string]interface{}{
+			"wrapped_key":   dataKey.WrappedKey,
+			"master_key_id": dataKey.MasterKeyID,
+		}).Error
+}
+
+func (r *dataKeyRepository) Delete(ctx context.Context, tx *gorm.DB, id string) error {
+	if tx == nil {
+		tx = r.db
+	}
+	return tx.WithContext(ctx).Where("id = ?", id).Delete(&entity.DataKey{}).Error
+}
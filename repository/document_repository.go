@@ -2,20 +2,29 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/PhanPhuc2609/be-sign-file/entity"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type DocumentRepository interface {
 	GetSignaturesByDocumentID(ctx context.Context, tx *gorm.DB, docID uint) ([]entity.Signature, error)
+	GetSignaturesByCertSerial(ctx context.Context, tx *gorm.DB, serial string) ([]entity.Signature, error)
 
 	Create(ctx context.Context, tx *gorm.DB, doc entity.Document) (entity.Document, error)
 	FindByID(ctx context.Context, tx *gorm.DB, id uint) (entity.Document, error)
+	LockByID(ctx context.Context, tx *gorm.DB, id uint) (entity.Document, error)
 	FindByUserID(ctx context.Context, tx *gorm.DB, userID string) ([]entity.Document, error)
 	FindByDigest(ctx context.Context, tx *gorm.DB, digest string, userID string) (entity.Document, error)
+	FindAllByDigest(ctx context.Context, tx *gorm.DB, digest string) ([]entity.Document, error)
+	CanAccess(ctx context.Context, tx *gorm.DB, docID uint, userID string) (bool, error)
 	Update(ctx context.Context, tx *gorm.DB, doc entity.Document) (entity.Document, error)
 	Delete(ctx context.Context, tx *gorm.DB, id uint) error
+	FindDeletedBefore(ctx context.Context, tx *gorm.DB, before time.Time) ([]entity.Document, error)
+	CountByFilePath(ctx context.Context, tx *gorm.DB, filePath string) (int64, error)
+	Purge(ctx context.Context, tx *gorm.DB, id uint) error
 }
 
 type documentRepository struct {
@@ -31,7 +40,18 @@ func (r *documentRepository) GetSignaturesByDocumentID(ctx context.Context, tx *
 		dbConn = r.db
 	}
 	var sigs []entity.Signature
-	err := dbConn.WithContext(ctx).Where("document_id = ?", docID).Find(&sigs).Error
+	err := dbConn.WithContext(ctx).Preload("Signer").Where("document_id = ?", docID).Find(&sigs).Error
+	return sigs, err
+}
+
+// GetSignaturesByCertSerial returns the signatures made with a certificate,
+// with their document and signer
+func (r *documentRepository) GetSignaturesByCertSerial(ctx context.Context, tx *gorm.DB, serial string) ([]entity.Signature, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var sigs []entity.Signature
+	err := tx.WithContext(ctx).Preload("Document").Preload("Signer").Where("cert_serial = ?", serial).Order("id").Find(&sigs).Error
 	return sigs, err
 }
 
@@ -60,6 +80,19 @@ func (r *documentRepository) FindByID(ctx context.Context, tx *gorm.DB, id uint)
 	return doc, nil
 }
 
+// LockByID returns the document of id, locked for update until the
+// transaction tx ends.
+func (r *documentRepository) LockByID(ctx context.Context, tx *gorm.DB, id uint) (entity.Document, error) {
+	var doc entity.Document
+	err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		First(&doc).Error
+	if err != nil {
+		return entity.Document{}, err
+	}
+	return doc, nil
+}
+
 func (r *documentRepository) FindByUserID(ctx context.Context, tx *gorm.DB, userID string) ([]entity.Document, error) {
 	if tx == nil {
 		tx = r.db
@@ -82,6 +115,37 @@ func (r *documentRepository) FindByDigest(ctx context.Context, tx *gorm.DB, dige
 	return doc, nil
 }
 
+// FindAllByDigest returns the documents of every owner with this content.
+func (r *documentRepository) FindAllByDigest(ctx context.Context, tx *gorm.DB, digest string) ([]entity.Document, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var docs []entity.Document
+	if err := tx.WithContext(ctx).Where("digest = ?", digest).Order("id").Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// CanAccess reports whether userID owns the document, has signed it or is
+// a signer of one of its signing requests.
+func (r *documentRepository) CanAccess(ctx context.Context, tx *gorm.DB, docID uint, userID string) (bool, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	signed := tx.Model(&entity.Signature{}).Select("1").
+		Where("signatures.document_id = documents.id AND signatures.signer_id = ?", userID)
+	invited := tx.Model(&entity.SigningParticipant{}).Select("1").
+		Joins("JOIN signing_requests ON signing_requests.id = signing_participants.signing_request_id").
+		Where("signing_requests.document_id = documents.id AND signing_participants.signer_id = ?", userID)
+	var count int64
+	err := tx.WithContext(ctx).Model(&entity.Document{}).
+		Where("id = ?", docID).
+		Where("user_id = ? OR EXISTS (?) OR EXISTS (?)", userID, signed, invited).
+		Count(&count).Error
+	return count > 0, err
+}
+
 func (r *documentRepository) Update(ctx context.Context, tx *gorm.DB, doc entity.Document) (entity.Document, error) {
 	if tx == nil {
 		tx = r.db
@@ -98,3 +162,57 @@ func (r *documentRepository) Delete(ctx context.Context, tx *gorm.DB, id uint) e
 	}
 	return tx.WithContext(ctx).Delete(&entity.Document{}, id).Error
 }
+
+// FindDeletedBefore returns the documents deleted before the given time.
+func (r *documentRepository) FindDeletedBefore(ctx context.Context, tx *gorm.DB, before time.Time) ([]entity.Document, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var docs []entity.Document
+	err := tx.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Order("id").Find(&docs).Error
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// CountByFilePath counts the documents, deleted or not, stored at filePath.
+func (r *documentRepository) CountByFilePath(ctx context.Context, tx *gorm.DB, filePath string) (int64, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var count int64
+	err := tx.WithContext(ctx).Unscoped().Model(&entity.Document{}).
+		Where("file_path = ?", filePath).
+		Count(&count).Error
+	return count, err
+}
+
+// Purge deletes a document for good, with its signatures and signing
+// requests. A document already purged is reported as not found.
+func (r *documentRepository) Purge(ctx context.Context, tx *gorm.DB, id uint) error {
+	if tx == nil {
+		tx = r.db
+	}
+	tx = tx.WithContext(ctx)
+	requests := tx.Unscoped().Model(&entity.SigningRequest{}).Select("id").Where("document_id = ?", id)
+	if err := tx.Unscoped().Where("signing_request_id IN (?)", requests).Delete(&entity.SigningParticipant{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("document_id = ?", id).Delete(&entity.SigningRequest{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("document_id = ?", id).Delete(&entity.Signature{}).Error; err != nil {
+		return err
+	}
+	result := tx.Unscoped().Delete(&entity.Document{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
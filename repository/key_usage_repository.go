@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"gorm.io/gorm"
+)
+
+type KeyUsageRepository interface {
+	Create(ctx context.Context, tx *gorm.DB, usage entity.KeyUsage) (entity.KeyUsage, error)
+	CountFailuresSince(ctx context.Context, tx *gorm.DB, keyID string, since time.Time) (int64, error)
+}
+
+type keyUsageRepository struct {
+	db *gorm.DB
+}
+
+func NewKeyUsageRepository(db *gorm.DB) KeyUsageRepository {
+	return &keyUsageRepository{db: db}
+}
+
+func (r *keyUsageRepository) Create(ctx context.Context, tx *gorm.DB, usage entity.KeyUsage) (entity.KeyUsage, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	if err := tx.WithContext(ctx).Create(&usage).Error; err != nil {
+		return entity.KeyUsage{}, err
+	}
+	return usage, nil
+}
+
+// CountFailuresSince counts the failed attempts to unlock keyID since the
+// given time.
+func (r *keyUsageRepository) CountFailuresSince(ctx context.Context, tx *gorm.DB, keyID string, since time.Time) (int64, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var count int64
+	err := tx.WithContext(ctx).Model(&entity.KeyUsage{}).
+		Where("key_id = ? AND success = ? AND created_at >= ?", keyID, false, since).
+		Count(&count).Error
+	return count, err
+}
@@ -12,6 +12,7 @@ type SignatureRepository interface {
 	FindByID(ctx context.Context, tx *gorm.DB, id uint) (entity.Signature, error)
 	FindByDocumentID(ctx context.Context, tx *gorm.DB, docID uint) ([]entity.Signature, error)
 	Update(ctx context.Context, tx *gorm.DB, sig entity.Signature) (entity.Signature, error)
+	UpdateCMS(ctx context.Context, tx *gorm.DB, id uint, cms []byte) error
 	Delete(ctx context.Context, tx *gorm.DB, id uint) error
 }
 
@@ -65,6 +66,15 @@ func (r *signatureRepository) Update(ctx context.Context, tx *gorm.DB, sig entit
 	return sig, nil
 }
 
+// UpdateCMS replaces the stored .p7s, e.g. after a counter-signature was
+// added to it.
+func (r *signatureRepository) UpdateCMS(ctx context.Context, tx *gorm.DB, id uint, cms []byte) error {
+	if tx == nil {
+		tx = r.db
+	}
+	return tx.WithContext(ctx).Model(&entity.Signature{}).Where("id = ?", id).Update("cms", cms).Error
+}
+
 func (r *signatureRepository) Delete(ctx context.Context, tx *gorm.DB, id uint) error {
 	if tx == nil {
 		tx = r.db
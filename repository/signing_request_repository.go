@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SigningRequestRepository interface {
+	Create(ctx context.Context, tx *gorm.DB, req entity.SigningRequest) (entity.SigningRequest, error)
+	FindByID(ctx context.Context, tx *gorm.DB, id uint) (entity.SigningRequest, error)
+	FindByDocumentID(ctx context.Context, tx *gorm.DB, docID uint) ([]entity.SigningRequest, error)
+	FindActiveByDocumentID(ctx context.Context, tx *gorm.DB, docID uint) (entity.SigningRequest, error)
+	FindPendingBySignerID(ctx context.Context, tx *gorm.DB, signerID string) ([]entity.SigningRequest, error)
+	Update(ctx context.Context, tx *gorm.DB, req entity.SigningRequest) (entity.SigningRequest, error)
+}
+
+type signingRequestRepository struct {
+	db *gorm.DB
+}
+
+func NewSigningRequestRepository(db *gorm.DB) SigningRequestRepository {
+	return &signingRequestRepository{db: db}
+}
+
+// preloadRequest loads the document and the participants in signing order.
+func preloadRequest(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Document").
+		Preload("Participants", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("Participants.Signer")
+}
+
+func (r *signingRequestRepository) Create(ctx context.Context, tx *gorm.DB, req entity.SigningRequest) (entity.SigningRequest, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	if err := tx.WithContext(ctx).Omit("Document", "Participants.Signer").Create(&req).Error; err != nil {
+		return entity.SigningRequest{}, err
+	}
+	return req, nil
+}
+
+// FindByID loads a request. Inside a transaction the request row is locked
+// so concurrent signers of a parallel request advance it one at a time.
+func (r *signingRequestRepository) FindByID(ctx context.Context, tx *gorm.DB, id uint) (entity.SigningRequest, error) {
+	query := r.db
+	if tx != nil {
+		query = tx.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: clause.CurrentTable}})
+	}
+	var req entity.SigningRequest
+	if err := preloadRequest(query.WithContext(ctx)).Where("id = ?", id).First(&req).Error; err != nil {
+		return entity.SigningRequest{}, err
+	}
+	return req, nil
+}
+
+func (r *signingRequestRepository) FindByDocumentID(ctx context.Context, tx *gorm.DB, docID uint) ([]entity.SigningRequest, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var reqs []entity.SigningRequest
+	if err := preloadRequest(tx.WithContext(ctx)).Where("document_id = ?", docID).Order("id").Find(&reqs).Error; err != nil {
+		return nil, err
+	}
+	return reqs, nil
+}
+
+func (r *signingRequestRepository) FindActiveByDocumentID(ctx context.Context, tx *gorm.DB, docID uint) (entity.SigningRequest, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var req entity.SigningRequest
+	err := preloadRequest(tx.WithContext(ctx)).
+		Where("document_id = ? AND status = ?", docID, constants.ENUM_SIGNING_REQUEST_IN_PROGRESS).
+		First(&req).Error
+	if err != nil {
+		return entity.SigningRequest{}, err
+	}
+	return req, nil
+}
+
+// FindPendingBySignerID returns the active requests in which signerID has a
+// task to act on now.
+func (r *signingRequestRepository) FindPendingBySignerID(ctx context.Context, tx *gorm.DB, signerID string) ([]entity.SigningRequest, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	pending := tx.Model(&entity.SigningParticipant{}).Select("signing_request_id").
+		Where("signer_id = ? AND status = ?", signerID, constants.ENUM_PARTICIPANT_PENDING)
+	var reqs []entity.SigningRequest
+	err := preloadRequest(tx.WithContext(ctx)).
+		Where("status = ? AND id IN (?)", constants.ENUM_SIGNING_REQUEST_IN_PROGRESS, pending).
+		Order("id").Find(&reqs).Error
+	if err != nil {
+		return nil, err
+	}
+	return reqs, nil
+}
+
+// Update saves the request and the state of its participants.
+func (r *signingRequestRepository) Update(ctx context.Context, tx *gorm.DB, req entity.SigningRequest) (entity.SigningRequest, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	err := tx.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(&req).Error; err != nil {
+			return err
+		}
+		for i := range req.Participants {
+			if err := tx.Omit(clause.Associations).Save(&req.Participants[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return entity.SigningRequest{}, err
+	}
+	return req, nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UploadRepository interface {
+	Create(ctx context.Context, tx *gorm.DB, upload entity.Upload) (entity.Upload, error)
+	FindByID(ctx context.Context, tx *gorm.DB, id string) (entity.Upload, error)
+	LockByID(ctx context.Context, tx *gorm.DB, id string) (entity.Upload, error)
+	FindExpired(ctx context.Context, tx *gorm.DB, now time.Time) ([]entity.Upload, error)
+	Update(ctx context.Context, tx *gorm.DB, upload entity.Upload) (entity.Upload, error)
+	Delete(ctx context.Context, tx *gorm.DB, id string) error
+}
+
+type uploadRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadRepository(db *gorm.DB) UploadRepository {
+	return &uploadRepository{db: db}
+}
+
+func (r *uploadRepository) Create(ctx context.Context, tx *gorm.DB, upload entity.Upload) (entity.Upload, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	if err := tx.WithContext(ctx).Create(&upload).Error; err != nil {
+		return entity.Upload{}, err
+	}
+	return upload, nil
+}
+
+func (r *uploadRepository) FindByID(ctx context.Context, tx *gorm.DB, id string) (entity.Upload, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var upload entity.Upload
+	if err := tx.WithContext(ctx).Where("id = ?", id).First(&upload).Error; err != nil {
+		return entity.Upload{}, err
+	}
+	return upload, nil
+}
+
+// LockByID returns the upload of id, locked for update until the transaction
+// tx ends.
+func (r *uploadRepository) LockByID(ctx context.Context, tx *gorm.DB, id string) (entity.Upload, error) {
+	var upload entity.Upload
+	err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		First(&upload).Error
+	if err != nil {
+		return entity.Upload{}, err
+	}
+	return upload, nil
+}
+
+// FindExpired returns the uploads whose expiration time has passed.
+func (r *uploadRepository) FindExpired(ctx context.Context, tx *gorm.DB, now time.Time) ([]entity.Upload, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var uploads []entity.Upload
+	if err := tx.WithContext(ctx).Where("expires_at < ?", now).Find(&uploads).Error; err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+func (r *uploadRepository) Update(ctx context.Context, tx *gorm.DB, upload entity.Upload) (entity.Upload, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	if err := tx.WithContext(ctx).Save(&upload).Error; err != nil {
+		return entity.Upload{}, err
+	}
+	return upload, nil
+}
+
+// Delete removes the upload row for good; its partial file is gone too.
+func (r *uploadRepository) Delete(ctx context.Context, tx *gorm.DB, id string) error {
+	if tx == nil {
+		tx = r.db
+	}
+	return tx.WithContext(ctx).Unscoped().Where("id = ?", id).Delete(&entity.Upload{}).Error
+}
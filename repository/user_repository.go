@@ -20,6 +20,9 @@ type (
 		GetUserByEmail(ctx context.Context, tx *gorm.DB, email string) (entity.User, error)
 		CheckEmail(ctx context.Context, tx *gorm.DB, email string) (entity.User, bool, error)
 		Update(ctx context.Context, tx *gorm.DB, user entity.User) (entity.User, error)
+		UpdateCertificate(ctx context.Context, tx *gorm.DB, userId string, certPEM, pubPEM string) error
+		FindWithLegacyKey(ctx context.Context, tx *gorm.DB, limit int) ([]entity.User, error)
+		ClearLegacyKey(ctx context.Context, tx *gorm.DB, userId string) error
 		Delete(ctx context.Context, tx *gorm.DB, userId string) error
 	}
 
@@ -137,6 +140,48 @@ func (r *userRepository) Update(ctx context.Context, tx *gorm.DB, user entity.Us
 	return user, nil
 }
 
+// UpdateCertificate only touches the certificate columns, so empty values are
+// written too and the password hook is not triggered. A legacy private key
+// left from before the vault is cleared with them.
+func (r *userRepository) UpdateCertificate(
+	ctx context.Context,
+	tx *gorm.DB,
+	userId string,
+	certPEM, pubPEM string,
+) error {
+	if tx == nil {
+		tx = r.db
+	}
+
+	return tx.WithContext(ctx).Model(&entity.User{}).Where("id = ?", userId).Updates(map[string]any{
+		"cert_pem": certPEM,
+		"priv_pem": "",
+		"pub_pem":  pubPEM,
+	}).Error
+}
+
+// FindWithLegacyKey returns up to limit users whose private key is still
+// stored in clear in the users table, deleted users included.
+func (r *userRepository) FindWithLegacyKey(ctx context.Context, tx *gorm.DB, limit int) ([]entity.User, error) {
+	if tx == nil {
+		tx = r.db
+	}
+
+	var users []entity.User
+	if err := tx.WithContext(ctx).Unscoped().Where("priv_pem <> ''").Order("id").Limit(limit).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *userRepository) ClearLegacyKey(ctx context.Context, tx *gorm.DB, userId string) error {
+	if tx == nil {
+		tx = r.db
+	}
+
+	return tx.WithContext(ctx).Unscoped().Model(&entity.User{}).Where("id = ?", userId).Update("priv_pem", "").Error
+}
+
 func (r *userRepository) Delete(ctx context.Context, tx *gorm.DB, userId string) error {
 	if tx == nil {
 		tx = r.db
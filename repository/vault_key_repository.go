@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type VaultKeyRepository interface {
+	Create(ctx context.Context, tx *gorm.DB, key entity.VaultKey) (entity.VaultKey, error)
+	FindByUserID(ctx context.Context, tx *gorm.DB, userID string) (entity.VaultKey, error)
+	LockByID(ctx context.Context, tx *gorm.DB, id string) (entity.VaultKey, error)
+	FindNotWrappedBy(ctx context.Context, tx *gorm.DB, masterKeyID string, limit int) ([]entity.VaultKey, error)
+	Rewrap(ctx context.Context, tx *gorm.DB, key entity.VaultKey) error
+	DeleteByUserID(ctx context.Context, tx *gorm.DB, userID string) error
+}
+
+type vaultKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewVaultKeyRepository(db *gorm.DB) VaultKeyRepository {
+	return &vaultKeyRepository{db: db}
+}
+
+func (r *vaultKeyRepository) Create(ctx context.Context, tx *gorm.DB, key entity.VaultKey) (entity.VaultKey, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	if err := tx.WithContext(ctx).Create(&key).Error; err != nil {
+		return entity.VaultKey{}, err
+	}
+	return key, nil
+}
+
+func (r *vaultKeyRepository) FindByUserID(ctx context.Context, tx *gorm.DB, userID string) (entity.VaultKey, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var key entity.VaultKey
+	if err := tx.WithContext(ctx).Where("user_id = ?", userID).First(&key).Error; err != nil {
+		return entity.VaultKey{}, err
+	}
+	return key, nil
+}
+
+// LockByID returns the vault key of id, locked for update until the
+// transaction tx ends.
+func (r *vaultKeyRepository) LockByID(ctx context.Context, tx *gorm.DB, id string) (entity.VaultKey, error) {
+	var key entity.VaultKey
+	err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		First(&key).Error
+	if err != nil {
+		return entity.VaultKey{}, err
+	}
+	return key, nil
+}
+
+// FindNotWrappedBy returns up to limit keys protected by another master key
+// than masterKeyID.
+func (r *vaultKeyRepository) FindNotWrappedBy(ctx context.Context, tx *gorm.DB, masterKeyID string, limit int) ([]entity.VaultKey, error) {
+	if tx == nil {
+		tx = r.db
+	}
+	var keys []entity.VaultKey
+	err := tx.WithContext(ctx).
+		Where("protection = ? AND master_key_id <> ?", constants.ENUM_KEY_PROTECTION_MASTER, masterKeyID).
+		Order("id").Limit(limit).Find(&keys).Error
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Rewrap replaces the encrypted key of a vault key protected by the master
+// key.
+func (r *vaultKeyRepository) Rewrap(ctx context.Context, tx *gorm.DB, key entity.VaultKey) error {
+	if tx == nil {
+		tx = r.db
+	}
+	return tx.WithContext(ctx).Model(&entity.VaultKey{}).Where("id = ?", key.ID).
+		Updates(map[string]interface{}{
+			"encrypted_key": key.EncryptedKey,
+			"master_key_id": key.MasterKeyID,
+		}).Error
+}
+
+func (r *vaultKeyRepository) DeleteByUserID(ctx context.Context, tx *gorm.DB, userID string) error {
+	if tx == nil {
+		tx = r.db
+	}
+	return tx.WithContext(ctx).Where("user_id = ?", userID).Delete(&entity.VaultKey{}).Error
+}
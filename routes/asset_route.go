@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/PhanPhuc2609/be-sign-file/controller"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/do"
+)
+
+func AssetRoutes(route *gin.Engine, injector *do.Injector) {
+	assetController := do.MustInvoke[controller.AssetController](injector)
+
+	route.GET("/assets/*filepath", assetController.GetAsset)
+	route.HEAD("/assets/*filepath", assetController.GetAsset)
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/PhanPhuc2609/be-sign-file/controller"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/do"
+)
+
+func CARoutes(route *gin.Engine, injector *do.Injector) {
+	caController := do.MustInvoke[controller.CAController](injector)
+
+	routes := route.Group("/api/ca")
+	{
+		routes.GET("/chain", caController.GetChain)
+		routes.GET("/crl", caController.GetCRL)
+		routes.GET("/issuer", caController.GetIssuer)
+		routes.POST("/ocsp", caController.OCSP)
+		routes.GET("/ocsp/*request", caController.OCSP)
+		routes.POST("/tsa", caController.Timestamp)
+	}
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/controller"
+	"github.com/PhanPhuc2609/be-sign-file/middleware"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/do"
+)
+
+func CertificateRoutes(route *gin.Engine, injector *do.Injector) {
+	jwtService := do.MustInvokeNamed[service.JWTService](injector, constants.JWTService)
+	certController := do.MustInvoke[controller.CertificateController](injector)
+
+	routes := route.Group("/api/certificates")
+	{
+		routes.POST("/csr", middleware.Authenticate(jwtService), certController.EnrollCSR)
+		routes.POST("/:serial/revoke", middleware.Authenticate(jwtService), certController.Revoke)
+	}
+}
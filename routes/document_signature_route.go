@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"github.com/PhanPhuc2609/be-sign-file/config"
 	"github.com/PhanPhuc2609/be-sign-file/constants"
 	"github.com/PhanPhuc2609/be-sign-file/controller"
 	"github.com/PhanPhuc2609/be-sign-file/middleware"
@@ -17,9 +18,39 @@ func DocumentRoutes(route *gin.Engine, injector *do.Injector) {
 	{
 		routes.POST("/upload", middleware.Authenticate(jwtService), docController.UploadDocument)
 		routes.POST("/verify", middleware.Authenticate(jwtService), docController.UploadAndVerifyDocument)
+		routes.POST("/verify/report", middleware.Authenticate(jwtService), docController.DownloadVerificationReport)
 		routes.GET(":id", docController.GetDocumentByID)
+		routes.GET(":id/content", middleware.Authenticate(jwtService), docController.DownloadContent)
+		routes.GET(":id/signed", middleware.Authenticate(jwtService), docController.DownloadSigned)
 		routes.GET("/user", middleware.Authenticate(jwtService), docController.GetDocumentsByUserID)
-		routes.DELETE(":id", docController.DeleteDocument)
+		routes.DELETE(":id", middleware.Authenticate(jwtService), docController.DeleteDocument)
+	}
+}
+
+// PublicVerifyRoutes serves verification to anyone holding a signed file,
+// without an account, under a per-client rate limit.
+func PublicVerifyRoutes(route *gin.Engine, injector *do.Injector) {
+	verifyController := do.MustInvoke[controller.PublicVerifyController](injector)
+	limiter := middleware.RateLimit(config.NewPublicVerifyConfig().RateLimit)
+
+	route.POST("/api/public/verify", limiter, verifyController.Verify)
+	route.GET("/verify", verifyController.VerifyPage)
+	route.POST("/verify", limiter, verifyController.SubmitVerifyPage)
+}
+
+// UploadRoutes serves resumable uploads with the tus protocol. A completed
+// upload becomes a document as if it was sent to /api/documents/upload.
+func UploadRoutes(route *gin.Engine, injector *do.Injector) {
+	uploadController := do.MustInvoke[controller.UploadController](injector)
+	jwtService := do.MustInvokeNamed[service.JWTService](injector, constants.JWTService)
+
+	routes := route.Group("/api/uploads", uploadController.TusResumable())
+	{
+		routes.OPTIONS("", uploadController.Options)
+		routes.POST("", middleware.Authenticate(jwtService), uploadController.CreateUpload)
+		routes.HEAD(":id", middleware.Authenticate(jwtService), uploadController.HeadUpload)
+		routes.PATCH(":id", middleware.Authenticate(jwtService), uploadController.PatchUpload)
+		routes.DELETE(":id", middleware.Authenticate(jwtService), uploadController.DeleteUpload)
 	}
 }
 
@@ -31,8 +62,29 @@ func SignatureRoutes(route *gin.Engine, injector *do.Injector) {
 	{
 		routes.POST("", middleware.Authenticate(jwtService), sigController.CreateSignature)
 		routes.GET(":id", sigController.GetSignatureByID)
+		routes.GET(":id/p7s", middleware.Authenticate(jwtService), sigController.DownloadCMS)
+		routes.GET(":id/verify", middleware.Authenticate(jwtService), sigController.VerifySignatureTree)
+		routes.POST(":id/countersign", middleware.Authenticate(jwtService), sigController.CounterSign)
 		routes.GET("/document/:doc_id", sigController.GetSignaturesByDocumentID)
 		routes.DELETE(":id", sigController.DeleteSignature)
 		routes.POST("/sign-string", middleware.Authenticate(jwtService), sigController.SignString)
+		routes.POST("/jws", middleware.Authenticate(jwtService), sigController.SignJWS)
+		routes.POST("/jws/verify", middleware.Authenticate(jwtService), sigController.VerifyJWS)
+	}
+}
+
+func SigningRequestRoutes(route *gin.Engine, injector *do.Injector) {
+	sigReqController := do.MustInvoke[controller.SigningRequestController](injector)
+	jwtService := do.MustInvokeNamed[service.JWTService](injector, constants.JWTService)
+
+	routes := route.Group("/api/signing-requests")
+	{
+		routes.POST("", middleware.Authenticate(jwtService), sigReqController.CreateSigningRequest)
+		routes.GET("/tasks", middleware.Authenticate(jwtService), sigReqController.GetPendingTasks)
+		routes.GET("/document/:doc_id", middleware.Authenticate(jwtService), sigReqController.GetSigningRequestsByDocumentID)
+		routes.GET(":id", middleware.Authenticate(jwtService), sigReqController.GetSigningRequestByID)
+		routes.POST(":id/sign", middleware.Authenticate(jwtService), sigReqController.Sign)
+		routes.POST(":id/decline", middleware.Authenticate(jwtService), sigReqController.Decline)
+		routes.POST(":id/cancel", middleware.Authenticate(jwtService), sigReqController.Cancel)
 	}
 }
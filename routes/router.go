@@ -10,6 +10,12 @@ func RegisterRoutes(server *gin.Engine, injector *do.Injector) {
 		c.File("user_management_frontend.html")
 	})
 	User(server, injector)
+	AssetRoutes(server, injector)
 	DocumentRoutes(server, injector)
+	PublicVerifyRoutes(server, injector)
+	UploadRoutes(server, injector)
 	SignatureRoutes(server, injector)
+	SigningRequestRoutes(server, injector)
+	CARoutes(server, injector)
+	CertificateRoutes(server, injector)
 }
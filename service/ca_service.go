@@ -0,0 +1,650 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/ca"
+	"github.com/PhanPhuc2609/be-sign-file/cms"
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/hsm"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/PhanPhuc2609/be-sign-file/repository"
+	"github.com/PhanPhuc2609/be-sign-file/tsa"
+	"golang.org/x/crypto/ocsp"
+	"gorm.io/gorm"
+)
+
+type CAService interface {
+	Initialize(ctx context.Context) error
+	IssueUserCertificate(ctx context.Context, userID string, subject pkix.Name, emails []string, pub crypto.PublicKey) (*x509.Certificate, error)
+	Chain(ctx context.Context) ([]*x509.Certificate, error)
+	ChainPEM(ctx context.Context) ([]byte, error)
+	RevokeCertificate(ctx context.Context, requesterID string, serial string, reason int) (dto.CertificateStatusResponse, error)
+	SupersedeUserCertificates(ctx context.Context, tx *gorm.DB, userID string, serial string) error
+	CRL(ctx context.Context) ([]byte, error)
+	RefreshCRL(ctx context.Context) error
+	RunCRLRefresher(ctx context.Context)
+	OCSPResponse(ctx context.Context, request []byte) ([]byte, error)
+	IssuingCertificate(ctx context.Context) ([]byte, error)
+	TrustStore(ctx context.Context) (*pki.TrustStore, error)
+	Timestamp(ctx context.Context, request []byte) ([]byte, error)
+	TimestampToken(ctx context.Context, message []byte) ([]byte, error)
+	SignReport(ctx context.Context, content []byte) ([]byte, error)
+}
+
+type caService struct {
+	certRepo     repository.CertificateRepository
+	userRepo     repository.UserRepository
+	keyUsageRepo repository.KeyUsageRepository
+	cfg          config.CAConfig
+	// nil khi khóa CA nằm trong file mã hóa bằng CA_PASSPHRASE
+	keys hsm.KeyStore
+
+	mu         sync.Mutex
+	authority  *ca.Authority
+	identities map[string]*ca.ServiceIdentity
+
+	crlMu      sync.Mutex
+	crl        []byte
+	crlExpires time.Time
+}
+
+func NewCAService(certRepo repository.CertificateRepository, userRepo repository.UserRepository, keyUsageRepo repository.KeyUsageRepository, cfg config.CAConfig, keys hsm.KeyStore) CAService {
+	return &caService{
+		certRepo:     certRepo,
+		userRepo:     userRepo,
+		keyUsageRepo: keyUsageRepo,
+		cfg:          cfg,
+		keys:         keys,
+		identities:   map[string]*ca.ServiceIdentity{},
+	}
+}
+
+// CA_ISSUING_KEY_ID identifies the issuing CA key in the key usage audit log.
+const CA_ISSUING_KEY_ID = "ca:issuing"
+
+// Initialize creates the root and issuing CA on disk and records both in the
+// certificate table. It is only meant to be run once from the CLI.
+func (s *caService) Initialize(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	authority, err := ca.Init(s.cfg, s.keys)
+	if err != nil {
+		return err
+	}
+
+	if err := s.record(ctx, authority.Root, "", constants.ENUM_CERT_PROFILE_ROOT); err != nil {
+		return err
+	}
+	if err := s.record(ctx, authority.Issuing, "", constants.ENUM_CERT_PROFILE_ISSUING); err != nil {
+		return err
+	}
+
+	s.authority = authority
+
+	for _, name := range []string{ca.IdentityOCSP, ca.IdentityTSA, ca.IdentityReport} {
+		if _, err := s.issueServiceIdentity(ctx, authority, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *caService) IssueUserCertificate(ctx context.Context, userID string, subject pkix.Name, emails []string, pub crypto.PublicKey) (*x509.Certificate, error) {
+	authority, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := s.allocateSerial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.auditIssuingKey(ctx, constants.ENUM_KEY_USAGE_ISSUE_CERTIFICATE, "serial:"+serial.Text(16)); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		EmailAddresses:        emails,
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.AddDate(1, 0, 0),
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageEmailProtection},
+		CRLDistributionPoints: []string{s.crlURL()},
+		OCSPServer:            []string{s.ocspURL()},
+		IssuingCertificateURL: []string{s.issuerURL()},
+	}
+
+	cert, err := authority.Issue(tmpl, pub)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.record(ctx, cert, userID, constants.ENUM_CERT_PROFILE_USER); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func (s *caService) Chain(ctx context.Context) ([]*x509.Certificate, error) {
+	authority, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return authority.Chain(), nil
+}
+
+func (s *caService) ChainPEM(ctx context.Context) ([]byte, error) {
+	authority, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return authority.ChainPEM(), nil
+}
+
+// TrustStore returns the roots accepted for externally signed documents:
+// the certificates in the trust store directory plus the platform root. The
+// directory is read on every call so that added roots apply immediately.
+func (s *caService) TrustStore(ctx context.Context) (*pki.TrustStore, error) {
+	store, err := pki.LoadTrustStore(s.cfg.TrustStoreDir)
+	if err != nil {
+		return nil, err
+	}
+	// the platform CA may not be initialized yet
+	if authority, err := s.load(); err == nil {
+		store.Add(authority.Root)
+	}
+	return store, nil
+}
+
+func (s *caService) RevokeCertificate(ctx context.Context, requesterID string, serial string, reason int) (dto.CertificateStatusResponse, error) {
+	serial = strings.ToLower(serial)
+
+	record, err := s.certRepo.FindBySerial(ctx, nil, serial)
+	if err != nil {
+		return dto.CertificateStatusResponse{}, dto.ErrCertificateNotFound
+	}
+	if record.Profile != constants.ENUM_CERT_PROFILE_USER {
+		return dto.CertificateStatusResponse{}, dto.ErrRevokeForbidden
+	}
+
+	requester, err := s.userRepo.GetUserById(ctx, nil, requesterID)
+	if err != nil {
+		return dto.CertificateStatusResponse{}, dto.ErrUserNotFound
+	}
+	if record.UserID != requester.ID.String() && requester.Role != constants.ENUM_ROLE_ADMIN {
+		return dto.CertificateStatusResponse{}, dto.ErrRevokeForbidden
+	}
+	if record.IsRevoked() {
+		return dto.CertificateStatusResponse{}, dto.ErrCertificateRevoked
+	}
+
+	revokedAt := time.Now().Truncate(time.Second)
+	if err := s.certRepo.Revoke(ctx, nil, serial, revokedAt, reason); err != nil {
+		return dto.CertificateStatusResponse{}, err
+	}
+
+	// Publish the new CRL right away instead of waiting for the next tick
+	if err := s.RefreshCRL(ctx); err != nil {
+		log.Printf("error refreshing CRL after revocation: %v", err)
+	}
+
+	return dto.CertificateStatusResponse{
+		Serial:           serial,
+		Status:           constants.ENUM_CERT_STATUS_REVOKED,
+		RevokedAt:        &revokedAt,
+		RevocationReason: ca.ReasonName(reason),
+	}, nil
+}
+
+// SupersedeUserCertificates revokes with reason superseded every user
+// certificate of userID other than serial. It runs in the caller's
+// transaction, the caller refreshes the CRL once it has committed.
+func (s *caService) SupersedeUserCertificates(ctx context.Context, tx *gorm.DB, userID string, serial string) error {
+	certs, err := s.certRepo.FindByUserID(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	revokedAt := time.Now().Truncate(time.Second)
+	for _, record := range certs {
+		if record.Profile != constants.ENUM_CERT_PROFILE_USER || record.Serial == serial || record.IsRevoked() {
+			continue
+		}
+		if err := s.certRepo.Revoke(ctx, tx, record.Serial, revokedAt, ca.ReasonSuperseded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CRL returns the current DER CRL, regenerating it once it is past half of
+// its validity window.
+func (s *caService) CRL(ctx context.Context) ([]byte, error) {
+	s.crlMu.Lock()
+	crl, expires := s.crl, s.crlExpires
+	s.crlMu.Unlock()
+
+	if crl != nil && time.Now().Before(expires) {
+		return crl, nil
+	}
+	if err := s.RefreshCRL(ctx); err != nil {
+		return nil, err
+	}
+
+	s.crlMu.Lock()
+	defer s.crlMu.Unlock()
+	return s.crl, nil
+}
+
+func (s *caService) RefreshCRL(ctx context.Context) error {
+	authority, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	revoked, err := s.certRepo.FindRevoked(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]ca.RevokedEntry, 0, len(revoked))
+	for _, record := range revoked {
+		serial, ok := new(big.Int).SetString(record.Serial, 16)
+		if !ok {
+			continue
+		}
+		entries = append(entries, ca.RevokedEntry{
+			Serial:    serial,
+			RevokedAt: *record.RevokedAt,
+			Reason:    record.RevocationReason,
+		})
+	}
+
+	now := time.Now()
+	interval := s.cfg.CRLRefreshInterval
+	// CRL numbers must only grow, the clock is good enough across restarts
+	number := big.NewInt(now.UnixNano())
+	if err := s.auditIssuingKey(ctx, constants.ENUM_KEY_USAGE_SIGN_CRL, "crl:"+number.String()); err != nil {
+		return err
+	}
+	crl, err := authority.CreateCRL(entries, number, now, now.Add(2*interval))
+	if err != nil {
+		return err
+	}
+
+	s.crlMu.Lock()
+	s.crl = crl
+	s.crlExpires = now.Add(interval)
+	s.crlMu.Unlock()
+	return nil
+}
+
+// RunCRLRefresher regenerates the CRL every CRLRefreshInterval until ctx is
+// cancelled.
+func (s *caService) RunCRLRefresher(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.CRLRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RefreshCRL(ctx); err != nil && !errors.Is(err, ca.ErrNotInitialized) {
+			log.Printf("error refreshing CRL: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// OCSPResponse answers a DER encoded RFC 6960 request from the certificate
+// table. Protocol level failures are returned as OCSP error responses, not
+// as Go errors, so clients always get something they can parse.
+func (s *caService) OCSPResponse(ctx context.Context, request []byte) ([]byte, error) {
+	req, err := ocsp.ParseRequest(request)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse, nil
+	}
+
+	authority, err := s.load()
+	if err != nil {
+		return ocsp.InternalErrorErrorResponse, nil
+	}
+	if !authority.IssuedOCSPRequest(req) {
+		return ocsp.UnauthorizedErrorResponse, nil
+	}
+
+	responder, err := s.serviceIdentity(ctx, ca.IdentityOCSP)
+	if err != nil {
+		log.Printf("error loading OCSP responder: %v", err)
+		return ocsp.InternalErrorErrorResponse, nil
+	}
+
+	status := ca.CertStatus{}
+	record, err := s.certRepo.FindBySerial(ctx, nil, strings.ToLower(req.SerialNumber.Text(16)))
+	if err == nil {
+		status.Known = true
+		if record.IsRevoked() {
+			status.RevokedAt = *record.RevokedAt
+			status.Reason = record.RevocationReason
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return ocsp.TryLaterErrorResponse, nil
+	}
+
+	now := time.Now()
+	return authority.CreateOCSPResponse(responder, req.SerialNumber, status, now, now.Add(s.cfg.CRLRefreshInterval))
+}
+
+// Timestamp answers a DER encoded RFC 3161 request with a token signed by the
+// platform TSA. Like OCSPResponse, failures the client should see are
+// returned as rejection responses.
+func (s *caService) Timestamp(ctx context.Context, request []byte) ([]byte, error) {
+	req, err := tsa.ParseRequest(request)
+	if errors.Is(err, tsa.ErrUnsupportedHash) {
+		return tsa.ErrorResponse(tsa.FailureBadAlg, "unsupported hash algorithm"), nil
+	}
+	if err != nil {
+		return tsa.ErrorResponse(tsa.FailureBadDataFormat, "malformed request"), nil
+	}
+
+	signer, err := s.tsaSigner(ctx)
+	if err != nil {
+		log.Printf("error loading TSA: %v", err)
+		return tsa.ErrorResponse(tsa.FailureSystemFailure, "time-stamping is not available"), nil
+	}
+	// serials only need to be unique, they are not recorded
+	serial, err := ca.NewSerial()
+	if err != nil {
+		return tsa.ErrorResponse(tsa.FailureSystemFailure, "time-stamping is not available"), nil
+	}
+	return signer.Respond(req, serial, time.Now())
+}
+
+// TimestampToken time-stamps message through the TSA protocol and returns
+// the DER token, checked against the request.
+func (s *caService) TimestampToken(ctx context.Context, message []byte) ([]byte, error) {
+	req, err := tsa.NewRequest(message, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	der, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.Timestamp(ctx, der)
+	if err != nil {
+		return nil, err
+	}
+	token, err := tsa.ParseResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Check(token); err != nil {
+		return nil, err
+	}
+	return token.Raw, nil
+}
+
+// SignReport wraps content in a CMS SignedData signed by the platform's
+// verification service identity, time-stamped like user signatures.
+func (s *caService) SignReport(ctx context.Context, content []byte) ([]byte, error) {
+	identity, err := s.serviceIdentity(ctx, ca.IdentityReport)
+	if err != nil {
+		return nil, err
+	}
+	authority, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	alg, err := pki.ResolveAlgorithm(pki.AlgRSASHA256, identity.Certificate.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sd, err := cms.SignContent(cms.OIDData, content, cms.SignerConfig{
+		Signer:      identity.Key,
+		Certificate: identity.Certificate,
+		Chain:       authority.Chain(),
+		Algorithm:   alg,
+		SigningTime: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	si := sd.SignerInfos[0]
+	token, err := s.TimestampToken(ctx, si.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if err := si.AddUnsignedAttribute(cms.OIDAttributeTimeStampToken, token); err != nil {
+		return nil, err
+	}
+	return sd.Marshal()
+}
+
+// IssuingCertificate returns the DER issuing CA certificate published as the
+// AIA caIssuers location.
+func (s *caService) IssuingCertificate(ctx context.Context) ([]byte, error) {
+	authority, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return authority.Issuing.Raw, nil
+}
+
+func (s *caService) crlURL() string {
+	return strings.TrimRight(s.cfg.BaseURL, "/") + "/api/ca/crl"
+}
+
+func (s *caService) ocspURL() string {
+	return strings.TrimRight(s.cfg.BaseURL, "/") + "/api/ca/ocsp"
+}
+
+func (s *caService) issuerURL() string {
+	return strings.TrimRight(s.cfg.BaseURL, "/") + "/api/ca/issuer"
+}
+
+func (s *caService) tsaSigner(ctx context.Context) (*tsa.Signer, error) {
+	policy, err := x509.ParseOID(s.cfg.TSAPolicyOID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TSA_POLICY_OID: %w", err)
+	}
+	identity, err := s.serviceIdentity(ctx, ca.IdentityTSA)
+	if err != nil {
+		return nil, err
+	}
+	authority, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	// PKCS#1 v1.5 is what every token verifier understands
+	alg, err := pki.ResolveAlgorithm(pki.AlgRSASHA256, identity.Certificate.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tsa.Signer{
+		Certificate: identity.Certificate,
+		Key:         identity.Key,
+		Chain:       authority.Chain(),
+		Algorithm:   alg,
+		Policy:      policy,
+		Accuracy:    time.Second,
+	}, nil
+}
+
+// serviceIdentity returns a cached platform identity, issuing a new one when
+// it is missing or about to expire.
+func (s *caService) serviceIdentity(ctx context.Context, name string) (*ca.ServiceIdentity, error) {
+	authority, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	identity := s.identities[name]
+	s.mu.Unlock()
+
+	renewAt := time.Now().AddDate(0, 0, 7)
+	if identity != nil && identity.Certificate.NotAfter.After(renewAt) {
+		return identity, nil
+	}
+
+	identity, err = ca.LoadServiceIdentity(s.cfg, s.keys, name)
+	if err != nil && !errors.Is(err, ca.ErrIdentityNotFound) {
+		return nil, err
+	}
+	if identity == nil || identity.Certificate.NotAfter.Before(renewAt) {
+		identity, err = s.issueServiceIdentity(ctx, authority, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	s.identities[name] = identity
+	s.mu.Unlock()
+	return identity, nil
+}
+
+func (s *caService) issueServiceIdentity(ctx context.Context, authority *ca.Authority, name string) (*ca.ServiceIdentity, error) {
+	serial, err := s.allocateSerial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ca.NewServiceIdentityKey(s.keys, name, serial)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.auditIssuingKey(ctx, constants.ENUM_KEY_USAGE_ISSUE_CERTIFICATE, "serial:"+serial.Text(16)); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.AddDate(1, 0, 0),
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+	}
+
+	var profile string
+	switch name {
+	case ca.IdentityOCSP:
+		profile = constants.ENUM_CERT_PROFILE_OCSP
+		tmpl.Subject = pkix.Name{CommonName: s.cfg.Name + " OCSP Responder", Organization: []string{s.cfg.Name}}
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: ca.OIDOCSPNoCheck, Value: asn1.NullBytes}}
+	case ca.IdentityTSA:
+		profile = constants.ENUM_CERT_PROFILE_TSA
+		tmpl.Subject = pkix.Name{CommonName: s.cfg.Name + " Time Stamping Authority", Organization: []string{s.cfg.Name}}
+		// RFC 3161 requires the time-stamping EKU alone and critical
+		tmpl.ExtraExtensions = []pkix.Extension{tsa.ExtKeyUsageExtension()}
+	case ca.IdentityReport:
+		profile = constants.ENUM_CERT_PROFILE_REPORT
+		tmpl.Subject = pkix.Name{CommonName: s.cfg.Name + " Verification Service", Organization: []string{s.cfg.Name}}
+		tmpl.KeyUsage |= x509.KeyUsageContentCommitment
+	default:
+		return nil, fmt.Errorf("unknown service identity %q", name)
+	}
+
+	cert, err := authority.Issue(tmpl, key.Public())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.record(ctx, cert, "", profile); err != nil {
+		return nil, err
+	}
+
+	identity := &ca.ServiceIdentity{Certificate: cert, Key: key}
+	if err := ca.SaveServiceIdentity(s.cfg, s.keys, name, identity); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// load unlocks the CA on first use so the server can still start before
+// --ca-init has been run.
+func (s *caService) load() (*ca.Authority, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.authority != nil {
+		return s.authority, nil
+	}
+	authority, err := ca.Load(s.cfg, s.keys)
+	if err != nil {
+		return nil, err
+	}
+	s.authority = authority
+	return authority, nil
+}
+
+// auditIssuingKey records a use of the issuing CA key before it signs; like
+// user keys, it is not used when the entry cannot be written.
+func (s *caService) auditIssuingKey(ctx context.Context, purpose string, reference string) error {
+	_, err := s.keyUsageRepo.Create(ctx, nil, entity.KeyUsage{
+		KeyID:     CA_ISSUING_KEY_ID,
+		Purpose:   purpose,
+		Reference: reference,
+		Success:   true,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot audit key usage: %w", err)
+	}
+	return nil
+}
+
+func (s *caService) allocateSerial(ctx context.Context) (*big.Int, error) {
+	for i := 0; i < 3; i++ {
+		serial, err := ca.NewSerial()
+		if err != nil {
+			return nil, err
+		}
+		exists, err := s.certRepo.ExistsSerial(ctx, nil, serial.Text(16))
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return serial, nil
+		}
+	}
+	return nil, errors.New("failed to allocate a unique serial number")
+}
+
+func (s *caService) record(ctx context.Context, cert *x509.Certificate, userID, profile string) error {
+	_, err := s.certRepo.Create(ctx, nil, entity.Certificate{
+		Serial:      pki.SerialHex(cert),
+		Fingerprint: pki.Fingerprint(cert),
+		UserID:      userID,
+		Profile:     profile,
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+		CertPEM:     pki.EncodeCertificatePEM(cert.Raw),
+		Status:      constants.ENUM_CERT_STATUS_GOOD,
+	})
+	return err
+}
@@ -1,65 +1,174 @@
 package service
 
 import (
+	"bytes"
 	"context"
-	"crypto"
-	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
-	"mime/multipart"
+	"log"
+	"mime"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
 	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/pdf"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
 	"github.com/PhanPhuc2609/be-sign-file/repository"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
+	"github.com/PhanPhuc2609/be-sign-file/xmldsig"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type DocumentService interface {
 	CreateDocument(ctx context.Context, doc entity.Document) (entity.Document, error)
+	UploadDocument(ctx context.Context, userID string, fileName string, content io.Reader) (entity.Document, error)
 	GetDocumentsByUserID(ctx context.Context, userID string) ([]entity.Document, error)
 	UpdateDocument(ctx context.Context, doc entity.Document) (entity.Document, error)
-	DeleteDocument(ctx context.Context, id uint) error
+	DeleteDocument(ctx context.Context, userID string, id uint) error
 	GetDocumentByID(ctx context.Context, id uint) (entity.Document, error)
 	FindDocumentByDigest(ctx context.Context, digest string, userID string) (entity.Document, error)
 	GetSignaturesByDocumentID(ctx context.Context, docID uint) ([]entity.Signature, error)
 	VerifySignature(ctx context.Context, sig entity.Signature, doc entity.Document) (bool, error)
-	VerifySignatureRaw(ctx context.Context, sigBase64 string, content []byte, sig entity.Signature) (bool, error)
-	UploadAndVerifyDocumentService(ctx context.Context, userID string, fileHeader *multipart.FileHeader) (bool, string, error)
+	VerifySignatureRaw(ctx context.Context, sigBase64 string, digestHex string, sig entity.Signature) (bool, error)
+	UploadAndVerifyDocumentService(ctx context.Context, userID string, fileName string, content io.Reader) (dto.VerifyDocumentResponse, error)
+	VerifyPDF(ctx context.Context, src io.ReaderAt, size int64) (dto.VerifyDocumentResponse, error)
+	VerifyXML(ctx context.Context, content []byte) (dto.VerifyDocumentResponse, error)
+	SignVerificationReport(ctx context.Context, report dto.VerifyDocumentResponse) ([]byte, error)
+	VerifyDocumentPublic(ctx context.Context, fileName string, content io.Reader) (dto.PublicVerifyResponse, error)
+	OpenDocumentFile(ctx context.Context, userID string, id uint, signed bool) (dto.DocumentFile, error)
+	PurgeDocuments(ctx context.Context, deletedBefore time.Time) (int, error)
+	CheckBlobs(ctx context.Context) ([]string, error)
+	RunPurger(ctx context.Context)
 }
 
 type documentService struct {
-	docRepo repository.DocumentRepository
-	db      *gorm.DB
+	docRepo   repository.DocumentRepository
+	certRepo  repository.CertificateRepository
+	blobRepo  repository.BlobRepository
+	caService CAService
+	store     storage.Storage
+	cfg       config.DocumentConfig
+	db        *gorm.DB
 }
 
 func (s *documentService) FindDocumentByDigest(ctx context.Context, digest string, userID string) (entity.Document, error) {
 	return s.docRepo.FindByDigest(ctx, nil, digest, userID)
 }
 
-func NewDocumentService(docRepo repository.DocumentRepository, db *gorm.DB) DocumentService {
+func NewDocumentService(docRepo repository.DocumentRepository, certRepo repository.CertificateRepository, blobRepo repository.BlobRepository, caService CAService, store storage.Storage, cfg config.DocumentConfig, db *gorm.DB) DocumentService {
 	return &documentService{
-		docRepo: docRepo,
-		db:      db,
+		docRepo:   docRepo,
+		certRepo:  certRepo,
+		blobRepo:  blobRepo,
+		caService: caService,
+		store:     store,
+		cfg:       cfg,
+		db:        db,
 	}
 }
 
+// CreateDocument records a document for a file already stored at
+// doc.FilePath, moving the file into the blob of its content.
 func (s *documentService) CreateDocument(ctx context.Context, doc entity.Document) (entity.Document, error) {
-	// Đọc nội dung file tài liệu
-	content, err := os.ReadFile(doc.FilePath)
+	file, err := s.store.Get(ctx, doc.FilePath)
 	if err != nil {
 		return entity.Document{}, errors.New("cannot read document file")
 	}
-	// Tạo digest SHA-256
-	hash := sha256.Sum256(content)
-	doc.Digest = hex.EncodeToString(hash[:])
+	stored := doc.FilePath
+	doc, err = s.createDocument(ctx, doc, file)
+	file.Close()
+	if err != nil {
+		return entity.Document{}, err
+	}
+	if stored != doc.FilePath {
+		s.store.Delete(ctx, stored)
+	}
+	return doc, nil
+}
 
-	return s.docRepo.Create(ctx, nil, doc)
+// UploadDocument stores an uploaded file as it arrives, hashing it on the
+// way, and records the document. The file name is kept only as metadata.
+func (s *documentService) UploadDocument(ctx context.Context, userID string, fileName string, content io.Reader) (entity.Document, error) {
+	return s.createDocument(ctx, entity.Document{
+		UserID:   userID,
+		FileName: filepath.Base(fileName),
+		Status:   constants.ENUM_DOCUMENT_STATUS_UPLOADED,
+	}, content)
+}
+
+// createDocument stores content in the blob of its SHA-256 digest, unless
+// that blob already exists, and records doc as a new reference to it. The
+// content is spooled to a temporary file while it is hashed, as its key
+// depends on the digest. A new blob whose document cannot be recorded stays
+// in storage for the next upload of the same content.
+func (s *documentService) createDocument(ctx context.Context, doc entity.Document, content io.Reader) (entity.Document, error) {
+	// file tạm trên máy đang chạy, không đưa lên storage
+	file, err := os.CreateTemp("", "upload_*")
+	if err != nil {
+		return entity.Document{}, errors.New("cannot save file")
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	src := &sourceReader{Reader: content}
+	size, err := io.Copy(io.MultiWriter(file, hash), src)
+	if err != nil {
+		// lỗi đọc upload (quá lớn, client ngắt) được trả nguyên cho controller
+		if src.err != nil {
+			return entity.Document{}, src.err
+		}
+		return entity.Document{}, errors.New("cannot save file")
+	}
+	doc.Digest = hex.EncodeToString(hash.Sum(nil))
+	doc.FilePath = blobKey(doc.Digest)
+
+	// Nội dung đã có thì không ghi lại. Ghi trước khi mở transaction để
+	// không giữ khóa trong lúc tải file lên storage
+	if err := s.putBlob(ctx, doc.FilePath, file); err != nil {
+		return entity.Document{}, errors.New("cannot save file")
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := s.blobRepo.Acquire(ctx, tx, doc.Digest, size); err != nil {
+			return err
+		}
+		// Dòng blob đã bị khóa: blob vừa bị thu gom thì ghi lại
+		if err := s.putBlob(ctx, doc.FilePath, file); err != nil {
+			return err
+		}
+		doc, err = s.docRepo.Create(ctx, tx, doc)
+		return err
+	})
+	if err != nil {
+		return entity.Document{}, errors.New("cannot save file")
+	}
+	return doc, nil
+}
+
+// putBlob uploads file to the blob key unless it is stored already.
+func (s *documentService) putBlob(ctx context.Context, key string, file *os.File) error {
+	_, err := s.store.Stat(ctx, key)
+	if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// hai upload cùng nội dung có thể cùng ghi, kết quả như nhau
+	return s.store.Put(ctx, key, file)
 }
 
 func (s *documentService) GetDocumentByID(ctx context.Context, id uint) (entity.Document, error) {
@@ -79,10 +188,133 @@ func (s *documentService) UpdateDocument(ctx context.Context, doc entity.Documen
 	return s.docRepo.Update(ctx, nil, doc)
 }
 
-func (s *documentService) DeleteDocument(ctx context.Context, id uint) error {
+// DeleteDocument deletes a document of userID; it is purged with its blob
+// once the retention period is over. Documents of other users are reported
+// as not found.
+func (s *documentService) DeleteDocument(ctx context.Context, userID string, id uint) error {
+	doc, err := s.docRepo.FindByID(ctx, nil, id)
+	if err != nil || doc.UserID != userID {
+		return dto.ErrDocumentNotFound
+	}
 	return s.docRepo.Delete(ctx, nil, id)
 }
 
+// PurgeDocuments deletes for good the documents deleted before
+// deletedBefore, with their signatures, signing requests, signed outputs and
+// the blobs no other document references. It returns how many were purged.
+func (s *documentService) PurgeDocuments(ctx context.Context, deletedBefore time.Time) (int, error) {
+	docs, err := s.docRepo.FindDeletedBefore(ctx, nil, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	var errs []error
+	for _, doc := range docs {
+		if err := s.purgeDocument(ctx, doc); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+func (s *documentService) purgeDocument(ctx context.Context, doc entity.Document) error {
+	var blob entity.Blob
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.docRepo.Purge(ctx, tx, doc.ID); err != nil {
+			return err
+		}
+		if !isBlobKey(doc.FilePath) {
+			return nil
+		}
+		var err error
+		blob, err = s.blobRepo.Release(ctx, tx, doc.Digest)
+		return err
+	})
+	// một replica khác đã xóa tài liệu này
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if isBlobKey(doc.FilePath) {
+		if err := s.store.Delete(ctx, signedKey(doc)); err != nil {
+			return err
+		}
+		if blob.RefCount > 0 {
+			return nil
+		}
+		return s.collectBlob(ctx, doc.Digest)
+	}
+
+	// File tải lên trước đây nằm theo tên file, có thể dùng chung với tài
+	// liệu khác cùng tên
+	count, err := s.docRepo.CountByFilePath(ctx, nil, doc.FilePath)
+	if err != nil || count > 0 {
+		return err
+	}
+	if err := s.store.Delete(ctx, signedKey(doc)); err != nil {
+		return err
+	}
+	return s.store.Delete(ctx, doc.FilePath)
+}
+
+// collectBlob removes an unreferenced blob from storage, then its row. The
+// row stays locked meanwhile, so an upload of the same content waits for it
+// and stores the content again.
+func (s *documentService) collectBlob(ctx context.Context, digest string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, err := s.blobRepo.LockUnreferenced(ctx, tx, digest)
+		// đã được tham chiếu lại hoặc đã được thu gom
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.store.Delete(ctx, blobKey(digest)); err != nil {
+			return err
+		}
+		return s.blobRepo.Delete(ctx, tx, digest)
+	})
+}
+
+// RunPurger purges the documents deleted longer than the retention period
+// ago, and collects the blobs an interrupted purge left behind, until ctx is
+// cancelled.
+func (s *documentService) RunPurger(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeDocuments(ctx, time.Now().Add(-s.cfg.Retention))
+		if err != nil {
+			log.Printf("error purging deleted documents: %v", err)
+		}
+		if purged > 0 {
+			log.Printf("purged %d deleted documents", purged)
+		}
+		blobs, err := s.blobRepo.FindUnreferenced(ctx, nil)
+		if err != nil {
+			log.Printf("error listing unreferenced blobs: %v", err)
+		}
+		for _, blob := range blobs {
+			if err := s.collectBlob(ctx, blob.Digest); err != nil {
+				log.Printf("error collecting blob %s: %v", blob.Digest, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // Get signatures by document ID
 func (s *documentService) GetSignaturesByDocumentID(ctx context.Context, docID uint) ([]entity.Signature, error) {
 	return s.docRepo.GetSignaturesByDocumentID(ctx, nil, docID)
@@ -94,88 +326,826 @@ func (s *documentService) VerifySignature(ctx context.Context, sig entity.Signat
 	return false, errors.New("Not implemented, use VerifySignatureRaw")
 }
 
-// Verify signature from raw signature in file
-func (s *documentService) VerifySignatureRaw(ctx context.Context, sigBase64 string, content []byte, sig entity.Signature) (bool, error) {
-	// Lấy public key từ chữ ký (ở đây demo dùng private key để lấy public key)
-	privBytes, err := base64.StdEncoding.DecodeString(sig.PrivateKey)
+// OpenDocumentFile opens the original file of a document, or its signed
+// output when signed is set, for the owner, its signers and the signers it
+// was sent to. Documents the user cannot access are reported as not found.
+func (s *documentService) OpenDocumentFile(ctx context.Context, userID string, id uint, signed bool) (dto.DocumentFile, error) {
+	doc, err := s.docRepo.FindByID(ctx, nil, id)
 	if err != nil {
-		return false, errors.New("invalid private key encoding")
+		return dto.DocumentFile{}, dto.ErrDocumentNotFound
 	}
-	privateKey, err := x509.ParsePKCS1PrivateKey(privBytes)
+	allowed, err := s.docRepo.CanAccess(ctx, nil, id, userID)
 	if err != nil {
-		return false, errors.New("invalid private key")
+		return dto.DocumentFile{}, err
+	}
+	if !allowed {
+		return dto.DocumentFile{}, dto.ErrDocumentNotFound
 	}
-	publicKey := &privateKey.PublicKey
-
-	// Để tương thích với cách ký: ký hash của hex digest
-	// 1. Tính lại digest của nội dung file upload
-	fileDigest := sha256.Sum256(content)
-	fileDigestHex := hex.EncodeToString(fileDigest[:])
-	// 2. Hash lại chuỗi hex digest này
-	hashed := sha256.Sum256([]byte(fileDigestHex))
 
-	signatureBytes, err := base64.StdEncoding.DecodeString(sigBase64)
+	key := doc.FilePath
+	if signed {
+		key = signedKey(doc)
+	}
+	file, err := s.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		if signed {
+			return dto.DocumentFile{}, dto.ErrSignedFileNotFound
+		}
+		return dto.DocumentFile{}, dto.ErrDocumentNotFound
+	}
 	if err != nil {
-		return false, errors.New("invalid signature encoding")
+		return dto.DocumentFile{}, err
+	}
+	info := file.Info()
+
+	// Digest của file gốc lưu khi tải lên, của file đã ký lưu mỗi lần ký:
+	// không đọc lại cả file cho từng request Range. File ký trước khi có
+	// SignedDigest dùng kích thước và thời điểm ghi
+	digest := doc.Digest
+	if signed {
+		digest = doc.SignedDigest
+		if digest == "" {
+			digest = strconv.FormatInt(info.Size, 16) + "-" + strconv.FormatInt(info.ModTime.UnixNano(), 16)
+		}
 	}
 
-	err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signatureBytes)
+	return dto.DocumentFile{
+		Content:     file,
+		Name:        doc.FileName,
+		ContentType: documentContentType(file, doc.FileName),
+		ModTime:     info.ModTime,
+		Size:        info.Size,
+		Digest:      digest,
+	}, nil
+}
+
+// documentContentType guesses the media type from the file name, then from
+// the first bytes of the file.
+func documentContentType(file io.ReadSeeker, name string) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType
+	}
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	file.Seek(0, io.SeekStart)
+	return http.DetectContentType(head[:n])
+}
+
+// Verify signature from raw signature in file, over the hex SHA-256 digest
+// of the content before the signature marker
+func (s *documentService) VerifySignatureRaw(ctx context.Context, sigBase64 string, digestHex string, sig entity.Signature) (bool, error) {
+	// Chữ ký cũ ký bằng khoá tạm, không có chứng chỉ
+	if isLegacySignature(sig) {
+		if err := verifyLegacySignature(sig, sigBase64, digestHex); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	// Lấy public key từ chứng chỉ của người ký
+	cert, record, err := signerCertificate(ctx, s.certRepo, sig.Signer, sig)
 	if err != nil {
-		return false, errors.New("signature verification failed")
+		return false, err
+	}
+	// Dấu thời gian phải khớp với chữ ký trong file
+	signedAt, err := signatureTime(ctx, s.caService, sig, sigBase64)
+	if err != nil {
+		return false, err
+	}
+	// Chữ ký tạo sau thời điểm thu hồi chứng chỉ không còn hợp lệ
+	if err := checkRevocation(record, signedAt); err != nil {
+		return false, err
+	}
+
+	// Để tương thích với cách ký: ký hash của hex digest
+	if err := verifyDigestSignature(cert.PublicKey, sig.Algorithm, sig.SaltLength, sigBase64, digestHex); err != nil {
+		return false, err
 	}
 	return true, nil
 }
 
 // Upload and verify document logic moved from controller
-func (s *documentService) UploadAndVerifyDocumentService(ctx context.Context, userID string, fileHeader *multipart.FileHeader) (bool, string, error) {
-	file, err := fileHeader.Open()
+func (s *documentService) UploadAndVerifyDocumentService(ctx context.Context, userID string, fileName string, content io.Reader) (dto.VerifyDocumentResponse, error) {
+	return s.verifyUpload(ctx, userID, fileName, content)
+}
+
+// VerifyDocumentPublic verifies a file for anyone holding it: documents are
+// looked up by digest across all owners and the report keeps only the
+// signature metadata that is safe to show without an account.
+func (s *documentService) VerifyDocumentPublic(ctx context.Context, fileName string, content io.Reader) (dto.PublicVerifyResponse, error) {
+	res, err := s.verifyUpload(ctx, "", fileName, content)
+	return publicReport(res), err
+}
+
+// verifyUpload spools the upload to a temporary file, hashing it on the way,
+// and builds the verification report from that file. userID is the caller
+// whose documents and signature records may be reported; an empty userID is
+// a public verification that matches any owner.
+func (s *documentService) verifyUpload(ctx context.Context, userID string, fileName string, content io.Reader) (dto.VerifyDocumentResponse, error) {
+	// file tạm trên máy đang chạy, không đưa lên storage
+	file, err := os.CreateTemp("", "verify_*")
 	if err != nil {
-		return false, "Cannot open uploaded file", err
+		return dto.VerifyDocumentResponse{Message: "Cannot save file"}, err
 	}
+	defer os.Remove(file.Name())
 	defer file.Close()
 
-	tempPath := "uploads/verify_" + fileHeader.Filename
-	out, err := os.Create(tempPath)
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), content)
 	if err != nil {
-		return false, "Cannot save file", err
+		return dto.VerifyDocumentResponse{Message: "Cannot save file"}, err
+	}
+
+	var res dto.VerifyDocumentResponse
+	format := "marker"
+	head := make([]byte, 512)
+	n, _ := file.ReadAt(head, 0)
+	head = head[:n]
+	// XML-DSig cần cả cây DOM nên file XML được đọc vào bộ nhớ; file văn bản
+	// có marker không bắt đầu bằng '<' nên không bị đọc hết
+	var xmlContent []byte
+	if looksLikeXML(head) {
+		content, err := io.ReadAll(io.NewSectionReader(file, 0, size))
+		if err == nil && xmldsig.IsXML(content) {
+			format, xmlContent = "xml", content
+		}
+	}
+	switch {
+	// PDF có chữ ký nhúng (của hệ thống hoặc phần mềm khác), đọc theo từng đoạn
+	case pdf.IsPDF(head):
+		format = "pdf"
+		res, err = s.VerifyPDF(ctx, file, size)
+	// XML có chữ ký XML-DSig enveloped
+	case format == "xml":
+		res, err = s.VerifyXML(ctx, xmlContent)
+	default:
+		res, err = s.verifyMarkedDocument(ctx, userID, file, size)
+	}
+	if err == nil && format != "marker" {
+		// bổ sung các bản ghi chữ ký trong hệ thống của tài liệu tương ứng
+		err = s.addDocumentRecords(ctx, userID, &res)
+	}
+
+	res.ReportID = uuid.NewString()
+	res.GeneratedAt = time.Now().Unix()
+	res.FileName = fileName
+	res.FileDigest = hex.EncodeToString(hash.Sum(nil))
+	res.Format = format
+	res.Verdict = reportVerdict(res)
+	res.Verified = res.Verdict == dto.VERDICT_VALID
+	if err == nil {
+		res.Message = verdictMessage(res)
+	}
+	return res, err
+}
+
+// publicReport drops identifiers, certificate details and error text from a
+// report; what is left tells who signed, when, and whether it holds.
+func publicReport(res dto.VerifyDocumentResponse) dto.PublicVerifyResponse {
+	public := dto.PublicVerifyResponse{
+		ReportID:                   res.ReportID,
+		GeneratedAt:                res.GeneratedAt,
+		FileName:                   res.FileName,
+		FileDigest:                 res.FileDigest,
+		Format:                     res.Format,
+		Verdict:                    res.Verdict,
+		Verified:                   res.Verified,
+		Message:                    res.Message,
+		ModifiedAfterLastSignature: res.ModifiedAfterLastSignature,
+		RegisteredDocument:         res.DocumentID != nil,
 	}
-	_, err = io.Copy(out, file)
-	out.Close()
+	for _, item := range res.Signatures {
+		public.Signatures = append(public.Signatures, dto.PublicSignatureResult{
+			Source:           item.Source,
+			CounterSignature: item.ParentID != nil,
+			SignerName:       item.SignerName,
+			Algorithm:        item.Algorithm,
+			SigningTime:      item.SigningTime,
+			Timestamp:        item.Timestamp,
+			CoversDocument:   item.CoversDocument,
+			CertificateValid: item.CertificateValid,
+			RevocationStatus: item.RevocationStatus,
+			DigestValid:      item.DigestValid,
+			SignatureValid:   item.SignatureValid,
+			ChainValid:       item.ChainValid,
+			TimestampValid:   item.TimestampValid,
+			Valid:            item.Valid,
+		})
+	}
+	return public
+}
+
+// SignVerificationReport returns the JSON report as a CMS SignedData (.p7m)
+// signed by the platform.
+func (s *documentService) SignVerificationReport(ctx context.Context, report dto.VerifyDocumentResponse) ([]byte, error) {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return s.caService.SignReport(ctx, content)
+}
+
+// verifyMarkedDocument handles files signed with text marker trailers: each
+// signature in the file, then every signature record of the document.
+func (s *documentService) verifyMarkedDocument(ctx context.Context, userID string, src io.ReaderAt, size int64) (dto.VerifyDocumentResponse, error) {
+	markerAt, fileSigs, err := findSignatureMarkers(src, size)
 	if err != nil {
-		return false, "Cannot save file", err
+		return dto.VerifyDocumentResponse{Message: "No signature found in file"}, err
+	}
+
+	// Nội dung gốc là phần trước marker đầu tiên
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(src, 0, markerAt)); err != nil {
+		return dto.VerifyDocumentResponse{Message: "Cannot read uploaded file"}, err
 	}
-	defer os.Remove(tempPath)
+	digest := hex.EncodeToString(hash.Sum(nil))
 
-	signedContent, err := os.ReadFile(tempPath)
+	var docs []entity.Document
+	if userID == "" {
+		docs, err = s.docRepo.FindAllByDigest(ctx, nil, digest)
+	} else {
+		var doc entity.Document
+		doc, err = s.FindDocumentByDigest(ctx, digest, userID)
+		docs = []entity.Document{doc}
+	}
+	if err == nil && len(docs) == 0 {
+		err = gorm.ErrRecordNotFound
+	}
 	if err != nil {
-		return false, "Cannot read uploaded file", err
+		return dto.VerifyDocumentResponse{Message: "Document not found by digest"}, err
 	}
-	parts := strings.Split(string(signedContent), "---BEGIN SIGNATURE---")
-	if len(parts) < 2 {
-		return false, "No signature found in file", errors.New("no signature")
+
+	// Chữ ký trong file ứng với bản ghi có cùng giá trị chữ ký; cùng một nội
+	// dung có thể được nhiều người tải lên, chọn tài liệu chứa chữ ký đó
+	var doc entity.Document
+	var sigs []entity.Signature
+	found := false
+	for _, candidate := range docs {
+		candidateSigs, err := s.GetSignaturesByDocumentID(ctx, candidate.ID)
+		if err != nil || len(candidateSigs) == 0 {
+			continue
+		}
+		if sigs == nil {
+			doc, sigs = candidate, candidateSigs
+		}
+		for _, sigBase64 := range fileSigs {
+			if findTopLevelSignature(candidateSigs, sigBase64) != nil {
+				doc, sigs, found = candidate, candidateSigs, true
+				break
+			}
+		}
+		if found {
+			break
+		}
 	}
-	signedParts := strings.SplitN(parts[1], "---END SIGNATURE---", 2)
-	if len(signedParts) < 1 {
-		return false, "No signature end marker in file", errors.New("no signature end marker")
+	if len(sigs) == 0 {
+		return dto.VerifyDocumentResponse{Message: "No signature found for this document"}, errors.New("no signature in db")
 	}
-	sigBase64 := strings.TrimSpace(signedParts[0])
-	originalContent := []byte(parts[0])
 
-	digest := fmt.Sprintf("%x", sha256.Sum256(originalContent))
+	res := dto.VerifyDocumentResponse{DocumentID: &doc.ID}
+	for _, sigBase64 := range fileSigs {
+		item := dto.SignatureCheckResult{Source: dto.SIGNATURE_SOURCE_FILE, CoversDocument: true, DigestValid: true}
+		if matched := findTopLevelSignature(sigs, sigBase64); matched != nil {
+			item = s.checkSignatureRecord(ctx, *matched, doc.Digest)
+			item.Source = dto.SIGNATURE_SOURCE_FILE
+			item.CoversDocument = true
+			item.DigestValid = true
+			if _, err := s.VerifySignatureRaw(ctx, sigBase64, digest, *matched); err != nil {
+				item.SignatureValid = false
+				item.Error = err.Error()
+			}
+			finishCheck(&item)
+		} else {
+			item.Error = "signature does not belong to any signer of this document"
+		}
+		res.Signatures = append(res.Signatures, item)
+	}
 
-	doc, err := s.FindDocumentByDigest(ctx, digest, userID)
-	if err != nil {
-		return false, "Document not found by digest", err
+	// Mọi chữ ký của tài liệu trong hệ thống đều ký lên digest của nội dung này
+	res.Signatures = append(res.Signatures, s.checkDocumentRecords(ctx, doc, sigs, func(sig entity.Signature) bool {
+		return sig.ParentID == nil
+	})...)
+	return res, nil
+}
+
+// findTopLevelSignature returns the signature of sigs, not a
+// counter-signature, whose value is sigBase64, or nil.
+func findTopLevelSignature(sigs []entity.Signature, sigBase64 string) *entity.Signature {
+	for i := range sigs {
+		if sigs[i].ParentID == nil && sigs[i].SignatureRaw == sigBase64 {
+			return &sigs[i]
+		}
+	}
+	return nil
+}
+
+// addDocumentRecords matches the signatures found in a PDF or XML file with
+// signature records by certificate serial (and signing time when the file
+// states one), then appends every record of the matched document. Records
+// are only reported to the document owner and its signers, or to anyone for
+// a public verification.
+func (s *documentService) addDocumentRecords(ctx context.Context, userID string, res *dto.VerifyDocumentResponse) error {
+	var doc *entity.Document
+	used := make(map[uint]bool)
+	for i := range res.Signatures {
+		item := &res.Signatures[i]
+		if item.SignerSerial == "" {
+			continue
+		}
+		records, err := s.docRepo.GetSignaturesByCertSerial(ctx, nil, item.SignerSerial)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if used[record.ID] || record.ParentID != nil || (doc != nil && record.DocumentID != doc.ID) {
+				continue
+			}
+			if item.SigningTime != 0 && record.SignedAt != item.SigningTime {
+				continue
+			}
+			if userID != "" && record.Document.UserID != userID && record.SignerID != userID {
+				continue
+			}
+			id := record.ID
+			item.SignatureID = &id
+			used[id] = true
+			if doc == nil {
+				recordDoc := record.Document
+				doc = &recordDoc
+			}
+			break
+		}
+	}
+	if doc == nil {
+		return nil
 	}
+
+	res.DocumentID = &doc.ID
 	sigs, err := s.GetSignaturesByDocumentID(ctx, doc.ID)
-	if err != nil || len(sigs) == 0 {
-		return false, "No signature found for this document", errors.New("no signature in db")
+	if err != nil {
+		return err
+	}
+	res.Signatures = append(res.Signatures, s.checkDocumentRecords(ctx, *doc, sigs, func(sig entity.Signature) bool {
+		return used[sig.ID]
+	})...)
+	return nil
+}
+
+// checkDocumentRecords verifies every signature record of doc: top-level
+// signatures over the recorded document digest, counter-signatures over their
+// parent's signature value. covers tells which records are part of the
+// uploaded file.
+func (s *documentService) checkDocumentRecords(ctx context.Context, doc entity.Document, sigs []entity.Signature, covers func(entity.Signature) bool) []dto.SignatureCheckResult {
+	values := make(map[uint]string, len(sigs))
+	for _, sig := range sigs {
+		value, _ := base64.StdEncoding.DecodeString(sig.SignatureRaw)
+		values[sig.ID] = string(value)
 	}
 
-	ok, err := s.VerifySignatureRaw(ctx, sigBase64, originalContent, sigs[0])
-	if ok {
-		return true, "Signature is valid", nil
+	storedValid := s.storesDigest(ctx, doc)
+
+	items := make([]dto.SignatureCheckResult, 0, len(sigs))
+	for _, sig := range sigs {
+		message := doc.Digest
+		digestValid := storedValid
+		if sig.ParentID != nil {
+			message, digestValid = values[*sig.ParentID]
+		}
+		item := s.checkSignatureRecord(ctx, sig, message)
+		item.CoversDocument = covers(sig)
+		item.DigestValid = digestValid
+		finishCheck(&item)
+		items = append(items, item)
+	}
+	return items
+}
+
+// storesDigest tells whether the stored original of doc is the content of
+// the digest its signatures cover. Blobs are keyed by their digest, so this
+// compares the recorded digest with the key instead of hashing the file on
+// every verification; CheckBlobs re-hashes their content.
+func (s *documentService) storesDigest(ctx context.Context, doc entity.Document) bool {
+	if doc.Digest == "" {
+		return false
+	}
+	if isBlobKey(doc.FilePath) && doc.FilePath != blobKey(doc.Digest) {
+		return false
+	}
+	_, err := s.store.Stat(ctx, doc.FilePath)
+	return err == nil
+}
+
+// CheckBlobs re-hashes the content of every referenced blob and returns the
+// digests whose content is missing or no longer matches. It reads all the
+// stored documents, so it is run on demand, not per request.
+func (s *documentService) CheckBlobs(ctx context.Context) ([]string, error) {
+	blobs, err := s.blobRepo.FindReferenced(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	var corrupted []string
+	for _, blob := range blobs {
+		digest, err := hashFile(ctx, s.store, blobKey(blob.Digest))
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return corrupted, err
+		}
+		if digest != blob.Digest {
+			corrupted = append(corrupted, blob.Digest)
+		}
+	}
+	return corrupted, nil
+}
+
+// checkSignatureRecord verifies one signature record over message: the
+// signature with the recorded certificate, its timestamp, and the
+// certificate, chain and revocation status at the time-stamped signing time.
+// The caller sets DigestValid and calls finishCheck.
+func (s *documentService) checkSignatureRecord(ctx context.Context, sig entity.Signature, message string) dto.SignatureCheckResult {
+	id := sig.ID
+	item := dto.SignatureCheckResult{
+		Source:      dto.SIGNATURE_SOURCE_DATABASE,
+		SignatureID: &id,
+		ParentID:    sig.ParentID,
+		SignerName:  sig.Signer.Name,
+		Algorithm:   sig.Algorithm,
+		SigningTime: sig.SignedAt,
+	}
+	// Chữ ký cũ ký bằng khoá tạm: chữ ký kiểm tra được nhưng không xác định
+	// được người ký qua chứng chỉ
+	if isLegacySignature(sig) {
+		item.ValidationTime = sig.SignedAt
+		if err := verifyLegacySignature(sig, sig.SignatureRaw, message); err != nil {
+			item.Error = err.Error()
+			return item
+		}
+		item.SignatureValid = true
+		item.Error = "signature was made with a one-off key, the signer has no certificate"
+		return item
+	}
+	cert, _, err := signerCertificate(ctx, s.certRepo, sig.Signer, sig)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	item.SignerSubject = cert.Subject.String()
+	item.SignerIssuer = cert.Issuer.String()
+	item.SignerSerial = pki.SerialHex(cert)
+
+	at := time.Unix(sig.SignedAt, 0)
+	if len(sig.TimestampToken) > 0 {
+		value, _ := base64.StdEncoding.DecodeString(sig.SignatureRaw)
+		timestamped, err := verifyTimestamp(ctx, s.caService, sig.TimestampToken, value)
+		timestampValid := err == nil
+		item.TimestampValid = &timestampValid
+		if timestampValid {
+			item.Timestamp = timestamped
+			at = time.Unix(timestamped, 0)
+		}
+	}
+
+	if err := verifyDigestSignature(cert.PublicKey, sig.Algorithm, sig.SaltLength, sig.SignatureRaw, message); err != nil {
+		item.Error = err.Error()
 	} else {
-		return false, err.Error(), err
+		item.SignatureValid = true
+	}
+
+	trust, err := s.caService.TrustStore(ctx)
+	if err != nil {
+		trust = nil
+	}
+	chain, err := s.caService.Chain(ctx)
+	if err != nil {
+		chain = nil
+	}
+	s.checkCertificate(ctx, &item, cert, at, trust, chain)
+	return item
+}
+
+// checkCertificate fills the certificate validity and revocation status of
+// the signer certificate at time at. With a trust store the chain is checked
+// too; PDF and XML results come with their chain status already.
+func (s *documentService) checkCertificate(ctx context.Context, item *dto.SignatureCheckResult, cert *x509.Certificate, at time.Time, trust *pki.TrustStore, intermediates []*x509.Certificate) {
+	item.ValidationTime = at.Unix()
+	item.CertNotBefore = cert.NotBefore.Unix()
+	item.CertNotAfter = cert.NotAfter.Unix()
+	item.CertificateValid = !at.Before(cert.NotBefore) && !at.After(cert.NotAfter)
+
+	item.RevocationStatus = dto.REVOCATION_UNKNOWN
+	if record, err := s.certRepo.FindByFingerprint(ctx, nil, pki.Fingerprint(cert)); err == nil {
+		item.RevocationStatus = dto.REVOCATION_GOOD
+		if record.IsRevoked() {
+			item.RevocationStatus = dto.REVOCATION_REVOKED
+			item.RevokedAt = record.RevokedAt.Unix()
+		}
+	}
+
+	if trust != nil {
+		_, err := trust.Verify(cert, intermediates, at)
+		item.ChainValid = err == nil
+		if err != nil && item.Error == "" {
+			item.Error = err.Error()
+		}
+	}
+}
+
+// revokedBeforeSigning reports whether the signer certificate was revoked at
+// or before the time the signature is known to exist.
+func revokedBeforeSigning(item dto.SignatureCheckResult) bool {
+	return item.RevocationStatus == dto.REVOCATION_REVOKED && item.RevokedAt <= item.ValidationTime
+}
+
+// finishCheck sets the overall result of one signature.
+func finishCheck(item *dto.SignatureCheckResult) {
+	if revokedBeforeSigning(*item) && item.Error == "" {
+		item.Error = "signer certificate was revoked before the signature was made"
+	}
+	if !item.CertificateValid && item.Error == "" {
+		item.Error = "signer certificate was not valid at signing time"
+	}
+	item.Valid = item.DigestValid && item.SignatureValid && item.ChainValid && item.CertificateValid &&
+		!revokedBeforeSigning(*item) && (item.TimestampValid == nil || *item.TimestampValid)
+}
+
+// reportVerdict is invalid when any signature of the file, or any record that
+// is part of it, is broken; indeterminate when all are intact but some signer
+// certificate could not be validated.
+func reportVerdict(res dto.VerifyDocumentResponse) string {
+	if res.ModifiedAfterLastSignature != nil && *res.ModifiedAfterLastSignature {
+		return dto.VERDICT_INVALID
+	}
+	verdict := dto.VERDICT_VALID
+	considered := 0
+	for _, item := range res.Signatures {
+		// bản ghi của phiên bản khác của tài liệu chỉ để tham khảo
+		if item.Source == dto.SIGNATURE_SOURCE_DATABASE && item.ParentID == nil && !item.CoversDocument {
+			continue
+		}
+		considered++
+		switch {
+		case item.Valid:
+		case !item.DigestValid || !item.SignatureValid || revokedBeforeSigning(item) ||
+			(item.TimestampValid != nil && !*item.TimestampValid):
+			return dto.VERDICT_INVALID
+		default:
+			verdict = dto.VERDICT_INDETERMINATE
+		}
+	}
+	if considered == 0 {
+		return dto.VERDICT_INVALID
+	}
+	return verdict
+}
+
+func verdictMessage(res dto.VerifyDocumentResponse) string {
+	switch {
+	case res.Verdict == dto.VERDICT_VALID:
+		return "All signatures are valid"
+	case res.Verdict == dto.VERDICT_INDETERMINATE:
+		return "Signatures are intact but one or more signer certificates could not be validated"
+	case res.ModifiedAfterLastSignature != nil && *res.ModifiedAfterLastSignature:
+		return "Document was modified after the last signature"
+	case len(res.Signatures) == 0:
+		return "No signature found in file"
+	}
+	return "One or more signatures are invalid"
+}
+
+// VerifyPDF validates every embedded signature of a PDF against the trust
+// store. The document is verified only when all signatures are valid and
+// nothing was appended after the last one.
+func (s *documentService) VerifyPDF(ctx context.Context, src io.ReaderAt, size int64) (dto.VerifyDocumentResponse, error) {
+	trust, err := s.caService.TrustStore(ctx)
+	if err != nil {
+		return dto.VerifyDocumentResponse{Message: "Cannot load trust store"}, err
+	}
+	result, err := pdf.Verify(src, size, pdf.VerifyOptions{Trust: trust})
+	if err != nil {
+		return dto.VerifyDocumentResponse{Message: "Cannot read PDF file"}, err
+	}
+	if len(result.Signatures) == 0 {
+		return dto.VerifyDocumentResponse{Message: "No signature found in file"}, errors.New("no signature")
+	}
+
+	modified := result.ModifiedAfterLastSignature
+	res := dto.VerifyDocumentResponse{
+		ModifiedAfterLastSignature: &modified,
+	}
+	for _, sig := range result.Signatures {
+		item := dto.SignatureCheckResult{
+			Source:         dto.SIGNATURE_SOURCE_FILE,
+			Field:          sig.Field,
+			SignerName:     sig.Name,
+			Reason:         sig.Reason,
+			Location:       sig.Location,
+			SubFilter:      sig.SubFilter,
+			ByteRange:      sig.ByteRange[:],
+			CoversDocument: sig.CoversDocument,
+			DigestValid:    sig.DigestValid,
+			SignatureValid: sig.SignatureValid,
+			ChainValid:     sig.ChainValid,
+		}
+		at := time.Now()
+		if !sig.SigningTime.IsZero() {
+			item.SigningTime = sig.SigningTime.Unix()
+			at = sig.SigningTime
+		}
+		if !sig.Timestamp.IsZero() {
+			timestampValid := sig.TimestampValid
+			item.Timestamp = sig.Timestamp.Unix()
+			item.TimestampValid = &timestampValid
+			if timestampValid {
+				at = sig.Timestamp
+			}
+		}
+		if sig.Err != nil {
+			item.Error = sig.Err.Error()
+		}
+		if sig.Signer != nil {
+			item.SignerSubject = sig.Signer.Subject.String()
+			item.SignerIssuer = sig.Signer.Issuer.String()
+			item.SignerSerial = pki.SerialHex(sig.Signer)
+			s.checkCertificate(ctx, &item, sig.Signer, at, nil, nil)
+		}
+		finishCheck(&item)
+		res.Signatures = append(res.Signatures, item)
+	}
+	res.Verdict = reportVerdict(res)
+	res.Verified = res.Verdict == dto.VERDICT_VALID
+	res.Message = verdictMessage(res)
+	return res, nil
+}
+
+// VerifyXML validates the enveloped XML-DSig signatures of an XML document
+// against the trust store.
+func (s *documentService) VerifyXML(ctx context.Context, content []byte) (dto.VerifyDocumentResponse, error) {
+	trust, err := s.caService.TrustStore(ctx)
+	if err != nil {
+		return dto.VerifyDocumentResponse{Message: "Cannot load trust store"}, err
+	}
+	results, err := xmldsig.Verify(content, xmldsig.VerifyOptions{Trust: trust})
+	if errors.Is(err, xmldsig.ErrNoSignature) {
+		return dto.VerifyDocumentResponse{Message: "No signature found in file"}, errors.New("no signature")
+	}
+	if err != nil {
+		return dto.VerifyDocumentResponse{Message: "Cannot read XML file"}, err
+	}
+
+	res := dto.VerifyDocumentResponse{}
+	for i, sig := range results {
+		item := dto.SignatureCheckResult{
+			Source:          dto.SIGNATURE_SOURCE_FILE,
+			SignatureMethod: sig.SignatureMethod,
+			// chữ ký sau cùng phủ toàn bộ tài liệu, kể cả các chữ ký trước
+			CoversDocument: i == len(results)-1,
+			DigestValid:    sig.DigestValid,
+			SignatureValid: sig.SignatureValid,
+			ChainValid:     sig.ChainValid,
+		}
+		if sig.Err != nil {
+			item.Error = sig.Err.Error()
+		}
+		if sig.Signer != nil {
+			item.SignerName = sig.Signer.Subject.CommonName
+			item.SignerSubject = sig.Signer.Subject.String()
+			item.SignerIssuer = sig.Signer.Issuer.String()
+			item.SignerSerial = pki.SerialHex(sig.Signer)
+			// XML-DSig không có thời điểm ký, chứng chỉ được đánh giá tại hiện tại
+			s.checkCertificate(ctx, &item, sig.Signer, time.Now(), nil, nil)
+		}
+		finishCheck(&item)
+		res.Signatures = append(res.Signatures, item)
+	}
+	res.Verdict = reportVerdict(res)
+	res.Verified = res.Verdict == dto.VERDICT_VALID
+	res.Message = verdictMessage(res)
+	return res, nil
+}
+
+// UPLOAD_DIR is the storage key prefix of uploaded documents and their
+// signed outputs. Documents are stored once per content, in blobs keyed by
+// their SHA-256 digest below BLOB_DIR.
+const (
+	UPLOAD_DIR = "uploads"
+	BLOB_DIR   = UPLOAD_DIR + "/sha256"
+	SIGNED_DIR = UPLOAD_DIR + "/signed"
+)
+
+// blobKey is where the content of digest is stored, spread over directories
+// by its first byte.
+func blobKey(digest string) string {
+	return BLOB_DIR + "/" + digest[:2] + "/" + digest
+}
+
+// isBlobKey tells the documents stored as blobs apart from those uploaded
+// before, which are stored under their file name.
+func isBlobKey(key string) bool {
+	return strings.HasPrefix(key, BLOB_DIR+"/")
+}
+
+// signedKey is where the signed output of a document is stored. Documents
+// sharing a blob are signed separately.
+func signedKey(doc entity.Document) string {
+	if !isBlobKey(doc.FilePath) {
+		return doc.FilePath + ".signed"
+	}
+	return SIGNED_DIR + "/" + strconv.FormatUint(uint64(doc.ID), 10)
+}
+
+const (
+	SIGNATURE_BEGIN = "---BEGIN SIGNATURE---"
+	SIGNATURE_END   = "---END SIGNATURE---"
+	// marker và chữ ký base64 luôn nằm ở cuối file, trong đoạn này
+	signatureTrailerSize = 64 << 10
+)
+
+// hashFile returns the hex SHA-256 digest of a stored file, read in chunks.
+func hashFile(ctx context.Context, store storage.Storage, key string) (string, error) {
+	file, err := store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// sourceReader remembers the error of the reader it wraps, telling a failed
+// upload apart from a failed store.
+type sourceReader struct {
+	io.Reader
+	err error
+}
+
+func (r *sourceReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// looksLikeXML reports whether the first bytes of a file open an XML
+// document.
+func looksLikeXML(head []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(head, " \t\r\n\xef\xbb\xbf"), []byte("<"))
+}
+
+// findSignatureMarkers locates the signature trailers at the end of a file,
+// one per signature, each appended after the previous one. It returns where
+// the first marker starts, which is the end of the signed content, and the
+// base64 signatures in file order.
+func findSignatureMarkers(src io.ReaderAt, size int64) (int64, []string, error) {
+	for window := int64(signatureTrailerSize); ; window *= 2 {
+		start := size - window
+		if start < 0 {
+			start = 0
+		}
+		tail := make([]byte, size-start)
+		if _, err := src.ReadAt(tail, start); err != nil && err != io.EOF {
+			return 0, nil, err
+		}
+		at, sigs, complete := parseSignatureTrailers(tail)
+		if len(sigs) == 0 {
+			return 0, nil, errors.New("no signature")
+		}
+		// marker đầu tiên có thể nằm trước đoạn đã đọc: đọc thêm
+		if complete || start == 0 {
+			return start + int64(at), sigs, nil
+		}
+	}
+}
+
+// parseSignatureTrailers reads the trailers at the end of tail from the last
+// one back. It returns where the first one starts and the signatures in file
+// order; complete is false when an earlier trailer may be cut off by the
+// start of tail.
+func parseSignatureTrailers(tail []byte) (int, []string, bool) {
+	i := bytes.LastIndex(tail, []byte(SIGNATURE_BEGIN))
+	if i < 0 {
+		return 0, nil, true
+	}
+	last := tail[i+len(SIGNATURE_BEGIN):]
+	if end := bytes.Index(last, []byte(SIGNATURE_END)); end >= 0 {
+		last = last[:end]
+	}
+	sigs := []string{strings.TrimSpace(string(last))}
+
+	// các marker trước đứng liền nhau, mỗi marker trên đúng ba dòng
+	begin := []byte(SIGNATURE_BEGIN + "\n")
+	end := []byte("\n" + SIGNATURE_END + "\n")
+	for bytes.HasSuffix(tail[:i], end) {
+		j := bytes.LastIndex(tail[:i], begin)
+		if j < 0 || j+len(begin) >= i-len(end) {
+			return i, sigs, false
+		}
+		sig := tail[j+len(begin) : i-len(end)]
+		if bytes.ContainsAny(sig, "\r\n") {
+			return i, sigs, false
+		}
+		sigs = append([]string{string(sig)}, sigs...)
+		i = j
 	}
+	return i, sigs, true
 }
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/keyring"
+	"github.com/PhanPhuc2609/be-sign-file/repository"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
+)
+
+// EncryptionService keeps the data keys of encrypted files in the database,
+// wrapped by the master key, for the encrypted storage.
+type EncryptionService interface {
+	storage.DataKeys
+	RotateMasterKey(ctx context.Context) (int, error)
+}
+
+type encryptionService struct {
+	dataKeyRepo repository.DataKeyRepository
+	keys        *keyring.Keyring
+}
+
+func NewEncryptionService(dataKeyRepo repository.DataKeyRepository, keys *keyring.Keyring) EncryptionService {
+	return &encryptionService{
+		dataKeyRepo: dataKeyRepo,
+		keys:        keys,
+	}
+}
+
+// số khóa được bọc lại mỗi lượt khi xoay vòng master key
+const rotateBatchSize = 500
+
+func (s *encryptionService) Create(ctx context.Context, id string, key []byte) error {
+	// khóa gói gắn với id, không chuyển sang bản ghi khác được
+	wrapped, masterKeyID, err := s.keys.Wrap(key, []byte(id))
+	if err != nil {
+		return err
+	}
+	_, err = s.dataKeyRepo.Create(ctx, nil, entity.DataKey{
+		ID:          id,
+		WrappedKey:  wrapped,
+		MasterKeyID: masterKeyID,
+	})
+	return err
+}
+
+func (s *encryptionService) Find(ctx context.Context, id string) ([]byte, error) {
+	dataKey, err := s.dataKeyRepo.FindByID(ctx, nil, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.keys.Unwrap(dataKey.WrappedKey, dataKey.MasterKeyID, []byte(id))
+}
+
+func (s *encryptionService) Delete(ctx context.Context, id string) error {
+	return s.dataKeyRepo.Delete(ctx, nil, id)
+}
+
+// RotateMasterKey wraps again with the current master key every data key
+// wrapped by a previous one, and returns how many were. The files keep
+// their data keys and are not rewritten; once it is done the previous master
+// keys can be dropped.
+func (s *encryptionService) RotateMasterKey(ctx context.Context) (int, error) {
+	rotated := 0
+	for {
+		dataKeys, err := s.dataKeyRepo.FindNotWrappedBy(ctx, nil, s.keys.CurrentID(), rotateBatchSize)
+		if err != nil {
+			return rotated, err
+		}
+		if len(dataKeys) == 0 {
+			return rotated, nil
+		}
+		for _, dataKey := range dataKeys {
+			key, err := s.keys.Unwrap(dataKey.WrappedKey, dataKey.MasterKeyID, []byte(dataKey.ID))
+			if err != nil {
+				return rotated, fmt.Errorf("data key %s: %w", dataKey.ID, err)
+			}
+			dataKey.WrappedKey, dataKey.MasterKeyID, err = s.keys.Wrap(key, []byte(dataKey.ID))
+			if err != nil {
+				return rotated, err
+			}
+			if err := s.dataKeyRepo.Rewrap(ctx, nil, dataKey); err != nil {
+				return rotated, err
+			}
+			rotated++
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/ca"
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/hsm"
+	"github.com/PhanPhuc2609/be-sign-file/keyring"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/PhanPhuc2609/be-sign-file/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// KeyProvider hands out the signing key of a user as a crypto.Signer for one
+// operation, wherever the key is kept: decrypted in process or used inside a
+// PKCS#11 token. The returned function ends the operation.
+type KeyProvider interface {
+	UnlockKey(ctx context.Context, user entity.User, pin string, purpose string, reference string) (crypto.Signer, func(), error)
+}
+
+// KeyVaultService keeps the private keys of users encrypted, either under a
+// key derived from their PIN or under the master key, or in a PKCS#11 token,
+// and unlocks a key only for one signing operation, writing an audit entry
+// each time.
+type KeyVaultService interface {
+	KeyProvider
+	CreateKey(userID string, keyType string, backend string, pin string) (entity.VaultKey, crypto.PublicKey, error)
+	SealKey(userID string, key crypto.Signer, pin string) (entity.VaultKey, error)
+	DestroyKey(vaultKey entity.VaultKey) error
+	MigrateLegacyKeys(ctx context.Context) (int, error)
+	RotateMasterKey(ctx context.Context) (int, error)
+}
+
+type keyVaultService struct {
+	vaultKeyRepo repository.VaultKeyRepository
+	keyUsageRepo repository.KeyUsageRepository
+	userRepo     repository.UserRepository
+	// nil khi không cấu hình master key: khi đó khóa chỉ được bảo vệ bằng PIN
+	keys *keyring.Keyring
+	// nil khi không cấu hình PKCS#11 token
+	keyStore hsm.KeyStore
+	db       *gorm.DB
+}
+
+func NewKeyVaultService(vaultKeyRepo repository.VaultKeyRepository, keyUsageRepo repository.KeyUsageRepository, userRepo repository.UserRepository, keys *keyring.Keyring, keyStore hsm.KeyStore, db *gorm.DB) KeyVaultService {
+	return &keyVaultService{
+		vaultKeyRepo: vaultKeyRepo,
+		keyUsageRepo: keyUsageRepo,
+		userRepo:     userRepo,
+		keys:         keys,
+		keyStore:     keyStore,
+		db:           db,
+	}
+}
+
+const (
+	MIN_KEY_PIN_LENGTH = 6
+	// số lần nhập sai PIN trong KEY_PIN_LOCKOUT trước khi khóa bị tạm khóa
+	MAX_KEY_PIN_FAILURES = 5
+	KEY_PIN_LOCKOUT      = 15 * time.Minute
+)
+
+// CreateKey generates a signing key of keyType for userID: in the PKCS#11
+// token when backend is config.KEY_BACKEND_PKCS11, otherwise in process,
+// sealed with SealKey. The caller stores the result once a certificate is
+// issued for the public key, or gives it to DestroyKey.
+func (s *keyVaultService) CreateKey(userID string, keyType string, backend string, pin string) (entity.VaultKey, crypto.PublicKey, error) {
+	if backend != config.KEY_BACKEND_PKCS11 {
+		key, err := pki.GenerateKey(keyType)
+		if err != nil {
+			return entity.VaultKey{}, nil, err
+		}
+		defer wipeKey(key)
+		vaultKey, err := s.SealKey(userID, key, pin)
+		if err != nil {
+			return entity.VaultKey{}, nil, err
+		}
+		return vaultKey, key.Public(), nil
+	}
+
+	if s.keyStore == nil {
+		return entity.VaultKey{}, nil, dto.ErrKeyBackendUnavailable
+	}
+	if pin != "" {
+		return entity.VaultKey{}, nil, dto.ErrKeyPINNotSupported
+	}
+	// khóa nằm trong token dưới id của bản ghi, vault không giữ gì của khóa
+	vaultKey := entity.VaultKey{
+		ID:           uuid.NewString(),
+		UserID:       userID,
+		Protection:   constants.ENUM_KEY_PROTECTION_PKCS11,
+		EncryptedKey: []byte{},
+	}
+	key, err := s.keyStore.GenerateKey(vaultKey.ID, keyType)
+	if err != nil {
+		return entity.VaultKey{}, nil, err
+	}
+	return vaultKey, key.Public(), nil
+}
+
+// DestroyKey deletes from the PKCS#11 token a key that is no longer used,
+// after its record was replaced or never stored. Other keys disappear with
+// their record.
+func (s *keyVaultService) DestroyKey(vaultKey entity.VaultKey) error {
+	if vaultKey.Protection != constants.ENUM_KEY_PROTECTION_PKCS11 {
+		return nil
+	}
+	if s.keyStore == nil {
+		return dto.ErrKeyBackendUnavailable
+	}
+	if err := s.keyStore.DeleteKey(vaultKey.ID); err != nil && !errors.Is(err, hsm.ErrKeyNotFound) {
+		return err
+	}
+	return nil
+}
+
+// SealKey encrypts key for userID: under pin when one is given, otherwise
+// under the current master key. The caller stores the result.
+func (s *keyVaultService) SealKey(userID string, key crypto.Signer, pin string) (entity.VaultKey, error) {
+	vaultKey := entity.VaultKey{ID: uuid.NewString(), UserID: userID}
+
+	if pin != "" {
+		if len(pin) < MIN_KEY_PIN_LENGTH {
+			return entity.VaultKey{}, dto.ErrKeyPINTooShort
+		}
+		sealed, err := ca.EncryptKeyPEM(key, []byte(pin))
+		if err != nil {
+			return entity.VaultKey{}, err
+		}
+		vaultKey.Protection = constants.ENUM_KEY_PROTECTION_PIN
+		vaultKey.EncryptedKey = sealed
+		return vaultKey, nil
+	}
+
+	if s.keys == nil {
+		return entity.VaultKey{}, dto.ErrKeyProtectionRequired
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return entity.VaultKey{}, err
+	}
+	defer clear(der)
+	// khóa bọc gắn với id, không chuyển sang bản ghi khác được
+	wrapped, masterKeyID, err := s.keys.Wrap(der, []byte(vaultKey.ID))
+	if err != nil {
+		return entity.VaultKey{}, err
+	}
+	vaultKey.Protection = constants.ENUM_KEY_PROTECTION_MASTER
+	vaultKey.EncryptedKey = wrapped
+	vaultKey.MasterKeyID = masterKeyID
+	return vaultKey, nil
+}
+
+// UnlockKey decrypts the signing key of user for one operation, described by
+// purpose and reference in the audit log, or finds it in the PKCS#11 token.
+// The returned function must be called once the operation is over: it wipes
+// a decrypted key from memory. Every
+// attempt to open the key is audited, including a wrong PIN, and the key is
+// not returned when the audit entry cannot be written.
+func (s *keyVaultService) UnlockKey(ctx context.Context, user entity.User, pin string, purpose string, reference string) (crypto.Signer, func(), error) {
+	vaultKey, err := s.vaultKeyRepo.FindByUserID(ctx, nil, user.ID.String())
+	if errors.Is(err, gorm.ErrRecordNotFound) && user.PrivPEM != "" {
+		// khóa lưu trước khi có vault: chuyển vào vault ở lần dùng đầu tiên
+		vaultKey, err = s.importLegacyKey(ctx, user, pin)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, dto.ErrNoSigningKey
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if vaultKey.Protection == constants.ENUM_KEY_PROTECTION_PIN && pin == "" {
+		return nil, nil, dto.ErrKeyPINRequired
+	}
+
+	// Đếm số lần sai PIN, mở khóa và ghi nhật ký trong cùng transaction với
+	// dòng vault_keys bị khóa, để các lần mở đồng thời lần lượt thấy lần sai
+	// của nhau và không vượt quá MAX_KEY_PIN_FAILURES
+	var key crypto.Signer
+	var openErr error
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		vaultKey, err = s.vaultKeyRepo.LockByID(ctx, tx, vaultKey.ID)
+		if err != nil {
+			return err
+		}
+		if vaultKey.Protection == constants.ENUM_KEY_PROTECTION_PIN {
+			failures, err := s.keyUsageRepo.CountFailuresSince(ctx, tx, vaultKey.ID, time.Now().Add(-KEY_PIN_LOCKOUT))
+			if err != nil {
+				return err
+			}
+			if failures >= MAX_KEY_PIN_FAILURES {
+				return dto.ErrKeyLocked
+			}
+		}
+
+		key, openErr = s.open(vaultKey, pin)
+		if _, err := s.keyUsageRepo.Create(ctx, tx, entity.KeyUsage{
+			KeyID:     vaultKey.ID,
+			UserID:    vaultKey.UserID,
+			Purpose:   purpose,
+			Reference: reference,
+			Success:   openErr == nil,
+		}); err != nil {
+			return fmt.Errorf("cannot audit key usage: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if key != nil {
+			wipeKey(key)
+		}
+		return nil, nil, err
+	}
+	if openErr != nil {
+		return nil, nil, openErr
+	}
+	return key, func() { wipeKey(key) }, nil
+}
+
+func (s *keyVaultService) open(vaultKey entity.VaultKey, pin string) (crypto.Signer, error) {
+	switch vaultKey.Protection {
+	case constants.ENUM_KEY_PROTECTION_PIN:
+		key, err := ca.DecryptKeyPEM(vaultKey.EncryptedKey, []byte(pin))
+		if errors.Is(err, ca.ErrWrongPassphrase) {
+			return nil, dto.ErrWrongKeyPIN
+		}
+		return key, err
+	case constants.ENUM_KEY_PROTECTION_PKCS11:
+		if s.keyStore == nil {
+			return nil, dto.ErrKeyBackendUnavailable
+		}
+		return s.keyStore.FindKey(vaultKey.ID)
+	}
+
+	if s.keys == nil {
+		return nil, keyring.ErrNoMasterKey
+	}
+	der, err := s.keys.Unwrap(vaultKey.EncryptedKey, vaultKey.MasterKeyID, []byte(vaultKey.ID))
+	if err != nil {
+		return nil, err
+	}
+	defer clear(der)
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("vault key is not a signing key")
+	}
+	return key, nil
+}
+
+// importLegacyKey moves the plaintext key of user into the vault, under pin
+// when one is given, and clears it from the users table.
+func (s *keyVaultService) importLegacyKey(ctx context.Context, user entity.User, pin string) (entity.VaultKey, error) {
+	key, err := pki.ParsePrivateKeyPEM(user.PrivPEM)
+	if err != nil {
+		return entity.VaultKey{}, errors.New("invalid signer private key")
+	}
+	defer wipeKey(key)
+
+	vaultKey, err := s.SealKey(user.ID.String(), key, pin)
+	if err != nil {
+		return entity.VaultKey{}, err
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		vaultKey, err = s.vaultKeyRepo.Create(ctx, tx, vaultKey)
+		if err != nil {
+			return err
+		}
+		return s.userRepo.ClearLegacyKey(ctx, tx, user.ID.String())
+	})
+	if err != nil {
+		return entity.VaultKey{}, err
+	}
+	return vaultKey, nil
+}
+
+// số khóa xử lý mỗi lượt khi chuyển khóa cũ hoặc xoay vòng master key
+const vaultBatchSize = 500
+
+// MigrateLegacyKeys moves every private key still stored in clear in the
+// users table into the vault, under the master key, and returns how many
+// were moved.
+func (s *keyVaultService) MigrateLegacyKeys(ctx context.Context) (int, error) {
+	if s.keys == nil {
+		return 0, keyring.ErrNoMasterKey
+	}
+	migrated := 0
+	for {
+		users, err := s.userRepo.FindWithLegacyKey(ctx, nil, vaultBatchSize)
+		if err != nil {
+			return migrated, err
+		}
+		if len(users) == 0 {
+			return migrated, nil
+		}
+		for _, user := range users {
+			_, err := s.vaultKeyRepo.FindByUserID(ctx, nil, user.ID.String())
+			if err == nil {
+				// vault đã có khóa mới hơn, khóa cũ chỉ cần xóa
+				if err := s.userRepo.ClearLegacyKey(ctx, nil, user.ID.String()); err != nil {
+					return migrated, err
+				}
+				continue
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return migrated, err
+			}
+			if _, err := s.importLegacyKey(ctx, user, ""); err != nil {
+				return migrated, fmt.Errorf("user %s: %w", user.ID, err)
+			}
+			migrated++
+		}
+	}
+}
+
+// RotateMasterKey wraps again with the current master key the vault keys
+// wrapped by a previous one, and returns how many were. Keys protected by a
+// PIN do not depend on the master key.
+func (s *keyVaultService) RotateMasterKey(ctx context.Context) (int, error) {
+	if s.keys == nil {
+		return 0, keyring.ErrNoMasterKey
+	}
+	rotated := 0
+	for {
+		vaultKeys, err := s.vaultKeyRepo.FindNotWrappedBy(ctx, nil, s.keys.CurrentID(), vaultBatchSize)
+		if err != nil {
+			return rotated, err
+		}
+		if len(vaultKeys) == 0 {
+			return rotated, nil
+		}
+		for _, vaultKey := range vaultKeys {
+			der, err := s.keys.Unwrap(vaultKey.EncryptedKey, vaultKey.MasterKeyID, []byte(vaultKey.ID))
+			if err != nil {
+				return rotated, fmt.Errorf("vault key %s: %w", vaultKey.ID, err)
+			}
+			vaultKey.EncryptedKey, vaultKey.MasterKeyID, err = s.keys.Wrap(der, []byte(vaultKey.ID))
+			clear(der)
+			if err != nil {
+				return rotated, err
+			}
+			if err := s.vaultKeyRepo.Rewrap(ctx, nil, vaultKey); err != nil {
+				return rotated, err
+			}
+			rotated++
+		}
+	}
+}
+
+// wipeKey overwrites the private values of an unlocked key. The runtime may
+// hold copies elsewhere, so this only shortens the time the key stays in
+// memory.
+func wipeKey(key crypto.Signer) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		wipeInt(k.D)
+		for _, prime := range k.Primes {
+			wipeInt(prime)
+		}
+		wipeInt(k.Precomputed.Dp)
+		wipeInt(k.Precomputed.Dq)
+		wipeInt(k.Precomputed.Qinv)
+	case *ecdsa.PrivateKey:
+		wipeInt(k.D)
+	case ed25519.PrivateKey:
+		clear(k)
+	}
+}
+
+func wipeInt(n *big.Int) {
+	if n != nil {
+		clear(n.Bits())
+		n.SetInt64(0)
+	}
+}
@@ -1,101 +1,301 @@
 package service
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"io"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/PhanPhuc2609/be-sign-file/cms"
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
 	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/jws"
+	"github.com/PhanPhuc2609/be-sign-file/pdf"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
 	"github.com/PhanPhuc2609/be-sign-file/repository"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
+	"github.com/PhanPhuc2609/be-sign-file/tsa"
+	"github.com/PhanPhuc2609/be-sign-file/xmldsig"
 	"gorm.io/gorm"
 )
 
 type SignatureService interface {
-	CreateSignature(ctx context.Context, sig entity.Signature) (entity.Signature, error)
+	CreateSignature(ctx context.Context, sig entity.Signature, pin string) (entity.Signature, error)
+	SignRequest(ctx context.Context, requestID uint, sig entity.Signature, pin string) (entity.Signature, error)
 	GetSignatureByID(ctx context.Context, id uint) (entity.Signature, error)
 	GetSignaturesByDocumentID(ctx context.Context, docID uint) ([]entity.Signature, error)
 	UpdateSignature(ctx context.Context, sig entity.Signature) (entity.Signature, error)
 	DeleteSignature(ctx context.Context, id uint) error
-	SignString(ctx context.Context, signerID string, raw string) (string, string, error) // signature, publicKey, error
+	GetSignatureCMS(ctx context.Context, userID string, id uint) ([]byte, string, error)                                       // DER .p7s, document file name, error
+	SignString(ctx context.Context, signerID string, raw string, algorithm string, pin string) (string, string, string, error) // signature, publicKey, algorithm, error
+	SignJWS(ctx context.Context, signerID string, payload []byte, algorithm string, pin string) (dto.SignJWSResponse, error)
+	VerifyJWS(ctx context.Context, token []byte) (dto.VerifyJWSResponse, error)
+	CounterSign(ctx context.Context, parentID uint, signerID string, algorithm string, pin string) (entity.Signature, error)
+	VerifySignatureTree(ctx context.Context, userID string, id uint) (dto.SignatureTreeNode, error)
 }
 
 type signatureService struct {
-	sigRepo  repository.SignatureRepository
-	docRepo  repository.DocumentRepository
-	userRepo repository.UserRepository
-	db       *gorm.DB
+	sigRepo    repository.SignatureRepository
+	docRepo    repository.DocumentRepository
+	userRepo   repository.UserRepository
+	certRepo   repository.CertificateRepository
+	sigReqRepo repository.SigningRequestRepository
+	caService  CAService
+	keys       KeyProvider
+	store      storage.Storage
+	db         *gorm.DB
 }
 
-func NewSignatureService(sigRepo repository.SignatureRepository, docRepo repository.DocumentRepository, userRepo repository.UserRepository, db *gorm.DB) SignatureService {
+func NewSignatureService(sigRepo repository.SignatureRepository, docRepo repository.DocumentRepository, userRepo repository.UserRepository, certRepo repository.CertificateRepository, sigReqRepo repository.SigningRequestRepository, caService CAService, keys KeyProvider, store storage.Storage, db *gorm.DB) SignatureService {
 	return &signatureService{
-		sigRepo:  sigRepo,
-		docRepo:  docRepo,
-		userRepo: userRepo,
-		db:       db,
+		sigRepo:    sigRepo,
+		docRepo:    docRepo,
+		userRepo:   userRepo,
+		certRepo:   certRepo,
+		sigReqRepo: sigReqRepo,
+		caService:  caService,
+		keys:       keys,
+		store:      store,
+		db:         db,
 	}
 }
 
-func (s *signatureService) CreateSignature(ctx context.Context, sig entity.Signature) (entity.Signature, error) {
+func (s *signatureService) CreateSignature(ctx context.Context, sig entity.Signature, pin string) (entity.Signature, error) {
+	return s.createSignature(ctx, nil, sig, pin)
+}
+
+// SignRequest signs the document of a signing request as one of its signers.
+// The request is checked again once locked, so a Decline or Cancel committed
+// meanwhile is not overwritten.
+func (s *signatureService) SignRequest(ctx context.Context, requestID uint, sig entity.Signature, pin string) (entity.Signature, error) {
+	return s.createSignature(ctx, &requestID, sig, pin)
+}
+
+func (s *signatureService) createSignature(ctx context.Context, requestID *uint, sig entity.Signature, pin string) (entity.Signature, error) {
 	// Ensure document exists
 	doc, err := s.docRepo.FindByID(ctx, nil, sig.DocumentID)
 	if err != nil {
 		return entity.Signature{}, errors.New("document not found")
 	}
 	// Ensure signer exists
-	_, err = s.userRepo.GetUserById(ctx, nil, sig.SignerID)
+	signer, err := s.userRepo.GetUserById(ctx, nil, sig.SignerID)
 	if err != nil {
 		return entity.Signature{}, errors.New("signer not found")
 	}
 
-	// Mô phỏng sinh private key RSA (trong thực tế nên lưu key ở nơi an toàn)
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	// Mỗi người ký lên file đã ký của người trước: dòng tài liệu bị khóa
+	// suốt lần ký để các replica ký lần lượt. Yêu cầu ký bị khóa trước tài
+	// liệu, cùng thứ tự với Decline và Cancel
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		request, err := s.lockSigningRequest(ctx, tx, doc.ID, requestID)
+		if err != nil {
+			return err
+		}
+		// Tài liệu có yêu cầu ký đang chạy: chỉ người ký đến lượt mới được ký
+		if request != nil {
+			if err := checkSigningTask(*request, sig.SignerID); err != nil {
+				return err
+			}
+		}
+		if _, err := s.docRepo.LockByID(ctx, tx, doc.ID); err != nil {
+			return err
+		}
+		sig, err = s.signDocument(ctx, tx, doc, signer, request, sig, pin)
+		return err
+	})
+	if err != nil {
+		return entity.Signature{}, err
+	}
+	return sig, nil
+}
+
+// lockSigningRequest locks in tx the signing request a signature is made
+// for: requestID, else the active request of the document. It returns nil
+// when the document has no active request.
+func (s *signatureService) lockSigningRequest(ctx context.Context, tx *gorm.DB, docID uint, requestID *uint) (*entity.SigningRequest, error) {
+	if requestID == nil {
+		active, err := s.sigReqRepo.FindActiveByDocumentID(ctx, tx, docID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		requestID = &active.ID
+	}
+	request, err := s.sigReqRepo.FindByID(ctx, tx, *requestID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && request.DocumentID != docID) {
+		return nil, dto.ErrSigningRequestNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// signDocument signs doc for signer in the transaction tx, which holds the
+// document and request, nil when there is none, locked: the signature
+// record, the CMS and the signed file.
+func (s *signatureService) signDocument(ctx context.Context, tx *gorm.DB, doc entity.Document, signer entity.User, request *entity.SigningRequest, sig entity.Signature, pin string) (entity.Signature, error) {
+	// Ký bằng khóa và chứng chỉ đã cấp cho người ký, khóa chỉ mở trong lần ký này
+	cert, privateKey, release, err := s.loadSigningCredentials(ctx, signer, pin, constants.ENUM_KEY_USAGE_SIGN_DOCUMENT, fmt.Sprintf("document:%d", doc.ID))
 	if err != nil {
-		return entity.Signature{}, errors.New("failed to generate private key")
+		return entity.Signature{}, err
 	}
+	defer release()
 
-	// Digest của tài liệu (đã lưu trong doc.Digest)
-	digestBytes := []byte(doc.Digest)
-	hashed := sha256.Sum256(digestBytes)
+	// Thuật toán theo yêu cầu, mặc định theo loại khóa của chứng chỉ
+	alg, err := pki.ResolveAlgorithm(sig.Algorithm, cert.PublicKey)
+	if err != nil {
+		return entity.Signature{}, err
+	}
 
-	// Ký digest
-	signatureBytes, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+	// Ký digest của tài liệu (đã lưu trong doc.Digest)
+	signatureBytes, err := alg.Sign(privateKey, []byte(doc.Digest))
 	if err != nil {
 		return entity.Signature{}, errors.New("failed to sign digest")
 	}
 	sig.SignatureRaw = base64.StdEncoding.EncodeToString(signatureBytes)
-	sig.Algorithm = "RSA"
+	sig.Algorithm = alg.Name
+	sig.SaltLength = alg.SaltLength
 	sig.SignedAt = time.Now().Unix()
+	sig.CertSerial = pki.SerialHex(cert)
+	sig.CertFingerprint = pki.Fingerprint(cert)
 
-	// Lưu private key dưới dạng base64 (chỉ dùng cho mô phỏng/demo, KHÔNG dùng cho production)
-	privBytes := x509.MarshalPKCS1PrivateKey(privateKey)
-	sig.PrivateKey = base64.StdEncoding.EncodeToString(privBytes)
+	// Dấu thời gian RFC 3161 trên giá trị chữ ký, làm bằng chứng thời điểm ký
+	sig.TimestampToken, sig.TimestampedAt, err = s.timestampSignature(ctx, signatureBytes)
+	if err != nil {
+		return entity.Signature{}, err
+	}
 
-	// Đính chữ ký vào file (tạo file mới .signed)
-	signedFilePath := doc.FilePath + ".signed"
-	originalContent, err := os.ReadFile(doc.FilePath)
+	// Chữ ký CMS tách rời (.p7s) trên nội dung file, kiểm tra được bằng openssl
+	sig.CMS, err = s.signDetachedCMS(ctx, doc.FilePath, cert, privateKey, alg, time.Unix(sig.SignedAt, 0))
+	if err != nil {
+		return entity.Signature{}, err
+	}
+
+	// Đính chữ ký vào file (tạo file mới .signed), đọc file gốc theo từng đoạn
+	signedFilePath := signedKey(doc)
+	original, err := s.store.Get(ctx, doc.FilePath)
 	if err != nil {
 		return entity.Signature{}, errors.New("cannot read original file to append signature")
 	}
+	defer original.Close()
+	info := original.Info()
+	head := make([]byte, 512)
+	n, _ := original.ReadAt(head, 0)
+	head = head[:n]
+	// PDF: thêm một revision PAdES, không làm hỏng cấu trúc file
+	if pdf.IsPDF(head) {
+		signedDigest, err := s.signPDF(ctx, original, info.Size, signedFilePath, signer, cert, privateKey, alg, time.Unix(sig.SignedAt, 0))
+		if err != nil {
+			return entity.Signature{}, err
+		}
+		return s.saveSignature(ctx, tx, request, sig, signedDigest)
+	}
+	// XML: chèn chữ ký XML-DSig enveloped, file vẫn là XML hợp lệ
+	if looksLikeXML(head) {
+		content, err := io.ReadAll(io.NewSectionReader(original, 0, info.Size))
+		if err != nil {
+			return entity.Signature{}, errors.New("cannot read original file to append signature")
+		}
+		if xmldsig.IsXML(content) {
+			signedDigest, err := s.signXML(ctx, content, signedFilePath, cert, privateKey, alg)
+			if err != nil {
+				return entity.Signature{}, err
+			}
+			return s.saveSignature(ctx, tx, request, sig, signedDigest)
+		}
+	}
+	// File ký = file gốc + marker của từng chữ ký đã có theo thứ tự ký + marker
+	// mới, dựng lại từ các bản ghi trong transaction đang khóa tài liệu
+	previous, err := s.sigRepo.FindByDocumentID(ctx, tx, doc.ID)
+	if err != nil {
+		return entity.Signature{}, err
+	}
+	sort.Slice(previous, func(i, j int) bool { return previous[i].ID < previous[j].ID })
+	var markers strings.Builder
+	for _, other := range previous {
+		if other.ParentID == nil {
+			markers.WriteString(signatureMarker(other.SignatureRaw))
+		}
+	}
+	markers.WriteString(signatureMarker(sig.SignatureRaw))
 	// Thêm marker đúng chuẩn, không thêm thừa dòng trống
-	var signedContent []byte
-	if len(originalContent) > 0 && originalContent[len(originalContent)-1] == '\n' {
-		signedContent = append(originalContent, []byte(fmt.Sprintf("---BEGIN SIGNATURE---\n%s\n---END SIGNATURE---\n", sig.SignatureRaw))...)
-	} else {
-		signedContent = append(originalContent, []byte(fmt.Sprintf("\n---BEGIN SIGNATURE---\n%s\n---END SIGNATURE---\n", sig.SignatureRaw))...)
+	trailer := markers.String()
+	last := make([]byte, 1)
+	if info.Size > 0 {
+		if _, err := original.ReadAt(last, info.Size-1); err != nil {
+			return entity.Signature{}, errors.New("cannot read original file to append signature")
+		}
+		if last[0] != '\n' {
+			trailer = "\n" + trailer
+		}
+	}
+	signedDigest, err := writeSignedStream(ctx, s.store, signedFilePath, func(w io.Writer) error {
+		if _, err := io.Copy(w, io.NewSectionReader(original, 0, info.Size)); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, trailer)
+		return err
+	})
+	if err != nil {
+		return entity.Signature{}, err
+	}
+
+	return s.saveSignature(ctx, tx, request, sig, signedDigest)
+}
+
+// signatureMarker is the text trailer of one signature in a signed file.
+func signatureMarker(sigBase64 string) string {
+	return fmt.Sprintf("%s\n%s\n%s\n", SIGNATURE_BEGIN, sigBase64, SIGNATURE_END)
+}
+
+// saveSignature stores a signature and moves the document forward: the
+// signing request, locked and checked by the caller, records the signer's
+// task as done, a document without one is simply marked signed.
+// signedDigest is the digest of the signed file just written, served as its
+// ETag. It runs in the transaction of the signing.
+func (s *signatureService) saveSignature(ctx context.Context, tx *gorm.DB, request *entity.SigningRequest, sig entity.Signature, signedDigest string) (entity.Signature, error) {
+	sig, err := s.sigRepo.Create(ctx, tx, sig)
+	if err != nil {
+		return entity.Signature{}, err
+	}
+
+	doc, err := s.docRepo.FindByID(ctx, tx, sig.DocumentID)
+	if err != nil {
+		return entity.Signature{}, err
 	}
-	if err := os.WriteFile(signedFilePath, signedContent, 0644); err != nil {
-		return entity.Signature{}, errors.New("cannot write signed file")
+	doc.SignedDigest = signedDigest
+
+	if request == nil {
+		if doc.Status == "" || doc.Status == constants.ENUM_DOCUMENT_STATUS_UPLOADED {
+			doc.Status = constants.ENUM_DOCUMENT_STATUS_SIGNED
+		}
+		if _, err := s.docRepo.Update(ctx, tx, doc); err != nil {
+			return entity.Signature{}, err
+		}
+		return sig, nil
+	}
+	if _, err := s.docRepo.Update(ctx, tx, doc); err != nil {
+		return entity.Signature{}, err
 	}
 
-	return s.sigRepo.Create(ctx, nil, sig)
+	request.RecordSignature(sig.SignerID, sig.ID, time.Unix(sig.SignedAt, 0))
+	if err := saveSigningRequest(ctx, tx, s.sigReqRepo, s.docRepo, *request); err != nil {
+		return entity.Signature{}, err
+	}
+	return sig, nil
 }
 
 func (s *signatureService) GetSignatureByID(ctx context.Context, id uint) (entity.Signature, error) {
@@ -118,54 +318,822 @@ func (s *signatureService) DeleteSignature(ctx context.Context, id uint) error {
 	return s.sigRepo.Delete(ctx, nil, id)
 }
 func (s *signatureService) VerifySignature(ctx context.Context, sig entity.Signature, doc entity.Document) (bool, error) {
-	// Giải mã private key (ở demo bạn lưu private key, thực tế sẽ dùng public key)
-	privBytes, err := base64.StdEncoding.DecodeString(sig.PrivateKey)
+	if isLegacySignature(sig) {
+		if err := verifyLegacySignature(sig, sig.SignatureRaw, doc.Digest); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	signer, err := s.userRepo.GetUserById(ctx, nil, sig.SignerID)
+	if err != nil {
+		return false, errors.New("signer not found")
+	}
+	cert, record, err := signerCertificate(ctx, s.certRepo, signer, sig)
 	if err != nil {
-		return false, errors.New("invalid private key encoding")
+		return false, err
 	}
-	privateKey, err := x509.ParsePKCS1PrivateKey(privBytes)
+	signedAt, err := signatureTime(ctx, s.caService, sig, sig.SignatureRaw)
 	if err != nil {
-		return false, errors.New("invalid private key")
+		return false, err
+	}
+	if err := checkRevocation(record, signedAt); err != nil {
+		return false, err
 	}
-	publicKey := &privateKey.PublicKey
+	if err := verifyDigestSignature(cert.PublicKey, sig.Algorithm, sig.SaltLength, sig.SignatureRaw, doc.Digest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	// Lấy digest gốc của tài liệu
-	digestBytes := []byte(doc.Digest)
-	hashed := sha256.Sum256(digestBytes)
+func (s *signatureService) GetSignatureCMS(ctx context.Context, userID string, id uint) ([]byte, string, error) {
+	sig, err := s.findAccessibleSignature(ctx, userID, id)
+	if err != nil {
+		return nil, "", err
+	}
+	// chữ ký đối chứng nằm trong file .p7s của chữ ký gốc
+	for sig.ParentID != nil {
+		if sig, err = s.sigRepo.FindByID(ctx, nil, *sig.ParentID); err != nil {
+			return nil, "", dto.ErrSignatureNotFound
+		}
+	}
+	if len(sig.CMS) == 0 {
+		return nil, "", errors.New("signature has no CMS output")
+	}
+	return sig.CMS, sig.Document.FileName, nil
+}
 
-	// Giải mã chữ ký
-	signatureBytes, err := base64.StdEncoding.DecodeString(sig.SignatureRaw)
+// signDetachedCMS builds the .p7s for a file: signed attributes with content
+// type, message digest and signing time, plus the signer certificate and the
+// platform CA chain.
+func (s *signatureService) signDetachedCMS(ctx context.Context, path string, cert *x509.Certificate, key crypto.Signer, alg pki.Algorithm, signedAt time.Time) ([]byte, error) {
+	file, err := s.store.Get(ctx, path)
 	if err != nil {
-		return false, errors.New("invalid signature encoding")
+		return nil, errors.New("cannot read original file to sign")
 	}
+	defer file.Close()
 
-	// Xác minh chữ ký
-	err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signatureBytes)
+	// certificates issued before the platform CA existed have no chain
+	chain, err := s.caService.Chain(ctx)
 	if err != nil {
-		return false, errors.New("signature verification failed")
+		chain = nil
 	}
-	return true, nil
+
+	sd, err := cms.SignDetached(file, cms.SignerConfig{
+		Signer:      key,
+		Certificate: cert,
+		Chain:       chain,
+		Algorithm:   alg,
+		SigningTime: signedAt,
+	})
+	if err != nil {
+		return nil, errors.New("failed to create CMS signature")
+	}
+
+	// CAdES-T: signatureTimeStampToken over the SignerInfo signature value
+	si := sd.SignerInfos[0]
+	token, _, err := s.timestampSignature(ctx, si.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if err := si.AddUnsignedAttribute(cms.OIDAttributeTimeStampToken, token); err != nil {
+		return nil, err
+	}
+	return sd.Marshal()
+}
+
+// signPDF appends a PAdES signature revision to the signed copy of a PDF.
+// Each signer signs on top of the previous signer's revision, so the
+// earlier signatures stay valid. The PDF is streamed, never held in memory.
+func (s *signatureService) signPDF(ctx context.Context, original io.ReaderAt, size int64, signedPath string, signer entity.User, cert *x509.Certificate, key crypto.Signer, alg pki.Algorithm, signedAt time.Time) (string, error) {
+	base := original
+	if previous, err := s.store.Get(ctx, signedPath); err == nil {
+		defer previous.Close()
+		head := make([]byte, 5)
+		if _, err := previous.ReadAt(head, 0); err == nil && pdf.IsPDF(head) {
+			base, size = previous, previous.Info().Size
+		}
+	}
+
+	chain, err := s.caService.Chain(ctx)
+	if err != nil {
+		chain = nil
+	}
+
+	digest, err := writeSignedStream(ctx, s.store, signedPath, func(w io.Writer) error {
+		return pdf.Sign(base, size, w, cms.SignerConfig{
+			Signer:      key,
+			Certificate: cert,
+			Chain:       chain,
+			Algorithm:   alg,
+		}, pdf.SignOptions{
+			Name:        signer.Name,
+			SigningTime: signedAt,
+			Timestamp: func(signature []byte) ([]byte, error) {
+				token, _, err := s.timestampSignature(ctx, signature)
+				return token, err
+			},
+		})
+	})
+	if err != nil && !errors.Is(err, errWriteSignedFile) {
+		return "", fmt.Errorf("failed to sign PDF: %w", err)
+	}
+	return digest, err
+}
+
+// signXML adds an enveloped XML-DSig signature to the signed copy of an XML
+// document, on top of the signatures of earlier signers.
+func (s *signatureService) signXML(ctx context.Context, original []byte, signedPath string, cert *x509.Certificate, key crypto.Signer, alg pki.Algorithm) (string, error) {
+	base := original
+	if previous, err := s.readStored(ctx, signedPath); err == nil && xmldsig.IsXML(previous) {
+		base = previous
+	}
+
+	chain, err := s.caService.Chain(ctx)
+	if err != nil {
+		chain = nil
+	}
+
+	out, err := xmldsig.Sign(base, xmldsig.SignerConfig{
+		Signer:      key,
+		Certificate: cert,
+		Chain:       chain,
+		Algorithm:   alg,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign XML: %w", err)
+	}
+	return writeSignedFile(ctx, s.store, signedPath, out)
+}
+
+// timestampSignature obtains a token from the platform TSA over a signature
+// value and returns it with its time.
+func (s *signatureService) timestampSignature(ctx context.Context, signature []byte) ([]byte, int64, error) {
+	der, err := s.caService.TimestampToken(ctx, signature)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot obtain timestamp: %w", err)
+	}
+	token, err := tsa.ParseToken(der)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot obtain timestamp: %w", err)
+	}
+	return der, token.Info.GenTime.Unix(), nil
+}
+
+// verifyTimestamp checks a stored signature timestamp and returns the time it
+// proves the signature existed at.
+func verifyTimestamp(ctx context.Context, caService CAService, der []byte, signature []byte) (int64, error) {
+	token, err := tsa.ParseToken(der)
+	if err != nil {
+		return 0, fmt.Errorf("invalid signature timestamp: %w", err)
+	}
+	trust, err := caService.TrustStore(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := token.Verify(signature, trust); err != nil {
+		return 0, fmt.Errorf("invalid signature timestamp: %w", err)
+	}
+	return token.Info.GenTime.Unix(), nil
+}
+
+// signatureTime is the time a signature is judged at: the time-stamped time
+// when the signature has a token, else the server clock at signing, as for
+// signatures made before timestamping existed.
+func signatureTime(ctx context.Context, caService CAService, sig entity.Signature, sigBase64 string) (int64, error) {
+	if len(sig.TimestampToken) == 0 {
+		return sig.SignedAt, nil
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(sigBase64)
+	if err != nil {
+		return 0, errors.New("invalid signature encoding")
+	}
+	return verifyTimestamp(ctx, caService, sig.TimestampToken, signatureBytes)
+}
+
+var errWriteSignedFile = errors.New("cannot write signed file")
+
+// writeSignedFile lưu file ký trọn vẹn, không để lại file ký dở, và trả về
+// SHA-256 hex của nội dung đã lưu
+func writeSignedFile(ctx context.Context, store storage.Storage, key string, data []byte) (string, error) {
+	return writeSignedStream(ctx, store, key, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeSignedStream is writeSignedFile for output produced by write, which
+// is piped into the storage as it is produced. An error from write itself is
+// returned as is.
+func writeSignedStream(ctx context.Context, store storage.Storage, key string, write func(io.Writer) error) (string, error) {
+	hash := sha256.New()
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		out := bufio.NewWriter(io.MultiWriter(pw, hash))
+		err := write(out)
+		if err == nil {
+			err = out.Flush()
+		}
+		// lỗi của write làm Put thất bại, không lưu file dở
+		pw.CloseWithError(err)
+		written <- err
+	}()
+	putErr := store.Put(ctx, key, pr)
+	// Put dừng đọc giữa chừng: write nhận lỗi thay vì bị chặn mãi
+	pr.CloseWithError(errWriteSignedFile)
+	if err := <-written; err != nil {
+		if errors.Is(err, errWriteSignedFile) {
+			return "", errWriteSignedFile
+		}
+		return "", err
+	}
+	if putErr != nil {
+		return "", errWriteSignedFile
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readStored reads a whole stored file, for formats that need it in memory.
+func (s *signatureService) readStored(ctx context.Context, key string) ([]byte, error) {
+	file, err := s.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// loadSigningCredentials returns the signer's enrolled certificate together
+// with the matching private key, unlocked from the vault for the operation
+// described by purpose and reference. release wipes the key and must be
+// called once the operation is over.
+func (s *signatureService) loadSigningCredentials(ctx context.Context, signer entity.User, pin string, purpose string, reference string) (*x509.Certificate, crypto.Signer, func(), error) {
+	if signer.CertPEM == "" {
+		return nil, nil, nil, errors.New("signer has no enrolled certificate")
+	}
+	cert, err := pki.ParseCertificatePEM(signer.CertPEM)
+	if err != nil {
+		return nil, nil, nil, errors.New("invalid signer certificate")
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, nil, nil, errors.New("signer certificate is not valid at this time")
+	}
+	if record, err := s.certRepo.FindByFingerprint(ctx, nil, pki.Fingerprint(cert)); err == nil && record.IsRevoked() {
+		return nil, nil, nil, errors.New("signer certificate has been revoked")
+	}
+	privateKey, release, err := s.keys.UnlockKey(ctx, signer, pin, purpose, reference)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := pki.MatchesCertificate(privateKey, cert); err != nil {
+		release()
+		return nil, nil, nil, err
+	}
+	return cert, privateKey, release, nil
+}
+
+// isLegacySignature reports whether sig was made with a one-off key before
+// signers had certificates. Those rows carry the public key instead of a
+// certificate fingerprint.
+func isLegacySignature(sig entity.Signature) bool {
+	return sig.CertFingerprint == "" && sig.PublicKey != ""
+}
+
+// verifyLegacySignature checks a legacy signature over message against the
+// public key stored on the row, with the algorithm it was recorded with.
+func verifyLegacySignature(sig entity.Signature, sigBase64 string, message string) error {
+	pub, err := pki.ParsePublicKeyPEM(sig.PublicKey)
+	if err != nil {
+		return errors.New("invalid signer public key")
+	}
+	return verifyDigestSignature(pub, sig.Algorithm, sig.SaltLength, sigBase64, message)
+}
+
+// signerCertificate resolves the certificate a signature was made with. The
+// CA record is nil for certificates enrolled before the platform CA existed.
+func signerCertificate(ctx context.Context, certRepo repository.CertificateRepository, signer entity.User, sig entity.Signature) (*x509.Certificate, *entity.Certificate, error) {
+	record, err := certRepo.FindByFingerprint(ctx, nil, sig.CertFingerprint)
+	if err == nil {
+		if record.UserID != "" && record.UserID != sig.SignerID {
+			return nil, nil, errors.New("signer certificate belongs to another user")
+		}
+		cert, err := pki.ParseCertificatePEM(record.CertPEM)
+		if err != nil {
+			return nil, nil, errors.New("signer certificate not found")
+		}
+		return cert, &record, nil
+	}
+
+	cert, err := pki.ParseCertificatePEM(signer.CertPEM)
+	if err != nil || pki.Fingerprint(cert) != sig.CertFingerprint {
+		return nil, nil, errors.New("signer certificate not found")
+	}
+	return cert, nil, nil
+}
+
+// checkRevocation rejects signatures made at or after the moment the signer
+// certificate was revoked. Earlier signatures stay valid.
+func checkRevocation(record *entity.Certificate, signedAt int64) error {
+	if record == nil || !record.IsRevoked() {
+		return nil
+	}
+	if signedAt >= record.RevokedAt.Unix() {
+		return errors.New("signer certificate was revoked before the signature was made")
+	}
+	return nil
+}
+
+// verifyDigestSignature checks a base64 signature over the hex digest of a
+// document against the certificate's public key, using the algorithm (and PSS
+// salt length) the signature was recorded with.
+func verifyDigestSignature(pub crypto.PublicKey, algorithm string, saltLength int, sigBase64 string, digestHex string) error {
+	alg, err := pki.LookupAlgorithm(algorithm)
+	if err != nil {
+		return err
+	}
+	alg = alg.WithSaltLength(saltLength)
+
+	signatureBytes, err := base64.StdEncoding.DecodeString(sigBase64)
+	if err != nil {
+		return errors.New("invalid signature encoding")
+	}
+
+	if err := alg.Verify(pub, []byte(digestHex), signatureBytes); err != nil {
+		return errors.New("signature verification failed")
+	}
+	return nil
 }
 
-func (s *signatureService) SignString(ctx context.Context, signerID string, raw string) (string, string, error) {
-	// Sinh private key RSA (demo, không lưu DB)
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+// SignString ký chuỗi bằng khóa đã cấp của người ký (không còn sinh khóa tạm)
+func (s *signatureService) SignString(ctx context.Context, signerID string, raw string, algorithm string, pin string) (string, string, string, error) {
+	signer, err := s.userRepo.GetUserById(ctx, nil, signerID)
 	if err != nil {
-		return "", "", errors.New("failed to generate private key")
+		return "", "", "", errors.New("signer not found")
 	}
-	// Hash chuỗi
-	hash := sha256.Sum256([]byte(raw))
-	// Ký
-	signatureBytes, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hash[:])
+	cert, privateKey, release, err := s.loadSigningCredentials(ctx, signer, pin, constants.ENUM_KEY_USAGE_SIGN_STRING, "")
 	if err != nil {
-		return "", "", errors.New("failed to sign string")
+		return "", "", "", err
+	}
+	defer release()
+	// khóa RSA mặc định ký RSASSA-PSS; PKCS#1 v1.5 chỉ khi client yêu cầu RSA-SHA256
+	alg, err := pki.ResolveAlgorithm(algorithm, cert.PublicKey)
+	if err != nil {
+		return "", "", "", err
+	}
+	signatureBytes, err := alg.Sign(privateKey, []byte(raw))
+	if err != nil {
+		return "", "", "", errors.New("failed to sign string")
 	}
 	signature := base64.StdEncoding.EncodeToString(signatureBytes)
-	// Xuất public key PEM
-	pubASN1, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	// Xuất public key (DER, base64)
+	pubASN1, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return signature, "", alg.Name, nil // vẫn trả signature
+	}
+	return signature, base64.StdEncoding.EncodeToString(pubASN1), alg.Name, nil
+}
+
+// SignJWS ký payload JSON thành JWS (compact và JSON) với header x5c và sigT
+func (s *signatureService) SignJWS(ctx context.Context, signerID string, payload []byte, algorithm string, pin string) (dto.SignJWSResponse, error) {
+	signer, err := s.userRepo.GetUserById(ctx, nil, signerID)
+	if err != nil {
+		return dto.SignJWSResponse{}, errors.New("signer not found")
+	}
+	cert, privateKey, release, err := s.loadSigningCredentials(ctx, signer, pin, constants.ENUM_KEY_USAGE_SIGN_JWS, "")
+	if err != nil {
+		return dto.SignJWSResponse{}, err
+	}
+	defer release()
+	alg, err := pki.ResolveAlgorithm(algorithm, cert.PublicKey)
+	if err != nil {
+		return dto.SignJWSResponse{}, err
+	}
+
+	chain, err := s.caService.Chain(ctx)
+	if err != nil {
+		chain = nil
+	}
+	signedAt := time.Now()
+	sig, err := jws.Sign(payload, jws.SignerConfig{
+		Signer:      privateKey,
+		Certificate: cert,
+		Chain:       chain,
+		Algorithm:   alg,
+		SigningTime: signedAt,
+		Type:        "jose",
+		ContentType: "json",
+	})
+	if err != nil {
+		return dto.SignJWSResponse{}, errors.New("failed to create JWS")
+	}
+	serialized, err := sig.JSON()
+	if err != nil {
+		return dto.SignJWSResponse{}, err
+	}
+	return dto.SignJWSResponse{
+		Compact:     sig.Compact(),
+		JSON:        serialized,
+		Algorithm:   sig.Header.Algorithm,
+		SigningTime: signedAt.Unix(),
+		CertSerial:  pki.SerialHex(cert),
+	}, nil
+}
+
+// VerifyJWS kiểm tra mọi chữ ký của một JWS theo trust store; chứng chỉ do
+// CA của hệ thống cấp còn được kiểm tra thu hồi tại thời điểm sigT.
+func (s *signatureService) VerifyJWS(ctx context.Context, token []byte) (dto.VerifyJWSResponse, error) {
+	trust, err := s.caService.TrustStore(ctx)
+	if err != nil {
+		return dto.VerifyJWSResponse{Message: "Cannot load trust store"}, err
+	}
+	results, err := jws.Verify(token, jws.VerifyOptions{Trust: trust})
+	if err != nil {
+		return dto.VerifyJWSResponse{Message: "Invalid JWS"}, err
+	}
+
+	res := dto.VerifyJWSResponse{Verified: true}
+	for _, r := range results {
+		if r.Valid() && r.Signer != nil {
+			if record, err := s.certRepo.FindBySerial(ctx, nil, pki.SerialHex(r.Signer)); err == nil {
+				signedAt := r.SigningTime
+				if signedAt.IsZero() {
+					signedAt = time.Now()
+				}
+				if err := checkRevocation(&record, signedAt.Unix()); err != nil {
+					r.ChainValid = false
+					r.Err = err
+				}
+			}
+		}
+
+		item := dto.JWSSignatureResult{
+			Algorithm:      r.Header.Algorithm,
+			SignatureValid: r.SignatureValid,
+			ChainValid:     r.ChainValid,
+			Valid:          r.Valid(),
+		}
+		if !r.SigningTime.IsZero() {
+			item.SigningTime = r.SigningTime.Unix()
+		}
+		if r.Signer != nil {
+			item.SignerName = r.Signer.Subject.CommonName
+			item.SignerSubject = r.Signer.Subject.String()
+			item.SignerIssuer = r.Signer.Issuer.String()
+			item.SignerSerial = pki.SerialHex(r.Signer)
+		}
+		if r.Err != nil {
+			item.Error = r.Err.Error()
+		}
+		if res.Payload == nil && r.Payload != nil {
+			res.Payload = payloadJSON(r.Payload)
+		}
+		res.Verified = res.Verified && item.Valid
+		res.Signatures = append(res.Signatures, item)
+	}
+
+	if res.Verified {
+		res.Message = "All signatures are valid"
+	} else {
+		res.Message = "One or more signatures are invalid"
+	}
+	return res, nil
+}
+
+// payloadJSON trả payload nguyên dạng nếu là JSON, ngược lại dạng chuỗi
+func payloadJSON(payload []byte) json.RawMessage {
+	if json.Valid(payload) {
+		return payload
+	}
+	quoted, _ := json.Marshal(string(payload))
+	return quoted
+}
+
+// CounterSign adds a counter-signature by signerID over the value of an
+// existing signature. The new SignerInfo is also attached as a
+// counterSignature attribute inside the document's .p7s.
+func (s *signatureService) CounterSign(ctx context.Context, parentID uint, signerID string, algorithm string, pin string) (entity.Signature, error) {
+	parent, err := s.sigRepo.FindByID(ctx, nil, parentID)
+	if err != nil {
+		return entity.Signature{}, dto.ErrSignatureNotFound
+	}
+	if parent.SignerID == signerID {
+		return entity.Signature{}, dto.ErrCounterSignOwnSignature
+	}
+	signer, err := s.userRepo.GetUserById(ctx, nil, signerID)
+	if err != nil {
+		return entity.Signature{}, errors.New("signer not found")
+	}
+	cert, privateKey, release, err := s.loadSigningCredentials(ctx, signer, pin, constants.ENUM_KEY_USAGE_COUNTERSIGN, fmt.Sprintf("signature:%d", parent.ID))
+	if err != nil {
+		return entity.Signature{}, err
+	}
+	defer release()
+	alg, err := pki.ResolveAlgorithm(algorithm, cert.PublicKey)
+	if err != nil {
+		return entity.Signature{}, err
+	}
+	parentValue, err := base64.StdEncoding.DecodeString(parent.SignatureRaw)
+	if err != nil {
+		return entity.Signature{}, errors.New("invalid signature encoding")
+	}
+
+	// Chữ ký đối chứng ký lên giá trị chữ ký cha, không ký lại tài liệu
+	signatureBytes, err := alg.Sign(privateKey, parentValue)
+	if err != nil {
+		return entity.Signature{}, errors.New("failed to sign parent signature")
+	}
+	counter := entity.Signature{
+		DocumentID:      parent.DocumentID,
+		ParentID:        &parent.ID,
+		SignerID:        signerID,
+		SignatureRaw:    base64.StdEncoding.EncodeToString(signatureBytes),
+		Algorithm:       alg.Name,
+		SaltLength:      alg.SaltLength,
+		SignedAt:        time.Now().Unix(),
+		CertSerial:      pki.SerialHex(cert),
+		CertFingerprint: pki.Fingerprint(cert),
+	}
+	counter.TimestampToken, counter.TimestampedAt, err = s.timestampSignature(ctx, signatureBytes)
+	if err != nil {
+		return entity.Signature{}, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// .p7s của chữ ký gốc được đọc rồi ghi lại: khóa dòng tài liệu như
+		// khi ký để không mất chữ ký đối chứng của replica khác
+		if _, err := s.docRepo.LockByID(ctx, tx, parent.DocumentID); err != nil {
+			return err
+		}
+		// .p7s: thuộc tính counterSignature dưới SignerInfo của chữ ký cha
+		root, rootCMS, err := s.counterSignCMS(ctx, tx, parent, &counter, cert, privateKey, alg)
+		if err != nil {
+			return err
+		}
+
+		created, err := s.sigRepo.Create(ctx, tx, counter)
+		if err != nil {
+			return err
+		}
+		counter = created
+		if rootCMS == nil {
+			return nil
+		}
+		return s.sigRepo.UpdateCMS(ctx, tx, root.ID, rootCMS)
+	})
+	if err != nil {
+		return entity.Signature{}, err
+	}
+	return counter, nil
+}
+
+// counterSignCMS builds the CMS counter-signature of parent, stores it in
+// counter.CMS and returns the top-level signature with its updated .p7s. It
+// returns a nil .p7s when the parent has no CMS output to extend.
+func (s *signatureService) counterSignCMS(ctx context.Context, tx *gorm.DB, parent entity.Signature, counter *entity.Signature, cert *x509.Certificate, key crypto.Signer, alg pki.Algorithm) (entity.Signature, []byte, error) {
+	// đọc lại trong transaction: .p7s có thể vừa được cập nhật
+	root, err := s.sigRepo.FindByID(ctx, tx, parent.ID)
+	if err != nil {
+		return entity.Signature{}, nil, err
+	}
+	for root.ParentID != nil {
+		next, err := s.sigRepo.FindByID(ctx, tx, *root.ParentID)
+		if err != nil {
+			return entity.Signature{}, nil, err
+		}
+		root = next
+	}
+	if len(root.CMS) == 0 || len(parent.CMS) == 0 {
+		return root, nil, nil
+	}
+
+	sd, err := cms.Parse(root.CMS)
+	if err != nil || len(sd.SignerInfos) != 1 {
+		return entity.Signature{}, nil, errors.New("invalid stored CMS signature")
+	}
+	parentSI := sd.SignerInfos[0]
+	if parent.ParentID != nil {
+		if parentSI, err = cms.ParseSignerInfo(parent.CMS); err != nil {
+			return entity.Signature{}, nil, errors.New("invalid stored CMS signature")
+		}
+	}
+
+	chain, err := s.caService.Chain(ctx)
 	if err != nil {
-		return signature, "", nil // vẫn trả signature
+		chain = nil
+	}
+	si, err := cms.SignCounterSignature(parentSI, cms.SignerConfig{
+		Signer:      key,
+		Certificate: cert,
+		Algorithm:   alg,
+		SigningTime: time.Unix(counter.SignedAt, 0),
+	})
+	if err != nil {
+		return entity.Signature{}, nil, errors.New("failed to create CMS counter-signature")
+	}
+	token, _, err := s.timestampSignature(ctx, si.Signature)
+	if err != nil {
+		return entity.Signature{}, nil, err
+	}
+	if err := si.AddUnsignedAttribute(cms.OIDAttributeTimeStampToken, token); err != nil {
+		return entity.Signature{}, nil, err
+	}
+	if counter.CMS, err = si.Marshal(); err != nil {
+		return entity.Signature{}, nil, err
+	}
+
+	found, err := sd.SignerInfos[0].AttachCounterSignature(parentSI.Signature, si)
+	if err != nil {
+		return entity.Signature{}, nil, err
+	}
+	if !found {
+		return entity.Signature{}, nil, errors.New("parent signature not found in stored CMS signature")
+	}
+	for _, c := range append([]*x509.Certificate{cert}, chain...) {
+		if !containsCertificate(sd.Certificates, c) {
+			sd.Certificates = append(sd.Certificates, c)
+		}
+	}
+	der, err := sd.Marshal()
+	if err != nil {
+		return entity.Signature{}, nil, err
+	}
+	return root, der, nil
+}
+
+// findAccessibleSignature loads a signature the user may read: the owner of
+// the document, one of its signers or a participant of its signing request,
+// the same check as the document file. Others get ErrSignatureNotFound.
+func (s *signatureService) findAccessibleSignature(ctx context.Context, userID string, id uint) (entity.Signature, error) {
+	sig, err := s.sigRepo.FindByID(ctx, nil, id)
+	if err != nil {
+		return entity.Signature{}, dto.ErrSignatureNotFound
+	}
+	allowed, err := s.docRepo.CanAccess(ctx, nil, sig.DocumentID, userID)
+	if err != nil {
+		return entity.Signature{}, err
+	}
+	if !allowed {
+		return entity.Signature{}, dto.ErrSignatureNotFound
+	}
+	return sig, nil
+}
+
+// VerifySignatureTree verifies a signature and, recursively, every
+// counter-signature below it, both the database records and the matching
+// SignerInfos of the document's .p7s. Only users who may read the document
+// see the tree.
+func (s *signatureService) VerifySignatureTree(ctx context.Context, userID string, id uint) (dto.SignatureTreeNode, error) {
+	sig, err := s.findAccessibleSignature(ctx, userID, id)
+	if err != nil {
+		return dto.SignatureTreeNode{}, err
+	}
+	all, err := s.sigRepo.FindByDocumentID(ctx, nil, sig.DocumentID)
+	if err != nil {
+		return dto.SignatureTreeNode{}, err
+	}
+	byID := make(map[uint]entity.Signature, len(all))
+	children := make(map[uint][]entity.Signature)
+	for _, other := range all {
+		byID[other.ID] = other
+		if other.ParentID != nil {
+			children[*other.ParentID] = append(children[*other.ParentID], other)
+		}
+	}
+
+	// SignerInfo của chữ ký cần kiểm tra trong file .p7s của chữ ký gốc
+	root := sig
+	for root.ParentID != nil {
+		root = byID[*root.ParentID]
+	}
+	var sd *cms.SignedData
+	var si, parentSI *cms.SignerInfo
+	if parsed, err := cms.Parse(root.CMS); err == nil && len(parsed.SignerInfos) == 1 {
+		sd, si = parsed, parsed.SignerInfos[0]
+		if sig.ID != root.ID {
+			si, parentSI = findCounterSignerInfo(si, sig)
+		}
+	}
+
+	var parentValue []byte
+	if sig.ParentID != nil {
+		parentValue, _ = base64.StdEncoding.DecodeString(byID[*sig.ParentID].SignatureRaw)
+	}
+	return s.verifyTreeNode(ctx, sig, sig.Document, parentValue, children, sd, si, parentSI), nil
+}
+
+// verifyTreeNode verifies sig, a top-level signature over doc when
+// parentValue is nil and a counter-signature over parentValue otherwise.
+// si is its SignerInfo in sd and parentSI that of its parent, both nil when
+// the .p7s does not carry them.
+func (s *signatureService) verifyTreeNode(ctx context.Context, sig entity.Signature, doc entity.Document, parentValue []byte, children map[uint][]entity.Signature, sd *cms.SignedData, si, parentSI *cms.SignerInfo) dto.SignatureTreeNode {
+	node := dto.SignatureTreeNode{
+		ID:            sig.ID,
+		ParentID:      sig.ParentID,
+		SignerID:      sig.SignerID,
+		Algorithm:     sig.Algorithm,
+		SignedAt:      sig.SignedAt,
+		TimestampedAt: sig.TimestampedAt,
+		CertSerial:    sig.CertSerial,
+	}
+	if signer, err := s.userRepo.GetUserById(ctx, nil, sig.SignerID); err == nil {
+		node.SignerName = signer.Name
+	}
+
+	var err error
+	if sig.ParentID == nil {
+		node.Valid, err = s.VerifySignature(ctx, sig, doc)
+	} else {
+		err = s.verifyCounterSignature(ctx, sig, parentValue)
+		node.Valid = err == nil
+	}
+	if err != nil {
+		node.Error = err.Error()
+	}
+
+	if si != nil {
+		cmsValid := s.verifyCMSSignerInfo(ctx, sd, si, parentSI, doc) == nil
+		node.CMSValid = &cmsValid
+	}
+
+	value, _ := base64.StdEncoding.DecodeString(sig.SignatureRaw)
+	for _, child := range children[sig.ID] {
+		var childSI *cms.SignerInfo
+		if si != nil {
+			if found, parent := findCounterSignerInfo(si, child); parent == si {
+				childSI = found
+			}
+		}
+		node.CounterSignatures = append(node.CounterSignatures, s.verifyTreeNode(ctx, child, doc, value, children, sd, childSI, si))
+	}
+	return node
+}
+
+// verifyCounterSignature checks a counter-signature record over the value of
+// its parent signature.
+func (s *signatureService) verifyCounterSignature(ctx context.Context, sig entity.Signature, parentValue []byte) error {
+	signer, err := s.userRepo.GetUserById(ctx, nil, sig.SignerID)
+	if err != nil {
+		return errors.New("signer not found")
+	}
+	cert, record, err := signerCertificate(ctx, s.certRepo, signer, sig)
+	if err != nil {
+		return err
+	}
+	signedAt, err := signatureTime(ctx, s.caService, sig, sig.SignatureRaw)
+	if err != nil {
+		return err
+	}
+	if err := checkRevocation(record, signedAt); err != nil {
+		return err
+	}
+	return verifyDigestSignature(cert.PublicKey, sig.Algorithm, sig.SaltLength, sig.SignatureRaw, string(parentValue))
+}
+
+// verifyCMSSignerInfo checks a top-level SignerInfo against the document
+// file, or a countersignature SignerInfo against its parent.
+func (s *signatureService) verifyCMSSignerInfo(ctx context.Context, sd *cms.SignedData, si, parentSI *cms.SignerInfo, doc entity.Document) error {
+	if parentSI != nil {
+		_, err := cms.VerifyCounterSignature(si, parentSI, sd.Certificates)
+		return err
+	}
+	file, err := s.store.Get(ctx, doc.FilePath)
+	if err != nil {
+		return errors.New("cannot read document file")
+	}
+	defer file.Close()
+	_, err = sd.Verify(file)
+	return err
+}
+
+// findCounterSignerInfo searches the countersignatures below si for the one
+// stored with sig, matching on the signature value. It returns it with its
+// parent SignerInfo, or nils.
+func findCounterSignerInfo(si *cms.SignerInfo, sig entity.Signature) (*cms.SignerInfo, *cms.SignerInfo) {
+	stored, err := cms.ParseSignerInfo(sig.CMS)
+	if err != nil {
+		return nil, nil
+	}
+	counters, err := si.CounterSignatures()
+	if err != nil {
+		return nil, nil
+	}
+	for _, counter := range counters {
+		if bytes.Equal(counter.Signature, stored.Signature) {
+			return counter, si
+		}
+		if found, parent := findCounterSignerInfo(counter, sig); found != nil {
+			return found, parent
+		}
+	}
+	return nil, nil
+}
+
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
 	}
-	pubPEM := base64.StdEncoding.EncodeToString(pubASN1)
-	return signature, pubPEM, nil
+	return false
 }
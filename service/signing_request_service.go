@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/repository"
+	"gorm.io/gorm"
+)
+
+type SigningRequestService interface {
+	CreateSigningRequest(ctx context.Context, ownerID string, req dto.CreateSigningRequestRequest) (entity.SigningRequest, error)
+	GetSigningRequestByID(ctx context.Context, userID string, id uint) (entity.SigningRequest, error)
+	GetSigningRequestsByDocumentID(ctx context.Context, userID string, docID uint) ([]entity.SigningRequest, error)
+	GetPendingTasks(ctx context.Context, signerID string) ([]entity.SigningRequest, error)
+	Sign(ctx context.Context, id uint, signerID string, algorithm string, pin string) (entity.Signature, error)
+	Decline(ctx context.Context, id uint, signerID string, reason string) (entity.SigningRequest, error)
+	Cancel(ctx context.Context, id uint, ownerID string) (entity.SigningRequest, error)
+}
+
+type signingRequestService struct {
+	sigReqRepo repository.SigningRequestRepository
+	docRepo    repository.DocumentRepository
+	userRepo   repository.UserRepository
+	sigService SignatureService
+	db         *gorm.DB
+}
+
+func NewSigningRequestService(sigReqRepo repository.SigningRequestRepository, docRepo repository.DocumentRepository, userRepo repository.UserRepository, sigService SignatureService, db *gorm.DB) SigningRequestService {
+	return &signingRequestService{
+		sigReqRepo: sigReqRepo,
+		docRepo:    docRepo,
+		userRepo:   userRepo,
+		sigService: sigService,
+		db:         db,
+	}
+}
+
+func (s *signingRequestService) CreateSigningRequest(ctx context.Context, ownerID string, req dto.CreateSigningRequestRequest) (entity.SigningRequest, error) {
+	doc, err := s.docRepo.FindByID(ctx, nil, req.DocumentID)
+	if err != nil {
+		return entity.SigningRequest{}, errors.New("document not found")
+	}
+	if doc.UserID != ownerID {
+		return entity.SigningRequest{}, dto.ErrSigningRequestForbidden
+	}
+
+	order := req.Order
+	if order == "" {
+		order = constants.ENUM_SIGNING_ORDER_SEQUENTIAL
+	}
+	request := entity.SigningRequest{
+		DocumentID: doc.ID,
+		OwnerID:    ownerID,
+		Order:      order,
+		Message:    req.Message,
+	}
+	seen := make(map[string]bool, len(req.SignerIDs))
+	for i, signerID := range req.SignerIDs {
+		if seen[signerID] {
+			return entity.SigningRequest{}, dto.ErrDuplicateSigner
+		}
+		seen[signerID] = true
+		if _, err := s.userRepo.GetUserById(ctx, nil, signerID); err != nil {
+			return entity.SigningRequest{}, errors.New("signer not found")
+		}
+		request.Participants = append(request.Participants, entity.SigningParticipant{
+			SignerID: signerID,
+			Position: i + 1,
+		})
+	}
+	request.Start()
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Mỗi tài liệu chỉ có một yêu cầu ký đang chạy
+		if _, err := s.sigReqRepo.FindActiveByDocumentID(ctx, tx, doc.ID); err == nil {
+			return dto.ErrSigningRequestActive
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		created, err := s.sigReqRepo.Create(ctx, tx, request)
+		if err != nil {
+			return err
+		}
+		request = created
+		doc.Status = request.DocumentStatus()
+		_, err = s.docRepo.Update(ctx, tx, doc)
+		return err
+	})
+	if err != nil {
+		return entity.SigningRequest{}, err
+	}
+	return s.sigReqRepo.FindByID(ctx, nil, request.ID)
+}
+
+// GetSigningRequestByID returns a request to its owner or one of its signers.
+func (s *signingRequestService) GetSigningRequestByID(ctx context.Context, userID string, id uint) (entity.SigningRequest, error) {
+	request, err := s.sigReqRepo.FindByID(ctx, nil, id)
+	if err != nil {
+		return entity.SigningRequest{}, dto.ErrSigningRequestNotFound
+	}
+	if request.OwnerID != userID && request.Participant(userID) == nil {
+		return entity.SigningRequest{}, dto.ErrSigningRequestNotFound
+	}
+	return request, nil
+}
+
+func (s *signingRequestService) GetSigningRequestsByDocumentID(ctx context.Context, userID string, docID uint) ([]entity.SigningRequest, error) {
+	doc, err := s.docRepo.FindByID(ctx, nil, docID)
+	if err != nil {
+		return nil, errors.New("document not found")
+	}
+	if doc.UserID != userID {
+		return nil, dto.ErrSigningRequestForbidden
+	}
+	return s.sigReqRepo.FindByDocumentID(ctx, nil, docID)
+}
+
+// GetPendingTasks lists the requests waiting for signerID's signature now.
+func (s *signingRequestService) GetPendingTasks(ctx context.Context, signerID string) ([]entity.SigningRequest, error) {
+	return s.sigReqRepo.FindPendingBySignerID(ctx, nil, signerID)
+}
+
+// Sign signs the request's document as signerID. The signature service
+// checks the task again with the request locked, records the signature
+// against it and advances the document status.
+func (s *signingRequestService) Sign(ctx context.Context, id uint, signerID string, algorithm string, pin string) (entity.Signature, error) {
+	request, err := s.sigReqRepo.FindByID(ctx, nil, id)
+	if err != nil {
+		return entity.Signature{}, dto.ErrSigningRequestNotFound
+	}
+	if err := checkSigningTask(request, signerID); err != nil {
+		return entity.Signature{}, err
+	}
+	return s.sigService.SignRequest(ctx, request.ID, entity.Signature{
+		DocumentID: request.DocumentID,
+		SignerID:   signerID,
+		Algorithm:  algorithm,
+	}, pin)
+}
+
+func (s *signingRequestService) Decline(ctx context.Context, id uint, signerID string, reason string) (entity.SigningRequest, error) {
+	return s.transition(ctx, id, func(request *entity.SigningRequest) error {
+		if err := checkSigningTask(*request, signerID); err != nil {
+			return err
+		}
+		request.Decline(signerID, reason, time.Now())
+		return nil
+	})
+}
+
+func (s *signingRequestService) Cancel(ctx context.Context, id uint, ownerID string) (entity.SigningRequest, error) {
+	return s.transition(ctx, id, func(request *entity.SigningRequest) error {
+		if request.OwnerID != ownerID {
+			return dto.ErrSigningRequestForbidden
+		}
+		if !request.IsActive() {
+			return dto.ErrSigningRequestClosed
+		}
+		request.Cancel()
+		return nil
+	})
+}
+
+// transition applies change to a locked request and moves its document to
+// the resulting status.
+func (s *signingRequestService) transition(ctx context.Context, id uint, change func(*entity.SigningRequest) error) (entity.SigningRequest, error) {
+	var request entity.SigningRequest
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		request, err = s.sigReqRepo.FindByID(ctx, tx, id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return dto.ErrSigningRequestNotFound
+		} else if err != nil {
+			return err
+		}
+		if err := change(&request); err != nil {
+			return err
+		}
+		return saveSigningRequest(ctx, tx, s.sigReqRepo, s.docRepo, request)
+	})
+	if err != nil {
+		return entity.SigningRequest{}, err
+	}
+	return request, nil
+}
+
+// checkSigningTask reports why signerID cannot act on request now, if so.
+func checkSigningTask(request entity.SigningRequest, signerID string) error {
+	if !request.IsActive() {
+		return dto.ErrSigningRequestClosed
+	}
+	p := request.Participant(signerID)
+	if p == nil {
+		return dto.ErrNotParticipant
+	}
+	if p.Status != constants.ENUM_PARTICIPANT_PENDING {
+		return dto.ErrNotYourTurn
+	}
+	return nil
+}
+
+// saveSigningRequest stores the request state and the document status it
+// implies.
+func saveSigningRequest(ctx context.Context, tx *gorm.DB, sigReqRepo repository.SigningRequestRepository, docRepo repository.DocumentRepository, request entity.SigningRequest) error {
+	if _, err := sigReqRepo.Update(ctx, tx, request); err != nil {
+		return err
+	}
+	doc, err := docRepo.FindByID(ctx, tx, request.DocumentID)
+	if err != nil {
+		return err
+	}
+	doc.Status = request.DocumentStatus()
+	_, err = docRepo.Update(ctx, tx, doc)
+	return err
+}
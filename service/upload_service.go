@@ -0,0 +1,357 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/repository"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UploadService implements resumable uploads (tus 1.0). A completed upload
+// is handed to DocumentService.UploadDocument like a direct upload.
+type UploadService interface {
+	CreateUpload(ctx context.Context, userID string, length int64, metadata string) (entity.Upload, error)
+	GetUpload(ctx context.Context, userID string, id string) (entity.Upload, error)
+	ResumeUpload(ctx context.Context, userID string, id string) (entity.Upload, error)
+	WriteChunk(ctx context.Context, userID string, id string, offset int64, chunk io.Reader) (entity.Upload, error)
+	TerminateUpload(ctx context.Context, userID string, id string) error
+	RunExpirationCleaner(ctx context.Context)
+}
+
+type uploadService struct {
+	uploadRepo repository.UploadRepository
+	docService DocumentService
+	store      storage.Storage
+	cfg        config.UploadConfig
+	db         *gorm.DB
+}
+
+func NewUploadService(uploadRepo repository.UploadRepository, docService DocumentService, store storage.Storage, cfg config.UploadConfig, db *gorm.DB) UploadService {
+	return &uploadService{
+		uploadRepo: uploadRepo,
+		docService: docService,
+		store:      store,
+		cfg:        cfg,
+		db:         db,
+	}
+}
+
+// TUS_DIR is the storage key prefix of the uploads in progress. Storage
+// cannot append, so each PATCH is stored as a chunk keyed by its offset and
+// the chunks are joined once the upload is complete.
+const TUS_DIR = UPLOAD_DIR + "/tus"
+
+func chunkKey(id string, offset int64) string {
+	return TUS_DIR + "/" + id + "/" + strconv.FormatInt(offset, 10)
+}
+
+func (s *uploadService) CreateUpload(ctx context.Context, userID string, length int64, metadata string) (entity.Upload, error) {
+	if length > s.cfg.MaxSize {
+		return entity.Upload{}, dto.ErrUploadTooLarge
+	}
+	fileName := uploadFileName(parseUploadMetadata(metadata))
+	if fileName == "" {
+		return entity.Upload{}, dto.ErrUploadNoFileName
+	}
+
+	upload := entity.Upload{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		FileName:  fileName,
+		Length:    length,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(s.cfg.Expiration),
+	}
+	upload, err := s.uploadRepo.Create(ctx, nil, upload)
+	if err != nil {
+		return entity.Upload{}, err
+	}
+	// File rỗng đã đủ ngay khi tạo
+	if upload.IsComplete() {
+		return s.complete(ctx, nil, upload)
+	}
+	return upload, nil
+}
+
+// GetUpload returns an upload of userID that has not expired.
+func (s *uploadService) GetUpload(ctx context.Context, userID string, id string) (entity.Upload, error) {
+	return s.findUpload(ctx, nil, userID, id)
+}
+
+// findUpload is GetUpload within the transaction tx, if not nil, which then
+// holds the upload row locked until it ends.
+func (s *uploadService) findUpload(ctx context.Context, tx *gorm.DB, userID string, id string) (entity.Upload, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return entity.Upload{}, dto.ErrUploadNotFound
+	}
+	var (
+		upload entity.Upload
+		err    error
+	)
+	if tx != nil {
+		upload, err = s.uploadRepo.LockByID(ctx, tx, id)
+	} else {
+		upload, err = s.uploadRepo.FindByID(ctx, nil, id)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return entity.Upload{}, dto.ErrUploadNotFound
+	} else if err != nil {
+		return entity.Upload{}, err
+	}
+	if upload.UserID != userID || time.Now().After(upload.ExpiresAt) {
+		return entity.Upload{}, dto.ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+// ResumeUpload returns an upload like GetUpload. A complete upload whose
+// document could not be created is completed again: its offset already
+// equals its length, so the client has nothing left to send.
+func (s *uploadService) ResumeUpload(ctx context.Context, userID string, id string) (entity.Upload, error) {
+	return s.withUpload(ctx, userID, id, func(tx *gorm.DB, upload entity.Upload) (entity.Upload, error) {
+		if upload.IsComplete() && upload.DocumentID == nil {
+			return s.complete(ctx, tx, upload)
+		}
+		return upload, nil
+	})
+}
+
+// withUpload runs fn on an upload of userID locked in a database
+// transaction, so writers of an upload on every replica take turns. The
+// transaction is committed even when fn fails, keeping what it saved before:
+// fn's error is returned after the commit.
+func (s *uploadService) withUpload(ctx context.Context, userID string, id string, fn func(tx *gorm.DB, upload entity.Upload) (entity.Upload, error)) (entity.Upload, error) {
+	var (
+		upload entity.Upload
+		fnErr  error
+	)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		locked, err := s.findUpload(ctx, tx, userID, id)
+		if err != nil {
+			return err
+		}
+		upload, fnErr = fn(tx, locked)
+		return nil
+	})
+	if err != nil {
+		return entity.Upload{}, err
+	}
+	return upload, fnErr
+}
+
+// WriteChunk stores the bytes of a PATCH request at offset, which must be
+// the current offset of the upload. Whatever arrived before the client went
+// away is kept, so the upload can resume from there; bytes past the declared
+// length are ignored.
+func (s *uploadService) WriteChunk(ctx context.Context, userID string, id string, offset int64, chunk io.Reader) (entity.Upload, error) {
+	// Request bị hủy khi client ngắt: vẫn lưu chunk và offset đã nhận
+	ctx = context.WithoutCancel(ctx)
+
+	return s.withUpload(ctx, userID, id, func(tx *gorm.DB, upload entity.Upload) (entity.Upload, error) {
+		if offset != upload.Offset {
+			return upload, dto.ErrUploadOffsetMismatch
+		}
+		if upload.IsComplete() {
+			// lần ghép trước lỗi: PATCH cuối (thường rỗng) thử tạo document lại
+			if upload.DocumentID == nil {
+				return s.complete(ctx, tx, upload)
+			}
+			return upload, nil
+		}
+
+		// chunk ở offset này (nếu lần PATCH trước bị ngắt trước khi lưu
+		// offset) bị ghi đè
+		received := &receivedReader{r: io.LimitReader(chunk, upload.Length-upload.Offset)}
+		if err := s.store.Put(ctx, chunkKey(id, upload.Offset), received); err != nil {
+			return entity.Upload{}, errors.New("cannot store upload chunk")
+		}
+		copyErr := received.err
+
+		upload.Offset += received.n
+		upload.ExpiresAt = time.Now().Add(s.cfg.Expiration)
+		upload, err := s.uploadRepo.Update(ctx, tx, upload)
+		if err != nil {
+			return entity.Upload{}, err
+		}
+		if copyErr != nil {
+			return upload, copyErr
+		}
+		if upload.IsComplete() {
+			return s.complete(ctx, tx, upload)
+		}
+		return upload, nil
+	})
+}
+
+// complete joins the chunks into the uploaded file and creates its
+// document. The chunks are kept when that fails, so ResumeUpload and
+// WriteChunk can try again.
+func (s *uploadService) complete(ctx context.Context, tx *gorm.DB, upload entity.Upload) (entity.Upload, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.joinChunks(ctx, upload, pw))
+	}()
+	doc, err := s.docService.UploadDocument(ctx, upload.UserID, upload.FileName, pr)
+	pr.Close()
+	if err != nil {
+		return upload, errors.New("cannot store uploaded file")
+	}
+	s.deleteChunks(ctx, upload)
+
+	upload.DocumentID = &doc.ID
+	return s.uploadRepo.Update(ctx, tx, upload)
+}
+
+func (s *uploadService) TerminateUpload(ctx context.Context, userID string, id string) error {
+	_, err := s.withUpload(ctx, userID, id, func(tx *gorm.DB, upload entity.Upload) (entity.Upload, error) {
+		return upload, s.removeUpload(ctx, tx, upload)
+	})
+	return err
+}
+
+// joinChunks writes the chunks of a complete upload to w in order.
+func (s *uploadService) joinChunks(ctx context.Context, upload entity.Upload, w io.Writer) error {
+	for offset := int64(0); offset < upload.Length; {
+		chunk, err := s.store.Get(ctx, chunkKey(upload.ID, offset))
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(w, chunk)
+		chunk.Close()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errors.New("empty upload chunk")
+		}
+		offset += n
+	}
+	return nil
+}
+
+// deleteChunks removes the stored chunks of upload, including one left at
+// its offset by an interrupted PATCH.
+func (s *uploadService) deleteChunks(ctx context.Context, upload entity.Upload) error {
+	for offset := int64(0); offset < upload.Offset; {
+		info, err := s.store.Stat(ctx, chunkKey(upload.ID, offset))
+		if err != nil || info.Size == 0 {
+			break
+		}
+		if err := s.store.Delete(ctx, chunkKey(upload.ID, offset)); err != nil {
+			return err
+		}
+		offset += info.Size
+	}
+	return s.store.Delete(ctx, chunkKey(upload.ID, upload.Offset))
+}
+
+func (s *uploadService) removeUpload(ctx context.Context, tx *gorm.DB, upload entity.Upload) error {
+	if err := s.deleteChunks(ctx, upload); err != nil {
+		return err
+	}
+	return s.uploadRepo.Delete(ctx, tx, upload.ID)
+}
+
+// RunExpirationCleaner removes expired uploads and their partial files until
+// ctx is cancelled.
+func (s *uploadService) RunExpirationCleaner(ctx context.Context) {
+	interval := s.cfg.Expiration
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := s.uploadRepo.FindExpired(ctx, nil, time.Now())
+		if err != nil {
+			log.Printf("error listing expired uploads: %v", err)
+		}
+		for _, upload := range expired {
+			err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				// một PATCH vừa xong có thể đã gia hạn upload
+				current, err := s.uploadRepo.LockByID(ctx, tx, upload.ID)
+				if err != nil || current.ExpiresAt.After(time.Now()) {
+					return nil
+				}
+				return s.removeUpload(ctx, tx, current)
+			})
+			if err != nil {
+				log.Printf("error removing expired upload %s: %v", upload.ID, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// receivedReader reads a PATCH body up to the point the client went away:
+// a read error ends the chunk like EOF and is kept in err.
+type receivedReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (r *receivedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF {
+		r.err = err
+		err = io.EOF
+	}
+	return n, err
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma separated
+// pairs of a key and an optional base64 value.
+func parseUploadMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 {
+			continue
+		}
+		value := ""
+		if len(fields) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+		metadata[fields[0]] = value
+	}
+	return metadata
+}
+
+// uploadFileName is the file name announced by the client; tus clients send
+// it as "filename" or "name".
+func uploadFileName(metadata map[string]string) string {
+	name := metadata["filename"]
+	if name == "" {
+		name = metadata["name"]
+	}
+	name = filepath.Base(name)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
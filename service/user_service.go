@@ -3,15 +3,17 @@ package service
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"html/template"
-	"math/big"
+	"log"
 	"os"
 	"strings"
 	"time"
@@ -22,7 +24,9 @@ import (
 	"github.com/PhanPhuc2609/be-sign-file/dto"
 	"github.com/PhanPhuc2609/be-sign-file/entity"
 	"github.com/PhanPhuc2609/be-sign-file/helpers"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
 	"github.com/PhanPhuc2609/be-sign-file/repository"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
 	"github.com/PhanPhuc2609/be-sign-file/utils"
 	"github.com/google/uuid"
 )
@@ -40,14 +44,19 @@ type (
 		Verify(ctx context.Context, req dto.UserLoginRequest) (dto.TokenResponse, error)
 		RefreshToken(ctx context.Context, req dto.RefreshTokenRequest) (dto.TokenResponse, error)
 		RevokeRefreshToken(ctx context.Context, userID string) error
-		CreateUserCertificate(ctx context.Context, userId, userEmail, userName string) (certPEM, privPEM, pubPEM string, err error)
-		IssueUserCertificate(ctx context.Context, userEmail, userName string) (certPEM, privPEM, pubPEM string, err error)
+		CreateUserCertificate(ctx context.Context, userId, userEmail, userName, keyType, keyBackend, pin string) (certPEM, pubPEM string, err error)
+		IssueUserCertificate(ctx context.Context, userEmail, userName, keyType string) (certPEM, privPEM, pubPEM string, err error)
+		IssueCertificateFromCSR(ctx context.Context, userId string, csrPEM string) (dto.CertificateEnrollResponse, error)
 	}
 
 	userService struct {
 		userRepo         repository.UserRepository
 		refreshTokenRepo repository.RefreshTokenRepository
 		jwtService       JWTService
+		caService        CAService
+		keyVault         KeyVaultService
+		vaultKeyRepo     repository.VaultKeyRepository
+		store            storage.Storage
 		db               *gorm.DB
 	}
 )
@@ -56,12 +65,20 @@ func NewUserService(
 	userRepo repository.UserRepository,
 	refreshTokenRepo repository.RefreshTokenRepository,
 	jwtService JWTService,
+	caService CAService,
+	keyVault KeyVaultService,
+	vaultKeyRepo repository.VaultKeyRepository,
+	store storage.Storage,
 	db *gorm.DB,
 ) UserService {
 	return &userService{
 		userRepo:         userRepo,
 		refreshTokenRepo: refreshTokenRepo,
 		jwtService:       jwtService,
+		caService:        caService,
+		keyVault:         keyVault,
+		vaultKeyRepo:     vaultKeyRepo,
+		store:            store,
 		db:               db,
 	}
 }
@@ -96,7 +113,7 @@ func (s *userService) Register(ctx context.Context, req dto.UserCreateRequest) (
 		ext := utils.GetExtensions(req.Image.Filename)
 
 		filename = fmt.Sprintf("profile/%s.%s", imageId, ext)
-		if err := utils.UploadFile(req.Image, filename); err != nil {
+		if err := utils.UploadFile(ctx, s.store, req.Image, filename); err != nil {
 			return dto.UserResponse{}, err
 		}
 	}
@@ -504,163 +521,212 @@ func (s *userService) RevokeRefreshToken(ctx context.Context, userID string) err
 	return nil
 }
 
-func (s *userService) CreateUserCertificate(ctx context.Context, userId, userEmail, userName string) (certPEM, privPEM, pubPEM string, err error) {
-	// 1. Generate RSA key pair
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+func (s *userService) CreateUserCertificate(ctx context.Context, userId, userEmail, userName, keyType, keyBackend, pin string) (certPEM, pubPEM string, err error) {
+	user, err := s.userRepo.GetUserById(ctx, nil, userId)
 	if err != nil {
-		return "", "", "", err
+		return "", "", err
 	}
-	// 2. Create certificate template
-	tmpl := x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().UnixNano()),
-		Subject: pkix.Name{
-			CommonName:   userName,
-			Organization: []string{"VinCSS User"},
-			ExtraNames: []pkix.AttributeTypeAndValue{
-				{Type: []int{1, 2, 840, 113549, 1, 9, 1}, Value: userEmail}, // email OID
-			},
-		},
-		NotBefore:   time.Now(),
-		NotAfter:    time.Now().AddDate(1, 0, 0), // 1 year
-		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	previous, err := s.vaultKeyRepo.FindByUserID(ctx, nil, user.ID.String())
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", "", err
 	}
-	// 3. Self-sign (hoặc dùng CA riêng nếu có)
-	certDER, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &priv.PublicKey, priv)
+
+	// 1. Sinh keypair: trong PKCS#11 token, hoặc trong process và chỉ lưu đã
+	// mã hóa trong vault (PIN hoặc master key)
+	vaultKey, userPub, err := s.keyVault.CreateKey(user.ID.String(), keyType, keyBackend, pin)
 	if err != nil {
-		return "", "", "", err
+		return "", "", err
 	}
-	// 4. Encode to PEM
-	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}))
-	privPEM = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}))
-	pubASN1, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
-	pubPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubASN1}))
 
-	// 5. Lưu vào DB
-	user, err := s.userRepo.GetUserById(ctx, nil, userId)
+	// 2. CA của hệ thống cấp chứng chỉ
+	cert, certPEM, pubPEM, err := s.issueCertificate(ctx, userId, userEmail, userName, userPub)
 	if err != nil {
-		return certPEM, privPEM, pubPEM, err
+		s.destroyKey(vaultKey)
+		return "", "", err
 	}
-	user.CertPEM = certPEM
-	user.PrivPEM = privPEM
-	user.PubPEM = pubPEM
-	_, err = s.userRepo.Update(ctx, nil, user)
+
+	// 3. Thay khóa cũ trong vault và chứng chỉ trong cùng một transaction,
+	// chứng chỉ cũ bị thu hồi (superseded)
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.vaultKeyRepo.DeleteByUserID(ctx, tx, user.ID.String()); err != nil {
+			return err
+		}
+		if _, err := s.vaultKeyRepo.Create(ctx, tx, vaultKey); err != nil {
+			return err
+		}
+		if err := s.caService.SupersedeUserCertificates(ctx, tx, user.ID.String(), pki.SerialHex(cert)); err != nil {
+			return err
+		}
+		return s.userRepo.UpdateCertificate(ctx, tx, user.ID.String(), certPEM, pubPEM)
+	})
 	if err != nil {
-		return certPEM, privPEM, pubPEM, err
+		s.destroyKey(vaultKey)
+		return "", "", err
+	}
+	s.destroyKey(previous)
+	s.refreshCRL(ctx)
+	return certPEM, pubPEM, nil
+}
+
+// destroyKey removes from the PKCS#11 token a key no vault record points to.
+// A failure only leaves an unused key in the token, so it is logged.
+func (s *userService) destroyKey(vaultKey entity.VaultKey) {
+	if err := s.keyVault.DestroyKey(vaultKey); err != nil {
+		log.Printf("cannot delete signing key %s from the PKCS#11 token: %v", vaultKey.ID, err)
+	}
+}
+
+// refreshCRL publishes the certificates superseded by a new enrollment. On
+// failure the CRL refresher picks them up on its next tick.
+func (s *userService) refreshCRL(ctx context.Context) {
+	if err := s.caService.RefreshCRL(ctx); err != nil {
+		log.Printf("error refreshing CRL after certificate enrollment: %v", err)
 	}
-	return certPEM, privPEM, pubPEM, nil
 }
 
 // IssueUserCertificate: CA cấp chứng chỉ cho user, trả về cert, private key, public key (KHÔNG lưu vào DB)
-func (s *userService) IssueUserCertificate(ctx context.Context, userEmail, userName string) (certPEM, privPEM, pubPEM string, err error) {
-	// 1. Sinh keypair cho user
-	userPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+func (s *userService) IssueUserCertificate(ctx context.Context, userEmail, userName, keyType string) (certPEM, privPEM, pubPEM string, err error) {
+	userPriv, err := pki.GenerateKey(keyType)
 	if err != nil {
 		return "", "", "", err
 	}
-	// 2. Tạo certificate request (CSR) cho user (bỏ qua bước này, tạo trực tiếp cert template)
-	tmpl := x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().UnixNano()),
-		Subject: pkix.Name{
-			CommonName:   userName,
-			Organization: []string{"VinCSS User"},
-			ExtraNames: []pkix.AttributeTypeAndValue{
-				{Type: []int{1, 2, 840, 113549, 1, 9, 1}, Value: userEmail},
-			},
-		},
-		NotBefore:   time.Now(),
-		NotAfter:    time.Now().AddDate(1, 0, 0),
-		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
-	}
-	// 3. CA key/cert (demo: sinh tạm CA key/cert, thực tế nên lưu CA key/cert riêng)
-	caPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	_, certPEM, pubPEM, err = s.issueCertificate(ctx, "", userEmail, userName, userPriv.Public())
 	if err != nil {
 		return "", "", "", err
 	}
-	caTmpl := x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().UnixNano()),
-		Subject: pkix.Name{
-			CommonName: "VinCSS CA",
-		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(10, 0, 0),
-		IsCA:                  true,
-		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
-		BasicConstraintsValid: true,
-	}
-	caCertDER, err := x509.CreateCertificate(rand.Reader, &caTmpl, &caTmpl, &caPriv.PublicKey, caPriv)
+	privPEM, err = pki.EncodePrivateKeyPEM(userPriv)
 	if err != nil {
 		return "", "", "", err
 	}
-	caCert, err := x509.ParseCertificate(caCertDER)
+	return certPEM, privPEM, pubPEM, nil
+}
+
+func (s *userService) issueCertificate(ctx context.Context, userId, userEmail, userName string, userPub crypto.PublicKey) (cert *x509.Certificate, certPEM, pubPEM string, err error) {
+	cert, err = s.caService.IssueUserCertificate(ctx, userId, userSubject(userEmail, userName), []string{userEmail}, userPub)
 	if err != nil {
-		return "", "", "", err
+		return nil, "", "", err
 	}
-	// 4. Ký cert user bằng CA
-	certDER, err := x509.CreateCertificate(rand.Reader, &tmpl, caCert, &userPriv.PublicKey, caPriv)
+
+	certPEM = pki.EncodeCertificatePEM(cert.Raw)
+	pubPEM, err = pki.EncodePublicKeyPEM(userPub)
 	if err != nil {
-		return "", "", "", err
+		return nil, "", "", err
+	}
+	return cert, certPEM, pubPEM, nil
+}
+
+func userSubject(userEmail, userName string) pkix.Name {
+	return pkix.Name{
+		CommonName:   userName,
+		Organization: []string{"VinCSS User"},
+		ExtraNames: []pkix.AttributeTypeAndValue{
+			{Type: []int{1, 2, 840, 113549, 1, 9, 1}, Value: userEmail}, // email OID
+		},
 	}
-	// 5. Encode PEM
-	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}))
-	privPEM = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(userPriv)}))
-	pubASN1, _ := x509.MarshalPKIXPublicKey(&userPriv.PublicKey)
-	pubPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubASN1}))
-	return certPEM, privPEM, pubPEM, nil
 }
 
-// IssueCertificateFromCSR: Nhận CSR PEM, CA ký và trả về certificate PEM
-func (s *userService) IssueCertificateFromCSR(ctx context.Context, csrPEM string) (certPEM string, err error) {
+// IssueCertificateFromCSR: Nhận CSR PEM của user đang đăng nhập, CA ký và trả về certificate cùng chain.
+// Khóa riêng do client giữ, hệ thống chỉ lưu chứng chỉ.
+func (s *userService) IssueCertificateFromCSR(ctx context.Context, userId string, csrPEM string) (dto.CertificateEnrollResponse, error) {
+	user, err := s.userRepo.GetUserById(ctx, nil, userId)
+	if err != nil {
+		return dto.CertificateEnrollResponse{}, dto.ErrUserNotFound
+	}
+
 	// 1. Parse CSR
 	block, _ := pem.Decode([]byte(csrPEM))
 	if block == nil || block.Type != "CERTIFICATE REQUEST" {
-		return "", errors.New("invalid CSR PEM")
+		return dto.CertificateEnrollResponse{}, dto.ErrInvalidCSR
 	}
 	csr, err := x509.ParseCertificateRequest(block.Bytes)
 	if err != nil {
-		return "", err
+		return dto.CertificateEnrollResponse{}, dto.ErrInvalidCSR
 	}
 	if err := csr.CheckSignature(); err != nil {
-		return "", errors.New("CSR signature invalid")
+		return dto.CertificateEnrollResponse{}, dto.ErrCSRSignatureInvalid
 	}
-	// 2. CA key/cert (demo: sinh tạm CA key/cert, thực tế nên lưu riêng)
-	caPriv, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return "", err
+	if err := pki.CheckPublicKey(csr.PublicKey); err != nil {
+		return dto.CertificateEnrollResponse{}, err
 	}
-	caTmpl := x509.Certificate{
-		SerialNumber:          big.NewInt(time.Now().UnixNano()),
-		Subject:               pkix.Name{CommonName: "VinCSS CA"},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(10, 0, 0),
-		IsCA:                  true,
-		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
-		BasicConstraintsValid: true,
+
+	// 2. Subject/email trong CSR phải khớp với user
+	if err := checkCSRIdentity(csr, user); err != nil {
+		return dto.CertificateEnrollResponse{}, err
 	}
-	caCertDER, err := x509.CreateCertificate(rand.Reader, &caTmpl, &caTmpl, &caPriv.PublicKey, caPriv)
+
+	// 3. CA cấp chứng chỉ với subject do hệ thống quyết định
+	cert, err := s.caService.IssueUserCertificate(ctx, user.ID.String(), userSubject(user.Email, user.Name), []string{user.Email}, csr.PublicKey)
 	if err != nil {
-		return "", err
+		return dto.CertificateEnrollResponse{}, err
 	}
-	caCert, err := x509.ParseCertificate(caCertDER)
+	chain, err := s.caService.Chain(ctx)
 	if err != nil {
-		return "", err
+		return dto.CertificateEnrollResponse{}, err
 	}
-	// 3. Tạo cert cho user từ CSR
-	tmpl := x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().UnixNano()),
-		Subject:      csr.Subject,
-		NotBefore:    time.Now(),
-		NotAfter:     time.Now().AddDate(1, 0, 0),
-		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+
+	certPEM := pki.EncodeCertificatePEM(cert.Raw)
+	pubPEM, err := pki.EncodePublicKeyPEM(csr.PublicKey)
+	if err != nil {
+		return dto.CertificateEnrollResponse{}, err
 	}
-	certDER, err := x509.CreateCertificate(rand.Reader, &tmpl, caCert, csr.PublicKey, caPriv)
+
+	// 4. Lưu chứng chỉ, xóa khóa riêng cũ do server giữ (nếu có) và thu hồi
+	// chứng chỉ cũ (superseded)
+	previous, err := s.vaultKeyRepo.FindByUserID(ctx, nil, user.ID.String())
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return dto.CertificateEnrollResponse{}, err
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.vaultKeyRepo.DeleteByUserID(ctx, tx, user.ID.String()); err != nil {
+			return err
+		}
+		if err := s.caService.SupersedeUserCertificates(ctx, tx, user.ID.String(), pki.SerialHex(cert)); err != nil {
+			return err
+		}
+		return s.userRepo.UpdateCertificate(ctx, tx, user.ID.String(), certPEM, pubPEM)
+	})
 	if err != nil {
-		return "", err
+		return dto.CertificateEnrollResponse{}, dto.ErrUpdateUser
 	}
-	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}))
-	return certPEM, nil
+	s.destroyKey(previous)
+	s.refreshCRL(ctx)
+
+	chainPEM := certPEM
+	for _, c := range chain {
+		chainPEM += pki.EncodeCertificatePEM(c.Raw)
+	}
+
+	return dto.CertificateEnrollResponse{
+		Serial:      pki.SerialHex(cert),
+		Fingerprint: pki.Fingerprint(cert),
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+		CertPEM:     certPEM,
+		ChainPEM:    chainPEM,
+	}, nil
+}
+
+func checkCSRIdentity(csr *x509.CertificateRequest, user entity.User) error {
+	emails := append([]string{}, csr.EmailAddresses...)
+	for _, name := range csr.Subject.Names {
+		if name.Type.Equal(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}) {
+			if email, ok := name.Value.(string); ok {
+				emails = append(emails, email)
+			}
+		}
+	}
+	if len(emails) == 0 {
+		return dto.ErrCSRIdentityMismatch
+	}
+	for _, email := range emails {
+		if !strings.EqualFold(email, user.Email) {
+			return dto.ErrCSRIdentityMismatch
+		}
+	}
+	if csr.Subject.CommonName != "" && csr.Subject.CommonName != user.Name {
+		return dto.ErrCSRIdentityMismatch
+	}
+	return nil
 }
 
 // GenerateCSRWithPublicKey: Nhận public key, tạo CSR PEM cho user
@@ -0,0 +1,410 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DataKeys keeps the data keys of encrypted objects outside the storage,
+// wrapped by a master key.
+type DataKeys interface {
+	Create(ctx context.Context, id string, key []byte) error
+	Find(ctx context.Context, id string) ([]byte, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// An encrypted object is a header naming its data key followed by the
+// content in segments, each sealed with AES-256-GCM on its own so that the
+// object can still be read at any offset. The nonce of a segment is the
+// random prefix of the object, the segment index and a flag set on the last
+// segment, which detects a truncated object.
+const (
+	encryptedMagic      = "BSFENC\x00\x01"
+	noncePrefixSize     = 7
+	encryptedHeaderSize = len(encryptedMagic) + 16 + noncePrefixSize
+	dataKeySize         = 32
+	segmentSize         = 64 << 10
+	sealedSegmentSize   = segmentSize + 16
+)
+
+var (
+	ErrCorruptObject     = errors.New("corrupt encrypted object")
+	ErrUnencryptedObject = errors.New("object is not encrypted")
+)
+
+// encryptedStorage encrypts the objects stored under prefixes, each with a
+// data key of its own. Objects stored there before encryption was enabled
+// are read as they are only with allowPlaintext, else they fail with
+// ErrUnencryptedObject.
+type encryptedStorage struct {
+	Storage
+	keys           DataKeys
+	allowPlaintext bool
+	prefixes       []string
+}
+
+func NewEncrypted(inner Storage, keys DataKeys, allowPlaintext bool, prefixes ...string) Storage {
+	return &encryptedStorage{Storage: inner, keys: keys, allowPlaintext: allowPlaintext, prefixes: prefixes}
+}
+
+func (s *encryptedStorage) encrypts(key string) bool {
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Put records a new data key, stores the content sealed with it and then
+// deletes the data key of the object it replaced.
+func (s *encryptedStorage) Put(ctx context.Context, key string, content io.Reader) error {
+	if !s.encrypts(key) {
+		return s.Storage.Put(ctx, key, content)
+	}
+	previous, err := s.dataKeyID(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	id := uuid.New()
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	if err := s.keys.Create(ctx, id.String(), dataKey); err != nil {
+		return err
+	}
+	sealed, err := newSealingReader(content, id, dataKey)
+	if err == nil {
+		err = s.Storage.Put(ctx, key, sealed)
+	}
+	if err != nil {
+		s.keys.Delete(context.WithoutCancel(ctx), id.String())
+		return err
+	}
+	if previous != "" {
+		// khóa cũ còn sót lại không ảnh hưởng gì, chỉ không còn dùng được
+		s.keys.Delete(ctx, previous)
+	}
+	return nil
+}
+
+func (s *encryptedStorage) Get(ctx context.Context, key string) (Object, error) {
+	object, err := s.Storage.Get(ctx, key)
+	if err != nil || !s.encrypts(key) {
+		return object, err
+	}
+	id, header, err := readHeader(object)
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+	// object lưu trước khi bật mã hóa, chỉ đọc được trong lúc chuyển đổi
+	if id == "" {
+		if !s.allowPlaintext {
+			object.Close()
+			return nil, ErrUnencryptedObject
+		}
+		return object, nil
+	}
+	dataKey, err := s.keys.Find(ctx, id)
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+	opened, err := openSealed(object, header, dataKey)
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+	return opened, nil
+}
+
+// Stat of an encrypted object reports the size of its content.
+func (s *encryptedStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	if !s.encrypts(key) {
+		return s.Storage.Stat(ctx, key)
+	}
+	object, err := s.Get(ctx, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer object.Close()
+	return object.Info(), nil
+}
+
+func (s *encryptedStorage) Delete(ctx context.Context, key string) error {
+	if !s.encrypts(key) {
+		return s.Storage.Delete(ctx, key)
+	}
+	id, err := s.dataKeyID(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := s.Storage.Delete(ctx, key); err != nil {
+		return err
+	}
+	if id != "" {
+		return s.keys.Delete(ctx, id)
+	}
+	return nil
+}
+
+// Presign is not supported for encrypted objects: only the application can
+// decrypt them.
+func (s *encryptedStorage) Presign(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if s.encrypts(key) {
+		return "", ErrPresignNotSupported
+	}
+	return s.Storage.Presign(ctx, key, expires)
+}
+
+// dataKeyID returns the data key of the object stored under key, or an
+// empty id when there is no object or it is not encrypted.
+func (s *encryptedStorage) dataKeyID(ctx context.Context, key string) (string, error) {
+	object, err := s.Storage.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer object.Close()
+	id, _, err := readHeader(object)
+	return id, err
+}
+
+// readHeader returns the data key id and the header of an encrypted object,
+// or an empty id for an object that is not encrypted.
+func readHeader(object Object) (string, []byte, error) {
+	header := make([]byte, encryptedHeaderSize)
+	n, err := object.ReadAt(header, 0)
+	if n < len(header) || string(header[:len(encryptedMagic)]) != encryptedMagic {
+		if err != nil && err != io.EOF {
+			return "", nil, err
+		}
+		return "", nil, nil
+	}
+	id, err := uuid.FromBytes(header[len(encryptedMagic) : len(encryptedMagic)+16])
+	if err != nil {
+		return "", nil, ErrCorruptObject
+	}
+	return id.String(), header, nil
+}
+
+func newGCM(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func segmentNonce(prefix []byte, index int64, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], uint32(index))
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// sealingReader reads the encrypted form of src: the header, then sealed
+// segments. One byte past each segment is read ahead to know whether it is
+// the last one.
+type sealingReader struct {
+	src    io.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	index  int64
+	plain  []byte
+	out    []byte
+	done   bool
+}
+
+func newSealingReader(src io.Reader, id uuid.UUID, dataKey []byte) (*sealingReader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, encryptedHeaderSize)
+	header = append(header, encryptedMagic...)
+	header = append(header, id[:]...)
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	header = append(header, prefix...)
+	return &sealingReader{
+		src:    src,
+		aead:   aead,
+		prefix: prefix,
+		plain:  make([]byte, 0, segmentSize+1),
+		out:    header,
+	}, nil
+}
+
+func (r *sealingReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.seal(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// seal reads the next segment and seals it into out.
+func (r *sealingReader) seal() error {
+	n, err := io.ReadFull(r.src, r.plain[len(r.plain):segmentSize+1])
+	r.plain = r.plain[:len(r.plain)+n]
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := len(r.plain) <= segmentSize
+	segment := r.plain
+	if !last {
+		segment = r.plain[:segmentSize]
+	}
+	r.out = r.aead.Seal(r.out[:0], segmentNonce(r.prefix, r.index, last), segment, nil)
+	r.index++
+	if last {
+		r.done = true
+		r.plain = r.plain[:0]
+	} else {
+		r.plain = append(r.plain[:0], r.plain[segmentSize:]...)
+	}
+	return nil
+}
+
+// sealedObject decrypts an encrypted object, one segment at a time.
+type sealedObject struct {
+	inner    Object
+	aead     cipher.AEAD
+	prefix   []byte
+	info     ObjectInfo
+	segments int64
+
+	mu      sync.Mutex
+	pos     int64
+	cached  int64
+	segment []byte
+	sealed  []byte
+}
+
+func openSealed(inner Object, header []byte, dataKey []byte) (*sealedObject, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	body := inner.Info().Size - int64(encryptedHeaderSize)
+	segments := (body + sealedSegmentSize - 1) / sealedSegmentSize
+	if segments == 0 || body-(segments-1)*sealedSegmentSize < int64(aead.Overhead()) {
+		return nil, ErrCorruptObject
+	}
+	info := inner.Info()
+	info.Size = body - segments*int64(aead.Overhead())
+	return &sealedObject{
+		inner:    inner,
+		aead:     aead,
+		prefix:   header[len(header)-noncePrefixSize:],
+		info:     info,
+		segments: segments,
+		cached:   -1,
+		sealed:   make([]byte, sealedSegmentSize),
+	}, nil
+}
+
+func (o *sealedObject) Info() ObjectInfo {
+	return o.info
+}
+
+func (o *sealedObject) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := 0
+	for n < len(p) && off+int64(n) < o.info.Size {
+		pos := off + int64(n)
+		segment, err := o.open(pos / segmentSize)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], segment[pos%segmentSize:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// open returns the content of segment index, keeping the last one opened.
+func (o *sealedObject) open(index int64) ([]byte, error) {
+	if index == o.cached {
+		return o.segment, nil
+	}
+	start := int64(encryptedHeaderSize) + index*sealedSegmentSize
+	size := min(sealedSegmentSize, o.inner.Info().Size-start)
+	n, err := o.inner.ReadAt(o.sealed[:size], start)
+	if n < int(size) {
+		if err == nil || err == io.EOF {
+			err = ErrCorruptObject
+		}
+		return nil, err
+	}
+	segment, err := o.aead.Open(o.segment[:0], segmentNonce(o.prefix, index, index == o.segments-1), o.sealed[:size], nil)
+	if err != nil {
+		o.cached = -1
+		return nil, ErrCorruptObject
+	}
+	o.segment, o.cached = segment, index
+	return segment, nil
+}
+
+func (o *sealedObject) Read(p []byte) (int, error) {
+	n, err := o.ReadAt(p, o.pos)
+	o.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (o *sealedObject) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.pos
+	case io.SeekEnd:
+		offset += o.info.Size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	o.pos = offset
+	return offset, nil
+}
+
+func (o *sealedObject) Close() error {
+	return o.inner.Close()
+}
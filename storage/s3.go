@@ -0,0 +1,413 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+)
+
+const (
+	// ReadAt đọc theo khối để PDF (đọc ngẫu nhiên nhiều đoạn nhỏ) không tạo
+	// một request cho mỗi lần đọc
+	s3BlockSize    = 1 << 20
+	s3CachedBlocks = 8
+)
+
+// s3Storage keeps objects in a bucket of AWS S3 or an S3-compatible server
+// such as MinIO. Requests are signed with Signature Version 4.
+type s3Storage struct {
+	endpoint  *url.URL
+	bucket    string
+	pathStyle bool
+	partSize  int64
+	signer    signer
+	client    *http.Client
+}
+
+func NewS3(cfg config.S3Config) (Storage, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3 storage needs an endpoint and a bucket")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	partSize := cfg.PartSize
+	if partSize <= 0 {
+		partSize = config.DEFAULT_S3_PART_SIZE
+	}
+	return &s3Storage{
+		endpoint:  endpoint,
+		bucket:    cfg.Bucket,
+		pathStyle: cfg.PathStyle,
+		partSize:  partSize,
+		signer:    signer{accessKey: cfg.AccessKey, secretKey: cfg.SecretKey, region: cfg.Region},
+		client:    &http.Client{},
+	}, nil
+}
+
+// objectURL addresses key in the bucket, path style or virtual-hosted.
+func (s *s3Storage) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	prefix := strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		prefix += "/" + s.bucket
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	u.Path = prefix + "/" + key
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// do sends a signed request for key and returns the response when it has
+// one of the expected statuses, the S3 error otherwise.
+func (s *s3Storage) do(ctx context.Context, method string, key string, query url.Values, header http.Header, body []byte, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL = s.objectURL(key, query)
+	req.Host = req.URL.Host
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if len(body) == 0 && method == http.MethodPut {
+		// object rỗng: gửi Content-Length: 0 thay vì chunked
+		req.Body = http.NoBody
+	} else if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	hash := sha256.Sum256(body)
+	s.signer.sign(req, hex.EncodeToString(hash[:]), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	return nil, s3Error(resp, key)
+}
+
+// s3ErrorResponse is the error document S3 returns.
+type s3ErrorResponse struct {
+	XMLName xml.Name
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func s3Error(resp *http.Response, key string) error {
+	defer resp.Body.Close()
+	var body s3ErrorResponse
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+	if resp.StatusCode == http.StatusNotFound && body.Code != "NoSuchBucket" {
+		return ErrNotFound
+	}
+	if body.Code == "" {
+		body.Code = resp.Status
+	}
+	return fmt.Errorf("s3 %s: %s %s", key, body.Code, body.Message)
+}
+
+// Put sends content in one request when it fits in a part, as a multipart
+// upload otherwise. Parts are buffered so each one is signed with its hash.
+func (s *s3Storage) Put(ctx context.Context, key string, content io.Reader) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, s.partSize)
+	n, err := io.ReadFull(content, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		resp, err := s.do(ctx, http.MethodPut, key, nil, nil, buf[:n], http.StatusOK)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.putMultipart(ctx, key, buf, content)
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// putMultipart uploads first and the rest of content as the parts of a
+// multipart upload, which is aborted if anything fails.
+func (s *s3Storage) putMultipart(ctx context.Context, key string, first []byte, content io.Reader) error {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	var initiated initiateMultipartUploadResult
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("s3 %s: cannot start multipart upload", key)
+	}
+
+	err = s.uploadParts(ctx, key, initiated.UploadID, first, content)
+	if err != nil {
+		// hủy để S3 không giữ các phần đã tải, kể cả khi request bị hủy
+		if resp, abortErr := s.do(context.WithoutCancel(ctx), http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadID}}, nil, nil, http.StatusNoContent, http.StatusOK); abortErr == nil {
+			resp.Body.Close()
+		}
+	}
+	return err
+}
+
+func (s *s3Storage) uploadParts(ctx context.Context, key string, uploadID string, part []byte, content io.Reader) error {
+	buf := part
+	var completed completeMultipartUpload
+	for number := 1; ; number++ {
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := s.do(ctx, http.MethodPut, key, query, nil, part, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		completed.Parts = append(completed.Parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+		n, err := io.ReadFull(content, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		part = buf[:n]
+	}
+
+	body, err := xml.Marshal(completed)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 có thể trả 200 kèm tài liệu lỗi khi ghép các phần thất bại
+	var result s3ErrorResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("s3 %s: cannot complete multipart upload", key)
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("s3 %s: %s %s", key, result.Code, result.Message)
+	}
+	return nil
+}
+
+func (s *s3Storage) Get(ctx context.Context, key string) (Object, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Object{ctx: ctx, store: s, info: info}, nil
+}
+
+func (s *s3Storage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil, http.StatusOK)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return ObjectInfo{Key: key, Size: resp.ContentLength, ModTime: modTime}, nil
+}
+
+// getRange opens the bytes from start to end, inclusive, of key.
+func (s *s3Storage) getRange(ctx context.Context, key string, start, end int64) (io.ReadCloser, error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", start, end)}}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, header, nil, http.StatusPartialContent, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil, http.StatusNoContent, http.StatusOK)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3Storage) Presign(ctx context.Context, key string, expires time.Duration) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return s.signer.presign(http.MethodGet, s.objectURL(key, nil), expires, time.Now()), nil
+}
+
+// s3Object reads an object with ranged GETs: Read streams from the current
+// offset, ReadAt goes through a small cache of blocks.
+type s3Object struct {
+	ctx   context.Context
+	store *s3Storage
+	info  ObjectInfo
+
+	offset     int64
+	body       io.ReadCloser
+	bodyOffset int64
+
+	mu     sync.Mutex
+	blocks [s3CachedBlocks]s3Block
+	next   int
+}
+
+type s3Block struct {
+	index int64
+	data  []byte
+}
+
+func (o *s3Object) Info() ObjectInfo {
+	return o.info
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.info.Size {
+		return 0, io.EOF
+	}
+	if o.body == nil || o.bodyOffset != o.offset {
+		o.closeBody()
+		body, err := o.store.getRange(o.ctx, o.info.Key, o.offset, o.info.Size-1)
+		if err != nil {
+			return 0, err
+		}
+		o.body, o.bodyOffset = body, o.offset
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	o.bodyOffset += int64(n)
+	if err == io.EOF {
+		o.closeBody()
+		if o.offset < o.info.Size {
+			return n, io.ErrUnexpectedEOF
+		}
+		if n > 0 {
+			err = nil
+		}
+	}
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.info.Size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of object")
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+func (o *s3Object) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := 0
+	for n < len(p) && off+int64(n) < o.info.Size {
+		pos := off + int64(n)
+		block, err := o.block(pos / s3BlockSize)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], block[pos%s3BlockSize:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns block index of the object, from the cache when possible.
+func (o *s3Object) block(index int64) ([]byte, error) {
+	for _, block := range o.blocks {
+		if block.data != nil && block.index == index {
+			return block.data, nil
+		}
+	}
+	start := index * s3BlockSize
+	end := min(start+s3BlockSize, o.info.Size) - 1
+	body, err := o.store.getRange(o.ctx, o.info.Key, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data := make([]byte, end-start+1)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return nil, err
+	}
+	o.blocks[o.next] = s3Block{index: index, data: data}
+	o.next = (o.next + 1) % s3CachedBlocks
+	return data, nil
+}
+
+func (o *s3Object) closeBody() {
+	if o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+}
+
+func (o *s3Object) Close() error {
+	o.closeBody()
+	return nil
+}
@@ -0,0 +1,71 @@
+// Package storage keeps the files of the application (uploaded documents,
+// their signed outputs and profile images) under slash separated keys, on
+// the local disk or in an S3-compatible bucket shared by all replicas.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+)
+
+var (
+	ErrNotFound            = errors.New("object not found")
+	ErrInvalidKey          = errors.New("invalid object key")
+	ErrPresignNotSupported = errors.New("storage cannot presign URLs")
+)
+
+type Storage interface {
+	// Put stores everything read from content under key, replacing the
+	// object stored there. Readers never see a partly written object, and a
+	// read error from content is returned as is.
+	Put(ctx context.Context, key string, content io.Reader) error
+	// Get opens the object stored under key.
+	Get(ctx context.Context, key string) (Object, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete removes the object stored under key; a missing object is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+	// Presign returns a URL anyone can download the object from until
+	// expires has passed.
+	Presign(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Object is an opened object. It is read sequentially or at any offset.
+type Object interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+	Info() ObjectInfo
+}
+
+// New returns the driver selected by cfg.
+func New(cfg config.StorageConfig) (Storage, error) {
+	switch cfg.Driver {
+	case config.STORAGE_DRIVER_LOCAL:
+		return NewLocal(cfg.LocalRoot), nil
+	case config.STORAGE_DRIVER_S3:
+		return NewS3(cfg.S3)
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+}
+
+// cleanKey rejects keys that would leave the storage root.
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean(key)
+	if key == "" || path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
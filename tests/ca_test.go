@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/ca"
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+func SetUpTestCA(t *testing.T) (config.CAConfig, *ca.Authority) {
+	cfg := config.CAConfig{
+		Dir:        t.TempDir(),
+		Name:       "Test",
+		Passphrase: "correct horse battery staple",
+	}
+	authority, err := ca.Init(cfg, nil)
+	require.NoError(t, err)
+	return cfg, authority
+}
+
+func Test_CA_InitAndLoad(t *testing.T) {
+	cfg, created := SetUpTestCA(t)
+
+	_, err := ca.Init(cfg, nil)
+	assert.ErrorIs(t, err, ca.ErrAlreadyInitialized)
+
+	loaded, err := ca.Load(cfg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, created.Root.Raw, loaded.Root.Raw)
+	assert.Equal(t, created.Issuing.Raw, loaded.Issuing.Raw)
+
+	cfg.Passphrase = "wrong"
+	_, err = ca.Load(cfg, nil)
+	assert.ErrorIs(t, err, ca.ErrWrongPassphrase)
+}
+
+func Test_CA_NotInitialized(t *testing.T) {
+	_, err := ca.Load(config.CAConfig{Dir: t.TempDir(), Passphrase: "x"}, nil)
+	assert.ErrorIs(t, err, ca.ErrNotInitialized)
+}
+
+func Test_CA_IssuedCertificateChainsToRoot(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := ca.NewSerial()
+	require.NoError(t, err)
+
+	cert, err := authority.Issue(&x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "alice"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}, &key.PublicKey)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.Root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(authority.Issuing)
+
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	assert.NoError(t, err)
+}
+
+func Test_CA_CreateCRL(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+
+	serial, err := ca.NewSerial()
+	require.NoError(t, err)
+	revokedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	der, err := authority.CreateCRL([]ca.RevokedEntry{
+		{Serial: serial, RevokedAt: revokedAt, Reason: ca.ReasonKeyCompromise},
+	}, big.NewInt(1), time.Now(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	crl, err := x509.ParseRevocationList(der)
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(authority.Issuing))
+	require.Len(t, crl.RevokedCertificateEntries, 1)
+	assert.Equal(t, 0, crl.RevokedCertificateEntries[0].SerialNumber.Cmp(serial))
+	assert.Equal(t, ca.ReasonKeyCompromise, crl.RevokedCertificateEntries[0].ReasonCode)
+	assert.True(t, crl.RevokedCertificateEntries[0].RevocationTime.Equal(revokedAt))
+}
+
+func Test_CA_ParseReason(t *testing.T) {
+	code, err := ca.ParseReason("keyCompromise")
+	require.NoError(t, err)
+	assert.Equal(t, ca.ReasonKeyCompromise, code)
+	assert.Equal(t, "keyCompromise", ca.ReasonName(code))
+
+	code, err = ca.ParseReason("")
+	require.NoError(t, err)
+	assert.Equal(t, ca.ReasonUnspecified, code)
+
+	_, err = ca.ParseReason("certificateHold")
+	assert.Error(t, err)
+}
+
+func Test_CA_OCSPResponse(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+
+	issue := func(eku x509.ExtKeyUsage) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		serial, err := ca.NewSerial()
+		require.NoError(t, err)
+		cert, err := authority.Issue(&x509.Certificate{
+			SerialNumber: serial,
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().AddDate(1, 0, 0),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{eku},
+		}, &key.PublicKey)
+		require.NoError(t, err)
+		return cert, key
+	}
+
+	responderCert, responderKey := issue(x509.ExtKeyUsageOCSPSigning)
+	responder := &ca.ServiceIdentity{Certificate: responderCert, Key: responderKey}
+	userCert, _ := issue(x509.ExtKeyUsageClientAuth)
+
+	reqDER, err := ocsp.CreateRequest(userCert, authority.Issuing, nil)
+	require.NoError(t, err)
+	req, err := ocsp.ParseRequest(reqDER)
+	require.NoError(t, err)
+	assert.True(t, authority.IssuedOCSPRequest(req))
+
+	now := time.Now()
+	der, err := authority.CreateOCSPResponse(responder, req.SerialNumber, ca.CertStatus{Known: true}, now, now.Add(time.Hour))
+	require.NoError(t, err)
+	resp, err := ocsp.ParseResponseForCert(der, userCert, authority.Issuing)
+	require.NoError(t, err)
+	assert.Equal(t, ocsp.Good, resp.Status)
+
+	revokedAt := now.Add(-time.Hour).Truncate(time.Second)
+	der, err = authority.CreateOCSPResponse(responder, req.SerialNumber, ca.CertStatus{
+		Known:     true,
+		RevokedAt: revokedAt,
+		Reason:    ca.ReasonKeyCompromise,
+	}, now, now.Add(time.Hour))
+	require.NoError(t, err)
+	resp, err = ocsp.ParseResponseForCert(der, userCert, authority.Issuing)
+	require.NoError(t, err)
+	assert.Equal(t, ocsp.Revoked, resp.Status)
+	assert.Equal(t, ocsp.KeyCompromise, resp.RevocationReason)
+	assert.True(t, resp.RevokedAt.Equal(revokedAt))
+
+	der, err = authority.CreateOCSPResponse(responder, req.SerialNumber, ca.CertStatus{}, now, now.Add(time.Hour))
+	require.NoError(t, err)
+	resp, err = ocsp.ParseResponseForCert(der, userCert, authority.Issuing)
+	require.NoError(t, err)
+	assert.Equal(t, ocsp.Unknown, resp.Status)
+
+	// a request for a certificate from another CA must not be answered
+	_, other := SetUpTestCA(t)
+	foreignReq, err := ocsp.CreateRequest(userCert, other.Issuing, nil)
+	require.NoError(t, err)
+	parsed, err := ocsp.ParseRequest(foreignReq)
+	require.NoError(t, err)
+	assert.False(t, authority.IssuedOCSPRequest(parsed))
+}
@@ -0,0 +1,235 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/ca"
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/controller"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/PhanPhuc2609/be-sign-file/repository"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryUserRepository keeps users in a map, only the lookups and the
+// certificate update are implemented.
+type memoryUserRepository struct {
+	repository.UserRepository
+	users map[string]entity.User
+}
+
+func (r *memoryUserRepository) GetUserById(ctx context.Context, tx *gorm.DB, userId string) (entity.User, error) {
+	user, ok := r.users[userId]
+	if !ok {
+		return entity.User{}, gorm.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+func (r *memoryUserRepository) UpdateCertificate(ctx context.Context, tx *gorm.DB, userId string, certPEM, pubPEM string) error {
+	user, ok := r.users[userId]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	user.CertPEM, user.PrivPEM, user.PubPEM = certPEM, "", pubPEM
+	r.users[userId] = user
+	return nil
+}
+
+// memoryCertificateRepository keeps the certificates issued by the CA in a
+// slice.
+type memoryCertificateRepository struct {
+	certs []entity.Certificate
+}
+
+func (r *memoryCertificateRepository) Create(ctx context.Context, tx *gorm.DB, cert entity.Certificate) (entity.Certificate, error) {
+	cert.ID = uint(len(r.certs) + 1)
+	r.certs = append(r.certs, cert)
+	return cert, nil
+}
+
+func (r *memoryCertificateRepository) find(match func(entity.Certificate) bool) (entity.Certificate, error) {
+	for _, cert := range r.certs {
+		if match(cert) {
+			return cert, nil
+		}
+	}
+	return entity.Certificate{}, gorm.ErrRecordNotFound
+}
+
+func (r *memoryCertificateRepository) FindBySerial(ctx context.Context, tx *gorm.DB, serial string) (entity.Certificate, error) {
+	return r.find(func(cert entity.Certificate) bool { return cert.Serial == serial })
+}
+
+func (r *memoryCertificateRepository) FindByFingerprint(ctx context.Context, tx *gorm.DB, fingerprint string) (entity.Certificate, error) {
+	return r.find(func(cert entity.Certificate) bool { return cert.Fingerprint == fingerprint })
+}
+
+func (r *memoryCertificateRepository) FindByUserID(ctx context.Context, tx *gorm.DB, userID string) ([]entity.Certificate, error) {
+	var certs []entity.Certificate
+	for i := len(r.certs) - 1; i >= 0; i-- {
+		if r.certs[i].UserID == userID {
+			certs = append(certs, r.certs[i])
+		}
+	}
+	return certs, nil
+}
+
+func (r *memoryCertificateRepository) ExistsSerial(ctx context.Context, tx *gorm.DB, serial string) (bool, error) {
+	_, err := r.FindBySerial(ctx, tx, serial)
+	return err == nil, nil
+}
+
+func (r *memoryCertificateRepository) Revoke(ctx context.Context, tx *gorm.DB, serial string, revokedAt time.Time, reason int) error {
+	for i, cert := range r.certs {
+		if cert.Serial == serial && !cert.IsRevoked() {
+			r.certs[i].Status = constants.ENUM_CERT_STATUS_REVOKED
+			r.certs[i].RevokedAt = &revokedAt
+			r.certs[i].RevocationReason = reason
+		}
+	}
+	return nil
+}
+
+func (r *memoryCertificateRepository) FindRevoked(ctx context.Context, tx *gorm.DB) ([]entity.Certificate, error) {
+	var certs []entity.Certificate
+	for _, cert := range r.certs {
+		if cert.IsRevoked() {
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
+
+// SetUpMemoryCA returns a CA service over a temporary CA and in-memory
+// repositories.
+func SetUpMemoryCA(t *testing.T, users *memoryUserRepository) (service.CAService, *memoryCertificateRepository) {
+	cfg, _ := SetUpTestCA(t)
+	cfg.CRLRefreshInterval = time.Hour
+	cfg.TSAPolicyOID = config.DEFAULT_TSA_POLICY_OID
+	certs := &memoryCertificateRepository{}
+	return service.NewCAService(certs, users, &memoryKeyUsageRepository{}, cfg, nil), certs
+}
+
+func newCSR(t *testing.T, key crypto.Signer, commonName string, email string) string {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: commonName},
+		EmailAddresses: []string{email},
+	}, key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
+
+func Test_Certificate_EnrollCSR(t *testing.T) {
+	user := entity.User{ID: uuid.New(), Name: "alice", Email: "alice@example.com"}
+	users := &memoryUserRepository{users: map[string]entity.User{user.ID.String(): user}}
+	caService, certs := SetUpMemoryCA(t, users)
+	vaultKeys := &memoryVaultKeyRepository{keys: map[string]entity.VaultKey{}}
+	keyVault := service.NewKeyVaultService(vaultKeys, &memoryKeyUsageRepository{}, nil, nil, nil, SetUpMemoryDB())
+	userService := service.NewUserService(users, nil, nil, caService, keyVault, vaultKeys, nil, SetUpMemoryDB())
+	ctrl := controller.NewCertificateController(userService, caService)
+
+	r := SetUpRoutes()
+	r.POST("/api/certificates/csr", func(c *gin.Context) {
+		c.Set("user_id", user.ID.String())
+		ctrl.EnrollCSR(c)
+	})
+	enroll := func(csrPEM string) (int, dto.CertificateEnrollResponse, string) {
+		body, _ := json.Marshal(dto.CSREnrollRequest{CSR: csrPEM})
+		req, _ := http.NewRequest(http.MethodPost, "/api/certificates/csr", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var resp struct {
+			Data  dto.CertificateEnrollResponse `json:"data"`
+			Error string                        `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp.Data, resp.Error
+	}
+
+	key, err := pki.GenerateKey("ECDSA-P256")
+	require.NoError(t, err)
+
+	t.Run("valid CSR", func(t *testing.T) {
+		code, result, _ := enroll(newCSR(t, key, user.Name, user.Email))
+		require.Equal(t, http.StatusOK, code)
+
+		cert, err := pki.ParseCertificatePEM(result.CertPEM)
+		require.NoError(t, err)
+		assert.Equal(t, result.Serial, pki.SerialHex(cert))
+		assert.Equal(t, []string{user.Email}, cert.EmailAddresses)
+		assert.NoError(t, pki.MatchesCertificate(key, cert))
+		assert.Equal(t, result.CertPEM, users.users[user.ID.String()].CertPEM)
+	})
+
+	t.Run("subject or email of another user", func(t *testing.T) {
+		before := users.users[user.ID.String()].CertPEM
+		for _, csrPEM := range []string{
+			newCSR(t, key, user.Name, "mallory@example.com"),
+			newCSR(t, key, "mallory", user.Email),
+		} {
+			code, _, message := enroll(csrPEM)
+			assert.Equal(t, http.StatusBadRequest, code)
+			assert.Equal(t, dto.ErrCSRIdentityMismatch.Error(), message)
+		}
+		assert.Equal(t, before, users.users[user.ID.String()].CertPEM)
+	})
+
+	t.Run("bad CSR signature", func(t *testing.T) {
+		block, _ := pem.Decode([]byte(newCSR(t, key, user.Name, user.Email)))
+		// byte cuối nằm trong chữ ký, CSR vẫn parse được
+		block.Bytes[len(block.Bytes)-1] ^= 0xff
+		code, _, message := enroll(string(pem.EncodeToMemory(block)))
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, dto.ErrCSRSignatureInvalid.Error(), message)
+	})
+
+	t.Run("re-enrolling supersedes the previous certificate", func(t *testing.T) {
+		previous, err := pki.ParseCertificatePEM(users.users[user.ID.String()].CertPEM)
+		require.NoError(t, err)
+
+		newKey, err := pki.GenerateKey("ECDSA-P256")
+		require.NoError(t, err)
+		code, result, _ := enroll(newCSR(t, newKey, user.Name, user.Email))
+		require.Equal(t, http.StatusOK, code)
+
+		record, err := certs.FindBySerial(context.Background(), nil, pki.SerialHex(previous))
+		require.NoError(t, err)
+		assert.True(t, record.IsRevoked())
+		assert.Equal(t, ca.ReasonSuperseded, record.RevocationReason)
+
+		current, err := certs.FindBySerial(context.Background(), nil, result.Serial)
+		require.NoError(t, err)
+		assert.False(t, current.IsRevoked())
+
+		// CRL được phát hành lại ngay
+		der, err := caService.CRL(context.Background())
+		require.NoError(t, err)
+		crl, err := x509.ParseRevocationList(der)
+		require.NoError(t, err)
+		require.Len(t, crl.RevokedCertificateEntries, 1)
+		assert.Equal(t, 0, crl.RevokedCertificateEntries[0].SerialNumber.Cmp(previous.SerialNumber))
+		assert.Equal(t, ca.ReasonSuperseded, crl.RevokedCertificateEntries[0].ReasonCode)
+	})
+}
@@ -0,0 +1,251 @@
+package tests
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/ca"
+	"github.com/PhanPhuc2609/be-sign-file/cms"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func IssueTestCertificate(t *testing.T, authority *ca.Authority, keyType string) (crypto.Signer, *x509.Certificate) {
+	key, err := pki.GenerateKey(keyType)
+	require.NoError(t, err)
+	serial, err := ca.NewSerial()
+	require.NoError(t, err)
+
+	cert, err := authority.Issue(&x509.Certificate{
+		SerialNumber:   serial,
+		Subject:        pkix.Name{CommonName: "signer " + keyType},
+		EmailAddresses: []string{"signer@example.com"},
+		NotBefore:      time.Now().Add(-time.Minute),
+		NotAfter:       time.Now().AddDate(1, 0, 0),
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}, key.Public())
+	require.NoError(t, err)
+	return key, cert
+}
+
+func Test_CMS_SignDetachedRoundTrip(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	content := []byte("hop dong mua ban so 42\n")
+
+	for _, keyType := range []string{pki.KeyRSA2048, pki.KeyECDSAP256, pki.KeyECDSAP384, pki.KeyEd25519} {
+		t.Run(keyType, func(t *testing.T) {
+			key, cert := IssueTestCertificate(t, authority, keyType)
+			alg, err := pki.ResolveAlgorithm("", key.Public())
+			require.NoError(t, err)
+
+			signingTime := time.Now()
+			sd, err := cms.SignDetached(bytes.NewReader(content), cms.SignerConfig{
+				Signer:      key,
+				Certificate: cert,
+				Chain:       authority.Chain(),
+				Algorithm:   alg,
+				SigningTime: signingTime,
+			})
+			require.NoError(t, err)
+			der, err := sd.Marshal()
+			require.NoError(t, err)
+
+			parsed, err := cms.Parse(der)
+			require.NoError(t, err)
+			assert.True(t, parsed.Detached)
+			assert.Len(t, parsed.Certificates, 3)
+
+			signers, err := parsed.Verify(bytes.NewReader(content))
+			require.NoError(t, err)
+			assert.Equal(t, cert.Raw, signers[0].Raw)
+
+			at, ok := parsed.SignerInfos[0].SigningTime()
+			require.True(t, ok)
+			assert.Equal(t, signingTime.Unix(), at.Unix())
+
+			_, err = parsed.Verify(bytes.NewReader([]byte("hop dong mua ban so 43\n")))
+			assert.ErrorIs(t, err, cms.ErrDigestMismatch)
+
+			fromPEM, err := cms.ParsePEM(cms.EncodePEM(der))
+			require.NoError(t, err)
+			_, err = fromPEM.Verify(bytes.NewReader(content))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_CMS_UnsignedAttributesKeepSignature(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	key, cert := IssueTestCertificate(t, authority, pki.KeyECDSAP256)
+	alg, err := pki.ResolveAlgorithm("", key.Public())
+	require.NoError(t, err)
+
+	sd, err := cms.SignDetached(bytes.NewReader([]byte("data")), cms.SignerConfig{
+		Signer: key, Certificate: cert, Algorithm: alg,
+	})
+	require.NoError(t, err)
+
+	counter, err := cms.SignCounterSignature(sd.SignerInfos[0], cms.SignerConfig{
+		Signer: key, Certificate: cert, Algorithm: alg,
+	})
+	require.NoError(t, err)
+	counterDER, err := counter.Marshal()
+	require.NoError(t, err)
+	require.NoError(t, sd.SignerInfos[0].AddUnsignedAttribute(cms.OIDAttributeCounterSignature, counterDER))
+
+	der, err := sd.Marshal()
+	require.NoError(t, err)
+	parsed, err := cms.Parse(der)
+	require.NoError(t, err)
+
+	_, err = parsed.Verify(bytes.NewReader([]byte("data")))
+	require.NoError(t, err)
+
+	attr := parsed.SignerInfos[0].UnsignedAttribute(cms.OIDAttributeCounterSignature)
+	require.NotNil(t, attr)
+	parsedCounter, err := cms.ParseSignerInfo(attr.Values[0].FullBytes)
+	require.NoError(t, err)
+	_, err = cms.VerifyCounterSignature(parsedCounter, parsed.SignerInfos[0], parsed.Certificates)
+	assert.NoError(t, err)
+}
+
+func Test_CMS_NestedCounterSignatures(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	key, cert := IssueTestCertificate(t, authority, pki.KeyECDSAP256)
+	witnessKey, witnessCert := IssueTestCertificate(t, authority, pki.KeyRSA2048)
+	alg, err := pki.ResolveAlgorithm("", key.Public())
+	require.NoError(t, err)
+	witnessAlg, err := pki.ResolveAlgorithm("", witnessKey.Public())
+	require.NoError(t, err)
+
+	sd, err := cms.SignDetached(bytes.NewReader([]byte("data")), cms.SignerConfig{
+		Signer: key, Certificate: cert, Algorithm: alg,
+	})
+	require.NoError(t, err)
+	sd.Certificates = append(sd.Certificates, witnessCert)
+	root := sd.SignerInfos[0]
+
+	// witness countersigns the signer, the signer countersigns the witness
+	witness, err := cms.SignCounterSignature(root, cms.SignerConfig{
+		Signer: witnessKey, Certificate: witnessCert, Algorithm: witnessAlg,
+	})
+	require.NoError(t, err)
+	found, err := root.AttachCounterSignature(root.Signature, witness)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	manager, err := cms.SignCounterSignature(witness, cms.SignerConfig{
+		Signer: key, Certificate: cert, Algorithm: alg,
+	})
+	require.NoError(t, err)
+	found, err = root.AttachCounterSignature(witness.Signature, manager)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	found, err = root.AttachCounterSignature([]byte("unknown"), manager)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	der, err := sd.Marshal()
+	require.NoError(t, err)
+	parsed, err := cms.Parse(der)
+	require.NoError(t, err)
+	_, err = parsed.Verify(bytes.NewReader([]byte("data")))
+	require.NoError(t, err)
+
+	level1, err := parsed.SignerInfos[0].CounterSignatures()
+	require.NoError(t, err)
+	require.Len(t, level1, 1)
+	signer, err := cms.VerifyCounterSignature(level1[0], parsed.SignerInfos[0], parsed.Certificates)
+	require.NoError(t, err)
+	assert.True(t, signer.Equal(witnessCert))
+
+	level2, err := level1[0].CounterSignatures()
+	require.NoError(t, err)
+	require.Len(t, level2, 1)
+	signer, err = cms.VerifyCounterSignature(level2[0], level1[0], parsed.Certificates)
+	require.NoError(t, err)
+	assert.True(t, signer.Equal(cert))
+
+	// a countersignature does not cover a different parent
+	_, err = cms.VerifyCounterSignature(level2[0], parsed.SignerInfos[0], parsed.Certificates)
+	assert.Error(t, err)
+}
+
+// Test_CMS_OpenSSLVerify checks that the .p7s output is understood by
+// openssl cms -verify, skipped when openssl is not installed.
+func Test_CMS_OpenSSLVerify(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+	_, authority := SetUpTestCA(t)
+	dir := t.TempDir()
+	content := []byte("%PDF-1.7 not really\n")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "root.pem"), []byte(pki.EncodeCertificatePEM(authority.Root.Raw)), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "content.bin"), content, 0600))
+
+	for _, keyType := range []string{pki.KeyRSA2048, pki.KeyECDSAP256} {
+		key, cert := IssueTestCertificate(t, authority, keyType)
+		alg, err := pki.ResolveAlgorithm("", key.Public())
+		require.NoError(t, err)
+
+		sd, err := cms.SignDetached(bytes.NewReader(content), cms.SignerConfig{
+			Signer: key, Certificate: cert, Chain: authority.Chain(), Algorithm: alg, SigningTime: time.Now(),
+		})
+		require.NoError(t, err)
+		der, err := sd.Marshal()
+		require.NoError(t, err)
+
+		p7s := filepath.Join(dir, keyType+".p7s")
+		require.NoError(t, os.WriteFile(p7s, der, 0600))
+
+		out, err := exec.Command("openssl", "cms", "-verify", "-binary", "-inform", "DER",
+			"-in", p7s, "-content", filepath.Join(dir, "content.bin"),
+			"-CAfile", filepath.Join(dir, "root.pem"), "-purpose", "any", "-out", os.DevNull).CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+}
+
+func Test_CMS_AttachedContentOpenSSLVerify(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+	_, authority := SetUpTestCA(t)
+	dir := t.TempDir()
+	report := []byte(`{"report_id":"r-1","verdict":"valid"}`)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "root.pem"), []byte(pki.EncodeCertificatePEM(authority.Root.Raw)), 0600))
+
+	key, cert := IssueTestCertificate(t, authority, pki.KeyRSA2048)
+	alg, err := pki.ResolveAlgorithm(pki.AlgRSASHA256, key.Public())
+	require.NoError(t, err)
+	sd, err := cms.SignContent(cms.OIDData, report, cms.SignerConfig{
+		Signer: key, Certificate: cert, Chain: authority.Chain(), Algorithm: alg, SigningTime: time.Now(),
+	})
+	require.NoError(t, err)
+	der, err := sd.Marshal()
+	require.NoError(t, err)
+
+	parsed, err := cms.Parse(der)
+	require.NoError(t, err)
+	assert.Equal(t, report, parsed.Content)
+
+	p7m := filepath.Join(dir, "report.p7m")
+	out := filepath.Join(dir, "report.json")
+	require.NoError(t, os.WriteFile(p7m, der, 0600))
+	msg, err := exec.Command("openssl", "cms", "-verify", "-binary", "-inform", "DER", "-in", p7m,
+		"-CAfile", filepath.Join(dir, "root.pem"), "-purpose", "any", "-out", out).CombinedOutput()
+	require.NoError(t, err, string(msg))
+	extracted, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, report, extracted)
+}
@@ -1,8 +1,12 @@
 package tests
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/PhanPhuc2609/be-sign-file/constants"
@@ -49,6 +53,101 @@ func SetUpDatabaseConnection() *gorm.DB {
 	return db
 }
 
+// memoryConnPool lets services backed by in-memory repositories open
+// transactions without a database: BEGIN and COMMIT do nothing and any
+// query fails.
+type memoryConnPool struct{}
+
+// memoryTx is a transaction of memoryConnPool. Rows locked through
+// memoryRowLocks stay locked until it commits or rolls back.
+type memoryTx struct {
+	memoryConnPool
+	mu     sync.Mutex
+	locked map[*sync.Mutex]bool
+}
+
+var errMemoryDB = errors.New("no database in memory tests")
+
+func (p *memoryConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errMemoryDB
+}
+
+func (p *memoryConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, errMemoryDB
+}
+
+func (p *memoryConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errMemoryDB
+}
+
+func (p *memoryConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func (p *memoryConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return &memoryTx{locked: map[*sync.Mutex]bool{}}, nil
+}
+
+func (t *memoryTx) Commit() error   { t.unlock(); return nil }
+func (t *memoryTx) Rollback() error { t.unlock(); return nil }
+
+func (t *memoryTx) unlock() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for row := range t.locked {
+		row.Unlock()
+	}
+	t.locked = map[*sync.Mutex]bool{}
+}
+
+// memoryRowLocks emulates SELECT ... FOR UPDATE for in-memory repositories:
+// a row locked in a transaction of SetUpMemoryDB blocks the other
+// transactions locking it until the first one ends.
+type memoryRowLocks struct {
+	mu   sync.Mutex
+	rows map[interface{}]*sync.Mutex
+}
+
+func (l *memoryRowLocks) lock(tx *gorm.DB, id interface{}) {
+	if tx == nil {
+		return
+	}
+	t, ok := tx.Statement.ConnPool.(*memoryTx)
+	if !ok {
+		return
+	}
+
+	l.mu.Lock()
+	if l.rows == nil {
+		l.rows = map[interface{}]*sync.Mutex{}
+	}
+	row, ok := l.rows[id]
+	if !ok {
+		row = &sync.Mutex{}
+		l.rows[id] = row
+	}
+	l.mu.Unlock()
+
+	t.mu.Lock()
+	held := t.locked[row]
+	t.mu.Unlock()
+	if held {
+		return
+	}
+	row.Lock()
+	t.mu.Lock()
+	t.locked[row] = true
+	t.mu.Unlock()
+}
+
+func SetUpMemoryDB() *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: &memoryConnPool{}}), &gorm.Config{})
+	if err != nil {
+		panic("Failed to open memory database: " + err.Error())
+	}
+	return db
+}
+
 func Test_DBConnection(t *testing.T) {
 	db := SetUpDatabaseConnection()
 	assert.NoError(t, db.Error, "Expected no error during database connection")
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/migrations"
+	"github.com/PhanPhuc2609/be-sign-file/repository"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_Document_BlobDedupe(t *testing.T) {
+	db := SetUpDatabaseConnection()
+	require.NoError(t, migrations.Migrate(db))
+	ctx := context.Background()
+	root := t.TempDir()
+	docService := service.NewDocumentService(repository.NewDocumentRepository(db), repository.NewCertificateRepository(db),
+		repository.NewBlobRepository(db), nil, storage.NewLocal(root), config.DocumentConfig{}, db)
+
+	run := time.Now().UnixNano()
+	var users []entity.User
+	for i := 0; i < 2; i++ {
+		user := entity.User{Name: "blob", Email: fmt.Sprintf("blob%d-%d@gmail.com", i, run), Password: "password123"}
+		require.NoError(t, db.Create(&user).Error)
+		users = append(users, user)
+	}
+
+	// hai người dùng tải lên hai file cùng tên, cùng nội dung
+	content := fmt.Sprintf("hợp đồng %d", run)
+	first, err := docService.UploadDocument(ctx, users[0].ID.String(), "hop-dong.pdf", strings.NewReader(content))
+	require.NoError(t, err)
+	second, err := docService.UploadDocument(ctx, users[1].ID.String(), "../hop-dong.pdf", strings.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, "hop-dong.pdf", second.FileName)
+	assert.Equal(t, first.Digest, second.Digest)
+	assert.Equal(t, first.FilePath, second.FilePath)
+	assert.True(t, strings.HasSuffix(first.FilePath, "/"+first.Digest))
+
+	var blob entity.Blob
+	require.NoError(t, db.First(&blob, "digest = ?", first.Digest).Error)
+	assert.Equal(t, int64(2), blob.RefCount)
+	assert.Equal(t, int64(len(content)), blob.Size)
+
+	// cùng tên, khác nội dung: không ghi đè file của người khác
+	other, err := docService.UploadDocument(ctx, users[1].ID.String(), "hop-dong.pdf", strings.NewReader(content+" v2"))
+	require.NoError(t, err)
+	assert.NotEqual(t, first.FilePath, other.FilePath)
+	stored, err := os.ReadFile(filepath.Join(root, first.FilePath))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(stored))
+
+	// chỉ xóa hẳn các tài liệu của test này
+	purge := func(doc entity.Document) {
+		require.NoError(t, docService.DeleteDocument(ctx, doc.UserID, doc.ID))
+		require.NoError(t, db.Unscoped().Model(&entity.Document{}).Where("id = ?", doc.ID).Update("deleted_at", time.Unix(0, 0)).Error)
+		purged, err := docService.PurgeDocuments(ctx, time.Unix(1, 0))
+		require.NoError(t, err)
+		assert.Equal(t, 1, purged)
+	}
+
+	purge(first)
+	require.NoError(t, db.First(&blob, "digest = ?", first.Digest).Error)
+	assert.Equal(t, int64(1), blob.RefCount)
+	_, err = os.Stat(filepath.Join(root, second.FilePath))
+	assert.NoError(t, err)
+	file, err := docService.OpenDocumentFile(ctx, users[1].ID.String(), second.ID, false)
+	require.NoError(t, err)
+	file.Content.Close()
+
+	purge(second)
+	err = db.First(&blob, "digest = ?", first.Digest).Error
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = os.Stat(filepath.Join(root, second.FilePath))
+	assert.True(t, os.IsNotExist(err))
+
+	purge(other)
+}
+
+// memoryBlobRepository lists blobs kept in a slice instead of the database.
+type memoryBlobRepository struct {
+	repository.BlobRepository
+	blobs []entity.Blob
+}
+
+func (r *memoryBlobRepository) FindReferenced(ctx context.Context, tx *gorm.DB) ([]entity.Blob, error) {
+	return r.blobs, nil
+}
+
+func Test_Document_CheckBlobs(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocal(t.TempDir())
+	blobs := &memoryBlobRepository{}
+	put := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		digest := hex.EncodeToString(sum[:])
+		require.NoError(t, store.Put(ctx, service.BLOB_DIR+"/"+digest[:2]+"/"+digest, strings.NewReader(content)))
+		blobs.blobs = append(blobs.blobs, entity.Blob{Digest: digest, Size: int64(len(content)), RefCount: 1})
+		return digest
+	}
+	put("hợp đồng")
+	tampered := put("phụ lục")
+	missing := put("biên bản")
+
+	digest := tampered
+	require.NoError(t, store.Put(ctx, service.BLOB_DIR+"/"+digest[:2]+"/"+digest, strings.NewReader("phụ lục đã sửa")))
+	require.NoError(t, store.Delete(ctx, service.BLOB_DIR+"/"+missing[:2]+"/"+missing))
+
+	docService := service.NewDocumentService(nil, nil, blobs, nil, store, config.DocumentConfig{}, nil)
+	corrupted, err := docService.CheckBlobs(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{tampered, missing}, corrupted)
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/controller"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/repository"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// memoryDocumentRepository keeps documents in a map; deleted ones are
+// removed from it. Besides the owner, readers decides who may access a
+// document, it stands for the signature and participant lookups of the
+// database repository.
+type memoryDocumentRepository struct {
+	repository.DocumentRepository
+	mu      sync.Mutex
+	rows    memoryRowLocks
+	docs    map[uint]entity.Document
+	readers func(docID uint, userID string) bool
+}
+
+func (r *memoryDocumentRepository) FindByID(ctx context.Context, tx *gorm.DB, id uint) (entity.Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	doc, ok := r.docs[id]
+	if !ok {
+		return entity.Document{}, gorm.ErrRecordNotFound
+	}
+	return doc, nil
+}
+
+func (r *memoryDocumentRepository) LockByID(ctx context.Context, tx *gorm.DB, id uint) (entity.Document, error) {
+	r.rows.lock(tx, id)
+	return r.FindByID(ctx, tx, id)
+}
+
+func (r *memoryDocumentRepository) Update(ctx context.Context, tx *gorm.DB, doc entity.Document) (entity.Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.docs[doc.ID] = doc
+	return doc, nil
+}
+
+func (r *memoryDocumentRepository) CanAccess(ctx context.Context, tx *gorm.DB, docID uint, userID string) (bool, error) {
+	doc, err := r.FindByID(ctx, tx, docID)
+	if err != nil {
+		return false, nil
+	}
+	return doc.UserID == userID || (r.readers != nil && r.readers(docID, userID)), nil
+}
+
+func (r *memoryDocumentRepository) Delete(ctx context.Context, tx *gorm.DB, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.docs, id)
+	return nil
+}
+
+func Test_Document_DeleteOwnerOnly(t *testing.T) {
+	docs := &memoryDocumentRepository{docs: map[uint]entity.Document{
+		1: {ID: 1, UserID: "owner"},
+	}}
+	docService := service.NewDocumentService(docs, nil, nil, nil, nil, config.DocumentConfig{}, nil)
+	ctrl := controller.NewDocumentController(docService, config.NewUploadConfig())
+
+	r := SetUpRoutes()
+	as := func(userID string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			if userID != "" {
+				c.Set("user_id", userID)
+			}
+		}
+	}
+	r.DELETE("/anonymous/:id", as(""), ctrl.DeleteDocument)
+	r.DELETE("/other/:id", as("other"), ctrl.DeleteDocument)
+	r.DELETE("/owner/:id", as("owner"), ctrl.DeleteDocument)
+	del := func(url string) int {
+		req, _ := http.NewRequest(http.MethodDelete, url, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, del("/anonymous/1"))
+	// tài liệu của người khác được báo như không tồn tại
+	assert.Equal(t, http.StatusNotFound, del("/other/1"))
+	assert.Contains(t, docs.docs, uint(1))
+
+	assert.Equal(t, http.StatusOK, del("/owner/1"))
+	assert.NotContains(t, docs.docs, uint(1))
+	assert.Equal(t, http.StatusNotFound, del("/owner/1"))
+}
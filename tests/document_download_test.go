@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/controller"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileDocumentService serves one file from disk as the original of every
+// document; the other methods are not used by the download handlers.
+type fileDocumentService struct {
+	service.DocumentService
+	path string
+}
+
+func (s fileDocumentService) OpenDocumentFile(ctx context.Context, userID string, id uint, signed bool) (dto.DocumentFile, error) {
+	if signed {
+		return dto.DocumentFile{}, dto.ErrSignedFileNotFound
+	}
+	file, err := os.Open(s.path)
+	if err != nil {
+		return dto.DocumentFile{}, err
+	}
+	return dto.DocumentFile{
+		Content: file, Name: "hợp đồng.pdf", ContentType: "application/pdf",
+		ModTime: time.Unix(1700000000, 0), Size: 16, Digest: "d1g3st",
+	}, nil
+}
+
+func Test_DocumentDownload_RangeAndETag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.pdf")
+	require.NoError(t, os.WriteFile(path, []byte("0123456789abcdef"), 0600))
+
+	ctrl := controller.NewDocumentController(fileDocumentService{path: path}, config.NewUploadConfig())
+	r := SetUpRoutes()
+	login := func(c *gin.Context) { c.Set("user_id", "user") }
+	r.GET("/api/documents/:id/content", login, ctrl.DownloadContent)
+	r.GET("/api/documents/:id/signed", login, ctrl.DownloadSigned)
+
+	get := func(url string, header map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/api/documents/1/content", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, `"d1g3st"`, w.Header().Get("ETag"))
+	assert.Equal(t, "attachment; filename*=utf-8''h%E1%BB%A3p%20%C4%91%E1%BB%93ng.pdf", w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "0123456789abcdef", w.Body.String())
+
+	w = get("/api/documents/1/content", map[string]string{"Range": "bytes=4-7"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 4-7/16", w.Header().Get("Content-Range"))
+	assert.Equal(t, "4567", w.Body.String())
+
+	w = get("/api/documents/1/content", map[string]string{"If-None-Match": `"d1g3st"`})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// ETag khác: trả toàn bộ file thay vì một đoạn
+	w = get("/api/documents/1/content", map[string]string{"Range": "bytes=4-7", "If-Range": `"old"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 16, w.Body.Len())
+
+	w = get("/api/documents/1/signed", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
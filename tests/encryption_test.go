@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/keyring"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryDataKeyRepository keeps data keys in a map instead of the database.
+type memoryDataKeyRepository struct {
+	dataKeys map[string]entity.DataKey
+}
+
+func (r *memoryDataKeyRepository) Create(ctx context.Context, tx *gorm.DB, dataKey entity.DataKey) (entity.DataKey, error) {
+	r.dataKeys[dataKey.ID] = dataKey
+	return dataKey, nil
+}
+
+func (r *memoryDataKeyRepository) FindByID(ctx context.Context, tx *gorm.DB, id string) (entity.DataKey, error) {
+	dataKey, ok := r.dataKeys[id]
+	if !ok {
+		return entity.DataKey{}, gorm.ErrRecordNotFound
+	}
+	return dataKey, nil
+}
+
+func (r *memoryDataKeyRepository) FindNotWrappedBy(ctx context.Context, tx *gorm.DB, masterKeyID string, limit int) ([]entity.DataKey, error) {
+	var dataKeys []entity.DataKey
+	for _, dataKey := range r.dataKeys {
+		if dataKey.MasterKeyID != masterKeyID && len(dataKeys) < limit {
+			dataKeys = append(dataKeys, dataKey)
+		}
+	}
+	return dataKeys, nil
+}
+
+func (r *memoryDataKeyRepository) Rewrap(ctx context.Context, tx *gorm.DB, dataKey entity.DataKey) error {
+	if _, ok := r.dataKeys[dataKey.ID]; ok {
+		r.dataKeys[dataKey.ID] = dataKey
+	}
+	return nil
+}
+
+func (r *memoryDataKeyRepository) Delete(ctx context.Context, tx *gorm.DB, id string) error {
+	delete(r.dataKeys, id)
+	return nil
+}
+
+func newMasterKey(t *testing.T) string {
+	key := make([]byte, keyring.MASTER_KEY_SIZE)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func newEncryptedStorage(t *testing.T, root string, repo *memoryDataKeyRepository, cfg config.EncryptionConfig) (storage.Storage, service.EncryptionService) {
+	keys, err := keyring.New(cfg)
+	require.NoError(t, err)
+	encryptionService := service.NewEncryptionService(repo, keys)
+	return storage.NewEncrypted(storage.NewLocal(root), encryptionService, cfg.AllowPlaintext, service.UPLOAD_DIR+"/"), encryptionService
+}
+
+func Test_Storage_Encrypted(t *testing.T) {
+	root := t.TempDir()
+	repo := &memoryDataKeyRepository{dataKeys: map[string]entity.DataKey{}}
+	store, _ := newEncryptedStorage(t, root, repo, config.EncryptionConfig{MasterKey: newMasterKey(t)})
+	testStorageRoundTrip(t, store)
+	// khóa của object đã ghi đè và đã xóa không còn
+	assert.Empty(t, repo.dataKeys)
+
+	ctx := context.Background()
+	content := []byte(strings.Repeat("hợp đồng mua bán ", 8000))
+	require.NoError(t, store.Put(ctx, "uploads/contract.pdf", bytes.NewReader(content)))
+	require.Len(t, repo.dataKeys, 1)
+	raw, err := os.ReadFile(filepath.Join(root, "uploads", "contract.pdf"))
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(raw, []byte("hợp đồng")))
+	info, err := store.Stat(ctx, "uploads/contract.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size)
+
+	// nội dung đúng bằng hai đoạn và nội dung rỗng
+	for _, size := range []int{2 << 16, 0} {
+		require.NoError(t, store.Put(ctx, "uploads/exact", bytes.NewReader(content[:size])))
+		object, err := store.Get(ctx, "uploads/exact")
+		require.NoError(t, err)
+		all, err := io.ReadAll(object)
+		object.Close()
+		require.NoError(t, err)
+		assert.Equal(t, content[:size], all)
+	}
+
+	// object không mã hóa (thay vào bucket hoặc lưu trước khi bật mã hóa)
+	// bị từ chối; assets không bị mã hóa
+	require.NoError(t, os.WriteFile(filepath.Join(root, "uploads", "legacy.txt"), []byte("plain"), 0644))
+	_, err = store.Get(ctx, "uploads/legacy.txt")
+	assert.ErrorIs(t, err, storage.ErrUnencryptedObject)
+	_, err = store.Stat(ctx, "uploads/legacy.txt")
+	assert.ErrorIs(t, err, storage.ErrUnencryptedObject)
+	require.NoError(t, store.Put(ctx, "assets/a.png", strings.NewReader("png")))
+	raw, err = os.ReadFile(filepath.Join(root, "assets", "a.png"))
+	require.NoError(t, err)
+	assert.Equal(t, "png", string(raw))
+
+	// file bị sửa hoặc bị cắt bớt không giải mã được
+	path := filepath.Join(root, "uploads", "contract.pdf")
+	raw, _ = os.ReadFile(path)
+	tampered := append([]byte(nil), raw...)
+	tampered[len(tampered)/2] ^= 1
+	require.NoError(t, os.WriteFile(path, tampered, 0644))
+	object, err := store.Get(ctx, "uploads/contract.pdf")
+	require.NoError(t, err)
+	_, err = io.ReadAll(object)
+	object.Close()
+	assert.ErrorIs(t, err, storage.ErrCorruptObject)
+	require.NoError(t, os.WriteFile(path, raw[:len(raw)-sealedTail(len(content))], 0644))
+	object, err = store.Get(ctx, "uploads/contract.pdf")
+	if err == nil {
+		_, err = io.ReadAll(object)
+		object.Close()
+	}
+	assert.ErrorIs(t, err, storage.ErrCorruptObject)
+}
+
+func Test_Storage_EncryptedAllowPlaintext(t *testing.T) {
+	root := t.TempDir()
+	repo := &memoryDataKeyRepository{dataKeys: map[string]entity.DataKey{}}
+	store, _ := newEncryptedStorage(t, root, repo, config.EncryptionConfig{MasterKey: newMasterKey(t), AllowPlaintext: true})
+	ctx := context.Background()
+
+	// trong lúc chuyển đổi, file lưu trước khi bật mã hóa vẫn đọc được
+	path := filepath.Join(root, "uploads", "legacy.txt")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("plain"), 0644))
+	object, err := store.Get(ctx, "uploads/legacy.txt")
+	require.NoError(t, err)
+	all, _ := io.ReadAll(object)
+	object.Close()
+	assert.Equal(t, "plain", string(all))
+
+	// ghi lại thì được mã hóa
+	require.NoError(t, store.Put(ctx, "uploads/legacy.txt", strings.NewReader("plain")))
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "plain")
+	assert.Len(t, repo.dataKeys, 1)
+}
+
+// sealedTail is the size of the last sealed segment of content of size n,
+// cutting it off leaves whole segments.
+func sealedTail(n int) int {
+	return n%(64<<10) + 16
+}
+
+func Test_Storage_EncryptedRotateMasterKey(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	repo := &memoryDataKeyRepository{dataKeys: map[string]entity.DataKey{}}
+	oldKey, newKey := newMasterKey(t), newMasterKey(t)
+	store, _ := newEncryptedStorage(t, root, repo, config.EncryptionConfig{MasterKey: oldKey})
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, store.Put(ctx, "uploads/"+name, strings.NewReader("content "+name)))
+	}
+	before, err := os.ReadFile(filepath.Join(root, "uploads", "a"))
+	require.NoError(t, err)
+
+	// master key mới, master key cũ chỉ còn để mở các khóa chưa xoay vòng
+	keyFile := filepath.Join(t.TempDir(), "master.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(newKey+"\n"), 0600))
+	store, encryptionService := newEncryptedStorage(t, root, repo, config.EncryptionConfig{MasterKeyFile: keyFile, PreviousMasterKeys: []string{oldKey}})
+	require.NoError(t, store.Put(ctx, "uploads/d", strings.NewReader("content d")))
+	rotated, err := encryptionService.RotateMasterKey(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, rotated)
+	rotated, err = encryptionService.RotateMasterKey(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, rotated)
+
+	// file không bị mã hóa lại, chỉ khóa được bọc lại
+	after, err := os.ReadFile(filepath.Join(root, "uploads", "a"))
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	store, _ = newEncryptedStorage(t, root, repo, config.EncryptionConfig{MasterKey: newKey})
+	for _, name := range []string{"a", "b", "c", "d"} {
+		object, err := store.Get(ctx, "uploads/"+name)
+		require.NoError(t, err)
+		all, _ := io.ReadAll(object)
+		object.Close()
+		assert.Equal(t, "content "+name, string(all))
+	}
+
+	// không có master key cũ thì khóa chưa xoay vòng không mở được
+	store, _ = newEncryptedStorage(t, root, repo, config.EncryptionConfig{MasterKey: oldKey})
+	_, err = store.Get(ctx, "uploads/a")
+	assert.ErrorIs(t, err, keyring.ErrUnknownMasterKey)
+
+	_, err = keyring.New(config.EncryptionConfig{})
+	assert.ErrorIs(t, err, keyring.ErrNoMasterKey)
+	_, err = keyring.New(config.EncryptionConfig{MasterKey: base64.StdEncoding.EncodeToString([]byte("short"))})
+	assert.Error(t, err)
+}
@@ -0,0 +1,308 @@
+package tests
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/ca"
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/hsm"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryKeyStore stands in for a PKCS#11 token, with keys held in a map.
+type memoryKeyStore struct {
+	keys map[string]crypto.Signer
+}
+
+// tokenKey hides the type of the key like a key in a token: the vault cannot
+// wipe it after use.
+type tokenKey struct {
+	crypto.Signer
+}
+
+func newMemoryKeyStore() *memoryKeyStore {
+	return &memoryKeyStore{keys: map[string]crypto.Signer{}}
+}
+
+func (s *memoryKeyStore) GenerateKey(id string, keyType string) (crypto.Signer, error) {
+	if _, ok := s.keys[id]; ok {
+		return nil, hsm.ErrKeyExists
+	}
+	key, err := pki.GenerateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+	s.keys[id] = tokenKey{key}
+	return s.keys[id], nil
+}
+
+func (s *memoryKeyStore) FindKey(id string) (crypto.Signer, error) {
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, hsm.ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *memoryKeyStore) DeleteKey(id string) error {
+	if _, ok := s.keys[id]; !ok {
+		return hsm.ErrKeyNotFound
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+func testKeyStoreCA(t *testing.T, keys hsm.KeyStore) {
+	// khóa nằm trong key store: không cần CA_PASSPHRASE, không có file khóa
+	cfg := config.CAConfig{Dir: t.TempDir(), Name: "Test"}
+	created, err := ca.Init(cfg, keys)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(cfg.Dir, "root.key"))
+	assert.NoFileExists(t, filepath.Join(cfg.Dir, "issuing.key"))
+
+	authority, err := ca.Load(cfg, keys)
+	require.NoError(t, err)
+	assert.Equal(t, created.Issuing.Raw, authority.Issuing.Raw)
+	_, err = ca.Load(cfg, nil)
+	assert.ErrorIs(t, err, ca.ErrMissingPassphrase)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := ca.NewSerial()
+	require.NoError(t, err)
+	cert, err := authority.Issue(&x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "user"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, &key.PublicKey)
+	require.NoError(t, err)
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	roots.AddCert(authority.Root)
+	intermediates.AddCert(authority.Issuing)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	assert.NoError(t, err)
+
+	// service identity: chỉ ghi chứng chỉ, khóa nằm trong key store
+	serial, err = ca.NewSerial()
+	require.NoError(t, err)
+	identityKey, err := ca.NewServiceIdentityKey(keys, ca.IdentityTSA, serial)
+	require.NoError(t, err)
+	identityCert, err := authority.Issue(&x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "tsa"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, identityKey.Public())
+	require.NoError(t, err)
+	require.NoError(t, ca.SaveServiceIdentity(cfg, keys, ca.IdentityTSA, &ca.ServiceIdentity{Certificate: identityCert, Key: identityKey}))
+	assert.NoFileExists(t, filepath.Join(cfg.Dir, ca.IdentityTSA+".key"))
+
+	identity, err := ca.LoadServiceIdentity(cfg, keys, ca.IdentityTSA)
+	require.NoError(t, err)
+	assert.Equal(t, identityCert.Raw, identity.Certificate.Raw)
+	assert.NoError(t, pki.MatchesCertificate(identity.Key, identityCert))
+}
+
+func Test_CA_KeyStore(t *testing.T) {
+	keys := newMemoryKeyStore()
+	testKeyStoreCA(t, keys)
+	assert.Contains(t, keys.keys, ca.RootKeyID)
+	assert.Contains(t, keys.keys, ca.IssuingKeyID)
+
+	// identity mất khóa trong key store thì được cấp lại
+	keys = newMemoryKeyStore()
+	cfg := config.CAConfig{Dir: t.TempDir(), Name: "Test"}
+	authority, err := ca.Init(cfg, keys)
+	require.NoError(t, err)
+	serial, err := ca.NewSerial()
+	require.NoError(t, err)
+	identityKey, err := ca.NewServiceIdentityKey(keys, ca.IdentityOCSP, serial)
+	require.NoError(t, err)
+	identityCert, err := authority.Issue(&x509.Certificate{
+		SerialNumber: serial,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, identityKey.Public())
+	require.NoError(t, err)
+	require.NoError(t, ca.SaveServiceIdentity(cfg, keys, ca.IdentityOCSP, &ca.ServiceIdentity{Certificate: identityCert, Key: identityKey}))
+	for id := range keys.keys {
+		if strings.HasPrefix(id, "ca-"+ca.IdentityOCSP) {
+			require.NoError(t, keys.DeleteKey(id))
+		}
+	}
+	_, err = ca.LoadServiceIdentity(cfg, keys, ca.IdentityOCSP)
+	assert.ErrorIs(t, err, ca.ErrIdentityNotFound)
+
+	// khóa issuing trong key store phải khớp chứng chỉ
+	other := newMemoryKeyStore()
+	_, err = other.GenerateKey(ca.IssuingKeyID, pki.KeyRSA2048)
+	require.NoError(t, err)
+	_, err = ca.Load(cfg, other)
+	assert.ErrorIs(t, err, pki.ErrKeyMismatch)
+}
+
+func testKeyStoreVault(t *testing.T, keys hsm.KeyStore, keyType string) {
+	ctx := context.Background()
+	vaultKeys := &memoryVaultKeyRepository{keys: map[string]entity.VaultKey{}}
+	usages := &memoryKeyUsageRepository{}
+	vault := service.NewKeyVaultService(vaultKeys, usages, nil, nil, keys, SetUpMemoryDB())
+	user := entity.User{ID: uuid.New()}
+
+	_, _, err := vault.CreateKey(user.ID.String(), keyType, config.KEY_BACKEND_PKCS11, "correct horse")
+	assert.ErrorIs(t, err, dto.ErrKeyPINNotSupported)
+
+	vaultKey, pub, err := vault.CreateKey(user.ID.String(), keyType, config.KEY_BACKEND_PKCS11, "")
+	require.NoError(t, err)
+	assert.Equal(t, constants.ENUM_KEY_PROTECTION_PKCS11, vaultKey.Protection)
+	assert.Empty(t, vaultKey.EncryptedKey)
+	vaultKeys.Create(ctx, nil, vaultKey)
+
+	signer, release, err := vault.UnlockKey(ctx, user, "", constants.ENUM_KEY_USAGE_SIGN_DOCUMENT, "document:1")
+	require.NoError(t, err)
+	alg, err := pki.ResolveAlgorithm("", pub)
+	require.NoError(t, err)
+	signature, err := alg.Sign(signer, []byte("hello"))
+	require.NoError(t, err)
+	assert.NoError(t, alg.Verify(pub, []byte("hello"), signature))
+	release()
+
+	require.Len(t, usages.usages, 1)
+	assert.Equal(t, vaultKey.ID, usages.usages[0].KeyID)
+	assert.True(t, usages.usages[0].Success)
+
+	// khóa đã xóa khỏi token không dùng được nữa, lần thử vẫn được ghi nhật ký
+	require.NoError(t, vault.DestroyKey(vaultKey))
+	_, err = keys.FindKey(vaultKey.ID)
+	assert.ErrorIs(t, err, hsm.ErrKeyNotFound)
+	_, _, err = vault.UnlockKey(ctx, user, "", constants.ENUM_KEY_USAGE_SIGN_DOCUMENT, "document:2")
+	assert.ErrorIs(t, err, hsm.ErrKeyNotFound)
+	require.Len(t, usages.usages, 2)
+	assert.False(t, usages.usages[1].Success)
+}
+
+func Test_KeyVault_PKCS11(t *testing.T) {
+	testKeyStoreVault(t, newMemoryKeyStore(), pki.KeyECDSAP256)
+
+	// không cấu hình token
+	ctx := context.Background()
+	vaultKeys := &memoryVaultKeyRepository{keys: map[string]entity.VaultKey{}}
+	vault := service.NewKeyVaultService(vaultKeys, &memoryKeyUsageRepository{}, nil, nil, nil, SetUpMemoryDB())
+	user := entity.User{ID: uuid.New()}
+	_, _, err := vault.CreateKey(user.ID.String(), pki.KeyECDSAP256, config.KEY_BACKEND_PKCS11, "")
+	assert.ErrorIs(t, err, dto.ErrKeyBackendUnavailable)
+	vaultKeys.Create(ctx, nil, entity.VaultKey{ID: uuid.NewString(), UserID: user.ID.String(), Protection: constants.ENUM_KEY_PROTECTION_PKCS11})
+	_, _, err = vault.UnlockKey(ctx, user, "", constants.ENUM_KEY_USAGE_SIGN_DOCUMENT, "")
+	assert.ErrorIs(t, err, dto.ErrKeyBackendUnavailable)
+
+	// backend software vẫn sinh khóa trong process và bọc bằng PIN
+	vaultKey, _, err := vault.CreateKey(user.ID.String(), pki.KeyEd25519, config.KEY_BACKEND_SOFTWARE, "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, constants.ENUM_KEY_PROTECTION_PIN, vaultKey.Protection)
+	assert.NoError(t, vault.DestroyKey(vaultKey))
+}
+
+// openSoftHSM initializes a fresh SoftHSM2 token. It runs when
+// SOFTHSM2_MODULE is the path of libsofthsm2.so, e.g.
+// /usr/lib/softhsm/libsofthsm2.so, and softhsm2-util is installed.
+func openSoftHSM(t *testing.T) *hsm.Token {
+	module := os.Getenv("SOFTHSM2_MODULE")
+	if module == "" {
+		t.Skip("SOFTHSM2_MODULE is not set")
+	}
+	util, err := exec.LookPath("softhsm2-util")
+	if err != nil {
+		t.Skip("softhsm2-util is not installed")
+	}
+
+	dir := t.TempDir()
+	tokens := filepath.Join(dir, "tokens")
+	require.NoError(t, os.Mkdir(tokens, 0700))
+	conf := filepath.Join(dir, "softhsm2.conf")
+	require.NoError(t, os.WriteFile(conf, []byte("directories.tokendir = "+tokens+"\nobjectstore.backend = file\n"), 0600))
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	out, err := exec.Command(util, "--init-token", "--free", "--label", "be-sign-file", "--pin", "123456", "--so-pin", "12345678").CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	token, err := hsm.Open(config.PKCS11Config{Module: module, TokenLabel: "be-sign-file", PIN: "123456"})
+	if errors.Is(err, hsm.ErrUnsupported) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { token.Close() })
+	return token
+}
+
+func Test_HSM_SoftHSM(t *testing.T) {
+	token := openSoftHSM(t)
+
+	for keyType, algorithms := range map[string][]string{
+		pki.KeyRSA2048:   {pki.AlgRSASHA256, pki.AlgRSAPSSSHA256},
+		pki.KeyECDSAP256: {pki.AlgECDSASHA256},
+		pki.KeyECDSAP384: {pki.AlgECDSASHA384},
+	} {
+		key, err := token.GenerateKey(keyType, keyType)
+		require.NoError(t, err, keyType)
+		for _, name := range algorithms {
+			alg, err := pki.LookupAlgorithm(name)
+			require.NoError(t, err)
+			signature, err := alg.Sign(key, []byte("hello"))
+			require.NoError(t, err, name)
+			assert.NoError(t, alg.Verify(key.Public(), []byte("hello"), signature), name)
+		}
+
+		found, err := token.FindKey(keyType)
+		require.NoError(t, err)
+		assert.Equal(t, key.Public(), found.Public())
+		_, err = token.GenerateKey(keyType, keyType)
+		assert.ErrorIs(t, err, hsm.ErrKeyExists)
+	}
+
+	// RSASSA-PSS với salt dài nhất, như rsa.SignPSS
+	key, err := token.FindKey(pki.KeyRSA2048)
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte("hello"))
+	signature, err := key.Sign(rand.Reader, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: crypto.SHA256})
+	require.NoError(t, err)
+	assert.NoError(t, rsa.VerifyPSS(key.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], signature, nil))
+
+	_, err = token.GenerateKey("ed25519", pki.KeyEd25519)
+	assert.ErrorIs(t, err, pki.ErrUnsupportedKeyType)
+
+	require.NoError(t, token.DeleteKey(pki.KeyRSA2048))
+	_, err = token.FindKey(pki.KeyRSA2048)
+	assert.ErrorIs(t, err, hsm.ErrKeyNotFound)
+	assert.ErrorIs(t, token.DeleteKey(pki.KeyRSA2048), hsm.ErrKeyNotFound)
+}
+
+func Test_HSM_SoftHSM_CAAndVault(t *testing.T) {
+	token := openSoftHSM(t)
+	testKeyStoreCA(t, token)
+	testKeyStoreVault(t, token, pki.KeyRSA2048)
+	testKeyStoreVault(t, token, pki.KeyECDSAP384)
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/ca"
+	"github.com/PhanPhuc2609/be-sign-file/jws"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPayloadJSON = `{"invoice":42,"amount":"10.00","note":"Hàng hóa & dịch vụ"}`
+
+func signTestJWS(t *testing.T, authority *ca.Authority, keyType string, signedAt time.Time) *jws.Signature {
+	key, cert := IssueTestCertificate(t, authority, keyType)
+	alg, err := pki.ResolveAlgorithm("", key.Public())
+	require.NoError(t, err)
+	sig, err := jws.Sign([]byte(testPayloadJSON), jws.SignerConfig{
+		Signer:      key,
+		Certificate: cert,
+		Chain:       authority.Chain(),
+		Algorithm:   alg,
+		SigningTime: signedAt,
+		Type:        "jose",
+		ContentType: "json",
+	})
+	require.NoError(t, err)
+	return sig
+}
+
+func Test_JWS_SignVerifyAllKeyTypes(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	trust := pki.NewTrustStore(authority.Root)
+	signedAt := time.Now().Truncate(time.Second)
+
+	expected := map[string]string{
+		pki.KeyRSA2048:   jws.PS256,
+		pki.KeyECDSAP256: jws.ES256,
+		pki.KeyECDSAP384: jws.ES384,
+		pki.KeyEd25519:   jws.EdDSA,
+	}
+	for keyType, name := range expected {
+		t.Run(keyType, func(t *testing.T) {
+			sig := signTestJWS(t, authority, keyType, signedAt)
+			assert.Equal(t, name, sig.Header.Algorithm)
+			assert.Equal(t, []string{"sigT"}, sig.Header.Critical)
+
+			serialized, err := sig.JSON()
+			require.NoError(t, err)
+			for _, token := range [][]byte{[]byte(sig.Compact()), serialized} {
+				results, err := jws.Verify(token, jws.VerifyOptions{Trust: trust})
+				require.NoError(t, err)
+				require.Len(t, results, 1)
+				assert.True(t, results[0].Valid(), results[0].Err)
+				assert.JSONEq(t, testPayloadJSON, string(results[0].Payload))
+				assert.True(t, signedAt.Equal(results[0].SigningTime))
+				assert.Equal(t, "signer "+keyType, results[0].Signer.Subject.CommonName)
+				assert.Len(t, results[0].Chain, 3)
+			}
+
+			tampered := sig.Protected + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"invoice":43}`)) + "." + sig.Signature
+			results, err := jws.Verify([]byte(tampered), jws.VerifyOptions{Trust: trust})
+			require.NoError(t, err)
+			assert.False(t, results[0].SignatureValid)
+			assert.ErrorIs(t, results[0].Err, jws.ErrInvalidSignature)
+		})
+	}
+}
+
+func Test_JWS_RejectsUnknownCriticalHeader(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	sig := signTestJWS(t, authority, pki.KeyECDSAP256, time.Now())
+
+	raw, err := base64.RawURLEncoding.DecodeString(sig.Protected)
+	require.NoError(t, err)
+	var header map[string]any
+	require.NoError(t, json.Unmarshal(raw, &header))
+	header["crit"] = []string{"sigT", "exp"}
+	header["exp"] = 1
+	raw, err = json.Marshal(header)
+	require.NoError(t, err)
+
+	token := base64.RawURLEncoding.EncodeToString(raw) + "." + sig.Payload + "." + sig.Signature
+	results, err := jws.Verify([]byte(token), jws.VerifyOptions{Trust: pki.NewTrustStore(authority.Root)})
+	require.NoError(t, err)
+	assert.False(t, results[0].Valid())
+	assert.ErrorIs(t, results[0].Err, jws.ErrUnsupportedCritical)
+}
+
+func Test_JWS_UntrustedAndMalformed(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	sig := signTestJWS(t, authority, pki.KeyRSA2048, time.Now())
+
+	results, err := jws.Verify([]byte(sig.Compact()), jws.VerifyOptions{Trust: pki.NewTrustStore()})
+	require.NoError(t, err)
+	assert.True(t, results[0].SignatureValid)
+	assert.ErrorIs(t, results[0].Err, pki.ErrUntrustedChain)
+
+	_, err = jws.Verify([]byte(strings.Replace(sig.Compact(), ".", "", 1)), jws.VerifyOptions{})
+	assert.ErrorIs(t, err, jws.ErrMalformed)
+	_, err = jws.Verify([]byte(`{"payload":"e30"}`), jws.VerifyOptions{})
+	assert.ErrorIs(t, err, jws.ErrMalformed)
+}
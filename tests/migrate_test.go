@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/migrations"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Migrate_DropsSignaturePrivateKey(t *testing.T) {
+	db := SetUpDatabaseConnection()
+	require.NoError(t, migrations.Migrate(db))
+
+	// database cũ còn cột private_key chứa khoá riêng tạm dùng để ký
+	require.NoError(t, db.Exec("ALTER TABLE signatures ADD COLUMN IF NOT EXISTS private_key text").Error)
+	require.True(t, db.Migrator().HasColumn(&entity.Signature{}, "private_key"))
+
+	user := entity.User{Name: "legacy", Email: uuid.NewString() + "@example.com", Password: "password123"}
+	require.NoError(t, db.Create(&user).Error)
+	doc := entity.Document{UserID: user.ID.String(), FileName: "legacy.txt", Digest: "00"}
+	require.NoError(t, db.Create(&doc).Error)
+	legacy := entity.Signature{DocumentID: doc.ID, SignerID: user.ID.String(), Algorithm: pki.AlgRSALegacy}
+	require.NoError(t, db.Create(&legacy).Error)
+	broken := entity.Signature{DocumentID: doc.ID, SignerID: user.ID.String(), Algorithm: pki.AlgRSALegacy}
+	require.NoError(t, db.Create(&broken).Error)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privateKey := base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PrivateKey(key))
+	require.NoError(t, db.Exec("UPDATE signatures SET private_key = ? WHERE id = ?", privateKey, legacy.ID).Error)
+	require.NoError(t, db.Exec("UPDATE signatures SET private_key = ? WHERE id = ?", "not a key", broken.ID).Error)
+
+	require.NoError(t, migrations.Migrate(db))
+	assert.False(t, db.Migrator().HasColumn(&entity.Signature{}, "private_key"))
+
+	// public key của khoá cũ được giữ lại để xác minh chữ ký
+	pubPEM, err := pki.EncodePublicKeyPEM(&key.PublicKey)
+	require.NoError(t, err)
+	var migrated entity.Signature
+	require.NoError(t, db.First(&migrated, legacy.ID).Error)
+	assert.Equal(t, pubPEM, migrated.PublicKey)
+	require.NoError(t, db.First(&migrated, broken.ID).Error)
+	assert.Empty(t, migrated.PublicKey)
+
+	// chạy lại không lỗi khi cột đã bị xoá
+	require.NoError(t, migrations.Migrate(db))
+}
@@ -0,0 +1,235 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/ca"
+	"github.com/PhanPhuc2609/be-sign-file/cms"
+	"github.com/PhanPhuc2609/be-sign-file/pdf"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// BuildTestPDF writes a one page PDF with a classic cross-reference table.
+func BuildTestPDF(t *testing.T) []byte {
+	objects := []string{
+		"<</Type /Catalog /Pages 2 0 R>>",
+		"<</Type /Pages /Kids [3 0 R] /Count 1>>",
+		"<</Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Contents 4 0 R /Resources <<>>>>",
+		"<</Length 0>>\nstream\n\nendstream",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n\r\n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<</Size %d /Root 1 0 R>>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+type pdfSignature struct {
+	name      string
+	byteRange []int64
+	contents  []byte
+}
+
+func readPDFSignatures(t *testing.T, data []byte) []pdfSignature {
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	_, catalog, err := r.Catalog()
+	require.NoError(t, err)
+	form, err := r.Dict(catalog.Get("AcroForm"))
+	require.NoError(t, err)
+	fields, err := r.Array(form.Get("Fields"))
+	require.NoError(t, err)
+
+	var out []pdfSignature
+	for _, f := range fields {
+		field, err := r.Dict(f)
+		require.NoError(t, err)
+		if field.Get("FT") != pdf.Name("Sig") {
+			continue
+		}
+		value, err := r.Dict(field.Get("V"))
+		require.NoError(t, err)
+		ranges, err := r.Array(value.Get("ByteRange"))
+		require.NoError(t, err)
+		sig := pdfSignature{name: pdf.DecodeTextString(field.Get("T").(pdf.String))}
+		for _, v := range ranges {
+			sig.byteRange = append(sig.byteRange, v.(int64))
+		}
+		// the placeholder is zero padded after the DER
+		var raw asn1.RawValue
+		_, err = asn1.Unmarshal(value.Get("Contents").(pdf.String), &raw)
+		require.NoError(t, err)
+		sig.contents = raw.FullBytes
+		out = append(out, sig)
+	}
+	return out
+}
+
+func signedRanges(data []byte, br []int64) io.Reader {
+	return io.MultiReader(
+		bytes.NewReader(data[br[0]:br[0]+br[1]]),
+		bytes.NewReader(data[br[2]:br[2]+br[3]]),
+	)
+}
+
+func Test_PDF_SignTwiceKeepsEarlierSignature(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	doc := BuildTestPDF(t)
+
+	signed := doc
+	var signers []string
+	for _, keyType := range []string{pki.KeyRSA2048, pki.KeyECDSAP256} {
+		key, cert := IssueTestCertificate(t, authority, keyType)
+		alg, err := pki.ResolveAlgorithm("", key.Public())
+		require.NoError(t, err)
+
+		var out bytes.Buffer
+		err = pdf.Sign(bytes.NewReader(signed), int64(len(signed)), &out, cms.SignerConfig{
+			Signer:      key,
+			Certificate: cert,
+			Chain:       authority.Chain(),
+			Algorithm:   alg,
+		}, pdf.SignOptions{Name: "Nguyễn Văn A", SigningTime: time.Now()})
+		require.NoError(t, err)
+
+		// an incremental update leaves the previous revision untouched
+		require.True(t, bytes.HasPrefix(out.Bytes(), signed))
+		signed = out.Bytes()
+		signers = append(signers, cert.Subject.CommonName)
+	}
+
+	sigs := readPDFSignatures(t, signed)
+	require.Len(t, sigs, 2)
+	assert.Equal(t, "Signature1", sigs[0].name)
+	assert.Equal(t, "Signature2", sigs[1].name)
+
+	for i, sig := range sigs {
+		require.Len(t, sig.byteRange, 4)
+		assert.Equal(t, int64(0), sig.byteRange[0])
+		end := sig.byteRange[2] + sig.byteRange[3]
+		if i == len(sigs)-1 {
+			assert.Equal(t, int64(len(signed)), end)
+		} else {
+			assert.Less(t, end, int64(len(signed)))
+		}
+
+		parsed, err := cms.Parse(sig.contents)
+		require.NoError(t, err)
+		assert.True(t, parsed.Detached)
+		certs, err := parsed.Verify(signedRanges(signed, sig.byteRange))
+		require.NoError(t, err)
+		assert.Equal(t, signers[i], certs[0].Subject.CommonName)
+	}
+
+	tampered := append([]byte{}, signed...)
+	tampered[len(doc)-10] ^= 0xff
+	parsed, err := cms.Parse(sigs[1].contents)
+	require.NoError(t, err)
+	_, err = parsed.Verify(signedRanges(tampered, sigs[1].byteRange))
+	assert.ErrorIs(t, err, cms.ErrDigestMismatch)
+}
+
+func Test_PDF_RejectsNonPDF(t *testing.T) {
+	data := []byte("hop dong mua ban so 42\n")
+	_, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.ErrorIs(t, err, pdf.ErrMalformed)
+	assert.False(t, pdf.IsPDF(data))
+	assert.True(t, pdf.IsPDF(BuildTestPDF(t)))
+}
+
+func signTestPDF(t *testing.T, authority *ca.Authority, doc []byte, keyType string) []byte {
+	key, cert := IssueTestCertificate(t, authority, keyType)
+	alg, err := pki.ResolveAlgorithm("", key.Public())
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	err = pdf.Sign(bytes.NewReader(doc), int64(len(doc)), &out, cms.SignerConfig{
+		Signer:      key,
+		Certificate: cert,
+		Chain:       authority.Chain(),
+		Algorithm:   alg,
+	}, pdf.SignOptions{Reason: "Phê duyệt", SigningTime: time.Now()})
+	require.NoError(t, err)
+	return out.Bytes()
+}
+
+func Test_PDF_VerifyReport(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	signed := signTestPDF(t, authority, BuildTestPDF(t), pki.KeyRSA2048)
+	signed = signTestPDF(t, authority, signed, pki.KeyECDSAP384)
+	trust := pki.NewTrustStore(authority.Root)
+
+	result, err := pdf.Verify(bytes.NewReader(signed), int64(len(signed)), pdf.VerifyOptions{Trust: trust})
+	require.NoError(t, err)
+	require.Len(t, result.Signatures, 2)
+	assert.False(t, result.ModifiedAfterLastSignature)
+	for _, sig := range result.Signatures {
+		assert.True(t, sig.Valid(), sig.Err)
+		assert.Equal(t, "ETSI.CAdES.detached", sig.SubFilter)
+		assert.Equal(t, "Phê duyệt", sig.Reason)
+		assert.Len(t, sig.Chain, 3)
+	}
+	assert.False(t, result.Signatures[0].CoversDocument)
+	assert.True(t, result.Signatures[1].CoversDocument)
+	assert.Equal(t, "signer "+pki.KeyECDSAP384, result.Signatures[1].Name)
+
+	// content appended after the last signature
+	appended := append(append([]byte{}, signed...), "\n% appended\n"...)
+	result, err = pdf.Verify(bytes.NewReader(appended), int64(len(appended)), pdf.VerifyOptions{Trust: trust})
+	require.NoError(t, err)
+	assert.True(t, result.ModifiedAfterLastSignature)
+	assert.True(t, result.Signatures[1].Valid())
+
+	// a byte changed inside the signed ranges
+	tampered := append([]byte{}, signed...)
+	tampered[20] ^= 0x01
+	result, err = pdf.Verify(bytes.NewReader(tampered), int64(len(tampered)), pdf.VerifyOptions{Trust: trust})
+	require.NoError(t, err)
+	for _, sig := range result.Signatures {
+		assert.False(t, sig.DigestValid)
+		assert.ErrorIs(t, sig.Err, cms.ErrDigestMismatch)
+	}
+
+	// a signer outside the trust store
+	result, err = pdf.Verify(bytes.NewReader(signed), int64(len(signed)), pdf.VerifyOptions{Trust: pki.NewTrustStore()})
+	require.NoError(t, err)
+	for _, sig := range result.Signatures {
+		assert.True(t, sig.SignatureValid)
+		assert.False(t, sig.ChainValid)
+		assert.ErrorIs(t, sig.Err, pki.ErrUntrustedChain)
+	}
+}
+
+func Test_PDF_LoadTrustStore(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "partner.pem"), authority.ChainPEM(), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "root.cer"), authority.Root.Raw, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.txt"), []byte("not a certificate"), 0644))
+
+	trust, err := pki.LoadTrustStore(dir)
+	require.NoError(t, err)
+	assert.Len(t, trust.Certificates(), 3)
+
+	missing, err := pki.LoadTrustStore(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, missing.Certificates())
+}
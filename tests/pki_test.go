@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PKI_SignVerifyAllKeyTypes(t *testing.T) {
+	cases := []struct {
+		keyType   string
+		algorithm string
+	}{
+		{pki.KeyRSA2048, pki.AlgRSAPSSSHA256},
+		{pki.KeyECDSAP256, pki.AlgECDSASHA256},
+		{pki.KeyECDSAP384, pki.AlgECDSASHA384},
+		{pki.KeyEd25519, pki.AlgEd25519},
+	}
+
+	message := []byte("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+
+	for _, tc := range cases {
+		t.Run(tc.keyType, func(t *testing.T) {
+			key, err := pki.GenerateKey(tc.keyType)
+			require.NoError(t, err)
+
+			alg, err := pki.ResolveAlgorithm("", key.Public())
+			require.NoError(t, err)
+			assert.Equal(t, tc.algorithm, alg.Name)
+
+			signature, err := alg.Sign(key, message)
+			require.NoError(t, err)
+
+			stored, err := pki.LookupAlgorithm(alg.Name)
+			require.NoError(t, err)
+			assert.NoError(t, stored.Verify(key.Public(), message, signature))
+			assert.Error(t, stored.Verify(key.Public(), []byte("tampered"), signature))
+		})
+	}
+}
+
+func Test_PKI_LegacyRSAAlgorithm(t *testing.T) {
+	key, err := pki.GenerateKey(pki.KeyRSA2048)
+	require.NoError(t, err)
+
+	current, err := pki.LookupAlgorithm(pki.AlgRSASHA256)
+	require.NoError(t, err)
+	signature, err := current.Sign(key, []byte("digest"))
+	require.NoError(t, err)
+
+	// rows written before algorithm selection only say "RSA"
+	legacy, err := pki.LookupAlgorithm(pki.AlgRSALegacy)
+	require.NoError(t, err)
+	assert.NoError(t, legacy.Verify(key.Public(), []byte("digest"), signature))
+}
+
+func Test_PKI_RSAPSSSaltLength(t *testing.T) {
+	key, err := pki.GenerateKey(pki.KeyRSA2048)
+	require.NoError(t, err)
+
+	pss, err := pki.LookupAlgorithm(pki.AlgRSAPSSSHA256)
+	require.NoError(t, err)
+	assert.Equal(t, 32, pss.SaltLength)
+
+	signature, err := pss.WithSaltLength(20).Sign(key, []byte("digest"))
+	require.NoError(t, err)
+
+	assert.NoError(t, pss.WithSaltLength(20).Verify(key.Public(), []byte("digest"), signature))
+	assert.Error(t, pss.Verify(key.Public(), []byte("digest"), signature))
+	assert.NoError(t, pss.WithSaltLength(0).Verify(key.Public(), []byte("digest"), signature))
+
+	// PSS signatures must not verify under the PKCS#1 v1.5 identifiers
+	legacy, err := pki.LookupAlgorithm(pki.AlgRSALegacy)
+	require.NoError(t, err)
+	assert.Error(t, legacy.Verify(key.Public(), []byte("digest"), signature))
+}
+
+func Test_PKI_ResolveAlgorithmRejectsMismatchedKey(t *testing.T) {
+	key, err := pki.GenerateKey(pki.KeyECDSAP256)
+	require.NoError(t, err)
+
+	_, err = pki.ResolveAlgorithm(pki.AlgRSASHA256, key.Public())
+	assert.Error(t, err)
+
+	_, err = pki.ResolveAlgorithm("DSA-SHA1", key.Public())
+	assert.ErrorIs(t, err, pki.ErrUnsupportedAlgorithm)
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RateLimit_PerClient(t *testing.T) {
+	r := SetUpRoutes()
+	r.POST("/verify", middleware.RateLimit(config.RateLimitConfig{Rate: 1, Period: time.Hour, Burst: 2}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(ip string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/verify", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, send("10.0.0.1").Code)
+	w := send("10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// mỗi client có hạn mức riêng
+	assert.Equal(t, http.StatusOK, send("10.0.0.2").Code)
+}
+
+func Test_RateLimit_SpoofedForwardedFor(t *testing.T) {
+	limited := func() *gin.Engine {
+		r := SetUpRoutes()
+		if err := r.SetTrustedProxies(config.TrustedProxies()); err != nil {
+			t.Fatal(err)
+		}
+		r.POST("/verify", middleware.RateLimit(config.RateLimitConfig{Rate: 1, Period: time.Hour, Burst: 1}), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		return r
+	}
+	send := func(r *gin.Engine, remote string, forwarded string) int {
+		req, _ := http.NewRequest(http.MethodPost, "/verify", nil)
+		req.RemoteAddr = remote + ":1234"
+		req.Header.Set("X-Forwarded-For", forwarded)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// không cấu hình proxy: đổi X-Forwarded-For mỗi lần không được hạn mức mới
+	t.Setenv("TRUSTED_PROXIES", "")
+	r := limited()
+	assert.Equal(t, http.StatusOK, send(r, "10.0.0.1", "1.1.1.1"))
+	assert.Equal(t, http.StatusTooManyRequests, send(r, "10.0.0.1", "2.2.2.2"))
+	assert.Equal(t, http.StatusTooManyRequests, send(r, "10.0.0.1", "3.3.3.3"))
+
+	// sau proxy tin cậy thì giới hạn theo client mà proxy báo
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+	r = limited()
+	assert.Equal(t, http.StatusOK, send(r, "10.0.0.1", "1.1.1.1"))
+	assert.Equal(t, http.StatusTooManyRequests, send(r, "10.0.0.2", "1.1.1.1"))
+	assert.Equal(t, http.StatusOK, send(r, "10.0.0.1", "2.2.2.2"))
+	// proxy không tin cậy vẫn bị tính theo IP kết nối
+	assert.Equal(t, http.StatusOK, send(r, "192.0.2.1", "3.3.3.3"))
+	assert.Equal(t, http.StatusTooManyRequests, send(r, "192.0.2.1", "4.4.4.4"))
+}
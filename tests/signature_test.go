@@ -0,0 +1,538 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/controller"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/PhanPhuc2609/be-sign-file/repository"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memorySignatureRepository keeps signatures in a map keyed by id. Like the
+// database repository, lookups preload the document and the signer.
+type memorySignatureRepository struct {
+	repository.SignatureRepository
+	mu    sync.Mutex
+	sigs  map[uint]entity.Signature
+	docs  *memoryDocumentRepository
+	users *memoryUserRepository
+}
+
+func (r *memorySignatureRepository) preload(sig entity.Signature) entity.Signature {
+	sig.Document = r.docs.docs[sig.DocumentID]
+	sig.Signer = r.users.users[sig.SignerID]
+	return sig
+}
+
+func (r *memorySignatureRepository) Create(ctx context.Context, tx *gorm.DB, sig entity.Signature) (entity.Signature, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sig.ID = uint(len(r.sigs) + 1)
+	r.sigs[sig.ID] = sig
+	return sig, nil
+}
+
+func (r *memorySignatureRepository) FindByID(ctx context.Context, tx *gorm.DB, id uint) (entity.Signature, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sig, ok := r.sigs[id]
+	if !ok {
+		return entity.Signature{}, gorm.ErrRecordNotFound
+	}
+	return r.preload(sig), nil
+}
+
+func (r *memorySignatureRepository) FindByDocumentID(ctx context.Context, tx *gorm.DB, docID uint) ([]entity.Signature, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sigs []entity.Signature
+	for id := uint(1); id <= uint(len(r.sigs)); id++ {
+		if sig := r.sigs[id]; sig.DocumentID == docID {
+			sigs = append(sigs, r.preload(sig))
+		}
+	}
+	return sigs, nil
+}
+
+// memorySigningRequestRepository keeps signing requests in a map keyed by
+// id. Participants are copied in and out, as rows would be, and FindByID
+// locks the request inside a transaction like the database repository.
+// found, when set, runs after each FindByID so tests can interleave
+// operations.
+type memorySigningRequestRepository struct {
+	repository.SigningRequestRepository
+	mu       sync.Mutex
+	rows     memoryRowLocks
+	requests map[uint]entity.SigningRequest
+	found    func(tx *gorm.DB)
+}
+
+func copySigningRequest(req entity.SigningRequest) entity.SigningRequest {
+	req.Participants = append([]entity.SigningParticipant(nil), req.Participants...)
+	return req
+}
+
+func (r *memorySigningRequestRepository) FindByID(ctx context.Context, tx *gorm.DB, id uint) (entity.SigningRequest, error) {
+	r.rows.lock(tx, id)
+	r.mu.Lock()
+	req, ok := r.requests[id]
+	found := r.found
+	r.mu.Unlock()
+	if !ok {
+		return entity.SigningRequest{}, gorm.ErrRecordNotFound
+	}
+	if found != nil {
+		found(tx)
+	}
+	return copySigningRequest(req), nil
+}
+
+func (r *memorySigningRequestRepository) FindActiveByDocumentID(ctx context.Context, tx *gorm.DB, docID uint) (entity.SigningRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, req := range r.requests {
+		if req.DocumentID == docID && req.IsActive() {
+			return copySigningRequest(req), nil
+		}
+	}
+	return entity.SigningRequest{}, gorm.ErrRecordNotFound
+}
+
+func (r *memorySigningRequestRepository) Update(ctx context.Context, tx *gorm.DB, req entity.SigningRequest) (entity.SigningRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests[req.ID] = copySigningRequest(req)
+	return req, nil
+}
+
+// memorySignedDocumentRepository adds to memoryDocumentRepository the
+// lookups the verification of a signed file makes.
+type memorySignedDocumentRepository struct {
+	*memoryDocumentRepository
+	sigs *memorySignatureRepository
+}
+
+func (r *memorySignedDocumentRepository) FindByDigest(ctx context.Context, tx *gorm.DB, digest string, userID string) (entity.Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := uint(1); id <= uint(len(r.docs)); id++ {
+		if doc := r.docs[id]; doc.Digest == digest && doc.UserID == userID {
+			return doc, nil
+		}
+	}
+	return entity.Document{}, gorm.ErrRecordNotFound
+}
+
+func (r *memorySignedDocumentRepository) GetSignaturesByDocumentID(ctx context.Context, tx *gorm.DB, docID uint) ([]entity.Signature, error) {
+	return r.sigs.FindByDocumentID(ctx, tx, docID)
+}
+
+// signingFixture signs with keys enrolled through the user service, the
+// platform CA and repositories all in memory.
+type signingFixture struct {
+	users     *memoryUserRepository
+	certs     *memoryCertificateRepository
+	docs      *memoryDocumentRepository
+	sigs      *memorySignatureRepository
+	requests  *memorySigningRequestRepository
+	store     storage.Storage
+	db        *gorm.DB
+	caService service.CAService
+	userSvc   service.UserService
+	sigSvc    service.SignatureService
+}
+
+func SetUpSigning(t *testing.T) *signingFixture {
+	f := &signingFixture{
+		users:    &memoryUserRepository{users: map[string]entity.User{}},
+		docs:     &memoryDocumentRepository{docs: map[uint]entity.Document{}},
+		requests: &memorySigningRequestRepository{requests: map[uint]entity.SigningRequest{}},
+		store:    storage.NewLocal(t.TempDir()),
+	}
+	f.sigs = &memorySignatureRepository{sigs: map[uint]entity.Signature{}, docs: f.docs, users: f.users}
+	f.docs.readers = f.canRead
+	f.caService, f.certs = SetUpMemoryCA(t, f.users)
+	keyVault, vaultKeys, _ := newKeyVault(t, &config.EncryptionConfig{MasterKey: newMasterKey(t)})
+	f.db = SetUpMemoryDB()
+	f.userSvc = service.NewUserService(f.users, nil, nil, f.caService, keyVault, vaultKeys, f.store, f.db)
+	f.sigSvc = service.NewSignatureService(f.sigs, f.docs, f.users, f.certs, f.requests, f.caService, keyVault, f.store, f.db)
+	return f
+}
+
+// canRead reports whether userID signed the document or takes part in one
+// of its signing requests.
+func (f *signingFixture) canRead(docID uint, userID string) bool {
+	f.sigs.mu.Lock()
+	defer f.sigs.mu.Unlock()
+	for _, sig := range f.sigs.sigs {
+		if sig.DocumentID == docID && sig.SignerID == userID {
+			return true
+		}
+	}
+	f.requests.mu.Lock()
+	defer f.requests.mu.Unlock()
+	for _, req := range f.requests.requests {
+		for _, p := range req.Participants {
+			if req.DocumentID == docID && p.SignerID == userID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// enroll creates a user and issues them a certificate for a key kept in the
+// vault, as POST /api/user/certificate does.
+func (f *signingFixture) enroll(t *testing.T, name string) entity.User {
+	return f.enrollKey(t, name, pki.KeyECDSAP256)
+}
+
+func (f *signingFixture) enrollKey(t *testing.T, name string, keyType string) entity.User {
+	user := entity.User{ID: uuid.New(), Name: name, Email: name + "@example.com"}
+	f.users.users[user.ID.String()] = user
+	_, _, err := f.userSvc.CreateUserCertificate(context.Background(), user.ID.String(), user.Email, user.Name, keyType, "", "")
+	require.NoError(t, err)
+	return f.users.users[user.ID.String()]
+}
+
+func (f *signingFixture) upload(t *testing.T, owner entity.User, content string) entity.Document {
+	digest := sha256.Sum256([]byte(content))
+	doc := entity.Document{
+		ID:       uint(len(f.docs.docs) + 1),
+		UserID:   owner.ID.String(),
+		FileName: "contract.txt",
+		Digest:   hex.EncodeToString(digest[:]),
+		Status:   "uploaded",
+	}
+	doc.FilePath = "documents/" + doc.Digest
+	require.NoError(t, f.store.Put(context.Background(), doc.FilePath, bytes.NewReader([]byte(content))))
+	f.docs.docs[doc.ID] = doc
+	return doc
+}
+
+func Test_Signature_ReadAccess(t *testing.T) {
+	ctx := context.Background()
+	f := SetUpSigning(t)
+	alice, bob, carol, mallory := f.enroll(t, "alice"), f.enroll(t, "bob"), f.enroll(t, "carol"), f.enroll(t, "mallory")
+	doc := f.upload(t, alice, "hợp đồng mua bán\n")
+
+	sig, err := f.sigSvc.CreateSignature(ctx, entity.Signature{DocumentID: doc.ID, SignerID: bob.ID.String()}, "")
+	require.NoError(t, err)
+	f.requests.requests[1] = entity.SigningRequest{ID: 1, DocumentID: doc.ID, Participants: []entity.SigningParticipant{
+		{SigningRequestID: 1, SignerID: carol.ID.String()},
+	}}
+
+	ctrl := controller.NewSignatureController(f.sigSvc)
+	r := SetUpRoutes()
+	as := func(handler gin.HandlerFunc) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			if userID := c.GetHeader("X-User-ID"); userID != "" {
+				c.Set("user_id", userID)
+			}
+			handler(c)
+		}
+	}
+	r.GET("/api/signatures/:id/p7s", as(ctrl.DownloadCMS))
+	r.GET("/api/signatures/:id/verify", as(ctrl.VerifySignatureTree))
+	get := func(userID string, path string, id uint) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/signatures/%d/%s", id, path), nil)
+		req.Header.Set("X-User-ID", userID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// chủ tài liệu, người ký và người tham gia yêu cầu ký đều xem được
+	for _, user := range []entity.User{alice, bob, carol} {
+		w := get(user.ID.String(), "p7s", sig.ID)
+		assert.Equal(t, http.StatusOK, w.Code, user.Name)
+		assert.Equal(t, sig.CMS, w.Body.Bytes(), user.Name)
+
+		w = get(user.ID.String(), "verify", sig.ID)
+		require.Equal(t, http.StatusOK, w.Code, user.Name)
+		var node dto.SignatureTreeNode
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &node))
+		assert.True(t, node.Valid, node.Error)
+	}
+
+	for _, path := range []string{"p7s", "verify"} {
+		// người khác nhận 404 như khi chữ ký không tồn tại
+		w := get(mallory.ID.String(), path, sig.ID)
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+		assert.Equal(t, get(mallory.ID.String(), path, sig.ID+100).Body.String(), w.Body.String(), path)
+
+		assert.Equal(t, http.StatusUnauthorized, get("", path, sig.ID).Code, path)
+	}
+}
+
+func Test_Signature_SignAndVerify(t *testing.T) {
+	ctx := context.Background()
+	f := SetUpSigning(t)
+	alice := f.enroll(t, "alice")
+	doc := f.upload(t, alice, "hợp đồng mua bán\n")
+
+	sig, err := f.sigSvc.CreateSignature(ctx, entity.Signature{DocumentID: doc.ID, SignerID: alice.ID.String()}, "")
+	require.NoError(t, err)
+
+	cert, err := pki.ParseCertificatePEM(alice.CertPEM)
+	require.NoError(t, err)
+	assert.Equal(t, pki.Fingerprint(cert), sig.CertFingerprint)
+	assert.Equal(t, pki.SerialHex(cert), sig.CertSerial)
+	assert.NotEmpty(t, sig.TimestampToken)
+	assert.Equal(t, "signed", f.docs.docs[doc.ID].Status)
+
+	node, err := f.sigSvc.VerifySignatureTree(ctx, alice.ID.String(), sig.ID)
+	require.NoError(t, err)
+	assert.True(t, node.Valid, node.Error)
+	require.NotNil(t, node.CMSValid)
+	assert.True(t, *node.CMSValid)
+	assert.Equal(t, "alice", node.SignerName)
+
+	// verify runs against the stored record, which the subtests change
+	verify := func(t *testing.T, change func(*entity.Signature)) dto.SignatureTreeNode {
+		stored := f.sigs.sigs[sig.ID]
+		changed := stored
+		change(&changed)
+		f.sigs.sigs[sig.ID] = changed
+		defer func() { f.sigs.sigs[sig.ID] = stored }()
+
+		node, err := f.sigSvc.VerifySignatureTree(ctx, alice.ID.String(), sig.ID)
+		require.NoError(t, err)
+		return node
+	}
+
+	t.Run("tampered signature", func(t *testing.T) {
+		node := verify(t, func(sig *entity.Signature) {
+			other, err := f.sigSvc.CreateSignature(ctx, entity.Signature{DocumentID: f.upload(t, alice, "hợp đồng cho thuê\n").ID, SignerID: alice.ID.String()}, "")
+			require.NoError(t, err)
+			sig.SignatureRaw, sig.TimestampToken = other.SignatureRaw, other.TimestampToken
+		})
+		assert.False(t, node.Valid)
+		assert.Equal(t, "signature verification failed", node.Error)
+	})
+
+	t.Run("signature made before certificate fingerprints", func(t *testing.T) {
+		node := verify(t, func(sig *entity.Signature) { sig.CertFingerprint = "" })
+		assert.False(t, node.Valid)
+		assert.Equal(t, "signer certificate not found", node.Error)
+	})
+
+	t.Run("certificate not recorded by the CA", func(t *testing.T) {
+		var recorded []entity.Certificate
+		for _, record := range f.certs.certs {
+			if record.Fingerprint != sig.CertFingerprint {
+				recorded = append(recorded, record)
+			}
+		}
+		f.certs.certs = recorded
+
+		// chứng chỉ cấp trước khi có CA nội bộ: dùng chứng chỉ hiện tại của người ký
+		node := verify(t, func(*entity.Signature) {})
+		assert.True(t, node.Valid, node.Error)
+
+		// người ký đã đổi chứng chỉ: không còn chứng chỉ nào khớp fingerprint
+		reenrolled := f.users.users[alice.ID.String()]
+		reenrolled.CertPEM = f.enroll(t, "bob").CertPEM
+		f.users.users[alice.ID.String()] = reenrolled
+
+		node = verify(t, func(*entity.Signature) {})
+		assert.False(t, node.Valid)
+		assert.Equal(t, "signer certificate not found", node.Error)
+	})
+}
+
+func Test_Signature_VerifyLegacy(t *testing.T) {
+	ctx := context.Background()
+	f := SetUpSigning(t)
+	alice := f.enroll(t, "alice")
+	doc := f.upload(t, alice, "hợp đồng mua bán\n")
+
+	// bản ghi cũ: ký PKCS#1 v1.5 bằng khoá RSA tạm, không có chứng chỉ;
+	// migration lưu public key lấy từ cột private_key
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	hashed := sha256.Sum256([]byte(doc.Digest))
+	value, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	require.NoError(t, err)
+	pubPEM, err := pki.EncodePublicKeyPEM(&key.PublicKey)
+	require.NoError(t, err)
+	sig, err := f.sigs.Create(ctx, nil, entity.Signature{
+		DocumentID:   doc.ID,
+		SignerID:     alice.ID.String(),
+		SignatureRaw: base64.StdEncoding.EncodeToString(value),
+		Algorithm:    pki.AlgRSALegacy,
+		SignedAt:     time.Now().Unix(),
+		PublicKey:    pubPEM,
+	})
+	require.NoError(t, err)
+
+	node, err := f.sigSvc.VerifySignatureTree(ctx, alice.ID.String(), sig.ID)
+	require.NoError(t, err)
+	assert.True(t, node.Valid, node.Error)
+	assert.Nil(t, node.CMSValid)
+
+	t.Run("signed by another key", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		otherPEM, err := pki.EncodePublicKeyPEM(&other.PublicKey)
+		require.NoError(t, err)
+		stored := f.sigs.sigs[sig.ID]
+		changed := stored
+		changed.PublicKey = otherPEM
+		f.sigs.sigs[sig.ID] = changed
+		defer func() { f.sigs.sigs[sig.ID] = stored }()
+
+		node, err := f.sigSvc.VerifySignatureTree(ctx, alice.ID.String(), sig.ID)
+		require.NoError(t, err)
+		assert.False(t, node.Valid)
+		assert.Equal(t, "signature verification failed", node.Error)
+	})
+}
+
+func Test_Signature_SignString(t *testing.T) {
+	ctx := context.Background()
+	f := SetUpSigning(t)
+	alice := f.enrollKey(t, "alice", pki.KeyRSA2048)
+	raw := "chuỗi cần ký"
+
+	verify := func(t *testing.T, algorithm string, signature string, publicKey string) {
+		value, err := base64.StdEncoding.DecodeString(signature)
+		require.NoError(t, err)
+		der, err := base64.StdEncoding.DecodeString(publicKey)
+		require.NoError(t, err)
+		pub, err := x509.ParsePKIXPublicKey(der)
+		require.NoError(t, err)
+		alg, err := pki.LookupAlgorithm(algorithm)
+		require.NoError(t, err)
+		assert.NoError(t, alg.Verify(pub, []byte(raw), value))
+	}
+
+	t.Run("RSA keys sign RSASSA-PSS by default", func(t *testing.T) {
+		signature, publicKey, algorithm, err := f.sigSvc.SignString(ctx, alice.ID.String(), raw, "", "")
+		require.NoError(t, err)
+		assert.Equal(t, pki.AlgRSAPSSSHA256, algorithm)
+		verify(t, pki.AlgRSAPSSSHA256, signature, publicKey)
+
+		value, _ := base64.StdEncoding.DecodeString(signature)
+		pub, _ := pki.ParseCertificatePEM(alice.CertPEM)
+		hashed := sha256.Sum256([]byte(raw))
+		assert.Error(t, rsa.VerifyPKCS1v15(pub.PublicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], value))
+	})
+
+	t.Run("PKCS#1 v1.5 when asked for", func(t *testing.T) {
+		signature, publicKey, algorithm, err := f.sigSvc.SignString(ctx, alice.ID.String(), raw, pki.AlgRSASHA256, "")
+		require.NoError(t, err)
+		assert.Equal(t, pki.AlgRSASHA256, algorithm)
+		verify(t, pki.AlgRSASHA256, signature, publicKey)
+	})
+
+	t.Run("algorithm of another key type", func(t *testing.T) {
+		_, _, _, err := f.sigSvc.SignString(ctx, alice.ID.String(), raw, pki.AlgECDSASHA256, "")
+		assert.Error(t, err)
+	})
+}
+
+func Test_Signature_MarkerKeepsEverySigner(t *testing.T) {
+	ctx := context.Background()
+	f := SetUpSigning(t)
+	alice, bob := f.enroll(t, "alice"), f.enroll(t, "bob")
+	content := "hợp đồng mua bán\n"
+	doc := f.upload(t, alice, content)
+	docSvc := service.NewDocumentService(&memorySignedDocumentRepository{f.docs, f.sigs}, f.certs, nil, f.caService, f.store, config.DocumentConfig{}, f.db)
+
+	signedFile := func() string {
+		file, err := f.store.Get(ctx, doc.FilePath+".signed")
+		require.NoError(t, err)
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		require.NoError(t, err)
+		return string(data)
+	}
+	verify := func(t *testing.T, file string) dto.VerifyDocumentResponse {
+		res, err := docSvc.UploadAndVerifyDocumentService(ctx, alice.ID.String(), "contract.txt", strings.NewReader(file))
+		require.NoError(t, err)
+		return res
+	}
+
+	first, err := f.sigSvc.CreateSignature(ctx, entity.Signature{DocumentID: doc.ID, SignerID: alice.ID.String()}, "")
+	require.NoError(t, err)
+	signedOnce := signedFile()
+	second, err := f.sigSvc.CreateSignature(ctx, entity.Signature{DocumentID: doc.ID, SignerID: bob.ID.String()}, "")
+	require.NoError(t, err)
+
+	// chữ ký mới được nối sau chữ ký trước, phần trước marker vẫn là file gốc
+	signed := signedFile()
+	assert.Equal(t, signedOnce, signed[:len(signedOnce)])
+	assert.Equal(t, content+
+		service.SIGNATURE_BEGIN+"\n"+first.SignatureRaw+"\n"+service.SIGNATURE_END+"\n"+
+		service.SIGNATURE_BEGIN+"\n"+second.SignatureRaw+"\n"+service.SIGNATURE_END+"\n", signed)
+
+	res := verify(t, signed)
+	assert.Equal(t, dto.VERDICT_VALID, res.Verdict)
+	var inFile []string
+	for _, item := range res.Signatures {
+		if item.Source == dto.SIGNATURE_SOURCE_FILE {
+			assert.True(t, item.Valid, item.Error)
+			inFile = append(inFile, item.SignerName)
+		}
+	}
+	assert.Equal(t, []string{"alice", "bob"}, inFile)
+
+	t.Run("file of the previous signature", func(t *testing.T) {
+		res := verify(t, signedOnce)
+		assert.Equal(t, dto.VERDICT_VALID, res.Verdict)
+	})
+
+	t.Run("signature appended by someone else", func(t *testing.T) {
+		other, err := f.sigSvc.CreateSignature(ctx, entity.Signature{DocumentID: f.upload(t, bob, "hợp đồng cho thuê\n").ID, SignerID: bob.ID.String()}, "")
+		require.NoError(t, err)
+		res := verify(t, signed+service.SIGNATURE_BEGIN+"\n"+other.SignatureRaw+"\n"+service.SIGNATURE_END+"\n")
+		assert.Equal(t, dto.VERDICT_INVALID, res.Verdict)
+	})
+
+	t.Run("more markers than the end of the file read first", func(t *testing.T) {
+		file := signed
+		value := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x5a}, 512))
+		for i := 0; i < 150; i++ {
+			file += service.SIGNATURE_BEGIN + "\n" + value + "\n" + service.SIGNATURE_END + "\n"
+		}
+		res := verify(t, file)
+		require.NotNil(t, res.DocumentID)
+		assert.Equal(t, doc.ID, *res.DocumentID)
+		inFile := 0
+		for _, item := range res.Signatures {
+			if item.Source == dto.SIGNATURE_SOURCE_FILE {
+				inFile++
+			}
+		}
+		assert.Equal(t, 152, inFile)
+		assert.Equal(t, dto.VERDICT_INVALID, res.Verdict)
+	})
+}
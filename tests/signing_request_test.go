@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/constants"
+	"github.com/PhanPhuc2609/be-sign-file/dto"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestSigningRequest(order string, signers ...string) *entity.SigningRequest {
+	request := &entity.SigningRequest{Order: order}
+	for i, signer := range signers {
+		request.Participants = append(request.Participants, entity.SigningParticipant{SignerID: signer, Position: i + 1})
+	}
+	request.Start()
+	return request
+}
+
+func participantStatuses(request *entity.SigningRequest) []string {
+	var statuses []string
+	for _, p := range request.Participants {
+		statuses = append(statuses, p.Status)
+	}
+	return statuses
+}
+
+func Test_SigningRequest_Sequential(t *testing.T) {
+	request := newTestSigningRequest(constants.ENUM_SIGNING_ORDER_SEQUENTIAL, "a", "b", "c")
+	assert.Equal(t, constants.ENUM_DOCUMENT_STATUS_PENDING, request.DocumentStatus())
+	assert.True(t, request.CanSign("a"))
+	assert.False(t, request.CanSign("b"), "b signs after a")
+	assert.False(t, request.CanSign("x"))
+
+	request.RecordSignature("a", 1, time.Now())
+	assert.Equal(t, []string{"signed", "pending", "waiting"}, participantStatuses(request))
+	assert.Equal(t, constants.ENUM_DOCUMENT_STATUS_PARTIALLY_SIGNED, request.DocumentStatus())
+	assert.False(t, request.CanSign("a"), "a already signed")
+
+	request.RecordSignature("b", 2, time.Now())
+	request.RecordSignature("c", 3, time.Now())
+	assert.Equal(t, constants.ENUM_SIGNING_REQUEST_COMPLETED, request.Status)
+	assert.Equal(t, constants.ENUM_DOCUMENT_STATUS_COMPLETED, request.DocumentStatus())
+	assert.NotNil(t, request.CompletedAt)
+	assert.Equal(t, uint(3), *request.Participant("c").SignatureID)
+	assert.False(t, request.IsActive())
+}
+
+func Test_SigningRequest_Parallel(t *testing.T) {
+	request := newTestSigningRequest(constants.ENUM_SIGNING_ORDER_PARALLEL, "a", "b")
+	assert.True(t, request.CanSign("a"))
+	assert.True(t, request.CanSign("b"))
+
+	request.RecordSignature("b", 1, time.Now())
+	assert.True(t, request.IsActive())
+	assert.Equal(t, constants.ENUM_DOCUMENT_STATUS_PARTIALLY_SIGNED, request.DocumentStatus())
+	request.RecordSignature("a", 2, time.Now())
+	assert.Equal(t, constants.ENUM_DOCUMENT_STATUS_COMPLETED, request.DocumentStatus())
+}
+
+func Test_SigningRequest_DeclineAndCancel(t *testing.T) {
+	request := newTestSigningRequest(constants.ENUM_SIGNING_ORDER_SEQUENTIAL, "a", "b")
+	request.RecordSignature("a", 1, time.Now())
+	request.Decline("b", "wrong amount", time.Now())
+	assert.Equal(t, constants.ENUM_SIGNING_REQUEST_DECLINED, request.Status)
+	assert.Equal(t, constants.ENUM_DOCUMENT_STATUS_DECLINED, request.DocumentStatus())
+	assert.Equal(t, "wrong amount", request.Participant("b").DeclineReason)
+	assert.False(t, request.CanSign("b"))
+
+	request = newTestSigningRequest(constants.ENUM_SIGNING_ORDER_PARALLEL, "a", "b")
+	request.Cancel()
+	assert.Equal(t, []string{"waiting", "waiting"}, participantStatuses(request))
+	assert.Equal(t, constants.ENUM_DOCUMENT_STATUS_UPLOADED, request.DocumentStatus())
+
+	request = newTestSigningRequest(constants.ENUM_SIGNING_ORDER_PARALLEL, "a", "b")
+	request.RecordSignature("a", 1, time.Now())
+	request.Cancel()
+	assert.Equal(t, constants.ENUM_DOCUMENT_STATUS_SIGNED, request.DocumentStatus())
+}
+
+func Test_SigningRequest_SignDeclineRace(t *testing.T) {
+	ctx := context.Background()
+	f := SetUpSigning(t)
+	alice := f.enroll(t, "alice")
+	requests := service.NewSigningRequestService(f.requests, f.docs, f.users, f.sigSvc, f.db)
+
+	start := func(t *testing.T) (entity.SigningRequest, entity.Document) {
+		doc := f.upload(t, alice, fmt.Sprintf("hợp đồng số %d\n", len(f.docs.docs)+1))
+		request := newTestSigningRequest(constants.ENUM_SIGNING_ORDER_SEQUENTIAL, alice.ID.String())
+		request.ID, request.DocumentID, request.OwnerID = doc.ID, doc.ID, alice.ID.String()
+		f.requests.Update(ctx, nil, *request)
+		return *request, doc
+	}
+	decline := func(id uint) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := requests.Decline(ctx, id, alice.ID.String(), "đổi ý")
+			done <- err
+		}()
+		return done
+	}
+	check := func(t *testing.T, request entity.SigningRequest, status string, documentStatus string, signatures int) {
+		stored, err := f.requests.FindByID(ctx, nil, request.ID)
+		require.NoError(t, err)
+		assert.Equal(t, status, stored.Status)
+		assert.Equal(t, documentStatus, f.docs.docs[request.DocumentID].Status)
+		sigs, err := f.sigs.FindByDocumentID(ctx, nil, request.DocumentID)
+		require.NoError(t, err)
+		assert.Len(t, sigs, signatures)
+	}
+
+	t.Run("decline commits after the first check", func(t *testing.T) {
+		request, _ := start(t)
+		// từ chối xong giữa lần kiểm tra đầu của Sign và transaction ký
+		f.requests.found = func(tx *gorm.DB) {
+			if tx == nil {
+				f.requests.found = nil
+				require.NoError(t, <-decline(request.ID))
+			}
+		}
+		defer func() { f.requests.found = nil }()
+
+		_, err := requests.Sign(ctx, request.ID, alice.ID.String(), "", "")
+		assert.ErrorIs(t, err, dto.ErrSigningRequestClosed)
+		check(t, request, constants.ENUM_SIGNING_REQUEST_DECLINED, constants.ENUM_DOCUMENT_STATUS_DECLINED, 0)
+	})
+
+	t.Run("decline waits for the signing transaction", func(t *testing.T) {
+		request, _ := start(t)
+		// từ chối khi Sign đang giữ khóa yêu cầu: chờ đến khi ký xong
+		var declined <-chan error
+		f.requests.found = func(tx *gorm.DB) {
+			if tx != nil {
+				f.requests.found = nil
+				declined = decline(request.ID)
+				time.Sleep(50 * time.Millisecond)
+			}
+		}
+		defer func() { f.requests.found = nil }()
+
+		_, err := requests.Sign(ctx, request.ID, alice.ID.String(), "", "")
+		require.NoError(t, err)
+		require.NotNil(t, declined)
+		assert.ErrorIs(t, <-declined, dto.ErrSigningRequestClosed)
+		check(t, request, constants.ENUM_SIGNING_REQUEST_COMPLETED, constants.ENUM_DOCUMENT_STATUS_COMPLETED, 1)
+	})
+}
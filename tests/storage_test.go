@@ -0,0 +1,223 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStorageRoundTrip exercises a driver the way the services use it.
+func testStorageRoundTrip(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+	key := fmt.Sprintf("uploads/test-%d/hợp đồng (1).pdf", time.Now().UnixNano())
+	// lớn hơn một khối ReadAt và nhiều phần multipart
+	content := bytes.Repeat([]byte("0123456789abcdef"), 160<<10)
+
+	require.NoError(t, store.Put(ctx, key, bytes.NewReader(content)))
+	t.Cleanup(func() { store.Delete(ctx, key) })
+
+	info, err := store.Stat(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size)
+
+	object, err := store.Get(ctx, key)
+	require.NoError(t, err)
+	defer object.Close()
+	all, err := io.ReadAll(object)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(content, all))
+
+	// đọc qua ranh giới hai khối 1 MiB
+	part := make([]byte, 32)
+	n, err := object.ReadAt(part, 1<<20-16)
+	require.NoError(t, err)
+	assert.Equal(t, content[1<<20-16:1<<20+16], part[:n])
+	n, err = object.ReadAt(part, int64(len(content))-10)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 10, n)
+
+	_, err = object.Seek(-4, io.SeekEnd)
+	require.NoError(t, err)
+	tail, err := io.ReadAll(object)
+	require.NoError(t, err)
+	assert.Equal(t, "cdef", string(tail))
+
+	// ghi đè
+	require.NoError(t, store.Put(ctx, key, strings.NewReader("")))
+	info, err = store.Stat(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size)
+
+	require.NoError(t, store.Delete(ctx, key))
+	_, err = store.Get(ctx, key)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.NoError(t, store.Delete(ctx, key))
+
+	_, err = store.Stat(ctx, "../outside")
+	assert.ErrorIs(t, err, storage.ErrInvalidKey)
+}
+
+func Test_Storage_Local(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewLocal(root)
+	testStorageRoundTrip(t, store)
+
+	_, err := store.Presign(context.Background(), "assets/a.png", time.Minute)
+	assert.ErrorIs(t, err, storage.ErrPresignNotSupported)
+
+	// a failed upload leaves neither the object nor a temporary file
+	err = store.Put(context.Background(), "uploads/broken.pdf", io.MultiReader(strings.NewReader("partial"), errReader{}))
+	assert.ErrorIs(t, err, errBrokenUpload)
+	entries, _ := os.ReadDir(root + "/uploads")
+	assert.Empty(t, entries)
+}
+
+var errBrokenUpload = fmt.Errorf("connection reset")
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errBrokenUpload
+}
+
+// fakeS3 is an in-memory S3 bucket with path-style addressing and multipart
+// uploads, enough to run the S3 driver without a server.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	parts   map[string]map[int][]byte
+	signed  bool
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+		f.signed = false
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(f.parts)+1)
+		f.parts[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		var number int
+		fmt.Sscan(query.Get("partNumber"), &number)
+		f.parts[query.Get("uploadId")][number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, number))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var complete struct {
+			Parts []struct{ PartNumber int } `xml:"Part"`
+		}
+		xml.Unmarshal(body, &complete)
+		parts := f.parts[query.Get("uploadId")]
+		numbers := make([]int, 0, len(complete.Parts))
+		for _, part := range complete.Parts {
+			numbers = append(numbers, part.PartNumber)
+		}
+		sort.Ints(numbers)
+		var joined []byte
+		for _, number := range numbers {
+			joined = append(joined, parts[number]...)
+		}
+		f.objects[key] = joined
+		delete(f.parts, query.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.parts, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		http.ServeContent(w, r, key, time.Unix(1700000000, 0), bytes.NewReader(data))
+	}
+}
+
+func Test_Storage_S3(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, parts: map[string]map[int][]byte{}, signed: true}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store, err := storage.NewS3(config.S3Config{
+		Endpoint: server.URL, Region: "us-east-1", Bucket: "bucket",
+		AccessKey: "minio", SecretKey: "minio123", PathStyle: true, PartSize: 1 << 20,
+	})
+	require.NoError(t, err)
+	testStorageRoundTrip(t, store)
+	assert.True(t, fake.signed)
+	assert.Empty(t, fake.parts)
+
+	url, err := store.Presign(context.Background(), "assets/profile/a b.png", 15*time.Minute)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(url, server.URL+"/bucket/assets/profile/a%20b.png?X-Amz-Algorithm=AWS4-HMAC-SHA256&"))
+	assert.Contains(t, url, "X-Amz-Expires=900")
+	assert.Contains(t, url, "&X-Amz-Signature=")
+
+	// upload bị lỗi giữa chừng: multipart bị hủy, object cũ không đổi
+	err = store.Put(context.Background(), "uploads/broken.pdf", io.MultiReader(bytes.NewReader(make([]byte, 3<<20)), errReader{}))
+	assert.ErrorIs(t, err, errBrokenUpload)
+	assert.Empty(t, fake.parts)
+	_, err = store.Stat(context.Background(), "uploads/broken.pdf")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+// Test_Storage_MinIO runs against a real server, e.g. the minio service of
+// docker-compose: S3_TEST_ENDPOINT=http://localhost:9000 with S3_TEST_BUCKET,
+// S3_TEST_ACCESS_KEY and S3_TEST_SECRET_KEY.
+func Test_Storage_MinIO(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	store, err := storage.NewS3(config.S3Config{
+		Endpoint:  endpoint,
+		Region:    config.DEFAULT_S3_REGION,
+		Bucket:    os.Getenv("S3_TEST_BUCKET"),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+		PathStyle: true,
+		// phần nhỏ nhất S3 cho phép
+		PartSize: 5 << 20,
+	})
+	require.NoError(t, err)
+	testStorageRoundTrip(t, store)
+
+	key := fmt.Sprintf("assets/test-%d.txt", time.Now().UnixNano())
+	require.NoError(t, store.Put(context.Background(), key, strings.NewReader("presigned")))
+	defer store.Delete(context.Background(), key)
+	url, err := store.Presign(context.Background(), key, time.Minute)
+	require.NoError(t, err)
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "presigned", string(body))
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/ca"
+	"github.com/PhanPhuc2609/be-sign-file/cms"
+	"github.com/PhanPhuc2609/be-sign-file/pdf"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/PhanPhuc2609/be-sign-file/tsa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testTSAPolicy, _ = x509.ParseOID("2.25.297977844126724156178257328349224674775")
+
+// SetUpTestTSA issues a time-stamping certificate from authority.
+func SetUpTestTSA(t *testing.T, authority *ca.Authority) *tsa.Signer {
+	key, err := pki.GenerateKey(pki.KeyRSA2048)
+	require.NoError(t, err)
+	serial, err := ca.NewSerial()
+	require.NoError(t, err)
+
+	cert, err := authority.Issue(&x509.Certificate{
+		SerialNumber:    serial,
+		Subject:         pkix.Name{CommonName: "Test TSA"},
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().AddDate(1, 0, 0),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{tsa.ExtKeyUsageExtension()},
+	}, key.Public())
+	require.NoError(t, err)
+	alg, err := pki.ResolveAlgorithm(pki.AlgRSASHA256, key.Public())
+	require.NoError(t, err)
+
+	return &tsa.Signer{
+		Certificate: cert,
+		Key:         key,
+		Chain:       authority.Chain(),
+		Algorithm:   alg,
+		Policy:      testTSAPolicy,
+		Accuracy:    time.Second,
+	}
+}
+
+func stampTestMessage(t *testing.T, signer *tsa.Signer, message []byte) (*tsa.Request, []byte) {
+	req, err := tsa.NewRequest(message, crypto.SHA256)
+	require.NoError(t, err)
+	der, err := req.Marshal()
+	require.NoError(t, err)
+	parsed, err := tsa.ParseRequest(der)
+	require.NoError(t, err)
+
+	serial, err := ca.NewSerial()
+	require.NoError(t, err)
+	resp, err := signer.Respond(parsed, serial, time.Now())
+	require.NoError(t, err)
+	return req, resp
+}
+
+func Test_TSA_RoundTrip(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	signer := SetUpTestTSA(t, authority)
+	message := []byte("signature value")
+
+	req, resp := stampTestMessage(t, signer, message)
+	token, err := tsa.ParseResponse(resp)
+	require.NoError(t, err)
+	require.NoError(t, req.Check(token))
+	assert.True(t, token.Info.Policy.Equal(testTSAPolicy))
+	assert.Equal(t, time.Second, token.Info.Accuracy)
+	assert.WithinDuration(t, time.Now(), token.Info.GenTime, 2*time.Second)
+
+	trust := pki.NewTrustStore(authority.Root)
+	tsaCert, err := token.Verify(message, trust)
+	require.NoError(t, err)
+	assert.Equal(t, "Test TSA", tsaCert.Subject.CommonName)
+
+	reparsed, err := tsa.ParseToken(token.Raw)
+	require.NoError(t, err)
+	_, err = reparsed.Verify([]byte("other value"), trust)
+	assert.ErrorIs(t, err, tsa.ErrImprintMismatch)
+	_, err = reparsed.Verify(message, pki.NewTrustStore())
+	assert.ErrorIs(t, err, pki.ErrUntrustedChain)
+}
+
+func Test_TSA_RejectsRequests(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	signer := SetUpTestTSA(t, authority)
+
+	req, err := tsa.NewRequest([]byte("x"), crypto.SHA256)
+	require.NoError(t, err)
+	req.Policy, _ = x509.ParseOID("1.2.3.4")
+	serial, err := ca.NewSerial()
+	require.NoError(t, err)
+	resp, err := signer.Respond(req, serial, time.Now())
+	require.NoError(t, err)
+
+	_, err = tsa.ParseResponse(resp)
+	var statusErr *tsa.StatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, tsa.StatusRejection, statusErr.Status)
+	assert.Equal(t, tsa.FailureUnacceptedPolicy, statusErr.FailInfo)
+
+	_, err = tsa.ParseRequest([]byte{0x30, 0x00})
+	assert.ErrorIs(t, err, tsa.ErrMalformed)
+
+	// a user certificate cannot sign tokens
+	key, cert := IssueTestCertificate(t, authority, pki.KeyRSA2048)
+	signer.Certificate, signer.Key = cert, key
+	_, resp = stampTestMessage(t, signer, []byte("x"))
+	token, err := tsa.ParseResponse(resp)
+	require.NoError(t, err)
+	_, err = token.Verify([]byte("x"), pki.NewTrustStore(authority.Root))
+	assert.ErrorIs(t, err, tsa.ErrNotTimeStampSigner)
+}
+
+// Test_TSA_OpenSSLVerify checks the response with openssl ts -verify,
+// skipped when openssl is not installed.
+func Test_TSA_OpenSSLVerify(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+	_, authority := SetUpTestCA(t)
+	signer := SetUpTestTSA(t, authority)
+	dir := t.TempDir()
+	message := []byte("signature value")
+
+	_, resp := stampTestMessage(t, signer, message)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "root.pem"), []byte(pki.EncodeCertificatePEM(authority.Root.Raw)), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data.bin"), message, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "reply.tsr"), resp, 0600))
+
+	out, err := exec.Command("openssl", "ts", "-verify", "-in", filepath.Join(dir, "reply.tsr"),
+		"-data", filepath.Join(dir, "data.bin"), "-CAfile", filepath.Join(dir, "root.pem")).CombinedOutput()
+	assert.NoError(t, err, string(out))
+}
+
+func Test_TSA_PDFSignatureTimestamp(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	signer := SetUpTestTSA(t, authority)
+	key, cert := IssueTestCertificate(t, authority, pki.KeyECDSAP256)
+	alg, err := pki.ResolveAlgorithm("", key.Public())
+	require.NoError(t, err)
+
+	doc := BuildTestPDF(t)
+	var out bytes.Buffer
+	err = pdf.Sign(bytes.NewReader(doc), int64(len(doc)), &out, cms.SignerConfig{
+		Signer:      key,
+		Certificate: cert,
+		Chain:       authority.Chain(),
+		Algorithm:   alg,
+	}, pdf.SignOptions{
+		SigningTime: time.Now(),
+		Timestamp: func(signature []byte) ([]byte, error) {
+			_, resp := stampTestMessage(t, signer, signature)
+			token, err := tsa.ParseResponse(resp)
+			if err != nil {
+				return nil, err
+			}
+			return token.Raw, nil
+		},
+	})
+	require.NoError(t, err)
+	signed := out.Bytes()
+
+	result, err := pdf.Verify(bytes.NewReader(signed), int64(len(signed)), pdf.VerifyOptions{Trust: pki.NewTrustStore(authority.Root)})
+	require.NoError(t, err)
+	require.Len(t, result.Signatures, 1)
+	sig := result.Signatures[0]
+	assert.True(t, sig.Valid(), sig.Err)
+	assert.True(t, sig.TimestampValid)
+	assert.WithinDuration(t, time.Now(), sig.Timestamp, 5*time.Second)
+}
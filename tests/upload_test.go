@@ -0,0 +1,238 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/config"
+	"github.com/PhanPhuc2609/be-sign-file/controller"
+	"github.com/PhanPhuc2609/be-sign-file/entity"
+	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryUploadRepository keeps uploads in a map instead of the database.
+type memoryUploadRepository struct {
+	uploads map[string]entity.Upload
+}
+
+func (r *memoryUploadRepository) Create(ctx context.Context, tx *gorm.DB, upload entity.Upload) (entity.Upload, error) {
+	r.uploads[upload.ID] = upload
+	return upload, nil
+}
+
+func (r *memoryUploadRepository) FindByID(ctx context.Context, tx *gorm.DB, id string) (entity.Upload, error) {
+	upload, ok := r.uploads[id]
+	if !ok {
+		return entity.Upload{}, gorm.ErrRecordNotFound
+	}
+	return upload, nil
+}
+
+func (r *memoryUploadRepository) LockByID(ctx context.Context, tx *gorm.DB, id string) (entity.Upload, error) {
+	return r.FindByID(ctx, tx, id)
+}
+
+func (r *memoryUploadRepository) FindExpired(ctx context.Context, tx *gorm.DB, now time.Time) ([]entity.Upload, error) {
+	var expired []entity.Upload
+	for _, upload := range r.uploads {
+		if upload.ExpiresAt.Before(now) {
+			expired = append(expired, upload)
+		}
+	}
+	return expired, nil
+}
+
+func (r *memoryUploadRepository) Update(ctx context.Context, tx *gorm.DB, upload entity.Upload) (entity.Upload, error) {
+	r.uploads[upload.ID] = upload
+	return upload, nil
+}
+
+func (r *memoryUploadRepository) Delete(ctx context.Context, tx *gorm.DB, id string) error {
+	delete(r.uploads, id)
+	return nil
+}
+
+// createdDocumentService records the documents created from uploads and
+// their content. While fail is set, creating a document fails with it.
+type createdDocumentService struct {
+	service.DocumentService
+	created  []entity.Document
+	contents []string
+	fail     error
+}
+
+func (s *createdDocumentService) UploadDocument(ctx context.Context, userID string, fileName string, content io.Reader) (entity.Document, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return entity.Document{}, err
+	}
+	if s.fail != nil {
+		return entity.Document{}, s.fail
+	}
+	doc := entity.Document{UserID: userID, FileName: fileName}
+	doc.ID = uint(len(s.created) + 1)
+	s.created = append(s.created, doc)
+	s.contents = append(s.contents, string(data))
+	return doc, nil
+}
+
+// tusClient sends tus requests to the upload routes of ctrl.
+type tusClient struct {
+	r *gin.Engine
+}
+
+func newTusClient(ctrl controller.UploadController) *tusClient {
+	r := SetUpRoutes()
+	login := func(c *gin.Context) { c.Set("user_id", "user") }
+	routes := r.Group("/api/uploads", ctrl.TusResumable())
+	routes.OPTIONS("", ctrl.Options)
+	routes.POST("", login, ctrl.CreateUpload)
+	routes.HEAD(":id", login, ctrl.HeadUpload)
+	routes.PATCH(":id", login, ctrl.PatchUpload)
+	routes.DELETE(":id", login, ctrl.DeleteUpload)
+	return &tusClient{r: r}
+}
+
+func (c *tusClient) do(method, url, body string, header map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	c.r.ServeHTTP(w, req)
+	return w
+}
+
+func (c *tusClient) patch(url, offset, body string) *httptest.ResponseRecorder {
+	return c.do(http.MethodPatch, url, body, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": offset,
+	})
+}
+
+func Test_Upload_TusResume(t *testing.T) {
+	root := t.TempDir()
+	docService := &createdDocumentService{}
+	cfg := config.UploadConfig{MaxSize: 1 << 20, Expiration: time.Hour}
+	uploadService := service.NewUploadService(&memoryUploadRepository{uploads: map[string]entity.Upload{}}, docService, storage.NewLocal(root), cfg, SetUpMemoryDB())
+	client := newTusClient(controller.NewUploadController(uploadService, cfg))
+	do, patch := client.do, client.patch
+
+	w := do(http.MethodOptions, "/api/uploads", "", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "creation,expiration,termination", w.Header().Get("Tus-Extension"))
+	assert.Equal(t, "1048576", w.Header().Get("Tus-Max-Size"))
+
+	w = do(http.MethodPost, "/api/uploads", "", map[string]string{"Upload-Length": "11", "Tus-Resumable": "0.2.2"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = do(http.MethodPost, "/api/uploads", "", map[string]string{"Upload-Length": "2097152", "Upload-Metadata": "filename Yi50eHQ="})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// filename "../b.txt": chỉ giữ tên file
+	w = do(http.MethodPost, "/api/uploads", "", map[string]string{"Upload-Length": "11", "Upload-Metadata": "filename Li4vYi50eHQ=,is_draft"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	location := w.Header().Get("Location")
+	assert.True(t, strings.HasPrefix(location, "/api/uploads/"))
+	assert.Equal(t, "0", w.Header().Get("Upload-Offset"))
+	assert.NotEmpty(t, w.Header().Get("Upload-Expires"))
+
+	w = patch(location, "0", "hello ")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+
+	// client gửi lại đoạn đầu: offset không khớp
+	w = patch(location, "0", "hello ")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = do(http.MethodHead, location, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, "11", w.Header().Get("Upload-Length"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w = do(http.MethodPatch, location, "world", map[string]string{"Upload-Offset": "6"})
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = patch(location, "6", "world and more")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "11", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, "1", w.Header().Get("X-Document-ID"))
+
+	require.Len(t, docService.created, 1)
+	assert.Equal(t, "b.txt", docService.created[0].FileName)
+	assert.Equal(t, "hello world", docService.contents[0])
+	// các chunk đã được ghép và xóa
+	_, err := os.Stat(filepath.Join(root, "uploads", "tus"))
+	assert.True(t, os.IsNotExist(err))
+
+	w = do(http.MethodDelete, location, "", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = do(http.MethodHead, location, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = do(http.MethodHead, "/api/uploads/not-an-id", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func Test_Upload_CompletionRetry(t *testing.T) {
+	root := t.TempDir()
+	docService := &createdDocumentService{fail: errors.New("database is down")}
+	cfg := config.UploadConfig{MaxSize: 1 << 20, Expiration: time.Hour}
+	uploadService := service.NewUploadService(&memoryUploadRepository{uploads: map[string]entity.Upload{}}, docService, storage.NewLocal(root), cfg, SetUpMemoryDB())
+	client := newTusClient(controller.NewUploadController(uploadService, cfg))
+
+	create := func() string {
+		w := client.do(http.MethodPost, "/api/uploads", "", map[string]string{"Upload-Length": "5", "Upload-Metadata": "filename YS50eHQ="})
+		require.Equal(t, http.StatusCreated, w.Code)
+		return w.Header().Get("Location")
+	}
+
+	// đủ byte nhưng tạo document lỗi: không được trả 204 như đã xong
+	first := create()
+	w := client.patch(first, "0", "hello")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get("X-Document-ID"))
+	w = client.patch(first, "5", "")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	w = client.do(http.MethodHead, first, "", nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, docService.created)
+
+	second := create()
+	w = client.patch(second, "0", "world")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// hết lỗi: PATCH rỗng ở offset cuối hoặc HEAD tạo lại document
+	docService.fail = nil
+	w = client.patch(first, "5", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Document-ID"))
+	w = client.do(http.MethodHead, second, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, "2", w.Header().Get("X-Document-ID"))
+	assert.Equal(t, []string{"hello", "world"}, docService.contents)
+
+	// document đã có thì không tạo lần nữa
+	w = client.patch(first, "5", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = client.do(http.MethodHead, second, "", nil)
+	assert.Equal(t, "2", w.Header().Get("X-Document-ID"))
+	assert.Len(t, docService.created, 2)
+	_, err := os.Stat(filepath.Join(root, "uploads", "tus"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -7,11 +7,13 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/PhanPhuc2609/be-sign-file/config"
 	"github.com/PhanPhuc2609/be-sign-file/controller"
 	"github.com/PhanPhuc2609/be-sign-file/dto"
 	"github.com/PhanPhuc2609/be-sign-file/entity"
 	"github.com/PhanPhuc2609/be-sign-file/repository"
 	"github.com/PhanPhuc2609/be-sign-file/service"
+	"github.com/PhanPhuc2609/be-sign-file/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -27,7 +29,12 @@ func SetupControllerUser() controller.UserController {
 		userRepo         = repository.NewUserRepository(db)
 		jwtService       = service.NewJWTService()
 		refreshTokenRepo = repository.NewRefreshTokenRepository(db)
-		userService      = service.NewUserService(userRepo, refreshTokenRepo, jwtService, db)
+		keyUsageRepo     = repository.NewKeyUsageRepository(db)
+		vaultKeyRepo     = repository.NewVaultKeyRepository(db)
+		caService        = service.NewCAService(repository.NewCertificateRepository(db), userRepo, keyUsageRepo, config.NewCAConfig(), nil)
+		keyVault         = service.NewKeyVaultService(vaultKeyRepo, keyUsageRepo, userRepo, nil, nil, db)
+		store            = storage.NewLocal(config.DEFAULT_STORAGE_LOCAL_ROOT)
+		userService      = service.NewUserService(userRepo, refreshTokenRepo, jwtService, caService, keyVault, vaultKeyRepo, store, db)
 		userController   = controller.NewUserController(userService)
 	)
 
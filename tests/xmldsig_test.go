@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/PhanPhuc2609/be-sign-file/ca"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/PhanPhuc2609/be-sign-file/xmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testInvoiceXML = `<?xml version="1.0" encoding="UTF-8"?>
+<inv:Invoice xmlns:inv="urn:example:invoice" xmlns="urn:example:default" Id="inv-42">
+  <inv:Number>42</inv:Number>
+  <Line amount="10.00" currency='VND'>Hàng hóa &amp; dịch vụ</Line>
+  <!-- ghi chú -->
+</inv:Invoice>
+`
+
+func signTestXML(t *testing.T, authority *ca.Authority, doc []byte, keyType string) []byte {
+	key, cert := IssueTestCertificate(t, authority, keyType)
+	alg, err := pki.ResolveAlgorithm("", key.Public())
+	require.NoError(t, err)
+	out, err := xmldsig.Sign(doc, xmldsig.SignerConfig{
+		Signer:      key,
+		Certificate: cert,
+		Chain:       authority.Chain(),
+		Algorithm:   alg,
+	})
+	require.NoError(t, err)
+	return out
+}
+
+func Test_XMLDSig_SignVerifyAllKeyTypes(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	trust := pki.NewTrustStore(authority.Root)
+
+	for _, keyType := range []string{pki.KeyRSA2048, pki.KeyECDSAP256, pki.KeyECDSAP384, pki.KeyEd25519} {
+		t.Run(keyType, func(t *testing.T) {
+			signed := signTestXML(t, authority, []byte(testInvoiceXML), keyType)
+			assert.True(t, xmldsig.IsXML(signed))
+
+			results, err := xmldsig.Verify(signed, xmldsig.VerifyOptions{Trust: trust})
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			assert.True(t, results[0].Valid(), results[0].Err)
+			assert.Equal(t, "signer "+keyType, results[0].Signer.Subject.CommonName)
+			assert.Len(t, results[0].Chain, 3)
+
+			tampered := bytes.Replace(signed, []byte("<inv:Number>42<"), []byte("<inv:Number>43<"), 1)
+			results, err = xmldsig.Verify(tampered, xmldsig.VerifyOptions{Trust: trust})
+			require.NoError(t, err)
+			assert.False(t, results[0].DigestValid)
+			assert.ErrorIs(t, results[0].Err, xmldsig.ErrDigestMismatch)
+		})
+	}
+}
+
+func Test_XMLDSig_MultipleSigners(t *testing.T) {
+	_, authority := SetUpTestCA(t)
+	signed := signTestXML(t, authority, []byte(testInvoiceXML), pki.KeyRSA2048)
+	signed = signTestXML(t, authority, signed, pki.KeyECDSAP256)
+
+	results, err := xmldsig.Verify(signed, xmldsig.VerifyOptions{Trust: pki.NewTrustStore(authority.Root)})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for _, res := range results {
+		assert.True(t, res.Valid(), res.Err)
+	}
+	assert.Equal(t, xmldsig.SignatureRSAPSSSHA256, results[0].SignatureMethod)
+	assert.Equal(t, xmldsig.SignatureECDSASHA256, results[1].SignatureMethod)
+
+	// signer outside the trust store
+	results, err = xmldsig.Verify(signed, xmldsig.VerifyOptions{Trust: pki.NewTrustStore()})
+	require.NoError(t, err)
+	assert.True(t, results[0].SignatureValid)
+	assert.ErrorIs(t, results[0].Err, pki.ErrUntrustedChain)
+}
+
+func Test_XMLDSig_RejectsUnsignedAndNonXML(t *testing.T) {
+	_, err := xmldsig.Verify([]byte(testInvoiceXML), xmldsig.VerifyOptions{})
+	assert.ErrorIs(t, err, xmldsig.ErrNoSignature)
+
+	_, err = xmldsig.Verify([]byte("hop dong mua ban so 42\n"), xmldsig.VerifyOptions{})
+	assert.ErrorIs(t, err, xmldsig.ErrNotXML)
+	assert.False(t, xmldsig.IsXML([]byte("hop dong mua ban so 42\n")))
+	assert.False(t, xmldsig.IsXML(BuildTestPDF(t)))
+}
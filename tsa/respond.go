@@ -0,0 +1,129 @@
+package tsa
+
+import (
+	"crypto"
+	"crypto/x509"
+	"math/big"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/cms"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// Signer issues time-stamp tokens with a TSA certificate.
+type Signer struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+	// Chain is added after the TSA certificate when a request sets certReq.
+	Chain     []*x509.Certificate
+	Algorithm pki.Algorithm
+	// Policy is the TSA policy every token is issued under.
+	Policy x509.OID
+	// Accuracy is stated in every token. The time is truncated to whole
+	// seconds, so it should be at least a second.
+	Accuracy time.Duration
+}
+
+// Respond answers a request with a granted response. Requests the TSA will
+// not serve get a rejection response; errors are internal failures only.
+func (s *Signer) Respond(req *Request, serial *big.Int, now time.Time) ([]byte, error) {
+	if !req.Policy.Equal(x509.OID{}) && !req.Policy.Equal(s.Policy) {
+		return ErrorResponse(FailureUnacceptedPolicy, "requested policy is not supported"), nil
+	}
+	// no request extensions are supported
+	if len(req.Extensions) > 0 {
+		return ErrorResponse(FailureUnacceptedExtension, "request extensions are not supported"), nil
+	}
+
+	info, err := s.tstInfo(req, serial, now)
+	if err != nil {
+		return nil, err
+	}
+	sd, err := cms.SignContent(OIDTSTInfo, info, cms.SignerConfig{
+		Signer:      s.Key,
+		Certificate: s.Certificate,
+		Chain:       s.Chain,
+		Algorithm:   s.Algorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !req.CertReq {
+		sd.Certificates = nil
+	}
+	token, err := sd.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) { // TimeStampResp
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) { // PKIStatusInfo
+			b.AddASN1Int64(StatusGranted)
+		})
+		b.AddBytes(token)
+	})
+	return b.Bytes()
+}
+
+func (s *Signer) tstInfo(req *Request, serial *big.Int, now time.Time) ([]byte, error) {
+	hashAlg, err := hashOID(req.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(1)
+		addOID(b, s.Policy)
+		addMessageImprint(b, hashAlg, req.HashedMessage)
+		b.AddASN1BigInt(serial)
+		b.AddASN1GeneralizedTime(now.UTC().Truncate(time.Second))
+		if s.Accuracy > 0 {
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				if seconds := int64(s.Accuracy / time.Second); seconds > 0 {
+					b.AddASN1Int64(seconds)
+				}
+				if millis := int64(s.Accuracy % time.Second / time.Millisecond); millis > 0 {
+					b.AddASN1Int64WithTag(millis, cbasn1.Tag(0).ContextSpecific())
+				}
+			})
+		}
+		if req.Nonce != nil {
+			b.AddASN1BigInt(req.Nonce)
+		}
+		// tsa [0] GeneralName, as a directoryName [4]
+		b.AddASN1(cbasn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+			b.AddASN1(cbasn1.Tag(4).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+				b.AddBytes(s.Certificate.RawSubject)
+			})
+		})
+	})
+	return b.Bytes()
+}
+
+// ErrorResponse builds a rejection response carrying one failure bit and a
+// human readable reason.
+func ErrorResponse(failInfo int, text string) []byte {
+	bits := make([]byte, failInfo/8+1)
+	bits[failInfo/8] = 0x80 >> (failInfo % 8)
+
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) { // TimeStampResp
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) { // PKIStatusInfo
+			b.AddASN1Int64(StatusRejection)
+			if text != "" {
+				b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					b.AddASN1(cbasn1.UTF8String, func(b *cryptobyte.Builder) { b.AddBytes([]byte(text)) })
+				})
+			}
+			b.AddASN1(cbasn1.BIT_STRING, func(b *cryptobyte.Builder) {
+				// named bit lists drop trailing zero bits
+				b.AddUint8(uint8(7 - failInfo%8))
+				b.AddBytes(bits)
+			})
+		})
+	})
+	return b.BytesOrPanic()
+}
@@ -0,0 +1,301 @@
+// Package tsa implements the RFC 3161 time-stamp protocol: parsing requests,
+// issuing time-stamp tokens as a TSA and checking tokens as a client.
+package tsa
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/cms"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// Media types of the HTTP transport (RFC 3161 section 3.4).
+const (
+	ContentTypeQuery = "application/timestamp-query"
+	ContentTypeReply = "application/timestamp-reply"
+)
+
+var (
+	// OIDTSTInfo is the content type of the SignedData in a token.
+	OIDTSTInfo = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	// OIDExtKeyUsageTimeStamping is the only extended key usage a TSA
+	// certificate may carry, marked critical.
+	OIDExtKeyUsageTimeStamping = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+
+	oidExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// PKIStatus values of a response.
+const (
+	StatusGranted                = 0
+	StatusGrantedWithMods        = 1
+	StatusRejection              = 2
+	StatusWaiting                = 3
+	StatusRevocationWarning      = 4
+	StatusRevocationNotification = 5
+)
+
+// PKIFailureInfo bits of a rejection.
+const (
+	FailureBadAlg              = 0
+	FailureBadRequest          = 2
+	FailureBadDataFormat       = 5
+	FailureTimeNotAvailable    = 14
+	FailureUnacceptedPolicy    = 15
+	FailureUnacceptedExtension = 16
+	FailureSystemFailure       = 25
+)
+
+var (
+	ErrMalformed          = errors.New("tsa: malformed time-stamp structure")
+	ErrUnsupportedHash    = errors.New("tsa: unsupported hash algorithm")
+	ErrImprintMismatch    = errors.New("tsa: message imprint does not match")
+	ErrNonceMismatch      = errors.New("tsa: nonce does not match the request")
+	ErrNotTimeStampSigner = errors.New("tsa: signer certificate is not a time-stamping certificate")
+)
+
+// StatusError is a response that did not grant a token.
+type StatusError struct {
+	Status   int
+	FailInfo int
+	Text     string
+}
+
+func (e *StatusError) Error() string {
+	if e.Text != "" {
+		return fmt.Sprintf("tsa: request rejected with status %d: %s", e.Status, e.Text)
+	}
+	return fmt.Sprintf("tsa: request rejected with status %d", e.Status)
+}
+
+// hashes are the imprint algorithms accepted in requests and tokens.
+var hashes = map[string]crypto.Hash{
+	cms.OIDDigestSHA256.String(): crypto.SHA256,
+	cms.OIDDigestSHA384.String(): crypto.SHA384,
+	cms.OIDDigestSHA512.String(): crypto.SHA512,
+}
+
+func hashOID(h crypto.Hash) (asn1.ObjectIdentifier, error) {
+	switch h {
+	case crypto.SHA256:
+		return cms.OIDDigestSHA256, nil
+	case crypto.SHA384:
+		return cms.OIDDigestSHA384, nil
+	case crypto.SHA512:
+		return cms.OIDDigestSHA512, nil
+	}
+	return nil, ErrUnsupportedHash
+}
+
+// Request is a TimeStampReq.
+type Request struct {
+	HashAlgorithm crypto.Hash
+	HashedMessage []byte
+	// Policy is the TSA policy asked for, the zero OID to accept the
+	// default.
+	Policy x509.OID
+	Nonce  *big.Int
+	// CertReq asks for the TSA certificate chain in the token.
+	CertReq    bool
+	Extensions []pkix.Extension
+}
+
+// NewRequest hashes message and returns a request with a random nonce that
+// asks for the TSA certificates.
+func NewRequest(message []byte, h crypto.Hash) (*Request, error) {
+	if _, err := hashOID(h); err != nil {
+		return nil, err
+	}
+	digest := h.New()
+	digest.Write(message)
+
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	return &Request{HashAlgorithm: h, HashedMessage: digest.Sum(nil), Nonce: nonce, CertReq: true}, nil
+}
+
+// ParseRequest decodes a DER TimeStampReq. Unknown hash algorithms are
+// reported as ErrUnsupportedHash so the TSA can answer with badAlg.
+func ParseRequest(der []byte) (*Request, error) {
+	input := cryptobyte.String(der)
+	var body cryptobyte.String
+	var version int64
+	if !input.ReadASN1(&body, cbasn1.SEQUENCE) || !input.Empty() ||
+		!body.ReadASN1Integer(&version) || version != 1 {
+		return nil, ErrMalformed
+	}
+	hashAlg, hashed, ok := readMessageImprint(&body)
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	req := &Request{HashedMessage: hashed}
+	if body.PeekASN1Tag(cbasn1.OBJECT_IDENTIFIER) {
+		if req.Policy, ok = readOID(&body); !ok {
+			return nil, ErrMalformed
+		}
+	}
+	if body.PeekASN1Tag(cbasn1.INTEGER) {
+		req.Nonce = new(big.Int)
+		if !body.ReadASN1Integer(req.Nonce) {
+			return nil, ErrMalformed
+		}
+	}
+	if body.PeekASN1Tag(cbasn1.BOOLEAN) {
+		if !body.ReadASN1Boolean(&req.CertReq) {
+			return nil, ErrMalformed
+		}
+	}
+	if body.PeekASN1Tag(cbasn1.Tag(0).Constructed().ContextSpecific()) {
+		var exts cryptobyte.String
+		if !body.ReadASN1(&exts, cbasn1.Tag(0).Constructed().ContextSpecific()) {
+			return nil, ErrMalformed
+		}
+		for !exts.Empty() {
+			var ext cryptobyte.String
+			var parsed pkix.Extension
+			if !exts.ReadASN1Element(&ext, cbasn1.SEQUENCE) {
+				return nil, ErrMalformed
+			}
+			if _, err := asn1.Unmarshal(ext, &parsed); err != nil {
+				return nil, ErrMalformed
+			}
+			req.Extensions = append(req.Extensions, parsed)
+		}
+	}
+	if !body.Empty() {
+		return nil, ErrMalformed
+	}
+
+	h, ok := hashes[hashAlg.String()]
+	if !ok {
+		return req, ErrUnsupportedHash
+	}
+	if len(req.HashedMessage) != h.Size() {
+		return nil, ErrMalformed
+	}
+	req.HashAlgorithm = h
+	return req, nil
+}
+
+// Marshal encodes the request as DER.
+func (r *Request) Marshal() ([]byte, error) {
+	hashAlg, err := hashOID(r.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(1)
+		addMessageImprint(b, hashAlg, r.HashedMessage)
+		if !r.Policy.Equal(x509.OID{}) {
+			addOID(b, r.Policy)
+		}
+		if r.Nonce != nil {
+			b.AddASN1BigInt(r.Nonce)
+		}
+		if r.CertReq {
+			b.AddASN1Boolean(true)
+		}
+		if len(r.Extensions) > 0 {
+			b.AddASN1(cbasn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+				for _, ext := range r.Extensions {
+					der, err := asn1.Marshal(ext)
+					if err != nil {
+						b.SetError(err)
+						return
+					}
+					b.AddBytes(der)
+				}
+			})
+		}
+	})
+	return b.Bytes()
+}
+
+// Check reports whether a token answers this request: same imprint and, when
+// the request had one, the same nonce.
+func (r *Request) Check(t *Token) error {
+	if t.Info.HashAlgorithm != r.HashAlgorithm || string(t.Info.HashedMessage) != string(r.HashedMessage) {
+		return ErrImprintMismatch
+	}
+	if r.Nonce != nil && (t.Info.Nonce == nil || t.Info.Nonce.Cmp(r.Nonce) != 0) {
+		return ErrNonceMismatch
+	}
+	return nil
+}
+
+// Info is the TSTInfo of a token.
+type Info struct {
+	Policy        x509.OID
+	HashAlgorithm crypto.Hash
+	HashedMessage []byte
+	SerialNumber  *big.Int
+	GenTime       time.Time
+	// Accuracy is zero when the token does not state one.
+	Accuracy time.Duration
+	Ordering bool
+	Nonce    *big.Int
+}
+
+// ExtKeyUsageExtension is the critical extended key usage extension for a TSA
+// certificate template. x509.CreateCertificate marks ExtKeyUsage non-critical,
+// so templates carry this in ExtraExtensions instead.
+func ExtKeyUsageExtension() pkix.Extension {
+	value, _ := asn1.Marshal([]asn1.ObjectIdentifier{OIDExtKeyUsageTimeStamping})
+	return pkix.Extension{Id: oidExtKeyUsage, Critical: true, Value: value}
+}
+
+func readMessageImprint(input *cryptobyte.String) (asn1.ObjectIdentifier, []byte, bool) {
+	var imprint, alg cryptobyte.String
+	var oid asn1.ObjectIdentifier
+	var hashed []byte
+	if !input.ReadASN1(&imprint, cbasn1.SEQUENCE) ||
+		!imprint.ReadASN1(&alg, cbasn1.SEQUENCE) ||
+		!alg.ReadASN1ObjectIdentifier(&oid) ||
+		!imprint.ReadASN1Bytes(&hashed, cbasn1.OCTET_STRING) || !imprint.Empty() {
+		return nil, nil, false
+	}
+	return oid, hashed, true
+}
+
+func addMessageImprint(b *cryptobyte.Builder, hashAlg asn1.ObjectIdentifier, hashed []byte) {
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(hashAlg)
+			b.AddASN1NULL()
+		})
+		b.AddASN1OctetString(hashed)
+	})
+}
+
+// readOID reads an OBJECT IDENTIFIER into x509.OID, which unlike
+// asn1.ObjectIdentifier holds arcs of any size such as 2.25 UUID OIDs.
+func readOID(input *cryptobyte.String) (x509.OID, bool) {
+	var der []byte
+	var oid x509.OID
+	if !input.ReadASN1Bytes(&der, cbasn1.OBJECT_IDENTIFIER) || oid.UnmarshalBinary(der) != nil {
+		return x509.OID{}, false
+	}
+	return oid, true
+}
+
+func addOID(b *cryptobyte.Builder, oid x509.OID) {
+	der, err := oid.MarshalBinary()
+	if err != nil {
+		b.SetError(err)
+		return
+	}
+	b.AddASN1(cbasn1.OBJECT_IDENTIFIER, func(b *cryptobyte.Builder) { b.AddBytes(der) })
+}
@@ -0,0 +1,216 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/cms"
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// Token is a parsed time-stamp token.
+type Token struct {
+	// Raw is the DER ContentInfo, the value stored as a
+	// signatureTimeStampToken attribute.
+	Raw        []byte
+	SignedData *cms.SignedData
+	Info       Info
+}
+
+// ParseResponse decodes a TimeStampResp. A response that does not grant a
+// token is returned as a *StatusError.
+func ParseResponse(der []byte) (*Token, error) {
+	input := cryptobyte.String(der)
+	var resp, status cryptobyte.String
+	if !input.ReadASN1(&resp, cbasn1.SEQUENCE) || !input.Empty() ||
+		!resp.ReadASN1(&status, cbasn1.SEQUENCE) {
+		return nil, ErrMalformed
+	}
+
+	statusErr := &StatusError{FailInfo: -1}
+	var code int64
+	if !status.ReadASN1Integer(&code) {
+		return nil, ErrMalformed
+	}
+	statusErr.Status = int(code)
+	if status.PeekASN1Tag(cbasn1.SEQUENCE) {
+		var texts cryptobyte.String
+		if !status.ReadASN1(&texts, cbasn1.SEQUENCE) {
+			return nil, ErrMalformed
+		}
+		var parts []string
+		for !texts.Empty() {
+			var text cryptobyte.String
+			if !texts.ReadASN1(&text, cbasn1.UTF8String) {
+				return nil, ErrMalformed
+			}
+			parts = append(parts, string(text))
+		}
+		statusErr.Text = strings.Join(parts, "; ")
+	}
+	if status.PeekASN1Tag(cbasn1.BIT_STRING) {
+		var bits asn1.BitString
+		if !status.ReadASN1BitString(&bits) {
+			return nil, ErrMalformed
+		}
+		for i := 0; i < bits.BitLength; i++ {
+			if bits.At(i) == 1 {
+				statusErr.FailInfo = i
+				break
+			}
+		}
+	}
+	if code != StatusGranted && code != StatusGrantedWithMods {
+		return nil, statusErr
+	}
+
+	var token cryptobyte.String
+	if !resp.ReadASN1Element(&token, cbasn1.SEQUENCE) {
+		return nil, ErrMalformed
+	}
+	return ParseToken(token)
+}
+
+// ParseToken decodes a time-stamp token, a SignedData over a TSTInfo.
+func ParseToken(der []byte) (*Token, error) {
+	sd, err := cms.Parse(der)
+	if err != nil {
+		return nil, err
+	}
+	if !sd.ContentType.Equal(OIDTSTInfo) || sd.Detached || len(sd.SignerInfos) != 1 {
+		return nil, ErrMalformed
+	}
+
+	info, err := parseInfo(sd.Content)
+	if err != nil {
+		return nil, err
+	}
+	return &Token{Raw: append([]byte(nil), der...), SignedData: sd, Info: *info}, nil
+}
+
+func parseInfo(der []byte) (*Info, error) {
+	input := cryptobyte.String(der)
+	var body cryptobyte.String
+	var version int64
+	if !input.ReadASN1(&body, cbasn1.SEQUENCE) || !input.Empty() ||
+		!body.ReadASN1Integer(&version) || version != 1 {
+		return nil, ErrMalformed
+	}
+
+	info := &Info{SerialNumber: new(big.Int)}
+	var ok bool
+	if info.Policy, ok = readOID(&body); !ok {
+		return nil, ErrMalformed
+	}
+	hashAlg, hashed, ok := readMessageImprint(&body)
+	if !ok {
+		return nil, ErrMalformed
+	}
+	h, ok := hashes[hashAlg.String()]
+	if !ok {
+		return nil, ErrUnsupportedHash
+	}
+	info.HashAlgorithm, info.HashedMessage = h, hashed
+
+	var genTime cryptobyte.String
+	if !body.ReadASN1Integer(info.SerialNumber) || !body.ReadASN1(&genTime, cbasn1.GeneralizedTime) {
+		return nil, ErrMalformed
+	}
+	// the fractional seconds RFC 3161 allows are not accepted by
+	// cryptobyte or encoding/asn1, time.Parse handles them
+	t, err := time.Parse("20060102150405Z0700", string(genTime))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	info.GenTime = t
+
+	if body.PeekASN1Tag(cbasn1.SEQUENCE) {
+		var accuracy cryptobyte.String
+		if !body.ReadASN1(&accuracy, cbasn1.SEQUENCE) {
+			return nil, ErrMalformed
+		}
+		var seconds, millis, micros int64
+		if accuracy.PeekASN1Tag(cbasn1.INTEGER) && !accuracy.ReadASN1Integer(&seconds) {
+			return nil, ErrMalformed
+		}
+		// millis [0] and micros [1] are IMPLICIT
+		if !readTaggedInteger(&accuracy, 0, &millis) || !readTaggedInteger(&accuracy, 1, &micros) {
+			return nil, ErrMalformed
+		}
+		info.Accuracy = time.Duration(seconds)*time.Second + time.Duration(millis)*time.Millisecond + time.Duration(micros)*time.Microsecond
+	}
+	if body.PeekASN1Tag(cbasn1.BOOLEAN) && !body.ReadASN1Boolean(&info.Ordering) {
+		return nil, ErrMalformed
+	}
+	if body.PeekASN1Tag(cbasn1.INTEGER) {
+		info.Nonce = new(big.Int)
+		if !body.ReadASN1Integer(info.Nonce) {
+			return nil, ErrMalformed
+		}
+	}
+	// the tsa name and extensions are not used
+	return info, nil
+}
+
+// readTaggedInteger reads an optional small INTEGER with an implicit context
+// tag, leaving out untouched when it is absent.
+func readTaggedInteger(input *cryptobyte.String, tag uint8, out *int64) bool {
+	t := cbasn1.Tag(tag).ContextSpecific()
+	if !input.PeekASN1Tag(t) {
+		return true
+	}
+	var content cryptobyte.String
+	if !input.ReadASN1(&content, t) || len(content) == 0 || len(content) > 4 {
+		return false
+	}
+	*out = new(big.Int).SetBytes(content).Int64()
+	return true
+}
+
+// Verify checks that the token covers message, that its signature is valid
+// and that it was signed by a time-stamping certificate chaining to trust at
+// the token's time. It returns the TSA certificate.
+func (t *Token) Verify(message []byte, trust *pki.TrustStore) (*x509.Certificate, error) {
+	h := t.Info.HashAlgorithm.New()
+	h.Write(message)
+	if !bytes.Equal(h.Sum(nil), t.Info.HashedMessage) {
+		return nil, ErrImprintMismatch
+	}
+
+	certs, err := t.SignedData.Verify(nil)
+	if err != nil {
+		return nil, err
+	}
+	cert := certs[0]
+	if !IsTimeStampingCertificate(cert) {
+		return nil, ErrNotTimeStampSigner
+	}
+
+	if trust == nil {
+		return nil, pki.ErrUntrustedChain
+	}
+	if _, err := trust.Verify(cert, t.SignedData.Certificates, t.Info.GenTime); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// IsTimeStampingCertificate reports whether cert has the critical,
+// time-stamping only extended key usage RFC 3161 section 2.3 requires.
+func IsTimeStampingCertificate(cert *x509.Certificate) bool {
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageTimeStamping || len(cert.UnknownExtKeyUsage) > 0 {
+		return false
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtKeyUsage) {
+			return ext.Critical
+		}
+	}
+	return false
+}
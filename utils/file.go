@@ -1,48 +1,25 @@
 package utils
 
 import (
-	"fmt"
-	"io"
+	"context"
 	"mime/multipart"
-	"os"
 	"strings"
+
+	"github.com/PhanPhuc2609/be-sign-file/storage"
 )
 
 const PATH = "assets"
 
-func UploadFile(file *multipart.FileHeader, path string) error {
-	parts := strings.Split(path, "/")
-	fileID := parts[1]
-	dirPath := fmt.Sprintf("%s/%s", PATH, parts[0])
-
-	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(dirPath, 0777); err != nil {
-			return err
-		}
-	}
-
-	filePath := fmt.Sprintf("%s/%s", dirPath, fileID)
-
+// UploadFile stores an uploaded file under the assets prefix, e.g.
+// "profile/<id>.png" as "assets/profile/<id>.png".
+func UploadFile(ctx context.Context, store storage.Storage, file *multipart.FileHeader, path string) error {
 	uploadedFile, err := file.Open()
 	if err != nil {
 		return err
 	}
 	defer uploadedFile.Close()
 
-	// Using os.Create to open the file with appropriate permissions
-	targetFile, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
-	defer targetFile.Close()
-
-	// Copy file contents from uploadedFile to targetFile
-	_, err = io.Copy(targetFile, uploadedFile)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return store.Put(ctx, PATH+"/"+path, uploadedFile)
 }
 
 func GetExtensions(filename string) string {
@@ -0,0 +1,101 @@
+package xmldsig
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// SignerConfig describes who signs and how.
+type SignerConfig struct {
+	Signer      crypto.Signer
+	Certificate *x509.Certificate
+	// Chain is placed in KeyInfo after the signer certificate.
+	Chain     []*x509.Certificate
+	Algorithm pki.Algorithm
+}
+
+// Sign appends an enveloped signature over the whole document as the last
+// child of the root element: Exclusive C14N, SHA-256 digest and KeyInfo with
+// the signer certificate and chain.
+//
+// Signatures already in the document are covered by the new one. Verify
+// handles this by leaving later signatures out when checking an earlier one,
+// so every signer can be validated, not only the last.
+func Sign(data []byte, cfg SignerConfig) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, ErrNotXML
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, ErrNotXML
+	}
+
+	method, err := SignatureMethod(cfg.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	canonical, err := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("").Canonicalize(root.Copy())
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(canonical)
+
+	signature := root.CreateElement(prefix + ":Signature")
+	signature.CreateAttr("xmlns:"+prefix, Namespace)
+
+	signedInfo := signature.CreateElement(prefix + ":SignedInfo")
+	signedInfo.CreateElement(prefix+":CanonicalizationMethod").CreateAttr("Algorithm", CanonicalExclusive)
+	signedInfo.CreateElement(prefix+":SignatureMethod").CreateAttr("Algorithm", method)
+
+	reference := signedInfo.CreateElement(prefix + ":Reference")
+	reference.CreateAttr("URI", "")
+	transforms := reference.CreateElement(prefix + ":Transforms")
+	transforms.CreateElement(prefix+":Transform").CreateAttr("Algorithm", TransformEnveloped)
+	transforms.CreateElement(prefix+":Transform").CreateAttr("Algorithm", CanonicalExclusive)
+	reference.CreateElement(prefix+":DigestMethod").CreateAttr("Algorithm", DigestSHA256)
+	reference.CreateElement(prefix + ":DigestValue").SetText(base64.StdEncoding.EncodeToString(digest[:]))
+
+	message, err := canonicalSignedInfo(signedInfo, dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := cfg.Algorithm.Sign(cfg.Signer, message)
+	if err != nil {
+		return nil, err
+	}
+	value, err := signatureValue(cfg.Signer.Public(), raw)
+	if err != nil {
+		return nil, err
+	}
+	signature.CreateElement(prefix + ":SignatureValue").SetText(base64.StdEncoding.EncodeToString(value))
+
+	x509Data := signature.CreateElement(prefix + ":KeyInfo").CreateElement(prefix + ":X509Data")
+	for _, cert := range append([]*x509.Certificate{cfg.Certificate}, cfg.Chain...) {
+		x509Data.CreateElement(prefix + ":X509Certificate").SetText(base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+
+	return doc.WriteToBytes()
+}
+
+// canonicalSignedInfo serializes SignedInfo with the namespaces in scope at
+// its position in the document.
+func canonicalSignedInfo(signedInfo *etree.Element, canonicalizer dsig.Canonicalizer) ([]byte, error) {
+	ctx, err := etreeutils.NSBuildParentContext(signedInfo)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := etreeutils.NSDetatch(ctx, signedInfo)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalizer.Canonicalize(detached)
+}
@@ -0,0 +1,310 @@
+package xmldsig
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// VerifyOptions configure signature validation.
+type VerifyOptions struct {
+	// Trust holds the accepted roots. Without it every chain is reported
+	// as untrusted.
+	Trust *pki.TrustStore
+	// Now is the time certificates are checked at, the current time when
+	// zero. XML-DSig carries no signing time of its own.
+	Now time.Time
+}
+
+// SignatureResult is the outcome for one ds:Signature element.
+type SignatureResult struct {
+	SignatureMethod string
+	Signer          *x509.Certificate
+	Chain           []*x509.Certificate
+
+	DigestValid    bool
+	SignatureValid bool
+	ChainValid     bool
+	// Err is the first problem found, nil for a valid signature.
+	Err error
+}
+
+// Valid reports whether the document digest, the signature value and the
+// certificate chain all check out.
+func (s SignatureResult) Valid() bool {
+	return s.DigestValid && s.SignatureValid && s.ChainValid
+}
+
+// IsXML reports whether data parses as an XML document with a root element.
+func IsXML(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\xef\xbb\xbf")
+	if !bytes.HasPrefix(trimmed, []byte("<")) {
+		return false
+	}
+	doc := etree.NewDocument()
+	return doc.ReadFromBytes(data) == nil && doc.Root() != nil
+}
+
+// Verify checks the enveloped signatures that are children of the root
+// element, in document order.
+func Verify(data []byte, opts VerifyOptions) ([]SignatureResult, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, ErrNotXML
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, ErrNotXML
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	signatures := signatureElements(root)
+	if len(signatures) == 0 {
+		return nil, ErrNoSignature
+	}
+	results := make([]SignatureResult, len(signatures))
+	for i := range signatures {
+		results[i] = verifySignature(root, i, opts)
+	}
+	return results, nil
+}
+
+func signatureElements(root *etree.Element) []*etree.Element {
+	var out []*etree.Element
+	for _, child := range root.ChildElements() {
+		if child.Tag == "Signature" && child.NamespaceURI() == Namespace {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+// verifySignature checks the index-th signature of the root element.
+func verifySignature(root *etree.Element, index int, opts VerifyOptions) SignatureResult {
+	var res SignatureResult
+	signature := signatureElements(root)[index]
+
+	signedInfo := child(signature, "SignedInfo")
+	if signedInfo == nil {
+		res.Err = ErrMalformed
+		return res
+	}
+	method := child(signedInfo, "SignatureMethod")
+	c14nMethod := child(signedInfo, "CanonicalizationMethod")
+	if method == nil || c14nMethod == nil {
+		res.Err = ErrMalformed
+		return res
+	}
+	res.SignatureMethod = method.SelectAttrValue("Algorithm", "")
+	alg, ok := signatureMethods[res.SignatureMethod]
+	if !ok {
+		res.Err = ErrUnsupportedAlgorithm
+		return res
+	}
+
+	if err := checkReference(root, index, signedInfo); err != nil {
+		res.Err = err
+		return res
+	}
+	res.DigestValid = true
+
+	certs, err := keyInfoCertificates(signature)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Signer = certs[0]
+
+	canonicalizer, err := canonicalizerFor(c14nMethod)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	message, err := canonicalSignedInfo(signedInfo, canonicalizer)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	value, err := base64.StdEncoding.DecodeString(collapse(textOf(child(signature, "SignatureValue"))))
+	if err != nil {
+		res.Err = ErrMalformed
+		return res
+	}
+	if err := verifySignatureValue(alg, res.Signer.PublicKey, message, value); err != nil {
+		res.Err = err
+		return res
+	}
+	res.SignatureValid = true
+
+	if opts.Trust == nil {
+		res.Err = pki.ErrUntrustedChain
+		return res
+	}
+	res.Chain, err = opts.Trust.Verify(res.Signer, certs[1:], opts.Now)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.ChainValid = true
+	return res
+}
+
+// checkReference requires a single Reference to the whole document and
+// compares its digest. The enveloped transform removes the signature being
+// checked and every signature added after it.
+func checkReference(root *etree.Element, index int, signedInfo *etree.Element) error {
+	var references []*etree.Element
+	for _, el := range signedInfo.ChildElements() {
+		if el.Tag == "Reference" {
+			references = append(references, el)
+		}
+	}
+	if len(references) != 1 {
+		return ErrUnsupportedReference
+	}
+	reference := references[0]
+
+	uri := reference.SelectAttrValue("URI", "")
+	if uri != "" {
+		id := strings.TrimPrefix(uri, "#")
+		if id == uri || (root.SelectAttrValue("Id", "") != id && root.SelectAttrValue("ID", "") != id && root.SelectAttrValue("id", "") != id) {
+			return ErrUnsupportedReference
+		}
+	}
+
+	target := root.Copy()
+	for _, sig := range signatureElements(target)[index:] {
+		target.RemoveChild(sig)
+	}
+
+	enveloped := false
+	// without transforms the reference is canonicalized with inclusive C14N
+	var canonicalizer dsig.Canonicalizer = dsig.MakeC14N10RecCanonicalizer()
+	if transforms := child(reference, "Transforms"); transforms != nil {
+		for _, transform := range transforms.ChildElements() {
+			if transform.SelectAttrValue("Algorithm", "") == TransformEnveloped {
+				enveloped = true
+				continue
+			}
+			c, err := canonicalizerFor(transform)
+			if err != nil {
+				return err
+			}
+			canonicalizer = c
+		}
+	}
+	if !enveloped {
+		return ErrUnsupportedReference
+	}
+
+	digestMethod := child(reference, "DigestMethod")
+	if digestMethod == nil {
+		return ErrMalformed
+	}
+	digestHash, ok := digestMethods[digestMethod.SelectAttrValue("Algorithm", "")]
+	if !ok {
+		return ErrUnsupportedAlgorithm
+	}
+	expected, err := base64.StdEncoding.DecodeString(collapse(textOf(child(reference, "DigestValue"))))
+	if err != nil {
+		return ErrMalformed
+	}
+
+	canonical, err := canonicalizer.Canonicalize(target)
+	if err != nil {
+		return err
+	}
+	h := digestHash.New()
+	h.Write(canonical)
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return ErrDigestMismatch
+	}
+	return nil
+}
+
+// canonicalizerFor maps a CanonicalizationMethod or Transform element to a
+// canonicalizer.
+func canonicalizerFor(el *etree.Element) (dsig.Canonicalizer, error) {
+	prefixList := ""
+	if inclusive := child(el, "InclusiveNamespaces"); inclusive != nil {
+		prefixList = inclusive.SelectAttrValue("PrefixList", "")
+	}
+	switch dsig.AlgorithmID(el.SelectAttrValue("Algorithm", "")) {
+	case dsig.CanonicalXML10ExclusiveAlgorithmId:
+		return dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(prefixList), nil
+	case dsig.CanonicalXML10ExclusiveWithCommentsAlgorithmId:
+		return dsig.MakeC14N10ExclusiveWithCommentsCanonicalizerWithPrefixList(prefixList), nil
+	case dsig.CanonicalXML10RecAlgorithmId:
+		return dsig.MakeC14N10RecCanonicalizer(), nil
+	case dsig.CanonicalXML10WithCommentsAlgorithmId:
+		return dsig.MakeC14N10WithCommentsCanonicalizer(), nil
+	case dsig.CanonicalXML11AlgorithmId:
+		return dsig.MakeC14N11Canonicalizer(), nil
+	case dsig.CanonicalXML11WithCommentsAlgorithmId:
+		return dsig.MakeC14N11WithCommentsCanonicalizer(), nil
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// keyInfoCertificates returns the X509Certificate entries of KeyInfo, the
+// signer first.
+func keyInfoCertificates(signature *etree.Element) ([]*x509.Certificate, error) {
+	x509Data := child(child(signature, "KeyInfo"), "X509Data")
+	if x509Data == nil {
+		return nil, errors.New("xmldsig: signature has no X509Data")
+	}
+	var certs []*x509.Certificate
+	for _, el := range x509Data.ChildElements() {
+		if el.Tag != "X509Certificate" {
+			continue
+		}
+		der, err := base64.StdEncoding.DecodeString(collapse(el.Text()))
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("xmldsig: signature has no X509Data")
+	}
+	return certs, nil
+}
+
+// child returns the first child element with the given local name, nil when
+// parent is nil or has none.
+func child(parent *etree.Element, tag string) *etree.Element {
+	if parent == nil {
+		return nil
+	}
+	for _, el := range parent.ChildElements() {
+		if el.Tag == tag {
+			return el
+		}
+	}
+	return nil
+}
+
+func textOf(el *etree.Element) string {
+	if el == nil {
+		return ""
+	}
+	return el.Text()
+}
+
+// collapse strips the whitespace base64 values are often wrapped with.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
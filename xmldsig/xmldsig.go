@@ -0,0 +1,111 @@
+// Package xmldsig produces and checks W3C XML-DSig enveloped signatures over
+// a whole XML document. Canonicalization is delegated to goxmldsig; signature
+// values use the same algorithms as the rest of the service.
+package xmldsig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"errors"
+
+	"github.com/PhanPhuc2609/be-sign-file/pki"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	Namespace = dsig.Namespace
+	prefix    = "ds"
+
+	// URIs from RFC 6931 and RFC 9231
+	SignatureRSASHA256    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	SignatureRSASHA384    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha384"
+	SignatureRSASHA512    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	SignatureRSAPSSSHA256 = "http://www.w3.org/2007/05/xmldsig-more#sha256-rsa-MGF1"
+	SignatureECDSASHA256  = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	SignatureECDSASHA384  = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384"
+	SignatureECDSASHA512  = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512"
+	SignatureEd25519      = "http://www.w3.org/2021/04/xmldsig-more#eddsa-ed25519"
+
+	DigestSHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+	DigestSHA384 = "http://www.w3.org/2001/04/xmldsig-more#sha384"
+	DigestSHA512 = "http://www.w3.org/2001/04/xmlenc#sha512"
+
+	TransformEnveloped = string(dsig.EnvelopedSignatureAltorithmId)
+	CanonicalExclusive = string(dsig.CanonicalXML10ExclusiveAlgorithmId)
+)
+
+var (
+	ErrNotXML               = errors.New("xmldsig: not an XML document")
+	ErrNoSignature          = errors.New("xmldsig: no signature found")
+	ErrMalformed            = errors.New("xmldsig: malformed signature")
+	ErrUnsupportedAlgorithm = errors.New("xmldsig: unsupported algorithm")
+	ErrUnsupportedReference = errors.New("xmldsig: reference does not cover the whole document")
+	ErrDigestMismatch       = errors.New("xmldsig: document digest does not match")
+	ErrInvalidSignature     = errors.New("xmldsig: invalid signature value")
+)
+
+// signatureMethods maps SignatureMethod URIs to the algorithms that produce
+// them. SHA-1 methods are deliberately absent.
+var signatureMethods = map[string]pki.Algorithm{
+	SignatureRSASHA256:    {Name: pki.AlgRSASHA256, KeyType: "RSA", Hash: crypto.SHA256},
+	SignatureRSASHA384:    {Name: "RSA-SHA384", KeyType: "RSA", Hash: crypto.SHA384},
+	SignatureRSASHA512:    {Name: "RSA-SHA512", KeyType: "RSA", Hash: crypto.SHA512},
+	SignatureRSAPSSSHA256: {Name: pki.AlgRSAPSSSHA256, KeyType: "RSA", Hash: crypto.SHA256, PSS: true},
+	SignatureECDSASHA256:  {Name: pki.AlgECDSASHA256, KeyType: "ECDSA", Hash: crypto.SHA256},
+	SignatureECDSASHA384:  {Name: pki.AlgECDSASHA384, KeyType: "ECDSA", Hash: crypto.SHA384},
+	SignatureECDSASHA512:  {Name: "ECDSA-SHA512", KeyType: "ECDSA", Hash: crypto.SHA512},
+	SignatureEd25519:      {Name: pki.AlgEd25519, KeyType: "Ed25519"},
+}
+
+var digestMethods = map[string]crypto.Hash{
+	DigestSHA256: crypto.SHA256,
+	DigestSHA384: crypto.SHA384,
+	DigestSHA512: crypto.SHA512,
+}
+
+// SignatureMethod returns the SignatureMethod URI for an algorithm.
+func SignatureMethod(alg pki.Algorithm) (string, error) {
+	switch alg.Name {
+	case pki.AlgRSALegacy, pki.AlgRSASHA256:
+		return SignatureRSASHA256, nil
+	case pki.AlgRSAPSSSHA256:
+		// the URI fixes the salt length to the hash size
+		if alg.SaltLength != crypto.SHA256.Size() {
+			return "", ErrUnsupportedAlgorithm
+		}
+		return SignatureRSAPSSSHA256, nil
+	case pki.AlgECDSASHA256:
+		return SignatureECDSASHA256, nil
+	case pki.AlgECDSASHA384:
+		return SignatureECDSASHA384, nil
+	case pki.AlgEd25519:
+		return SignatureEd25519, nil
+	}
+	return "", ErrUnsupportedAlgorithm
+}
+
+// signatureValue turns what crypto.Signer returns into the XML-DSig encoding.
+func signatureValue(pub crypto.PublicKey, sig []byte) ([]byte, error) {
+	if key, ok := pub.(*ecdsa.PublicKey); ok {
+		return pki.ECDSAToRaw(key, sig)
+	}
+	return sig, nil
+}
+
+// verifySignatureValue checks an XML-DSig encoded signature value.
+func verifySignatureValue(alg pki.Algorithm, pub crypto.PublicKey, message, sig []byte) error {
+	if key, ok := pub.(*ecdsa.PublicKey); ok {
+		der, err := pki.ECDSAFromRaw(key, sig)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		sig = der
+	}
+	if alg.PSS {
+		alg.SaltLength = alg.Hash.Size()
+	}
+	if err := alg.Verify(pub, message, sig); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}